@@ -17,12 +17,12 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -30,76 +30,16 @@ import (
 	"time"
 )
 
-// harnessResult holds parsed metrics from the harness output.
-type harnessResult struct {
-	Variant       string
-	Ops           int64
-	Duration      time.Duration
-	P50us         float64
-	P95us         float64
-	P99us         float64
-	WritesLogical int64
-	DBCalls       int64
-}
-
-var (
-	reVariant  = regexp.MustCompile(`^Variant:\s+(\w+)\s+\s*Ops:\s+(\d+)\b`)
-	reDuration = regexp.MustCompile(`^Duration:\s+([^\s]+)\s+Ops/sec:`)
-	reLatency  = regexp.MustCompile(`^Latency p50:\s+([0-9.]+)µs\s+p95:\s+([0-9.]+)µs\s+p99:\s+([0-9.]+)µs`)
-	reWrites   = regexp.MustCompile(`^Writes:\s+logical=([0-9,]+)\s+\([^)]*\),\s+dbCalls=([0-9,]+)\s+\(`)
-)
-
-func parseHarnessOutput(out string) (h harnessResult, _ error) {
-	scanner := bufio.NewScanner(strings.NewReader(out))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if m := reVariant.FindStringSubmatch(line); m != nil {
-			h.Variant = m[1]
-			ops, _ := strconv.ParseInt(m[2], 10, 64)
-			h.Ops = ops
-			continue
-		}
-		if m := reDuration.FindStringSubmatch(line); m != nil {
-			dur, err := time.ParseDuration(m[1])
-			if err == nil {
-				h.Duration = dur
-			}
-			continue
-		}
-		if m := reLatency.FindStringSubmatch(line); m != nil {
-			if v, err := strconv.ParseFloat(m[1], 64); err == nil {
-				h.P50us = v
-			}
-			if v, err := strconv.ParseFloat(m[2], 64); err == nil {
-				h.P95us = v
-			}
-			if v, err := strconv.ParseFloat(m[3], 64); err == nil {
-				h.P99us = v
-			}
-			continue
-		}
-		if m := reWrites.FindStringSubmatch(line); m != nil {
-			lw := strings.ReplaceAll(m[1], ",", "")
-			db := strings.ReplaceAll(m[2], ",", "")
-			if v, err := strconv.ParseInt(lw, 10, 64); err == nil {
-				h.WritesLogical = v
-			}
-			if v, err := strconv.ParseInt(db, 10, 64); err == nil {
-				h.DBCalls = v
-			}
-			continue
-		}
-	}
-	return h, scanner.Err()
-}
-
 // runHarness runs `go run .` inside the benchmarks/harness directory (this test's package)
-// with the provided args, and returns parsed metrics and raw output.
-func runHarness(t *testing.T, args ...string) (harnessResult, string) {
+// with the provided args plus -output=json, and returns the decoded record and the
+// human-readable output.
+func runHarness(t *testing.T, args ...string) (benchResult, string) {
 	t.Helper()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	outFile := filepath.Join(t.TempDir(), "result.json")
+	args = append(args, "-output=json", "-out_file="+outFile)
 	cmd := exec.CommandContext(ctx, "go", append([]string{"run", "."}, args...)...)
 	// Inherit environment but allow callers to override via env vars
 	cmd.Env = os.Environ()
@@ -113,9 +53,13 @@ func runHarness(t *testing.T, args ...string) (harnessResult, string) {
 	if err := cmd.Run(); err != nil {
 		t.Fatalf("harness failed: %v\nOutput:\n%s", err, buf.String())
 	}
-	res, err := parseHarnessOutput(buf.String())
+	raw, err := os.ReadFile(outFile)
 	if err != nil {
-		t.Fatalf("parse error: %v\nOutput:\n%s", err, buf.String())
+		t.Fatalf("read result: %v\nOutput:\n%s", err, buf.String())
+	}
+	var res benchResult
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("decode result: %v\nRecord:\n%s", err, raw)
 	}
 	return res, buf.String()
 }
@@ -176,14 +120,14 @@ func TestABSweepAgainstAtomic(t *testing.T) {
 		if atomicRes.Ops == 0 || vsaRes.Ops == 0 {
 			t.Fatalf("zero ops reported: atomic=%d vsa=%d", atomicRes.Ops, vsaRes.Ops)
 		}
-		if vsaRes.Duration == 0 || atomicRes.Duration == 0 {
-			t.Fatalf("zero duration parsed")
+		if vsaRes.DurationNS == 0 || atomicRes.DurationNS == 0 {
+			t.Fatalf("zero duration reported")
 		}
 
 		// Expect VSA to reduce durable logical writes at moderate/high churn
 		if churn >= 25 {
-			if !(vsaRes.WritesLogical < atomicRes.WritesLogical) {
-				t.Fatalf("expected VSA logical writes < Atomic at churn=%d: got vsa=%d atomic=%d", churn, vsaRes.WritesLogical, atomicRes.WritesLogical)
+			if !(vsaRes.LogicalWrites < atomicRes.LogicalWrites) {
+				t.Fatalf("expected VSA logical writes < Atomic at churn=%d: got vsa=%d atomic=%d", churn, vsaRes.LogicalWrites, atomicRes.LogicalWrites)
 			}
 		}
 	}
@@ -221,7 +165,10 @@ func TestVSAKnobTuning(t *testing.T) {
 		if res.Ops == 0 {
 			t.Fatalf("no ops for case %+v\n%s", c, out)
 		}
-		t.Logf("VSA tune case %+v: ops=%d p99=%.1fµs writes=%d", c, res.Ops, res.P99us, res.WritesLogical)
+		if res.VSA == nil {
+			t.Fatalf("missing VSA fields for case %+v", c)
+		}
+		t.Logf("VSA tune case %+v: ops=%d p99=%dns writes=%d commits=%d", c, res.Ops, res.P99NS, res.LogicalWrites, res.VSA.Commits)
 	}
 }
 
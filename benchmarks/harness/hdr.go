@@ -0,0 +1,181 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"time"
+)
+
+// hdrHistogram is a fixed-size HdrHistogram-style latency histogram: values below
+// 2^hdrSubBits ns are counted exactly, and every larger power-of-two range is split
+// into 2^(hdrSubBits-1) linear sub-buckets, so any recorded value is reproduced
+// within 1/2^(hdrSubBits-1) (~0.2%) relative error. Memory is constant regardless
+// of how many samples are recorded, so tails are computed from every sampled op
+// rather than from a downsampled subset.
+//
+// It is not safe for concurrent use; keep one per worker and merge them.
+type hdrHistogram struct {
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+}
+
+const (
+	hdrSubBits  = 10
+	hdrSubCount = 1 << hdrSubBits
+	hdrHalf     = hdrSubCount / 2
+	hdrMaxBits  = 40 // values are clamped to ~18 minutes (2^40 ns)
+)
+
+func newHDRHistogram() *hdrHistogram {
+	return &hdrHistogram{
+		counts: make([]int64, hdrSubCount+(hdrMaxBits-hdrSubBits)*hdrHalf),
+		min:    math.MaxInt64,
+	}
+}
+
+// hdrIndex maps a non-negative value to its bucket.
+func hdrIndex(v int64) int {
+	if v < hdrSubCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - hdrSubBits
+	return hdrSubCount + (shift-1)*hdrHalf + int(v>>shift) - hdrHalf
+}
+
+// hdrBounds returns the smallest and largest values that map to bucket i.
+func hdrBounds(i int) (lo, hi int64) {
+	if i < hdrSubCount {
+		return int64(i), int64(i)
+	}
+	shift := (i-hdrSubCount)/hdrHalf + 1
+	sub := int64((i-hdrSubCount)%hdrHalf + hdrHalf)
+	lo = sub << shift
+	return lo, lo + (1 << shift) - 1
+}
+
+// record adds one sample.
+func (h *hdrHistogram) record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	if v >= 1<<hdrMaxBits {
+		v = 1<<hdrMaxBits - 1
+	}
+	h.counts[hdrIndex(v)]++
+	h.total++
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// merge adds all of o's samples to h.
+func (h *hdrHistogram) merge(o *hdrHistogram) {
+	if o.total == 0 {
+		return
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+	h.min = min(h.min, o.min)
+	h.max = max(h.max, o.max)
+}
+
+// quantile returns the value at percentile q (0..100): the highest value equivalent
+// to the bucket holding the ceil(q% · total)-th sample, clamped to the observed range.
+func (h *hdrHistogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q / 100 * float64(h.total)))
+	rank = min(max(rank, 1), h.total)
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			_, hi := hdrBounds(i)
+			return time.Duration(min(max(hi, h.min), h.max))
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// countAbove returns the number of samples whose bucket lies entirely above d.
+func (h *hdrHistogram) countAbove(d time.Duration) int64 {
+	var n int64
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		if lo, _ := hdrBounds(i); lo > int64(d) {
+			n += c
+		}
+	}
+	return n
+}
+
+// forEach calls fn with the lowest value and count of every non-empty bucket.
+func (h *hdrHistogram) forEach(fn func(lo time.Duration, count int64)) {
+	for i, c := range h.counts {
+		if c > 0 {
+			lo, _ := hdrBounds(i)
+			fn(time.Duration(lo), c)
+		}
+	}
+}
+
+// reservoir keeps a uniform random sample of at most cap latencies (Algorithm R), so
+// latency memory stays bounded by -max_latency_samples no matter how long a run is.
+type reservoir struct {
+	buf  []time.Duration
+	cap  int
+	seen int
+	rnd  *rand.Rand
+}
+
+func newReservoir(capacity int, seed uint64) *reservoir {
+	return &reservoir{buf: make([]time.Duration, 0, min(capacity, 4096)), cap: capacity, rnd: rand.New(rand.NewPCG(seed, 0x9e3779b9))}
+}
+
+func (r *reservoir) add(d time.Duration) {
+	r.seen++
+	if len(r.buf) < r.cap {
+		r.buf = append(r.buf, d)
+		return
+	}
+	if j := r.rnd.IntN(r.seen); j < r.cap {
+		r.buf[j] = d
+	}
+}
+
+// histogram records the kept samples into a fresh hdrHistogram for quantiles.
+func (r *reservoir) histogram() *hdrHistogram {
+	h := newHDRHistogram()
+	for _, d := range r.buf {
+		h.record(d)
+	}
+	return h
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Quantiles from the histogram must match the exact sorted-sample quantiles of a
+// known heavy-tailed distribution within the histogram's relative precision.
+func TestHDRHistogram_QuantilesWithinTolerance(t *testing.T) {
+	const n = 500_000
+	rnd := rand.New(rand.NewPCG(1, 2))
+	h := newHDRHistogram()
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		// 300ns body with an exponential tail (mean 2µs) on 2% of samples.
+		d := 300 * time.Nanosecond
+		if rnd.IntN(100) < 2 {
+			d += time.Duration(rnd.ExpFloat64() * 2000)
+		}
+		samples[i] = d + time.Duration(rnd.IntN(100))
+		h.record(samples[i])
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	tol := 1.0 / hdrHalf
+	for _, q := range []float64{50, 95, 99, 99.9, 99.99} {
+		rank := int(math.Ceil(q / 100 * n))
+		exact := samples[rank-1]
+		got := h.quantile(q)
+		if diff := math.Abs(float64(got-exact)) / float64(exact); diff > tol {
+			t.Fatalf("p%v=%v exact=%v (relative error %.4f > %.4f)", q, got, exact, diff, tol)
+		}
+	}
+}
+
+// A uniform 1..1e6 ns distribution has p99 = 990µs; merged per-worker histograms
+// must report the same as a single one.
+func TestHDRHistogram_UniformP99AndMerge(t *testing.T) {
+	whole := newHDRHistogram()
+	parts := []*hdrHistogram{newHDRHistogram(), newHDRHistogram(), newHDRHistogram()}
+	for v := 1; v <= 1_000_000; v++ {
+		whole.record(time.Duration(v))
+		parts[v%len(parts)].record(time.Duration(v))
+	}
+	merged := newHDRHistogram()
+	for _, p := range parts {
+		merged.merge(p)
+	}
+	merged.merge(newHDRHistogram()) // empty merges are no-ops
+	for _, h := range []*hdrHistogram{whole, merged} {
+		got := h.quantile(99)
+		if diff := math.Abs(float64(got)-990_000) / 990_000; diff > 1.0/hdrHalf {
+			t.Fatalf("p99=%v want ≈990µs", got)
+		}
+		if h.quantile(100) != time.Millisecond || h.quantile(0) != 1 {
+			t.Fatalf("p0/p100 = %v/%v want 1ns/1ms", h.quantile(0), h.quantile(100))
+		}
+	}
+	if whole.quantile(99.9) != merged.quantile(99.9) || whole.total != merged.total {
+		t.Fatalf("merged histogram differs from the single one")
+	}
+}
+
+// Every value maps into a bucket whose bounds contain it.
+func TestHDRHistogram_BucketBounds(t *testing.T) {
+	for _, v := range []int64{0, 1, hdrSubCount - 1, hdrSubCount, hdrSubCount + 1, 123_456, 1 << 30, 1<<hdrMaxBits - 1} {
+		lo, hi := hdrBounds(hdrIndex(v))
+		if v < lo || v > hi {
+			t.Fatalf("value %d outside its bucket [%d,%d]", v, lo, hi)
+		}
+	}
+}
+
+// A reservoir keeps at most its capacity, and its uniform sample of 1..1e6 ns still
+// puts p50 and p99 near 500µs and 990µs.
+func TestReservoir_BoundedUniformSample(t *testing.T) {
+	r := newReservoir(20_000, 1)
+	for v := 1; v <= 1_000_000; v++ {
+		r.add(time.Duration(v))
+	}
+	if len(r.buf) != 20_000 || r.seen != 1_000_000 {
+		t.Fatalf("kept %d of %d samples, want 20000 of 1000000", len(r.buf), r.seen)
+	}
+	h := r.histogram()
+	for _, c := range []struct {
+		q    float64
+		want float64
+	}{{50, 500_000}, {99, 990_000}} {
+		if got := float64(h.quantile(c.q)); math.Abs(got-c.want)/c.want > 0.02 {
+			t.Fatalf("p%v=%v want ≈%v", c.q, time.Duration(got), time.Duration(c.want))
+		}
+	}
+
+	small := newReservoir(100, 1)
+	for v := 1; v <= 10; v++ {
+		small.add(time.Duration(v))
+	}
+	if h := small.histogram(); h.total != 10 || h.quantile(100) != 10 {
+		t.Fatalf("under capacity every sample must be kept: total=%d max=%v", h.total, h.quantile(100))
+	}
+}
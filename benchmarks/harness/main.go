@@ -19,12 +19,11 @@ package main
 import (
 	"flag"
 	"fmt"
-	"math/rand/v2"
+	"io"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"runtime"
-	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -41,17 +40,35 @@ const (
 	variantCRDT   variantType = "crdt"
 	variantToken  variantType = "token"
 	variantLeaky  variantType = "leaky"
+
+	// Same producers as vsa/atomic, but commits are real round-trips to -redis_addr.
+	variantVSARedis    variantType = "vsa_redis"
+	variantAtomicRedis variantType = "atomic_redis"
 )
 
+// base returns the producer a variant runs and whether it persists to a remote store.
+func (v variantType) base() (variantType, bool) {
+	switch v {
+	case variantVSARedis:
+		return variantVSA, true
+	case variantAtomicRedis:
+		return variantAtomic, true
+	}
+	return v, false
+}
+
 type metrics struct {
-	latencies []time.Duration
-	longOps   int64 // ops slower than 5x median
+	latencies *hdrHistogram // sampled hot-path latencies, merged across workers
+	longOps   int64         // ops slower than 5x median
 }
 
 type persister struct {
 	writeDelay    time.Duration
 	logicalWrites atomic.Int64
 	dbCalls       atomic.Int64
+
+	remote     remoteStore // nil: simulated persistence only
+	remoteErrs atomic.Int64
 }
 
 func newPersister(delay time.Duration) *persister { return &persister{writeDelay: delay} }
@@ -68,6 +85,20 @@ func (p *persister) write(n int) {
 	}
 }
 
+// commit persists one net delta for key. With a remote store it is a real round-trip
+// (in place of the simulated delay); otherwise it is a simulated write(1).
+func (p *persister) commit(key string, delta int64) {
+	if p.remote == nil {
+		p.write(1)
+		return
+	}
+	p.dbCalls.Add(1)
+	p.logicalWrites.Add(1)
+	if err := p.remote.incrBy(key, delta); err != nil {
+		p.remoteErrs.Add(1)
+	}
+}
+
 // ---- Producers (hot path) implement the same interface ----
 
 type producer interface {
@@ -86,8 +117,8 @@ type atomicCounter struct {
 func newAtomic(p *persister) *atomicCounter { return &atomicCounter{p: p} }
 
 func (a *atomicCounter) update(key string, delta int64) {
-	// Simulate an immediate persist for each logical op.
-	a.p.write(1)
+	// Persist each logical op immediately.
+	a.p.commit(key, delta)
 }
 func (a *atomicCounter) startBG() {}
 func (a *atomicCounter) stopBG()  {}
@@ -231,7 +262,7 @@ func (v *vsaHarness) startBG() {
 					vs := value.(*vsa.VSA)
 					_, vec := vs.State()
 					if vec != 0 {
-						v.p.write(1) // one net write
+						v.p.commit(key.(string), vec) // one net write
 						vs.Commit(vec)
 					}
 					if vec < 0 {
@@ -333,8 +364,8 @@ func (v *vsaHarness) startBG() {
 						v.commitCount.Add(1)
 					}
 					// one db call per key (simple model); each is a net logical write (1)
-					for range commits {
-						v.p.write(1)
+					for _, c := range commits {
+						v.p.commit(c.key, c.vec)
 					}
 					for _, c := range commits {
 						c.vs.Commit(c.vec)
@@ -569,14 +600,43 @@ func (l *leakyBucket) stopBG()  {}
 
 // ---- Runner ----
 
+// allVariants is the run order for -variant=all. The *_redis variants are included
+// only when -redis_addr is set; otherwise they would repeat vsa and atomic.
+var allVariants = []variantType{variantVSA, variantAtomic, variantBatch, variantCRDT, variantToken, variantLeaky}
+
+// runConfig carries the producer, persistence and harness knobs shared by every run.
+type runConfig struct {
+	workers, keysN, churnPct int
+
+	threshold, lowThreshold, initialScalar int64
+	commitInterval, commitMaxAge           time.Duration
+	batchSize                              int
+	batchInterval                          time.Duration
+	replicas                               int
+	mergePeriod                            time.Duration
+	rate                                   float64
+	burst                                  int
+
+	writeDelay   time.Duration
+	redisAddr    string
+	redisPrefix  string
+	redisTimeout time.Duration
+
+	sampleEvery   int
+	maxLatSamples int // latency samples kept across workers; 0 disables recording
+	duration      time.Duration
+}
+
 func main() {
 	var (
-		variantStr = flag.String("variant", "vsa", "vsa|atomic|batch|crdt|token|leaky")
+		variantStr = flag.String("variant", "vsa", "vsa|atomic|batch|crdt|token|leaky|vsa_redis|atomic_redis|all (all: every variant on the same trace, then a comparison table)")
 		opCount    = flag.Int("ops", 200_000, "total operations across all goroutines")
 		workers    = flag.Int("goroutines", 32, "concurrent workers")
 		keysN      = flag.Int("keys", 1, "number of hot keys")
 		churnPct   = flag.Int("churn", 50, "percentage of negative ops [0..100]")
 		seed       = flag.Int64("seed", 1, "PRNG seed")
+		traceIn    = flag.String("trace_in", "", "replay the (key, delta) ops recorded in this trace instead of generating them; overrides -ops, -goroutines, -keys, -churn and -seed")
+		traceOut   = flag.String("trace_out", "", "record the generated (key, delta) ops to this trace for later -trace_in replays")
 
 		// VSA
 		threshold      = flag.Int64("threshold", 64, "VSA commit threshold")
@@ -598,13 +658,18 @@ func main() {
 		burst = flag.Int("burst", 100, "capacity/burst for token/leaky baselines")
 
 		// Persistence
-		writeDelay = flag.Duration("write_delay", 0, "simulated delay per datastore call (e.g., 50us, 1ms)")
+		writeDelay   = flag.Duration("write_delay", 0, "simulated delay per datastore call (e.g., 50us, 1ms)")
+		redisAddr    = flag.String("redis_addr", "", "Redis endpoint for vsa_redis/atomic_redis commits (empty: simulated persister)")
+		redisPrefix  = flag.String("redis_prefix", "vsa-harness:", "key prefix for the *_redis variants")
+		redisTimeout = flag.Duration("redis_timeout", time.Second, "per-command timeout for the *_redis variants")
 
 		// Harness
 		pprofOn       = flag.Bool("pprof", false, "enable pprof on localhost:6060")
 		sampleEvery   = flag.Int("sample_every", 1, "record latency every N ops (1=all)")
-		maxLatSamples = flag.Int("max_latency_samples", 200000, "cap on stored latency samples to bound memory; downsample if exceeded")
+		maxLatSamples = flag.Int("max_latency_samples", 200000, "cap on latency samples kept across workers (reservoir sampled); 0 disables latency recording")
 		duration      = flag.Duration("duration", 0, "run for this duration instead of a fixed -ops (0 to disable)")
+		output        = flag.String("output", "text", "result format: text|json|csv (json/csv write one structured record per run)")
+		outFile       = flag.String("out_file", "", "append the -output=json|csv record to this file instead of stdout")
 	)
 	flag.Parse()
 
@@ -612,180 +677,239 @@ func main() {
 		go func() { _ = http.ListenAndServe("localhost:6060", nil) }()
 	}
 
-	v := variantType(strings.ToLower(*variantStr))
-	if v != variantVSA && v != variantAtomic && v != variantBatch && v != variantCRDT && v != variantToken && v != variantLeaky {
-		fmt.Println("-variant must be one of: vsa|atomic|batch|crdt|token|leaky")
+	var variants []variantType
+	if v := variantType(strings.ToLower(*variantStr)); v == "all" {
+		variants = append(variants, allVariants...)
+		if *redisAddr != "" {
+			variants = append(variants, variantVSARedis, variantAtomicRedis)
+		}
+	} else {
+		base, _ := v.base()
+		if base != variantVSA && base != variantAtomic && base != variantBatch && base != variantCRDT && base != variantToken && base != variantLeaky {
+			fmt.Println("-variant must be one of: vsa|atomic|batch|crdt|token|leaky|vsa_redis|atomic_redis|all")
+			os.Exit(2)
+		}
+		variants = []variantType{v}
+	}
+	if *maxLatSamples < 0 {
+		fmt.Println("-max_latency_samples must be >= 0")
+		os.Exit(2)
+	}
+	format := strings.ToLower(*output)
+	if format != "text" && format != "json" && format != "csv" {
+		fmt.Println("-output must be one of: text|json|csv")
 		os.Exit(2)
 	}
+	// The human summary goes to stdout unless the structured record takes its place.
+	var tw io.Writer = os.Stdout
+	if format != "text" && *outFile == "" {
+		tw = io.Discard
+	}
 
+	// Load the recorded workload first: the producers need its keys.
+	var wl *workload
+	if *traceIn != "" {
+		var err error
+		if wl, err = readTrace(*traceIn); err != nil {
+			fmt.Fprintln(os.Stderr, "trace_in:", err)
+			os.Exit(2)
+		}
+		*workers, *keysN, *churnPct = len(wl.opsKey), len(wl.keys), wl.churnPct()
+	}
 	keys := make([]string, *keysN)
 	for i := 0; i < *keysN; i++ {
 		keys[i] = fmt.Sprintf("key-%d", i)
 	}
-	p := newPersister(*writeDelay)
+	if wl != nil {
+		keys = wl.keys
+	}
+
+	// Pre-generate ops to avoid per-op RNG and allocations. With -variant=all every
+	// variant replays this same workload.
+	if wl == nil {
+		opsPerWorker := *opCount / *workers
+		if *duration > 0 {
+			// For duration-based runs, pre-generate a small fixed slice and cycle over it
+			opsPerWorker = 8192
+		}
+		wl = generateWorkload(keys, *workers, opsPerWorker, *churnPct, *seed)
+		if *traceOut != "" {
+			if err := writeTrace(*traceOut, wl); err != nil {
+				fmt.Fprintln(os.Stderr, "trace_out:", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	cfg := runConfig{
+		workers: *workers, keysN: *keysN, churnPct: *churnPct,
+		threshold: *threshold, lowThreshold: *lowThreshold, initialScalar: *initialScalar,
+		commitInterval: *commitInterval, commitMaxAge: *commitMaxAge,
+		batchSize: *batchSize, batchInterval: *batchInterval,
+		replicas: *replicas, mergePeriod: *mergePeriod,
+		rate: *rate, burst: *burst,
+		writeDelay: *writeDelay, redisAddr: *redisAddr, redisPrefix: *redisPrefix, redisTimeout: *redisTimeout,
+		sampleEvery: *sampleEvery, maxLatSamples: *maxLatSamples, duration: *duration,
+	}
+
+	// A single variant prints its full report; -variant=all prints only the comparison.
+	detail := tw
+	if len(variants) > 1 {
+		detail = io.Discard
+	}
+	results := make([]benchResult, 0, len(variants))
+	for i, v := range variants {
+		run := wl
+		if i < len(variants)-1 {
+			// runVariant consumes the ops it replays; keep them for the next variant.
+			cp := *wl
+			run = &cp
+		}
+		res, err := runVariant(cfg, v, run, detail)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		results = append(results, res)
+		if format != "text" {
+			if *outFile == "" {
+				// One CSV header on stdout, however many variants ran.
+				err = writeResult(os.Stdout, format, res, i == 0)
+			} else {
+				err = emitResult(*outFile, format, res)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "write result:", err)
+				os.Exit(1)
+			}
+		}
+	}
+	if len(variants) > 1 {
+		if err := writeComparison(tw, results); err != nil {
+			fmt.Fprintln(os.Stderr, "write comparison:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// runVariant replays wl against a fresh producer and persister for v, writes the
+// human-readable report to tw, and returns the structured result. It consumes wl:
+// the pre-generated ops are detached from it and freed before the memory snapshot, so
+// callers replaying the same ops again pass a shallow copy.
+func runVariant(cfg runConfig, v variantType, wl *workload, tw io.Writer) (benchResult, error) {
+	base, remote := v.base()
+	keys := wl.keys
+	p := newPersister(cfg.writeDelay)
+	if remote {
+		if cfg.redisAddr == "" {
+			fmt.Fprintf(os.Stderr, "%s: no -redis_addr set; using the simulated persister\n", v)
+		} else {
+			rs, err := newRedisStore(cfg.redisAddr, cfg.redisPrefix, cfg.redisTimeout)
+			if err != nil {
+				return benchResult{}, fmt.Errorf("redis %s: %v", cfg.redisAddr, err)
+			}
+			defer rs.close()
+			p.remote = rs
+		}
+	}
 
 	var prod producer
-	switch v {
+	switch base {
 	case variantAtomic:
 		prod = newAtomic(p)
 	case variantBatch:
-		prod = newBatcher(p, *batchSize, *batchInterval)
+		prod = newBatcher(p, cfg.batchSize, cfg.batchInterval)
 	case variantCRDT:
-		prod = newPN(p, keys, *replicas, *mergePeriod)
+		prod = newPN(p, keys, cfg.replicas, cfg.mergePeriod)
 	case variantToken:
-		prod = newTokenBucket(p, keys, *burst, *rate)
+		prod = newTokenBucket(p, keys, cfg.burst, cfg.rate)
 	case variantLeaky:
-		prod = newLeakyBucket(p, keys, *burst, *rate)
+		prod = newLeakyBucket(p, keys, cfg.burst, cfg.rate)
 	case variantVSA:
-		prod = newVSAHarness(p, keys, *initialScalar, *threshold, *commitInterval)
+		prod = newVSAHarness(p, keys, cfg.initialScalar, cfg.threshold, cfg.commitInterval)
 		// set max-age flush and hysteresis low watermark on VSA harness if provided
 		if vh, ok := prod.(*vsaHarness); ok {
-			vh.maxAge = *commitMaxAge
-			if *lowThreshold > 0 {
-				vh.lowThreshold = *lowThreshold
+			vh.maxAge = cfg.commitMaxAge
+			if cfg.lowThreshold > 0 {
+				vh.lowThreshold = cfg.lowThreshold
 			}
 		}
+	default:
+		return benchResult{}, fmt.Errorf("unknown variant %q", v)
 	}
 
 	prod.startBG()
 	defer prod.stopBG()
 
-	// Pre-generate ops to avoid per-op RNG and allocations
-	m := &metrics{latencies: make([]time.Duration, 0, *opCount)}
-	opsPerWorker := *opCount / *workers
-	if *duration > 0 {
-		// For duration-based runs, pre-generate a small fixed slice and cycle over it
-		opsPerWorker = 8192
-	}
-	opsKeys := make([][]string, *workers)
-	opsDelta := make([][]int64, *workers)
-	for g := 0; g < *workers; g++ {
-		rnd := rand.New(rand.NewPCG(uint64(*seed), uint64(g)+1))
-		ks := make([]string, opsPerWorker)
-		ds := make([]int64, opsPerWorker)
-		for i := 0; i < opsPerWorker; i++ {
-			ks[i] = keys[rnd.IntN(len(keys))]
-			if rnd.IntN(100) < *churnPct {
-				ds[i] = -1
-			} else {
-				ds[i] = 1
-			}
-		}
-		opsKeys[g] = ks
-		opsDelta[g] = ds
-	}
+	m := &metrics{latencies: newHDRHistogram()}
+	opsKeys, opsDelta := wl.opsKey, wl.opsDel
+	wl.opsKey, wl.opsDel = nil, nil
+	workers := len(opsKeys)
 
 	// Run workers
 	var wg sync.WaitGroup
-	wg.Add(*workers)
+	wg.Add(workers)
 	start := time.Now()
 	// Duration-based mode if -duration > 0
-	durationMode := *duration > 0
+	durationMode := cfg.duration > 0
 	deadline := time.Time{}
 	if durationMode {
-		deadline = start.Add(*duration)
+		deadline = start.Add(cfg.duration)
 	}
 	var opsDone atomic.Int64
 
-	recordLatency := *maxLatSamples != 0
-
-	latSlices := make([][]time.Duration, *workers)
-	// Cap per-worker latency storage in duration mode using reservoir sampling
-	capPerWorker := 0
-	if recordLatency && *maxLatSamples > 0 {
-		capPerWorker = *maxLatSamples / *workers
-		if capPerWorker < 1 {
-			capPerWorker = 1
-		}
-	}
-	for g := 0; g < *workers; g++ {
+	recordLatency := cfg.maxLatSamples > 0
+	// Each worker keeps a uniform reservoir of its sampled ops, together at most
+	// -max_latency_samples, so latency memory does not grow with run length.
+	capPerWorker := max(1, cfg.maxLatSamples/workers)
+	latSamples := make([]*reservoir, workers)
+	for g := 0; g < workers; g++ {
 		go func(id int) {
 			defer wg.Done()
 			ks := opsKeys[id]
 			ds := opsDelta[id]
-			// preallocate sampled latencies for this worker if recording is enabled
-			sample := *sampleEvery
+			sample := cfg.sampleEvery
 			if sample <= 0 {
 				sample = 1
 			}
-			var loc []time.Duration
+			var loc *reservoir
 			if recordLatency {
-				if durationMode && capPerWorker > 0 {
-					loc = make([]time.Duration, 0, capPerWorker)
-				} else {
-					loc = make([]time.Duration, 0, (len(ks)+sample-1)/sample)
-				}
-			}
-			// rng for reservoir sampling
-			var rndLoc *rand.Rand
-			if durationMode && recordLatency && capPerWorker > 0 {
-				rndLoc = rand.New(rand.NewPCG(uint64(*seed), uint64(id)+12345))
+				loc = newReservoir(capPerWorker, uint64(id))
 			}
-			totalSeen := 0
-			if durationMode {
-				// Run until deadline; cycle over pre-generated ops to avoid allocs
-				for i := 0; ; i++ {
+			for i := 0; ; i++ {
+				var idx int
+				if durationMode {
+					// Run until deadline; cycle over pre-generated ops to avoid allocs
 					if time.Now().After(deadline) {
 						break
 					}
-					idx := i % len(ks)
-					if recordLatency && (sample == 1 || (i%sample) == 0) {
-						t0 := time.Now()
-						prod.update(ks[idx], ds[idx])
-						d := time.Since(t0)
-						if capPerWorker > 0 {
-							totalSeen++
-							if totalSeen <= capPerWorker {
-								loc = append(loc, d)
-							} else {
-								j := rndLoc.IntN(totalSeen)
-								if j < capPerWorker {
-									loc[j] = d
-								}
-							}
-						} else {
-							loc = append(loc, d)
-						}
-					} else {
-						prod.update(ks[idx], ds[idx])
+					idx = i % len(ks)
+				} else {
+					if i >= len(ks) {
+						break
 					}
-					opsDone.Add(1)
+					idx = i
 				}
-			} else {
-				for i := 0; i < len(ks); i++ {
-					if recordLatency && (sample == 1 || (i%sample) == 0) {
-						t0 := time.Now()
-						prod.update(ks[i], ds[i])
-						loc = append(loc, time.Since(t0))
-					} else {
-						prod.update(ks[i], ds[i])
-					}
-					opsDone.Add(1)
+				if recordLatency && (sample == 1 || (i%sample) == 0) {
+					t0 := time.Now()
+					prod.update(ks[idx], ds[idx])
+					loc.add(time.Since(t0))
+				} else {
+					prod.update(ks[idx], ds[idx])
 				}
+				opsDone.Add(1)
 			}
-			latSlices[id] = loc
+			latSamples[id] = loc
 		}(g)
 	}
 	wg.Wait()
 
-	// Merge sampled latencies
-	for i, ls := range latSlices {
-		m.latencies = append(m.latencies, ls...)
-		latSlices[i] = nil // free per-worker slice
-	}
-	// Downsample if exceeding cap to bound memory
-	if *maxLatSamples > 0 && len(m.latencies) > *maxLatSamples {
-		capN := *maxLatSamples
-		reduced := make([]time.Duration, capN)
-		step := float64(len(m.latencies)) / float64(capN)
-		for j := 0; j < capN; j++ {
-			idx := int(float64(j) * step)
-			if idx >= len(m.latencies) {
-				idx = len(m.latencies) - 1
-			}
-			reduced[j] = m.latencies[idx]
+	// Merge per-worker latency samples
+	for i, r := range latSamples {
+		if r != nil {
+			m.latencies.merge(r.histogram())
 		}
-		m.latencies = reduced
+		latSamples[i] = nil
 	}
 	// Free pre-generated ops to reduce live memory footprint before stats
 	opsKeys = nil
@@ -797,30 +921,15 @@ func main() {
 	time.Sleep(2 * time.Millisecond)
 
 	// stats
-	// Sort latencies once to compute quantiles without extra allocations
-	sort.Slice(m.latencies, func(i, j int) bool { return m.latencies[i] < m.latencies[j] })
-	idx50 := (len(m.latencies) - 1) * 50 / 100
-	idx95 := (len(m.latencies) - 1) * 95 / 100
-	idx99 := (len(m.latencies) - 1) * 99 / 100
-	p50 := time.Duration(0)
-	p95 := time.Duration(0)
-	p99 := time.Duration(0)
-	if len(m.latencies) > 0 {
-		p50 = m.latencies[idx50]
-		p95 = m.latencies[idx95]
-		p99 = m.latencies[idx99]
-	}
-	med := p50
-	thr := 5 * med
-	for _, d := range m.latencies {
-		if d > thr {
-			m.longOps++
-		}
-	}
+	med := m.latencies.quantile(50)
+	p95 := m.latencies.quantile(95)
+	p99 := m.latencies.quantile(99)
+	p999 := m.latencies.quantile(99.9)
+	m.longOps = m.latencies.countAbove(5 * med)
 	// build latency histogram (ns/us/ms buckets)
 	hist := buildLatencyHistogram(m.latencies)
 
-	// Release latency samples before taking memory snapshot to reduce live Alloc
+	// Release latency buckets before taking memory snapshot to reduce live Alloc
 	m.latencies = nil
 	// Encourage a GC so snapshot reflects released buffers
 	runtime.GC()
@@ -829,54 +938,72 @@ func main() {
 	runtime.ReadMemStats(&ms)
 
 	actualOps := opsDone.Load()
-	fmt.Printf("Variant: %s  Ops: %d  Goroutines: %d  Keys: %d  Churn: %d%%\n", v, actualOps, *workers, *keysN, *churnPct)
-	fmt.Printf("Duration: %s  Ops/sec: %s\n", runDur.Round(time.Millisecond), humanRate(float64(actualOps)/runDur.Seconds()))
+	fmt.Fprintf(tw, "Variant: %s  Ops: %d  Goroutines: %d  Keys: %d  Churn: %d%%\n", v, actualOps, workers, cfg.keysN, cfg.churnPct)
+	fmt.Fprintf(tw, "Duration: %s  Ops/sec: %s\n", runDur.Round(time.Millisecond), humanRate(float64(actualOps)/runDur.Seconds()))
 	// Print latencies with adaptive precision to avoid clamped zeros
-	fmt.Printf("Latency p50: %sµs  p95: %sµs  p99: %sµs\n", formatMicros(med), formatMicros(p95), formatMicros(p99))
-	fmt.Println("Latency histogram (non-zero buckets):")
+	fmt.Fprintf(tw, "Latency p50: %sµs  p95: %sµs  p99: %sµs  p999: %sµs\n", formatMicros(med), formatMicros(p95), formatMicros(p99), formatMicros(p999))
+	fmt.Fprintln(tw, "Latency histogram (non-zero buckets):")
 	for _, b := range hist {
-		fmt.Printf("  %s: %d\n", b.label, b.count)
+		fmt.Fprintf(tw, "  %s: %d\n", b.label, b.count)
 	}
-	fmt.Printf("Writes: logical=%s (%s/sec), dbCalls=%s (%s/sec)\n",
+	fmt.Fprintf(tw, "Writes: logical=%s (%s/sec), dbCalls=%s (%s/sec)\n",
 		humanInt(p.logicalWrites.Load()), humanRate(float64(p.logicalWrites.Load())/runDur.Seconds()),
 		humanInt(p.dbCalls.Load()), humanRate(float64(p.dbCalls.Load())/runDur.Seconds()))
-	fmt.Printf("Memory: Alloc=%s  TotalAlloc=%s  Sys=%s  NumGC=%d\n",
+	fmt.Fprintf(tw, "Memory: Alloc=%s  TotalAlloc=%s  Sys=%s  NumGC=%d\n",
 		humanBytes(ms.Alloc), humanBytes(ms.TotalAlloc), humanBytes(ms.Sys), ms.NumGC)
-	fmt.Printf("Contention (long ops >5× median): %d\n", m.longOps)
+	fmt.Fprintf(tw, "Contention (long ops >5× median): %d\n", m.longOps)
 
 	// Machine-readable one-line summary for scripts
-	fmt.Printf("Summary: variant=%s ops=%d duration_ns=%d goroutines=%d keys=%d churn_pct=%d p50_ns=%d p95_ns=%d p99_ns=%d logical_writes=%d db_calls=%d write_delay_ns=%d\n",
-		v, actualOps, runDur.Nanoseconds(), *workers, *keysN, *churnPct, int64(med), int64(p95), int64(p99), p.logicalWrites.Load(), p.dbCalls.Load(), int64(p.writeDelay))
+	fmt.Fprintf(tw, "Summary: variant=%s ops=%d duration_ns=%d goroutines=%d keys=%d churn_pct=%d p50_ns=%d p95_ns=%d p99_ns=%d p999_ns=%d logical_writes=%d db_calls=%d write_delay_ns=%d\n",
+		v, actualOps, runDur.Nanoseconds(), workers, cfg.keysN, cfg.churnPct, int64(med), int64(p95), int64(p99), int64(p999), p.logicalWrites.Load(), p.dbCalls.Load(), int64(p.writeDelay))
+
+	res := benchResult{
+		Variant: string(v), Ops: actualOps, DurationNS: runDur.Nanoseconds(),
+		OpsPerSec:  float64(actualOps) / runDur.Seconds(),
+		Goroutines: workers, Keys: cfg.keysN, ChurnPct: cfg.churnPct,
+		P50NS: int64(med), P95NS: int64(p95), P99NS: int64(p99), P999NS: int64(p999), LongOps: m.longOps,
+		LogicalWrites: p.logicalWrites.Load(), DBCalls: p.dbCalls.Load(), WriteDelayNS: int64(p.writeDelay),
+		MemAlloc: ms.Alloc, MemTotal: ms.TotalAlloc, MemSys: ms.Sys, NumGC: ms.NumGC,
+	}
+
+	if n := p.remoteErrs.Load(); n > 0 {
+		fmt.Fprintf(os.Stderr, "remote write errors: %d\n", n)
+	}
 
 	// VSA-specific metrics
-	if v == variantVSA {
+	if base == variantVSA {
 		if vh, ok := prod.(*vsaHarness); ok {
 			avg := int64(0)
 			s := vh.samples.Load()
 			if s > 0 {
 				avg = vh.sumAbsVec.Load() / s
 			}
-			fmt.Printf("VSA |A_net| total: max=%s avg=%s final=%s (units)\n",
+			res.VSA = &vsaResult{MaxAbsVec: vh.maxAbsVec.Load(), AvgAbsVec: avg, FinalAbsVec: vh.finalAbsVec.Load(), Commits: vh.totalCommits.Load()}
+			fmt.Fprintf(tw, "VSA |A_net| total: max=%s avg=%s final=%s (units)\n",
 				humanInt(vh.maxAbsVec.Load()), humanInt(avg), humanInt(vh.finalAbsVec.Load()))
 			total := vh.totalCommits.Load()
 			cc := vh.commitCount.Load()
 			if total >= 2 && cc > 0 {
 				avgNS := vh.sumCommitNS.Load() / cc
-				fmt.Printf("VSA commits: total=%d | intervals min=%s avg=%s max=%s\n",
+				res.VSA.CommitMinNS, res.VSA.CommitAvgNS, res.VSA.CommitMaxNS = vh.minCommitNS.Load(), avgNS, vh.maxCommitNS.Load()
+				fmt.Fprintf(tw, "VSA commits: total=%d | intervals min=%s avg=%s max=%s\n",
 					total, time.Duration(vh.minCommitNS.Load()), time.Duration(avgNS), time.Duration(vh.maxCommitNS.Load()))
 			} else if total >= 1 {
 				last := vh.lastCommitTS.Load()
 				if last > 0 {
 					age := time.Since(time.Unix(0, last))
-					fmt.Printf("VSA commits: total=%d | last age=%s\n", total, age)
+					res.VSA.LastCommitAge = int64(age)
+					fmt.Fprintf(tw, "VSA commits: total=%d | last age=%s\n", total, age)
 				} else {
-					fmt.Printf("VSA commits: total=%d\n", total)
+					fmt.Fprintf(tw, "VSA commits: total=%d\n", total)
 				}
 			} else {
-				fmt.Println("VSA commits: none")
+				fmt.Fprintln(tw, "VSA commits: none")
 			}
 		}
 	}
+
+	return res, nil
 }
 
 // ---- Helpers ----
@@ -887,7 +1014,7 @@ type histBucket struct {
 	count  int64
 }
 
-func buildLatencyHistogram(durations []time.Duration) []histBucket {
+func buildLatencyHistogram(h *hdrHistogram) []histBucket {
 	b := []histBucket{
 		{"<100ns", 0, 100 * time.Nanosecond, 0},
 		{"100–200ns", 100 * time.Nanosecond, 200 * time.Nanosecond, 0},
@@ -907,14 +1034,14 @@ func buildLatencyHistogram(durations []time.Duration) []histBucket {
 		{"5–10ms", 5 * time.Millisecond, 10 * time.Millisecond, 0},
 		{">=10ms", 10 * time.Millisecond, time.Duration(1<<63 - 1), 0},
 	}
-	for _, d := range durations {
+	h.forEach(func(d time.Duration, count int64) {
 		for i := range b {
 			if d >= b[i].lo && d < b[i].hi {
-				b[i].count++
+				b[i].count += count
 				break
 			}
 		}
-	}
+	})
 	// Return only non-zero buckets
 	out := make([]histBucket, 0, len(b))
 	for _, x := range b {
@@ -925,17 +1052,6 @@ func buildLatencyHistogram(durations []time.Duration) []histBucket {
 	return out
 }
 
-func percentiles(durations []time.Duration, p int) time.Duration {
-	if len(durations) == 0 {
-		return 0
-	}
-	copyArr := make([]time.Duration, len(durations))
-	copy(copyArr, durations)
-	sort.Slice(copyArr, func(i, j int) bool { return copyArr[i] < copyArr[j] })
-	idx := (len(copyArr) - 1) * p / 100
-	return copyArr[idx]
-}
-
 // formatMicros returns a string with microseconds value using adaptive precision
 // to avoid clamped zeros for sub-microsecond durations.
 func formatMicros(d time.Duration) string {
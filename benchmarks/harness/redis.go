@@ -0,0 +1,57 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// remoteStore performs real datastore round-trips for the *_redis variants.
+type remoteStore interface {
+	incrBy(key string, delta int64) error
+}
+
+// redisStore applies each commit as an INCRBY on prefix+key.
+type redisStore struct {
+	c       *redis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// newRedisStore connects to addr and verifies it with a PING so a bad endpoint
+// fails the run up front instead of skewing the numbers with errors.
+func newRedisStore(addr, prefix string, timeout time.Duration) (*redisStore, error) {
+	c := redis.NewClient(&redis.Options{Addr: addr})
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := c.Ping(ctx).Err(); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return &redisStore{c: c, prefix: prefix, timeout: timeout}, nil
+}
+
+func (r *redisStore) incrBy(key string, delta int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return r.c.IncrBy(ctx, r.prefix+key, delta).Err()
+}
+
+func (r *redisStore) close() error { return r.c.Close() }
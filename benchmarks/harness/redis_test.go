@@ -0,0 +1,86 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRemote records INCRBY calls in memory.
+type fakeRemote struct {
+	mu    sync.Mutex
+	sums  map[string]int64
+	calls int
+}
+
+func (f *fakeRemote) incrBy(key string, delta int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sums == nil {
+		f.sums = map[string]int64{}
+	}
+	f.sums[key] += delta
+	f.calls++
+	return nil
+}
+
+// With a remote store, VSA commits carry the net per-key deltas (so the remote totals
+// match the applied updates) in far fewer calls than the atomic variant.
+func TestRemotePersister_VSAAndAtomicTotals(t *testing.T) {
+	keys := []string{"a", "b"}
+	deltas := []int64{1, 1, -1, 1, 1, 1, -1, 1}
+	want := map[string]int64{}
+
+	atomicRemote := &fakeRemote{}
+	ap := newPersister(0)
+	ap.remote = atomicRemote
+	ac := newAtomic(ap)
+
+	vsaRemote := &fakeRemote{}
+	vp := newPersister(0)
+	vp.remote = vsaRemote
+	vh := newVSAHarness(vp, keys, 1000, 4, time.Millisecond)
+	vh.startBG()
+
+	for i := 0; i < 100; i++ {
+		k := keys[i%len(keys)]
+		d := deltas[i%len(deltas)]
+		want[k] += d
+		ac.update(k, d)
+		vh.update(k, d)
+	}
+	vh.stopBG()
+
+	for _, r := range []struct {
+		name string
+		f    *fakeRemote
+	}{{"atomic", atomicRemote}, {"vsa", vsaRemote}} {
+		for _, k := range keys {
+			if got := r.f.sums[k]; got != want[k] {
+				t.Fatalf("%s remote total for %q=%d want %d", r.name, k, got, want[k])
+			}
+		}
+	}
+	if atomicRemote.calls != 100 || ap.dbCalls.Load() != 100 {
+		t.Fatalf("atomic remote calls=%d dbCalls=%d want 100", atomicRemote.calls, ap.dbCalls.Load())
+	}
+	if vsaRemote.calls >= atomicRemote.calls || vp.dbCalls.Load() != int64(vsaRemote.calls) {
+		t.Fatalf("vsa remote calls=%d dbCalls=%d; want fewer than atomic and counted", vsaRemote.calls, vp.dbCalls.Load())
+	}
+}
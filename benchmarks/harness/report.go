@@ -0,0 +1,144 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// benchResult is the structured per-run record written by -output=json|csv.
+type benchResult struct {
+	Variant       string  `json:"variant"`
+	Ops           int64   `json:"ops"`
+	DurationNS    int64   `json:"duration_ns"`
+	OpsPerSec     float64 `json:"ops_per_sec"`
+	Goroutines    int     `json:"goroutines"`
+	Keys          int     `json:"keys"`
+	ChurnPct      int     `json:"churn_pct"`
+	P50NS         int64   `json:"p50_ns"`
+	P95NS         int64   `json:"p95_ns"`
+	P99NS         int64   `json:"p99_ns"`
+	P999NS        int64   `json:"p999_ns"`
+	LongOps       int64   `json:"long_ops"`
+	LogicalWrites int64   `json:"logical_writes"`
+	DBCalls       int64   `json:"db_calls"`
+	WriteDelayNS  int64   `json:"write_delay_ns"`
+	MemAlloc      uint64  `json:"mem_alloc_bytes"`
+	MemTotal      uint64  `json:"mem_total_alloc_bytes"`
+	MemSys        uint64  `json:"mem_sys_bytes"`
+	NumGC         uint32  `json:"num_gc"`
+
+	VSA *vsaResult `json:"vsa,omitempty"` // only for -variant=vsa
+}
+
+// vsaResult holds the VSA-specific vector and commit statistics.
+type vsaResult struct {
+	MaxAbsVec     int64 `json:"max_abs_vec"`
+	AvgAbsVec     int64 `json:"avg_abs_vec"`
+	FinalAbsVec   int64 `json:"final_abs_vec"`
+	Commits       int64 `json:"commits"`
+	CommitMinNS   int64 `json:"commit_interval_min_ns"`
+	CommitAvgNS   int64 `json:"commit_interval_avg_ns"`
+	CommitMaxNS   int64 `json:"commit_interval_max_ns"`
+	LastCommitAge int64 `json:"last_commit_age_ns"`
+}
+
+// csvHeader lists the CSV columns in record order; VSA columns are empty for other variants.
+var csvHeader = []string{
+	"variant", "ops", "duration_ns", "ops_per_sec", "goroutines", "keys", "churn_pct",
+	"p50_ns", "p95_ns", "p99_ns", "p999_ns", "long_ops", "logical_writes", "db_calls", "write_delay_ns",
+	"mem_alloc_bytes", "mem_total_alloc_bytes", "mem_sys_bytes", "num_gc",
+	"vsa_max_abs_vec", "vsa_avg_abs_vec", "vsa_final_abs_vec", "vsa_commits",
+	"vsa_commit_interval_min_ns", "vsa_commit_interval_avg_ns", "vsa_commit_interval_max_ns", "vsa_last_commit_age_ns",
+}
+
+func (r benchResult) csvRow() []string {
+	i := func(v int64) string { return strconv.FormatInt(v, 10) }
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	row := []string{
+		r.Variant, i(r.Ops), i(r.DurationNS), strconv.FormatFloat(r.OpsPerSec, 'f', 2, 64),
+		i(int64(r.Goroutines)), i(int64(r.Keys)), i(int64(r.ChurnPct)),
+		i(r.P50NS), i(r.P95NS), i(r.P99NS), i(r.P999NS), i(r.LongOps), i(r.LogicalWrites), i(r.DBCalls), i(r.WriteDelayNS),
+		u(r.MemAlloc), u(r.MemTotal), u(r.MemSys), u(uint64(r.NumGC)),
+	}
+	if r.VSA == nil {
+		return append(row, make([]string, 8)...)
+	}
+	v := r.VSA
+	return append(row, i(v.MaxAbsVec), i(v.AvgAbsVec), i(v.FinalAbsVec), i(v.Commits),
+		i(v.CommitMinNS), i(v.CommitAvgNS), i(v.CommitMaxNS), i(v.LastCommitAge))
+}
+
+// writeResult encodes r in the given format: JSON is one object per line and CSV is
+// a single row, preceded by the header when withHeader is set.
+func writeResult(w io.Writer, format string, r benchResult, withHeader bool) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(r)
+	case "csv":
+		cw := csv.NewWriter(w)
+		if withHeader {
+			_ = cw.Write(csvHeader)
+		}
+		_ = cw.Write(r.csvRow())
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// emitResult writes r to path, or to stdout when path is empty. Files are appended
+// to so a sweep can collect one record per run; the CSV header is written only
+// when the file is new or empty.
+func emitResult(path, format string, r benchResult) error {
+	if path == "" {
+		return writeResult(os.Stdout, format, r, true)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := writeResult(f, format, r, st.Size() == 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeComparison prints the -variant=all table: one row per variant with its
+// logical writes, datastore calls, p99 hot-path latency and throughput, in run order.
+func writeComparison(w io.Writer, rs []benchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "variant\tlogical_writes\tdb_calls\tp99_us\tops_per_sec\t")
+	for _, r := range rs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", r.Variant, humanInt(r.LogicalWrites), humanInt(r.DBCalls),
+			formatMicros(time.Duration(r.P99NS)), humanRate(r.OpsPerSec))
+	}
+	return tw.Flush()
+}
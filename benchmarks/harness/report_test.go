@@ -0,0 +1,134 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Appending records to one file keeps a single CSV header and one JSON object per line.
+func TestEmitResult_AppendsRecords(t *testing.T) {
+	dir := t.TempDir()
+	atomicRes := benchResult{Variant: "atomic", Ops: 100, LogicalWrites: 100, DBCalls: 100}
+	vsaRes := benchResult{Variant: "vsa", Ops: 100, LogicalWrites: 3, VSA: &vsaResult{Commits: 3}}
+
+	csvPath := filepath.Join(dir, "out.csv")
+	for _, r := range []benchResult{atomicRes, vsaRes} {
+		if err := emitResult(csvPath, "csv", r); err != nil {
+			t.Fatalf("emitResult(csv): %v", err)
+		}
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "variant" || rows[1][0] != "atomic" || rows[2][0] != "vsa" {
+		t.Fatalf("rows=%q; want header + atomic + vsa", rows)
+	}
+	if got := rows[2][len(csvHeader)-5]; got != "3" {
+		t.Fatalf("vsa_commits=%q want 3", got)
+	}
+	if got := rows[1][len(csvHeader)-5]; got != "" {
+		t.Fatalf("atomic vsa_commits=%q want empty", got)
+	}
+
+	jsonPath := filepath.Join(dir, "out.json")
+	for _, r := range []benchResult{atomicRes, vsaRes} {
+		if err := emitResult(jsonPath, "json", r); err != nil {
+			t.Fatalf("emitResult(json): %v", err)
+		}
+	}
+	raw, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d JSON lines, want 2", len(lines))
+	}
+	var a, v benchResult
+	if err := json.Unmarshal([]byte(lines[0]), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &v); err != nil {
+		t.Fatal(err)
+	}
+	if a.VSA != nil || strings.Contains(lines[0], `"vsa":`) {
+		t.Fatalf("atomic record must omit VSA fields: %s", lines[0])
+	}
+	if v.VSA == nil || v.VSA.Commits != 3 || v.LogicalWrites != 3 {
+		t.Fatalf("vsa record=%+v", v)
+	}
+}
+
+// -variant=all replays one workload through every variant; each run sees the same
+// ops, releases them before its memory snapshot, and the table carries one row per
+// variant in run order.
+func TestRunVariant_SharedWorkloadComparison(t *testing.T) {
+	keys := []string{"key-0", "key-1"}
+	wl := generateWorkload(keys, 4, 500, 50, 1)
+	cfg := runConfig{
+		workers: 4, keysN: len(keys), churnPct: 50,
+		threshold: 64, commitInterval: time.Millisecond, initialScalar: 1_000_000,
+		batchSize: 64, batchInterval: time.Millisecond, replicas: 2, mergePeriod: time.Millisecond,
+		rate: 10000, burst: 100, sampleEvery: 1, maxLatSamples: 100000,
+	}
+	var results []benchResult
+	for _, v := range allVariants {
+		run := *wl // runVariant consumes the ops, as main's loop accounts for
+		res, err := runVariant(cfg, v, &run, io.Discard)
+		if err != nil {
+			t.Fatalf("runVariant(%s): %v", v, err)
+		}
+		if run.opsKey != nil || run.opsDel != nil {
+			t.Fatalf("%s: ops not released before the memory snapshot", v)
+		}
+		if res.Ops != 2000 {
+			t.Fatalf("%s: ops=%d want 2000", v, res.Ops)
+		}
+		results = append(results, res)
+	}
+	if results[1].LogicalWrites != 2000 {
+		t.Fatalf("atomic logical_writes=%d want one per op", results[1].LogicalWrites)
+	}
+
+	var buf strings.Builder
+	if err := writeComparison(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != len(allVariants)+1 || !strings.Contains(lines[0], "p99_us") {
+		t.Fatalf("table:\n%s", buf.String())
+	}
+	for i, v := range allVariants {
+		if f := strings.Fields(lines[i+1]); f[0] != string(v) {
+			t.Fatalf("row %d = %q; want variant %s", i+1, lines[i+1], v)
+		}
+	}
+}
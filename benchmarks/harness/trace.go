@@ -0,0 +1,182 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+)
+
+// A workload is the per-worker (key, delta) op sequences a run replays. It is either
+// generated from the seed (generateWorkload) or loaded from a trace recorded by an
+// earlier run (-trace_in), so variants can be compared on exactly the same ops.
+type workload struct {
+	keys   []string
+	opsKey [][]string // per worker
+	opsDel [][]int64  // per worker, parallel to opsKey
+}
+
+// generateWorkload draws opsPerWorker ops for each of workers goroutines from
+// independent PCG streams derived from seed; churnPct percent of the deltas are -1.
+func generateWorkload(keys []string, workers, opsPerWorker, churnPct int, seed int64) *workload {
+	wl := &workload{keys: keys, opsKey: make([][]string, workers), opsDel: make([][]int64, workers)}
+	for g := 0; g < workers; g++ {
+		rnd := rand.New(rand.NewPCG(uint64(seed), uint64(g)+1))
+		ks := make([]string, opsPerWorker)
+		ds := make([]int64, opsPerWorker)
+		for i := 0; i < opsPerWorker; i++ {
+			ks[i] = keys[rnd.IntN(len(keys))]
+			if rnd.IntN(100) < churnPct {
+				ds[i] = -1
+			} else {
+				ds[i] = 1
+			}
+		}
+		wl.opsKey[g] = ks
+		wl.opsDel[g] = ds
+	}
+	return wl
+}
+
+// churnPct is the percentage of negative deltas, as reported for a replayed trace.
+func (wl *workload) churnPct() int {
+	var neg, total int
+	for _, ds := range wl.opsDel {
+		for _, d := range ds {
+			if d < 0 {
+				neg++
+			}
+		}
+		total += len(ds)
+	}
+	if total == 0 {
+		return 0
+	}
+	return neg * 100 / total
+}
+
+// traceMagic starts every trace file; the last byte is the format version.
+var traceMagic = [4]byte{'V', 'T', 'R', 1}
+
+// Trace format (all integers varint-encoded, deltas zigzag):
+//
+//	magic | nKeys | nKeys × (len | bytes) | nWorkers | nWorkers × (nOps | nOps × (keyIdx | delta))
+//
+// With ±1 deltas and fewer than 128 keys every op takes two bytes.
+
+// writeTrace records wl to path.
+func writeTrace(path string, wl *workload) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	var buf [binary.MaxVarintLen64]byte
+	putU := func(x uint64) { _, _ = w.Write(buf[:binary.PutUvarint(buf[:], x)]) }
+	putI := func(x int64) { _, _ = w.Write(buf[:binary.PutVarint(buf[:], x)]) }
+
+	_, _ = w.Write(traceMagic[:])
+	idx := make(map[string]uint64, len(wl.keys))
+	putU(uint64(len(wl.keys)))
+	for i, k := range wl.keys {
+		idx[k] = uint64(i)
+		putU(uint64(len(k)))
+		_, _ = w.WriteString(k)
+	}
+	putU(uint64(len(wl.opsKey)))
+	for g, ks := range wl.opsKey {
+		putU(uint64(len(ks)))
+		for i, k := range ks {
+			putU(idx[k])
+			putI(wl.opsDel[g][i])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readTrace loads a workload recorded by writeTrace.
+func readTrace(path string) (*workload, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil || magic != traceMagic {
+		return nil, fmt.Errorf("%s: not a harness trace", path)
+	}
+	var rerr error
+	getU := func() uint64 {
+		if rerr != nil {
+			return 0
+		}
+		var x uint64
+		x, rerr = binary.ReadUvarint(r)
+		return x
+	}
+	getI := func() int64 {
+		if rerr != nil {
+			return 0
+		}
+		var x int64
+		x, rerr = binary.ReadVarint(r)
+		return x
+	}
+
+	wl := &workload{keys: make([]string, getU())}
+	for i := range wl.keys {
+		b := make([]byte, getU())
+		if rerr == nil {
+			_, rerr = io.ReadFull(r, b)
+		}
+		wl.keys[i] = string(b)
+	}
+	workers := getU()
+	wl.opsKey = make([][]string, workers)
+	wl.opsDel = make([][]int64, workers)
+	for g := range wl.opsKey {
+		n := getU()
+		ks := make([]string, n)
+		ds := make([]int64, n)
+		for i := range ks {
+			k := getU()
+			if rerr == nil && k >= uint64(len(wl.keys)) {
+				rerr = errors.New("key index out of range")
+			}
+			if rerr != nil {
+				return nil, fmt.Errorf("%s: %w", path, rerr)
+			}
+			ks[i] = wl.keys[k]
+			ds[i] = getI()
+		}
+		wl.opsKey[g], wl.opsDel[g] = ks, ds
+	}
+	if rerr != nil {
+		return nil, fmt.Errorf("%s: %w", path, rerr)
+	}
+	return wl, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestTrace_RecordReplay records a generated workload and replays it: the replay must
+// yield the same per-worker (key, delta) sequences, and the encoding must stay compact.
+func TestTrace_RecordReplay(t *testing.T) {
+	keys := []string{"key-0", "key-1", "key-2", "hot/ü"}
+	wl := generateWorkload(keys, 4, 1000, 30, 7)
+	wl.opsDel[2][5] = -123456 // deltas other than ±1 survive too
+
+	path := filepath.Join(t.TempDir(), "ops.trace")
+	if err := writeTrace(path, wl); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wl) {
+		t.Fatalf("replayed workload differs from the recorded one")
+	}
+	if c := got.churnPct(); c < 25 || c > 35 {
+		t.Fatalf("churnPct=%d, want about 30", c)
+	}
+	if st, _ := os.Stat(path); st.Size() > 2*4000+64 {
+		t.Fatalf("trace is %d bytes for 4000 ops, want about 2 bytes/op", st.Size())
+	}
+
+	// A different seed yields a different workload; the trace removes that drift.
+	if reflect.DeepEqual(generateWorkload(keys, 4, 1000, 30, 8).opsKey, wl.opsKey) {
+		t.Fatalf("different seeds produced identical ops")
+	}
+
+	if err := os.WriteFile(path, []byte("junk"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTrace(path); err == nil {
+		t.Fatalf("readTrace accepted a file without the trace header")
+	}
+}
@@ -1,6 +1,7 @@
 package benchmarks
 
 import (
+	"fmt"
 	"math/rand"
 	"runtime"
 	"sync"
@@ -165,6 +166,65 @@ func BenchmarkManyKeys_VSA_Optimized_PerP_Hier(b *testing.B) {
 	})
 }
 
+// Many-keys across StripePadding values: reports the heap bytes per VSA alongside
+// throughput, to weigh the per-key footprint against false sharing on hot stripes.
+//
+//	go test -run ^$ -bench=BenchmarkManyKeys_VSA_StripePadding -benchmem ./benchmarks
+func BenchmarkManyKeys_VSA_StripePadding(b *testing.B) {
+	const K = 4096
+	for _, pad := range []int{8, 64, 128} {
+		b.Run(fmt.Sprintf("pad=%d", pad), func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			keys := make([]*vsa.VSA, K)
+			for i := range keys {
+				keys[i] = vsa.NewWithOptions(bigBudget, vsa.Options{StripePadding: pad})
+			}
+			runtime.ReadMemStats(&after)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				z := rand.NewZipf(rand.New(rand.NewSource(time.Now().UnixNano())), 1.2, 1, uint64(K-1))
+				for pb.Next() {
+					_ = keys[int(z.Uint64())].TryConsume(1)
+				}
+			})
+			// Reported after the run: ResetTimer clears extra metrics.
+			b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/K, "B/key")
+		})
+	}
+}
+
+// Many cold keys: heap bytes per VSA of the lean single-stripe mode against the
+// default striping and the padded single stripe, plus the cost of constructing them.
+//
+//	go test -run ^$ -bench=BenchmarkManyKeys_VSA_SingleStripeMemory -benchmem ./benchmarks
+func BenchmarkManyKeys_VSA_SingleStripeMemory(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts vsa.Options
+	}{
+		{"default", vsa.Options{}},
+		{"stripes=1", vsa.Options{Stripes: 1}},
+		{"single-stripe", vsa.Options{SingleStripe: true}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			const K = 4096
+			keys := make([]*vsa.VSA, K)
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			for i := 0; i < b.N; i++ {
+				v := vsa.NewWithOptions(bigBudget, tc.opts)
+				v.Update(1)
+				keys[i%K] = v
+			}
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N), "B/key")
+		})
+	}
+}
+
 // Hot-key with fast path using Per-P chooser and cached gate
 func BenchmarkHotKey_VSA_FastPath_PerP(b *testing.B) {
 	v := vsa.NewWithOptions(bigBudget, vsa.Options{
@@ -33,12 +33,16 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -47,6 +51,8 @@ import (
 	"vsa/internal/ratelimiter/core"
 	"vsa/internal/ratelimiter/persistence"
 	"vsa/internal/ratelimiter/telemetry/churn"
+
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -95,18 +101,32 @@ func main() {
 	commitLowWatermark := flag.Int64("commit_low_watermark", 0, "Low watermark (hysteresis). After a commit we wait until |vector| falls below this value before re-arming another commit. Set 0 to disable.")
 	commitInterval := flag.Duration("commit_interval", 100*time.Millisecond, "How often the background worker checks whether to persist")
 	commitMaxAge := flag.Duration("commit_max_age", 0, "Freshness bound for idle periods. If a key hasn’t changed for this long and has a non-zero remainder, we commit even if below the high watermark. Set 0 to disable.")
+	shutdownTimeout := flag.Duration("shutdown_timeout", 30*time.Second, "Upper bound on the final flush at shutdown; if the persister hangs longer, exit without it")
+	commitMaxAgeJitter := flag.Duration("commit_max_age_jitter", 0, "Spread age-based commits: each key's max-age becomes commit_max_age ± a per-key fraction of this (capped at commit_max_age/2). 0 disables.")
 	evictionAge := flag.Duration("eviction_age", time.Hour, "Evict keys that haven’t been touched for this long")
+	window := flag.Duration("window", 0, "Sliding window: replenish each key toward rate_limit so a full limit is available again every window (e.g., 1m). 0 = budget only replenishes via refunds")
 	evictionInterval := flag.Duration("eviction_interval", 10*time.Minute, "How often to scan for idle keys to evict")
+	epochFile := flag.String("epoch_file", "", "If non-empty, namespace commit ids with a counter persisted in this file and incremented on every start, instead of the start time")
+	evictionLog := flag.String("eviction_log", "", "If non-empty, append a JSON line {key,vector,time} to this file for every key evicted with a non-zero final vector")
 	httpAddr := flag.String("http_addr", ":8080", "HTTP listen address (e.g., :8080)")
+	grpcAddr := flag.String("grpc_addr", "", "If non-empty, also serve the gRPC RateLimiter service on this address (e.g., :9000)")
+	maxReservations := flag.Int("max_reservations_per_key", 0, "Maximum outstanding reservations (/check?reserve=1, /reserve) per key; 0 = unlimited")
+	reservationTTL := flag.Duration("reservation_ttl", 30*time.Second, "Auto-refund reservations not committed or cancelled within this long; 0 disables expiry")
+	retryAfter := flag.Duration("retry_after", 0, "Fixed Retry-After for 429s (rounded up to whole seconds); 0 computes it from the window refill cadence (60s without a window)")
+	denyBody := flag.String("deny_body", "plain", "Body of 429 responses from /check and /reserve: plain|json")
+	authKeys := flag.String("auth_keys", "", "Path to a file of accepted API keys, one per line ('#' comments allowed); when set, requests without a listed key (X-API-Key header or api_key) get 401 before any budget is consumed; gRPC calls are checked the same way (x-api-key metadata or api_key) and get Unauthenticated")
+	keyLimits := flag.String("key_limits", "", "Path to a JSON object mapping keys to their own limit (e.g. {\"partner\": 5000}); other keys use rate_limit")
 
 	// Persistence adapter selection (demo)
 	adapter := flag.String("persistence_adapter", "mock", "Persistence adapter: mock|redis|kafka|postgres")
 	kafkaTopic := flag.String("kafka_topic", "vsa-commits", "Kafka topic for commits (when adapter=kafka)")
 	redisTTL := flag.Duration("redis_marker_ttl", 24*time.Hour, "Redis commit marker TTL (when adapter=redis)")
 	redisAddr := flag.String("redis_addr", "", "Redis address host:port (when adapter=redis). If empty, uses a demo logging client.")
+	postgresDSN := flag.String("postgres_dsn", "", "Postgres connection string (when adapter=postgres; required). The counters and applied_commits tables must exist (see persistence/postgres.go)")
+	postgresDriver := flag.String("postgres_driver", "postgres", "database/sql driver name used to open --postgres_dsn. This binary registers no SQL driver: build it with one imported (e.g. github.com/lib/pq or github.com/jackc/pgx/v5/stdlib, driver \"pgx\") or startup fails with an unknown-driver error")
 
 	// VSA engine tuning flags (optional)
-	vsaStripes := flag.Int("vsa_stripes", 0, "Number of stripes (0=auto). Rounded to next power of two; clamped to [8,64]")
+	vsaStripes := flag.Int("vsa_stripes", 0, "Number of stripes (0=auto, 1=single-stripe low-memory mode). Otherwise rounded to next power of two; clamped to [8,64]")
 	vsaCheapUpdate := flag.Bool("vsa_cheap_update_chooser", false, "Use per-goroutine PRNG to choose stripes on Update (no atomic.Add)")
 	vsaPerPUpdate := flag.Bool("vsa_per_p_update_chooser", false, "Use per-P chooser for Update (no atomics, requires runtime internals)")
 	vsaUseCachedGate := flag.Bool("vsa_use_cached_gate", false, "Enable background cached-gate refresher (1 goroutine per VSA)")
@@ -116,16 +136,38 @@ func main() {
 	vsaGroupSlack := flag.Int64("vsa_group_slack", 0, "Conservative slack for grouped scan estimate")
 	vsaFastGuard := flag.Int64("vsa_fast_path_guard", 0, "Guard distance to enable lock-free fast path when far from limit")
 	vsaHierGroups := flag.Int("vsa_hierarchical_groups", 0, "Hierarchical aggregation groups (>1 reduces cross-core reads)")
+	vsaAdaptive := flag.Bool("vsa_adaptive_stripes", false, "Start keys single-stripe and upgrade only contended keys to vsa_stripes (0=auto)")
+	vsaUpgradeAccesses := flag.Int64("vsa_upgrade_accesses", 1024, "Accesses within vsa_upgrade_window that mark a key hot (adaptive stripes)")
+	vsaUpgradeWindow := flag.Duration("vsa_upgrade_window", 100*time.Millisecond, "Heat measurement window for adaptive stripes")
+	fastReject := flag.Bool("fast_reject", false, "Deny keys last seen at zero availability without taking their gate lock; refunds clear the mark and a stale one lasts at most one commit_interval")
 
 	// Telemetry flags (opt-in)
 	// Set churnEnabled to true to enable telemetry KPis, speed will be impacted.
 	churnEnabled := flag.Bool("churn_metrics", false, "Enable in-process churn telemetry (opt-in)")
 	metricsAddr := flag.String("metrics_addr", "", "If non-empty, expose Prometheus /metrics on this address (e.g., :9090)")
 	sampleRate := flag.Float64("churn_sample", 1.0, "Deterministic per-key sampling rate for churn telemetry (0..1)")
+	metricsLogInterval := flag.Duration("metrics_log_interval", 0, "If > 0, periodically print a write-reduction summary (admits, refunds, writes, reduction) to stdout, e.g. 1m. 0 disables.")
 	logInterval := flag.Duration("churn_log_interval", 15*time.Second, "If > 0, periodically log churn summary (e.g., 1m). 0 disables.")
 	topN := flag.Int("churn_top_n", 50, "Top N keys by churn to include in logs when churn_log_interval > 0")
 	keyHashLen := flag.Int("churn_key_hash_len", 8, "Number of hex chars to log for anonymized key hashes")
 	flag.Parse()
+	if b := api.DenyBody(*denyBody); b != api.DenyBodyPlain && b != api.DenyBodyJSON {
+		log.Fatalf("invalid --deny_body %q: want plain or json", *denyBody)
+	}
+	limits, err := loadKeyLimits(*keyLimits, *rateLimit)
+	if err != nil {
+		log.Fatalf("invalid --key_limits: %v", err)
+	}
+	middleware := []api.Middleware{api.RequestID()}
+	var grpcOpts []grpc.ServerOption
+	if *authKeys != "" {
+		keys, err := loadAuthKeys(*authKeys)
+		if err != nil {
+			log.Fatalf("invalid --auth_keys: %v", err)
+		}
+		middleware = append(middleware, api.APIKeyAuth(keys))
+		grpcOpts = append(grpcOpts, grpc.UnaryInterceptor(api.APIKeyUnaryInterceptor(keys)))
+	}
 
 	// Capture thresholds/configuration for final metrics printing.
 	core.SetThresholdInt64("rate_limit", *rateLimit)
@@ -133,14 +175,19 @@ func main() {
 	core.SetThresholdInt64("commit_low_watermark", *commitLowWatermark)
 	core.SetThresholdDuration("commit_interval", *commitInterval)
 	core.SetThresholdDuration("commit_max_age", *commitMaxAge)
+	core.SetThresholdDuration("commit_max_age_jitter", *commitMaxAgeJitter)
 	core.SetThresholdDuration("eviction_age", *evictionAge)
 	core.SetThresholdDuration("eviction_interval", *evictionInterval)
 	core.SetThreshold("http_addr", *httpAddr)
+	core.SetThresholdInt64("max_reservations_per_key", int64(*maxReservations))
+	core.SetThresholdDuration("reservation_ttl", *reservationTTL)
+	core.SetThresholdDuration("retry_after", *retryAfter)
 	// Telemetry knobs
 	core.SetThresholdBool("churn_metrics", *churnEnabled)
 	core.SetThreshold("metrics_addr", *metricsAddr)
 	core.SetThresholdFloat64("churn_sample", *sampleRate)
 	core.SetThresholdDuration("churn_log_interval", *logInterval)
+	core.SetThresholdDuration("metrics_log_interval", *metricsLogInterval)
 	core.SetThresholdInt64("churn_top_n", int64(*topN))
 	core.SetThresholdInt64("churn_key_hash_len", int64(*keyHashLen))
 
@@ -154,9 +201,31 @@ func main() {
 		KeyHashLen:  *keyHashLen,
 	})
 
+	// Per-request counters and /check latency are only recorded when metrics are exposed.
+	if *metricsAddr != "" {
+		api.EnableRequestMetrics()
+	}
+
 	// 2. Initialize core components.
 	// Build a persister based on the selected adapter (demo-friendly defaults).
-	pOpts := persistence.DemoOptions{RedisMarkerTTL: *redisTTL, RedisAddr: *redisAddr, KafkaTopic: *kafkaTopic}
+	// Commit ids are "<epoch>:<cycle>:<key>" and the cycle restarts at 1, so the epoch
+	// must differ across restarts; a file counter survives clock steps, the default does not.
+	epoch := persistence.BootEpoch()
+	if *epochFile != "" {
+		epoch, err = persistence.NextFileEpoch(*epochFile)
+		if err != nil {
+			log.Fatalf("read --epoch_file: %v", err)
+		}
+	}
+	pOpts := persistence.DemoOptions{RedisMarkerTTL: *redisTTL, RedisAddr: *redisAddr, KafkaTopic: *kafkaTopic, Epoch: epoch}
+	if *adapter == "postgres" && *postgresDSN != "" {
+		db, err := openPostgres(*postgresDriver, *postgresDSN)
+		if err != nil {
+			log.Fatalf("invalid --postgres_dsn: %v", err)
+		}
+		defer db.Close()
+		pOpts.PostgresDB = db
+	}
 	persister, err := persistence.BuildPersister(*adapter, pOpts)
 	if err != nil {
 		log.Fatalf("failed to build persister (adapter=%s): %v", *adapter, err)
@@ -174,7 +243,14 @@ func main() {
 		FastPathGuard:      *vsaFastGuard,
 		HierarchicalGroups: *vsaHierGroups,
 	}
-	store := core.NewStoreWithOptions(*rateLimit, opts) // Initialize store with the rate limit and VSA options
+	// Initialize store with the rate limit, VSA options, and stripe sizing policy.
+	store := core.NewStoreWithPolicy(*rateLimit, opts, core.StripePolicy{
+		Adaptive:        *vsaAdaptive,
+		UpgradeAccesses: *vsaUpgradeAccesses,
+		Window:          *vsaUpgradeWindow,
+		HotStripes:      *vsaStripes,
+	})
+	store.SetFastReject(*fastReject)
 
 	// 2. Create and start the background worker.
 	// The worker handles the critical tasks of committing VSA vectors to persistent
@@ -189,12 +265,33 @@ func main() {
 		*evictionAge,        // Idle time before a key can be dropped
 		*evictionInterval,   // How often we scan for idle keys
 	)
+	worker.SetCommitIDEpoch(epoch)
+	worker.SetWindow(*window)
+	worker.SetCommitMaxAgeJitter(*commitMaxAgeJitter)
+	if *evictionLog != "" {
+		f, err := os.OpenFile(*evictionLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("open --eviction_log: %v", err)
+		}
+		defer f.Close()
+		worker.SetEvictionLog(f)
+	}
 	worker.Start()
+	stopMetricsLog := core.StartMetricsLogger(os.Stdout, *metricsLogInterval)
 
 	// 3. Create the API server.
 	// The server handles the incoming HTTP requests and uses the store to
 	// perform the rate-limiting checks.
-	apiServer := api.NewServer(store, *rateLimit)
+	apiServer := api.NewServerWithOptions(store, *rateLimit, api.ServerOptions{
+		MaxReservationsPerKey: *maxReservations,
+		ReservationTTL:        *reservationTTL,
+		Window:                *window,
+		RetryAfter:            *retryAfter,
+		DenyBody:              api.DenyBody(*denyBody),
+		Limits:                limits,
+		Middleware:            middleware,
+		Drainer:               worker,
+	})
 
 	// 4. Set up the HTTP server and routes.
 	// Using the ListenAndServe method from the api.Server is not ideal for graceful
@@ -205,6 +302,8 @@ func main() {
 		Addr:    *httpAddr,
 		Handler: mux,
 	}
+	// Open /events streams would otherwise keep Shutdown from completing.
+	httpServer.RegisterOnShutdown(apiServer.CloseStreams)
 
 	// 5. Start the HTTP server in a separate goroutine so it doesn't block.
 	go func() {
@@ -214,6 +313,23 @@ func main() {
 		}
 	}()
 
+	// Optionally serve the same Store over gRPC for internal RPC clients.
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("Could not listen on %s: %v\n", *grpcAddr, err)
+		}
+		grpcServer = grpc.NewServer(grpcOpts...)
+		api.NewGRPCServer(apiServer).Register(grpcServer)
+		go func() {
+			fmt.Printf("Rate limiter gRPC server listening on %s\n", *grpcAddr)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("gRPC server failed: %v\n", err)
+			}
+		}()
+	}
+
 	// 6. Set up graceful shutdown.
 	// We'll wait here for an OS signal.
 	stop := make(chan os.Signal, 1)
@@ -222,11 +338,20 @@ func main() {
 
 	fmt.Println("\nShutting down server...")
 
+	// Stop accepting RPCs before the final flush so no admits race with it.
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+
 	// 7. First, stop the background worker. This will trigger a final commit
-	// of any pending VSA vectors to ensure no data is lost.
-	worker.Stop()
+	// of any pending VSA vectors to ensure no data is lost. A hung persister must not
+	// block shutdown forever, so the drain is bounded.
+	if err := worker.StopWithTimeout(*shutdownTimeout); err != nil {
+		log.Printf("Final flush did not finish within %s: %v", *shutdownTimeout, err)
+	}
 
 	// Print a single end-of-process persistence summary in yellow.
+	stopMetricsLog()
 	persister.PrintFinalMetrics()
 
 	// Stop any background cached-gate aggregators inside VSA instances.
@@ -241,3 +366,61 @@ func main() {
 
 	fmt.Println("Server gracefully stopped.")
 }
+
+// openPostgres opens dsn with the named database/sql driver and pings it, so a bad DSN
+// or an unregistered driver fails at startup rather than on the first commit.
+func openPostgres(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// loadAuthKeys reads the --auth_keys file: one API key per line, ignoring blank lines
+// and lines starting with '#'.
+func loadAuthKeys(path string) (api.KeySet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s lists no keys", path)
+	}
+	return api.NewKeySet(keys...), nil
+}
+
+// loadKeyLimits reads the --key_limits file, a JSON object of key → limit, into a
+// provider that falls back to def for unlisted keys. An empty path yields nil (every
+// key gets the server's rate limit).
+func loadKeyLimits(path string, def int64) (api.LimitProvider, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]int64
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+	for k, l := range keys {
+		if l <= 0 {
+			return nil, fmt.Errorf("limit for %q must be positive, got %d", k, l)
+		}
+	}
+	return api.MapLimits{Default: def, Keys: keys}, nil
+}
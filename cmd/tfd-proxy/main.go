@@ -17,13 +17,17 @@
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"syscall"
 	"time"
@@ -31,6 +35,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"vsa/internal/sinks"
+	"vsa/internal/tfdharness"
 	tfd "vsa/plugin/tfd"
 )
 
@@ -101,6 +106,8 @@ func main() {
 	//     GET  /state?key=K                 → reconstructs state for key K
 	//     GET  /state?key=K&sum=1           → returns {"sum": total} for key K
 	//     GET  /state?key=K&bucket=B&sum=1  → returns {"sum": value} for that bucket
+	//     GET  /state?format=csv            → key_id,bucket_id,value rows (add key=K
+	//                                         and/or bucket=B to filter; sum is rejected)
 	//     GET  /metrics                     → Prometheus metrics (basic, process)
 	//     GET  /healthz                     → liveness probe
 	//
@@ -109,6 +116,8 @@ func main() {
 	//     - S-lane flush is time-capped (flag -flush); if you query /state too soon,
 	//       call it again or wait a couple of milliseconds.
 	//     - Logs go to -s_log (S batches) and -v_log (V envelopes) as JSONL.
+	//     - When the S-lane buffer is full, S ops get 503 + Retry-After (see
+	//       -s_overflow); V ops are never rejected.
 	//
 	// Flags
 	shards := flag.Int("shards", 4, "S-lane shards")
@@ -118,6 +127,17 @@ func main() {
 	flushEvery := flag.Duration("flush", 2*time.Millisecond, "service flush interval")
 	sLog := flag.String("s_log", "s.log", "S-batch log path")
 	vLog := flag.String("v_log", "v.log", "V log path")
+	logFormat := flag.String("log_format", "jsonl", "Encoding for new s/v logs: jsonl|binary (readers detect either)")
+	logCompress := flag.Bool("log_compress", false, "Gzip new s/v logs (readers detect compression)")
+	logMaxBytes := flag.Int64("log_max_bytes", 0, "Rotate s/v logs to name.1, name.2, ... once they reach this size (0 = never)")
+	logMaxBackups := flag.Int("log_max_backups", 5, "Rotated s/v log segments to keep with -log_max_bytes (0 disables rotation)")
+	vsaMode := flag.String("vsa", "simple", "S-batch transformer: simple (merge per flush) | compacting (merge across flushes for -vsa_window)")
+	vsaWindow := flag.Duration("vsa_window", 10*time.Millisecond, "How long -vsa=compacting holds S-batches before emitting")
+	checkpoint := flag.String("checkpoint", "", "If set, compact existing s/v logs into this checkpoint at startup; /state replays checkpoint + tail")
+	sKafkaTopic := flag.String("s_kafka_topic", "", "If set, also publish S-batches to this Kafka topic (keyed by KeyID)")
+	sKafkaBrokers := flag.String("s_kafka_brokers", "", "Comma-separated Kafka brokers for -s_kafka_topic; empty uses the demo logging producer (no Kafka client is bundled)")
+	sOverflow := flag.String("s_overflow", "drop", "When the S-lane buffer is full: drop (answer 503 with Retry-After so clients retry) | block (hold the request until there is room)")
+	hashName := flag.String("hash", "fnv", "Hash for key and bucket ids: fnv | xxhash64 (to match an upstream partitioner); must not change across restarts sharing the same logs")
 	addr := flag.String("http", ":9090", "HTTP listen address")
 	flag.Parse()
 
@@ -148,12 +168,51 @@ func main() {
 	if *countThresh <= 0 {
 		*countThresh = 4096
 	}
+	overflow := tfd.OverflowDrop
+	switch *sOverflow {
+	case "drop", "":
+	case "block":
+		overflow = tfd.OverflowBlock
+	default:
+		log.Fatalf("unknown -s_overflow %q (want drop|block)", *sOverflow)
+	}
 
-	fileSink, err := sinks.NewSBatchFileSink(*sLog)
+	hasher, err := tfd.HasherByName(*hashName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sinkOpts := sinks.FileSinkOptions{Format: sinks.FormatJSONL, Compressed: *logCompress, MaxBytes: *logMaxBytes, MaxBackups: *logMaxBackups}
+	switch *logFormat {
+	case "jsonl", "":
+	case "binary":
+		sinkOpts.Format = sinks.FormatBinary
+	default:
+		log.Fatalf("unknown -log_format %q (want jsonl|binary)", *logFormat)
+	}
+	if *checkpoint != "" {
+		// Compact before the sinks open the logs for appending.
+		if err := sinks.Compact(*sLog, *vLog, *checkpoint); err != nil {
+			log.Fatalf("compact logs: %v", err)
+		}
+	}
+	fileSink, err := sinks.NewSBatchFileSinkWithOptions(*sLog, sinkOpts)
 	if err != nil {
 		log.Fatalf("open s sink: %v", err)
 	}
 	defer fileSink.Close()
+	var sSink tfd.SBatchesSink = fileSink
+	if *sKafkaTopic != "" {
+		kafkaSink, err := tfdharness.BuildKafkaSBatchSink(*sKafkaBrokers, *sKafkaTopic)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		sSink = sinks.MultiSSink{fileSink, kafkaSink}
+	}
+	transformer, err := tfdharness.BuildTransformer(*vsaMode, *vsaWindow)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	opts := tfd.PipelineOptions{
 		Shards:        *shards,
@@ -162,19 +221,39 @@ func main() {
 		TimeCap:       *timeCap,
 		FlushInterval: *flushEvery,
 		Buffer:        8192,
-		VSA:           tfd.SimpleVSA{},
-		SSink:         fileSink,
+		OnOverflow:    overflow,
+		VSA:           transformer,
+		SSink:         sSink,
+		Hasher:        hasher,
 	}
 	pipe := tfd.NewPipeline(opts)
+	// Continue the V chains of an existing log so strict replay sees no restart.
+	vTail, err := sinks.ReadAllVLogRotated(*vLog)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("read v log: %v", err)
+	}
+	pipe.ResumeV(vTail)
 	pipe.Start()
 	defer pipe.Stop()
 
-	vSink, err := sinks.NewVEnvFileSink(*vLog)
+	vSink, err := sinks.NewVEnvFileSinkWithOptions(*vLog, sinkOpts)
 	if err != nil {
 		log.Fatalf("open v sink: %v", err)
 	}
 	defer vSink.Close()
 
+	// handle routes env through the pipeline, persisting V via the file sink. When the
+	// S-lane is saturated (-s_overflow=drop) it answers 503 with Retry-After and returns
+	// false, so the client can retry instead of the op being silently lost.
+	handle := func(w http.ResponseWriter, env tfd.Envelope) bool {
+		if err := pipe.Handle(env, vSink.Append); errors.Is(err, tfd.ErrSDropped) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "S-lane saturated, retry later", http.StatusServiceUnavailable)
+			return false
+		}
+		return true
+	}
+
 	// HTTP handlers
 	http.Handle("/metrics", promhttp.Handler())
 	// Health endpoint for quick checks
@@ -195,7 +274,7 @@ func main() {
 			}
 		}
 		seq := uint64(time.Now().UnixNano())
-		ch, fp, delta, err := tfd.Classify(tfd.Op{Key: key, Bucket: bucket, Amount: n, IsSingleKey: true, IsConservativeDelta: true, SeqEnd: seq})
+		ch, fp, delta, err := pipe.Classify(tfd.Op{Key: key, Bucket: bucket, Amount: n, IsSingleKey: true, IsConservativeDelta: true, SeqEnd: seq})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -206,7 +285,9 @@ func main() {
 			chName = "S"
 		}
 		// Delegate routing to the pipeline; persist V via file sink
-		pipe.Handle(env, vSink.Append)
+		if !handle(w, env) {
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusAccepted)
 		_ = json.NewEncoder(w).Encode(map[string]any{
@@ -227,14 +308,16 @@ func main() {
 		rpsStr := r.URL.Query().Get("rps")
 		_, _ = strconv.Atoi(rpsStr) // value unused in demo
 		seq := uint64(time.Now().UnixNano())
-		ch, fp, delta, err := tfd.Classify(tfd.Op{Key: key, ChangesPolicy: true, Amount: 0, IsSingleKey: true, SeqEnd: seq})
+		ch, fp, delta, err := pipe.Classify(tfd.Op{Key: key, ChangesPolicy: true, Amount: 0, IsSingleKey: true, SeqEnd: seq})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		env := tfd.Envelope{Channel: ch, Footprint: fp, Delta: delta, SeqEnd: seq}
 		// Route via pipeline and persist Vector via sink
-		pipe.Handle(env, vSink.Append)
+		if !handle(w, env) {
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusAccepted)
 		_ = json.NewEncoder(w).Encode(map[string]any{
@@ -247,7 +330,9 @@ func main() {
 		})
 	})
 
-	// reverse is modeled as an order-sensitive Vector delta for a specific bucket
+	// reverse is modeled as an order-sensitive Vector delta for a specific bucket.
+	// With mode=decrement it is a pure subtraction within the bucket instead, which is
+	// order-insensitive and stays on the S-lane like /consume.
 	http.HandleFunc("/reverse", func(w http.ResponseWriter, r *http.Request) {
 		key := r.URL.Query().Get("key")
 		bucket := r.URL.Query().Get("bucket")
@@ -259,54 +344,102 @@ func main() {
 			}
 		}
 		seq := uint64(time.Now().UnixNano())
-		ch, fp, delta, err := tfd.Classify(tfd.Op{Key: key, Bucket: bucket, Amount: -n, IsSingleKey: true, IsConservativeDelta: false, NeedsExternalDecision: true, SeqEnd: seq})
+		decrement := r.URL.Query().Get("mode") == "decrement"
+		if decrement && bucket == "" {
+			http.Error(w, "mode=decrement requires a bucket", http.StatusBadRequest)
+			return
+		}
+		ch, fp, delta, err := pipe.Classify(tfd.Op{Key: key, Bucket: bucket, Amount: -n, IsSingleKey: true, IsConservativeDelta: decrement, NeedsExternalDecision: !decrement, SeqEnd: seq})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		env := tfd.Envelope{Channel: ch, Footprint: fp, Delta: delta, SeqEnd: seq}
-		// Route via pipeline and persist Vector via sink
-		pipe.Handle(env, vSink.Append)
+		// Route via pipeline; Vector reversals are persisted via the sink
+		if !handle(w, env) {
+			return
+		}
+		chName, hint := "V", "Vector reversal logged; GET /state to observe effect"
+		if ch == tfd.ChannelScalar {
+			chName, hint = "S", "Decrement batched on the S-lane; GET /state after a few ms"
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusAccepted)
 		_ = json.NewEncoder(w).Encode(map[string]any{
 			"accepted":   true,
-			"channel":    "V",
+			"channel":    chName,
 			"key_id":     fp.KeyID,
 			"bucket_id":  fp.Time.BucketID,
 			"seq_end":    seq,
 			"v_log_path": *vLog,
-			"hint":       "Vector reversal logged; GET /state to observe effect",
+			"hint":       hint,
 		})
 	})
 
-	// /state reconstructs current state from logs in-process
-	http.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
-		key := r.URL.Query().Get("key")
-		// Request an immediate S-lane flush to reduce staleness, then flush sinks.
+	// /state reconstructs current state from logs in-process. Before each read it
+	// requests an immediate S-lane flush and flushes the sinks to reduce staleness.
+	http.HandleFunc("/state", stateHandler(func() {
 		pipe.FlushS()
 		_ = fileSink.Flush()
 		_ = vSink.Flush()
-		sb, err := sinks.ReadAllSLog(*sLog)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("read S log: %v", err), 500)
+	}, *sLog, *vLog, *checkpoint, pipe.HashKey))
+
+	go func() {
+		log.Printf("tfd-proxy listening on %s", *addr)
+		if err := http.ListenAndServe(*addr, nil); err != nil {
+			log.Fatalf("http: %v", err)
+		}
+	}()
+
+	// Wait for termination
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+}
+
+// stateHandler serves /state from the logs at sLog and vLog (replayed after checkpoint,
+// if set), calling sync first so recent ops are on disk. Keys and buckets in the query
+// are hashed with hash, the pipeline's Hasher.
+func stateHandler(sync func(), sLog, vLog, checkpoint string, hash tfd.Hasher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		key, bucket := q.Get("key"), q.Get("bucket")
+		format := q.Get("format")
+		switch {
+		case format != "" && format != "json" && format != "csv":
+			http.Error(w, fmt.Sprintf("unknown format %q (want json|csv)", format), http.StatusBadRequest)
+			return
+		case format == "csv" && q.Get("sum") != "":
+			http.Error(w, "sum is not supported with format=csv", http.StatusBadRequest)
 			return
 		}
-		ve, err := sinks.ReadAllVLog(*vLog)
+		sync()
+		st, err := sinks.ReconstructState(sLog, vLog, checkpoint)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("read V log: %v", err), 500)
+			http.Error(w, fmt.Sprintf("reconstruct from logs: %v", err), 500)
+			return
+		}
+		if format == "csv" {
+			var kid, bid *uint64
+			if key != "" {
+				id := hash(key)
+				kid = &id
+			}
+			if bucket != "" {
+				id := hash(bucket)
+				bid = &id
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			_ = writeStateCSV(w, st.Cells(), kid, bid)
 			return
 		}
-		st := tfd.NewState()
-		st.Reconstruct(sb, ve)
 		if key != "" {
 			// Optional sum-only response for easier automation
-			if r.URL.Query().Get("sum") == "1" {
-				kid := tfd.HashKey(key)
-				bucket := r.URL.Query().Get("bucket")
+			if q.Get("sum") == "1" {
+				kid := hash(key)
 				var sum int64
 				if bucket != "" {
-					bid := tfd.HashKey(bucket)
+					bid := hash(bucket)
 					for kb, v := range st.Cells() {
 						if kb[0] == kid && kb[1] == bid {
 							sum += v
@@ -323,7 +456,7 @@ func main() {
 				return
 			}
 			// Filter cells for the requested key
-			kid := tfd.HashKey(key)
+			kid := hash(key)
 			m := map[string]int64{}
 			for kb, v := range st.Cells() {
 				if kb[0] == kid {
@@ -335,17 +468,34 @@ func main() {
 		}
 		// dump everything
 		_ = json.NewEncoder(w).Encode(st.Cells())
-	})
+	}
+}
 
-	go func() {
-		log.Printf("tfd-proxy listening on %s", *addr)
-		if err := http.ListenAndServe(*addr, nil); err != nil {
-			log.Fatalf("http: %v", err)
+// writeStateCSV writes reconstructed cells as key_id,bucket_id,value rows,
+// sorted by key then bucket so output is stable across calls. A non-nil keyID
+// or bucketID restricts the rows to that key or bucket.
+func writeStateCSV(w io.Writer, cells map[[2]uint64]int64, keyID, bucketID *uint64) error {
+	keys := make([][2]uint64, 0, len(cells))
+	for kb := range cells {
+		if (keyID == nil || kb[0] == *keyID) && (bucketID == nil || kb[1] == *bucketID) {
+			keys = append(keys, kb)
 		}
-	}()
-
-	// Wait for termination
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	<-sigCh
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"key_id", "bucket_id", "value"})
+	for _, kb := range keys {
+		_ = cw.Write([]string{
+			strconv.FormatUint(kb[0], 10),
+			strconv.FormatUint(kb[1], 10),
+			strconv.FormatInt(cells[kb], 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
 }
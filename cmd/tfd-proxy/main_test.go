@@ -0,0 +1,133 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"vsa/internal/sinks"
+	tfd "vsa/plugin/tfd"
+)
+
+// TestStateHandler_CSV drives /state?format=csv over logs written through the /consume
+// classification path: the rows, their Content-Type and the key/bucket filters, and
+// the rejection of sum=1 and unknown formats.
+func TestStateHandler_CSV(t *testing.T) {
+	dir := t.TempDir()
+	sPath, vPath := filepath.Join(dir, "s.log"), filepath.Join(dir, "v.log")
+	ss, err := sinks.NewSBatchFileSink(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := sinks.NewVEnvFileSink(vPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := tfd.NewPipeline(tfd.PipelineOptions{Shards: 2, OrderPow2: 4, CountThresh: 64, TimeCap: time.Hour, FlushInterval: time.Hour, Buffer: 16, VSA: tfd.SimpleVSA{}, SSink: ss})
+	p.Start()
+	// Same classification the /consume handler uses.
+	consume := func(seq uint64, key, bucket string, n int64) {
+		ch, fp, delta, err := p.Classify(tfd.Op{Key: key, Bucket: bucket, Amount: n, IsSingleKey: true, IsConservativeDelta: true, SeqEnd: seq})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Handle(tfd.Envelope{Channel: ch, Footprint: fp, Delta: delta, SeqEnd: seq}, vs.Append)
+	}
+	consume(1, "a", "w1", 5)
+	consume(2, "a", "w1", 2)
+	consume(3, "b", "w1", 7)
+	consume(4, "a", "w2", 4)
+	p.Stop()
+	if err := ss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced := 0
+	srv := httptest.NewServer(stateHandler(func() { synced++ }, sPath, vPath, "", p.HashKey))
+	defer srv.Close()
+	get := func(query string) (int, string, string) {
+		t.Helper()
+		resp, err := srv.Client().Get(srv.URL + "/state?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	code, ctype, all := get("format=csv")
+	if code != http.StatusOK || ctype != "text/csv" {
+		t.Fatalf("format=csv: status=%d Content-Type=%q", code, ctype)
+	}
+	lines := strings.Split(strings.TrimSpace(all), "\n")
+	if len(lines) != 4 || lines[0] != "key_id,bucket_id,value" {
+		t.Fatalf("unexpected csv: %q", all)
+	}
+	rowA := fmt.Sprintf("%d,%d,7", p.HashKey("a"), p.HashKey("w1"))
+	if !strings.Contains(all, rowA+"\n") {
+		t.Fatalf("missing row %q in %q", rowA, all)
+	}
+	if synced != 1 {
+		t.Fatalf("handler synced %d times, want 1", synced)
+	}
+
+	header := "key_id,bucket_id,value\n"
+	for query, want := range map[string]string{
+		"format=csv&key=a":           header + rowA + "\n" + fmt.Sprintf("%d,%d,4\n", p.HashKey("a"), p.HashKey("w2")),
+		"format=csv&key=a&bucket=w1": header + rowA + "\n",
+		"format=csv&key=c":           header,
+	} {
+		if _, _, got := get(query); !sameRows(got, want) {
+			t.Fatalf("%s = %q, want %q", query, got, want)
+		}
+	}
+	_, _, w1 := get("format=csv&bucket=w1")
+	if n := len(strings.Split(strings.TrimSpace(w1), "\n")); n != 3 {
+		t.Fatalf("format=csv&bucket=w1 returned %d lines, want header + a/w1 + b/w1: %q", n, w1)
+	}
+	for _, query := range []string{"format=csv&key=a&sum=1", "format=xml"} {
+		if code, _, _ := get(query); code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d want 400", query, code)
+		}
+	}
+	if code, _, body := get("key=a&bucket=w1&sum=1"); code != http.StatusOK || strings.TrimSpace(body) != `{"sum":7}` {
+		t.Fatalf("JSON sum: status=%d body=%q", code, body)
+	}
+}
+
+// sameRows reports whether two CSV bodies hold the same lines, in any order.
+func sameRows(a, b string) bool {
+	la, lb := strings.Split(a, "\n"), strings.Split(b, "\n")
+	sort.Strings(la)
+	sort.Strings(lb)
+	return strings.Join(la, "\n") == strings.Join(lb, "\n")
+}
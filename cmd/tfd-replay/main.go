@@ -0,0 +1,171 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command tfd-replay reconstructs state from TFD S and V logs and optionally checks it
+// against expected sums, exiting non-zero on mismatch. It lets CI verify after a soak
+// run that replaying S in any order plus V in per-key order yields the expected cells.
+// Rotated log segments are replayed oldest first, after the checkpoint if one is given.
+//
+// Usage:
+//
+//	tfd-replay -s_log s.log -v_log v.log [-checkpoint state.ckpt] [-expect sums.json] [-strict_vchain] [-hash fnv|xxhash64]
+//
+// The expected-sums file is a JSON array of {"key": "...", "bucket": "...", "sum": N}.
+// Keys and buckets are the raw strings, hashed with -hash, which must match the
+// writer's (tfd-proxy -hash); omitting bucket compares the sum over all of the key's
+// cells, like /state?key=K&sum=1.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"vsa/internal/sinks"
+	tfd "vsa/plugin/tfd"
+)
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitMismatch = 1
+	exitError    = 2
+)
+
+// expectedSum is one entry of the -expect file.
+type expectedSum struct {
+	Key    string  `json:"key"`
+	Bucket *string `json:"bucket,omitempty"`
+	Sum    int64   `json:"sum"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("tfd-replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	sLog := fs.String("s_log", "s.log", "S-batch log path")
+	vLog := fs.String("v_log", "v.log", "V log path")
+	checkpoint := fs.String("checkpoint", "", "Optional checkpoint written by log compaction, replayed ahead of the logs")
+	expect := fs.String("expect", "", "Optional JSON file of expected sums to cross-check")
+	strict := fs.Bool("strict_vchain", false, "Fail if the V log's per-key prev-hash chain is broken")
+	hashName := fs.String("hash", "fnv", "Hash the logs' key and bucket ids were written with: fnv | xxhash64 (as tfd-proxy -hash)")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	hasher, err := tfd.HasherByName(*hashName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	base, err := sinks.ReadCheckpoint(*checkpoint)
+	if err != nil {
+		fmt.Fprintf(stderr, "read checkpoint: %v\n", err)
+		return exitError
+	}
+	sb, err := sinks.ReadAllSLogRotated(*sLog)
+	if err != nil {
+		fmt.Fprintf(stderr, "read S log: %v\n", err)
+		return exitError
+	}
+	ve, err := sinks.ReadAllVLogRotated(*vLog)
+	if err != nil {
+		fmt.Fprintf(stderr, "read V log: %v\n", err)
+		return exitError
+	}
+	st := tfd.NewState()
+	st.StrictVChain = *strict
+	if err := st.Reconstruct(append(base, sb...), ve); err != nil {
+		fmt.Fprintf(stderr, "reconstruct: %v\n", err)
+		if errors.Is(err, tfd.ErrVChainBroken) {
+			return exitMismatch
+		}
+		return exitError
+	}
+	fmt.Fprintf(stdout, "replayed %d checkpoint cells, %d S-batches and %d V-envelopes into %d cells\n", len(base), len(sb), len(ve), len(st.Cells()))
+
+	if *expect == "" {
+		return exitOK
+	}
+	want, err := readExpected(*expect)
+	if err != nil {
+		fmt.Fprintf(stderr, "read expected sums: %v\n", err)
+		return exitError
+	}
+	mismatches := 0
+	for _, e := range want {
+		got := sumCells(st.Cells(), hasher, e)
+		if got != e.Sum {
+			mismatches++
+			fmt.Fprintf(stderr, "MISMATCH key=%q bucket=%s got=%d want=%d\n", e.Key, describeBucket(e.Bucket), got, e.Sum)
+		}
+	}
+	if mismatches > 0 {
+		fmt.Fprintf(stderr, "%d of %d expected sums differ\n", mismatches, len(want))
+		return exitMismatch
+	}
+	fmt.Fprintf(stdout, "all %d expected sums match\n", len(want))
+	return exitOK
+}
+
+func readExpected(path string) ([]expectedSum, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []expectedSum
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// sumCells returns the reconstructed value for e: one (key,bucket) cell, or the sum
+// over all of the key's cells when no bucket is given.
+func sumCells(cells map[[2]uint64]int64, h tfd.Hasher, e expectedSum) int64 {
+	kid := h(e.Key)
+	if e.Bucket != nil {
+		return cells[[2]uint64{kid, bucketID(h, *e.Bucket)}]
+	}
+	var sum int64
+	for kb, v := range cells {
+		if kb[0] == kid {
+			sum += v
+		}
+	}
+	return sum
+}
+
+// bucketID hashes a bucket string the way tfd.ClassifyWith does ("" = all buckets, id 0).
+func bucketID(h tfd.Hasher, bucket string) uint64 {
+	if bucket == "" {
+		return 0
+	}
+	return h(bucket)
+}
+
+func describeBucket(b *string) string {
+	if b == nil {
+		return "(all)"
+	}
+	return fmt.Sprintf("%q", *b)
+}
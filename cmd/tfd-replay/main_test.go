@@ -0,0 +1,179 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"vsa/internal/sinks"
+	tfd "vsa/plugin/tfd"
+)
+
+// writeKnownLogs writes S and V logs for keys "a" and "b" through the pipeline
+// classification path and returns their paths. Expected cells:
+// a/w1 = 5+2-1 = 6, a/w2 = 4, b/w1 = 7-3 = 4.
+func writeKnownLogs(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	return writeKnownLogsWith(t, dir, tfd.HashKey)
+}
+
+// writeKnownLogsWith is writeKnownLogs with the ids hashed by h.
+func writeKnownLogsWith(t *testing.T, dir string, h tfd.Hasher) (string, string) {
+	t.Helper()
+	sPath, vPath := filepath.Join(dir, "s.log"), filepath.Join(dir, "v.log")
+	ss, err := sinks.NewSBatchFileSink(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := sinks.NewVEnvFileSink(vPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := tfd.NewPipeline(tfd.PipelineOptions{Shards: 2, OrderPow2: 4, CountThresh: 64, TimeCap: time.Hour, FlushInterval: time.Hour, Buffer: 16, VSA: tfd.SimpleVSA{}, SSink: ss})
+	p.Start()
+	seq := uint64(0)
+	handle := func(op tfd.Op) {
+		seq++
+		op.SeqEnd = seq
+		ch, fp, delta, err := tfd.ClassifyWith(h, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Handle(tfd.Envelope{Channel: ch, Footprint: fp, Delta: delta, SeqEnd: seq}, vs.Append)
+	}
+	s := func(key, bucket string, n int64) {
+		handle(tfd.Op{Key: key, Bucket: bucket, Amount: n, IsSingleKey: true, IsConservativeDelta: true})
+	}
+	v := func(key, bucket string, n int64) {
+		handle(tfd.Op{Key: key, Bucket: bucket, Amount: n, IsSingleKey: true, NeedsExternalDecision: true})
+	}
+	s("a", "w1", 5)
+	s("a", "w1", 2)
+	v("a", "w1", -1)
+	s("a", "w2", 4)
+	s("b", "w1", 7)
+	v("b", "w1", -3)
+	p.Stop()
+	if err := ss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sPath, vPath
+}
+
+func writeExpected(t *testing.T, dir, body string) string {
+	t.Helper()
+	p := filepath.Join(dir, "expect.json")
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRun_ComputesCellSums(t *testing.T) {
+	dir := t.TempDir()
+	sPath, vPath := writeKnownLogs(t, dir)
+	expect := writeExpected(t, dir, `[
+		{"key": "a", "bucket": "w1", "sum": 6},
+		{"key": "a", "bucket": "w2", "sum": 4},
+		{"key": "a", "sum": 10},
+		{"key": "b", "bucket": "w1", "sum": 4}
+	]`)
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-s_log", sPath, "-v_log", vPath, "-expect", expect, "-strict_vchain"}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("exit=%d stderr=%s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "into 3 cells") || !strings.Contains(stdout.String(), "all 4 expected sums match") {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+}
+
+func TestRun_MismatchExitsNonZero(t *testing.T) {
+	dir := t.TempDir()
+	sPath, vPath := writeKnownLogs(t, dir)
+	expect := writeExpected(t, dir, `[{"key": "a", "bucket": "w1", "sum": 6}, {"key": "b", "sum": 5}]`)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-s_log", sPath, "-v_log", vPath, "-expect", expect}, &stdout, &stderr); code != exitMismatch {
+		t.Fatalf("exit=%d want %d; stderr=%s", code, exitMismatch, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), `MISMATCH key="b" bucket=(all) got=4 want=5`) {
+		t.Fatalf("mismatch not reported: %s", stderr.String())
+	}
+	if code := run([]string{"-s_log", filepath.Join(dir, "missing.log"), "-v_log", vPath}, &stdout, &stderr); code != exitError {
+		t.Fatalf("missing log exit=%d want %d", code, exitError)
+	}
+}
+
+func TestRun_RotatedSegmentsAndCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	sPath, vPath := writeKnownLogs(t, dir)
+	expect := writeExpected(t, dir, `[{"key": "a", "sum": 10}, {"key": "b", "bucket": "w1", "sum": 4}]`)
+
+	// A rotated S log: everything in s.log.1, an empty active file.
+	if err := os.Rename(sPath, sPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-s_log", sPath, "-v_log", vPath, "-expect", expect}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("rotated: exit=%d stderr=%s", code, stderr.String())
+	}
+
+	// Compaction folds the logs into the checkpoint and truncates them.
+	ckpt := filepath.Join(dir, "state.ckpt")
+	if err := sinks.Compact(sPath, vPath, ckpt); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := run([]string{"-s_log", sPath, "-v_log", vPath, "-checkpoint", ckpt, "-expect", expect}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("checkpoint: exit=%d stderr=%s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "replayed 3 checkpoint cells") {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+	if code := run([]string{"-s_log", sPath, "-v_log", vPath, "-expect", expect}, &stdout, &stderr); code != exitMismatch {
+		t.Fatalf("without checkpoint: exit=%d want %d", code, exitMismatch)
+	}
+}
+
+// Logs written with xxhash64 ids only match the expected sums when replayed with the
+// same -hash.
+func TestRun_HashFlag(t *testing.T) {
+	dir := t.TempDir()
+	sPath, vPath := writeKnownLogsWith(t, dir, tfd.XXHash64)
+	expect := writeExpected(t, dir, `[{"key": "a", "bucket": "w1", "sum": 6}, {"key": "b", "sum": 4}]`)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-s_log", sPath, "-v_log", vPath, "-expect", expect, "-hash", "xxhash64"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("-hash=xxhash64: exit=%d stderr=%s", code, stderr.String())
+	}
+	if code := run([]string{"-s_log", sPath, "-v_log", vPath, "-expect", expect}, &stdout, &stderr); code != exitMismatch {
+		t.Fatalf("default hash on xxhash64 logs: exit=%d want %d", code, exitMismatch)
+	}
+	if code := run([]string{"-s_log", sPath, "-v_log", vPath, "-hash", "md5"}, &stdout, &stderr); code != exitError {
+		t.Fatalf("unknown -hash: exit=%d want %d", code, exitError)
+	}
+}
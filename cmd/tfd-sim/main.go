@@ -17,6 +17,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -33,6 +34,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"vsa/internal/sinks"
+	"vsa/internal/tfdharness"
 	tfd "vsa/plugin/tfd"
 )
 
@@ -54,9 +56,52 @@ func (m metricVSA) Compress(in []tfd.SBatch) []tfd.SBatch {
 	return out
 }
 
+// Drain forwards to transformers that hold batches across flushes, counting what they emit.
+func (m metricVSA) Drain() []tfd.SBatch {
+	d, ok := m.inner.(tfd.VSADrainer)
+	if !ok {
+		return nil
+	}
+	out := d.Drain()
+	if m.outCtr != nil {
+		m.outCtr.Add(float64(len(out)))
+	}
+	return out
+}
+
+// shardCollector exports per-shard accumulator occupancy and flush-trigger counts,
+// read from SAccumulator.ShardStats at scrape time.
+type shardCollector struct {
+	acc     *tfd.SAccumulator
+	used    *prometheus.Desc
+	flushes *prometheus.Desc
+}
+
+func newShardCollector(acc *tfd.SAccumulator) *shardCollector {
+	return &shardCollector{
+		acc:     acc,
+		used:    prometheus.NewDesc("tfd_s_shard_used_slots", "Occupied table slots per S-accumulator shard", []string{"shard"}, nil),
+		flushes: prometheus.NewDesc("tfd_s_shard_flushes_total", "S-accumulator shard flushes by trigger (count threshold or time cap)", []string{"shard", "trigger"}, nil),
+	}
+}
+
+func (c *shardCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.used
+	ch <- c.flushes
+}
+
+func (c *shardCollector) Collect(ch chan<- prometheus.Metric) {
+	for i, st := range c.acc.ShardStats() {
+		shard := strconv.Itoa(i)
+		ch <- prometheus.MustNewConstMetric(c.used, prometheus.GaugeValue, float64(st.Used), shard)
+		ch <- prometheus.MustNewConstMetric(c.flushes, prometheus.CounterValue, float64(st.CountFlushes), shard, "count")
+		ch <- prometheus.MustNewConstMetric(c.flushes, prometheus.CounterValue, float64(st.TimeFlushes), shard, "time")
+	}
+}
+
 // metricSink wraps the S sink to observe flush intervals.
 type metricSink struct {
-	inner     *sinks.SBatchFileSink
+	inner     tfd.SBatchesSink
 	last      atomic.Int64 // unix nano
 	flushHist prometheus.Observer
 }
@@ -132,7 +177,9 @@ func main() {
 	//   - tfd_total_ops, tfd_s_ops, tfd_v_ops
 	//   - tfd_s_batches_in_total (pre-VSA) vs tfd_s_batches_out_total (post-VSA)
 	//   - tfd_try_ingest_fail_total (S-service backpressure)
+	//   - tfd_s_ops_dropped_total (S ops shed on a full buffer with -s_overflow=drop)
 	//   - tfd_s_flush_interval_seconds (observed sink write intervals)
+	//   - tfd_s_shard_used_slots, tfd_s_shard_flushes_total{trigger=count|time} (per shard)
 	//
 	// Flags common to service
 	shards := flag.Int("shards", 4, "S-lane shards")
@@ -142,6 +189,15 @@ func main() {
 	flushEvery := flag.Duration("flush", 2*time.Millisecond, "service flush interval")
 	sLog := flag.String("s_log", "s.log", "S-batch log path")
 	vLog := flag.String("v_log", "v.log", "V log path")
+	logFormat := flag.String("log_format", "jsonl", "Encoding for new s/v logs: jsonl|binary (readers detect either)")
+	logCompress := flag.Bool("log_compress", false, "Gzip new s/v logs (readers detect compression)")
+	logMaxBytes := flag.Int64("log_max_bytes", 0, "Rotate s/v logs to name.1, name.2, ... once they reach this size (0 = never)")
+	logMaxBackups := flag.Int("log_max_backups", 5, "Rotated s/v log segments to keep with -log_max_bytes (0 disables rotation)")
+	vsaMode := flag.String("vsa", "simple", "S-batch transformer: simple (merge per flush) | compacting (merge across flushes for -vsa_window)")
+	vsaWindow := flag.Duration("vsa_window", 10*time.Millisecond, "How long -vsa=compacting holds S-batches before emitting")
+	sKafkaTopic := flag.String("s_kafka_topic", "", "If set, also publish S-batches to this Kafka topic (keyed by KeyID)")
+	sKafkaBrokers := flag.String("s_kafka_brokers", "", "Comma-separated Kafka brokers for -s_kafka_topic; empty uses the demo logging producer (no Kafka client is bundled)")
+	sOverflow := flag.String("s_overflow", "block", "When the S-service buffer is full: block (backpressure) | drop (shed the op, counted in tfd_s_ops_dropped_total)")
 	httpAddr := flag.String("http", ":8080", "HTTP listen")
 
 	// Simulation flags
@@ -203,6 +259,15 @@ func main() {
 		*duration = d
 	}
 
+	overflow := tfd.OverflowBlock
+	switch *sOverflow {
+	case "block", "":
+	case "drop":
+		overflow = tfd.OverflowDrop
+	default:
+		log.Fatalf("unknown -s_overflow %q (want block|drop)", *sOverflow)
+	}
+
 	acc := tfd.NewSAccumulator(*shards, *orderPow2, *countThresh, *timeCap)
 
 	// Metrics setup
@@ -212,24 +277,51 @@ func main() {
 	sOps := prometheus.NewCounter(prometheus.CounterOpts{Name: "tfd_s_ops", Help: "Ops routed to S"})
 	vOps := prometheus.NewCounter(prometheus.CounterOpts{Name: "tfd_v_ops", Help: "Ops routed to V"})
 	tryIngestFail := prometheus.NewCounter(prometheus.CounterOpts{Name: "tfd_try_ingest_fail_total", Help: "TryIngest failures due to full buffer"})
+	sDropped := prometheus.NewCounter(prometheus.CounterOpts{Name: "tfd_s_ops_dropped_total", Help: "S ops dropped on a full buffer (-s_overflow=drop)"})
 	sBatchesIn := prometheus.NewCounter(prometheus.CounterOpts{Name: "tfd_s_batches_in_total", Help: "S batches before VSA"})
 	sBatchesOut := prometheus.NewCounter(prometheus.CounterOpts{Name: "tfd_s_batches_out_total", Help: "S batches after VSA"})
 	flushInterval := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "tfd_s_flush_interval_seconds", Help: "Observed interval between sink writes", Buckets: prometheus.DefBuckets})
-	reg.MustRegister(totalOps, sOps, vOps, tryIngestFail, sBatchesIn, sBatchesOut, flushInterval)
+	reg.MustRegister(totalOps, sOps, vOps, tryIngestFail, sDropped, sBatchesIn, sBatchesOut, flushInterval, newShardCollector(acc))
 
 	// VSA + sink wiring
-	fileSink, err := sinks.NewSBatchFileSink(*sLog)
+	sinkOpts := sinks.FileSinkOptions{Format: sinks.FormatJSONL, Compressed: *logCompress, MaxBytes: *logMaxBytes, MaxBackups: *logMaxBackups}
+	switch *logFormat {
+	case "jsonl", "":
+	case "binary":
+		sinkOpts.Format = sinks.FormatBinary
+	default:
+		log.Fatalf("unknown -log_format %q (want jsonl|binary)", *logFormat)
+	}
+	fileSink, err := sinks.NewSBatchFileSinkWithOptions(*sLog, sinkOpts)
 	if err != nil {
 		log.Fatalf("open s sink: %v", err)
 	}
-	msink := &metricSink{inner: fileSink, flushHist: flushInterval}
-	var transformer tfd.VSATransformer = metricVSA{inner: tfd.SimpleVSA{}, inCtr: sBatchesIn, outCtr: sBatchesOut}
-	svc := tfd.NewSService(acc, transformer, msink, tfd.SServiceOptions{Buffer: 8192, FlushInterval: *flushEvery})
+	var sSink tfd.SBatchesSink = fileSink
+	if *sKafkaTopic != "" {
+		kafkaSink, err := tfdharness.BuildKafkaSBatchSink(*sKafkaBrokers, *sKafkaTopic)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		sSink = sinks.MultiSSink{fileSink, kafkaSink}
+	}
+	msink := &metricSink{inner: sSink, flushHist: flushInterval}
+	inner, err := tfdharness.BuildTransformer(*vsaMode, *vsaWindow)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	var transformer tfd.VSATransformer = metricVSA{inner: inner, inCtr: sBatchesIn, outCtr: sBatchesOut}
+	svc := tfd.NewSService(acc, transformer, msink, tfd.SServiceOptions{Buffer: 8192, FlushInterval: *flushEvery, OnOverflow: overflow})
 	svc.Start()
 	defer func() { svc.Stop(); _ = fileSink.Close() }()
 
 	vr := tfd.NewVRouter()
-	vSink, err := sinks.NewVEnvFileSink(*vLog)
+	// Continue the V chains of an existing log so strict replay sees no restart.
+	vTail, err := sinks.ReadAllVLogRotated(*vLog)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("read v log: %v", err)
+	}
+	vr.Resume(vTail)
+	vSink, err := sinks.NewVEnvFileSinkWithOptions(*vLog, sinkOpts)
 	if err != nil {
 		log.Fatalf("open v sink: %v", err)
 	}
@@ -256,12 +348,13 @@ func main() {
 		if ch == tfd.ChannelScalar {
 			if !svc.TryIngest(env) {
 				tryIngestFail.Inc()
-				svc.Ingest(env)
+				if svc.Submit(env) == tfd.ErrSDropped {
+					sDropped.Inc()
+				}
 			}
 			sOps.Inc()
 		} else {
-			vr.Route(fp.KeyID).Enqueue(env)
-			vSink.Append(env)
+			vr.Route(fp.KeyID).EnqueuePersist(env, vSink.Append)
 			vOps.Inc()
 		}
 		w.WriteHeader(202)
@@ -313,12 +406,13 @@ func main() {
 					if ch == tfd.ChannelScalar {
 						if !svc.TryIngest(env) {
 							tryIngestFail.Inc()
-							svc.Ingest(env)
+							if svc.Submit(env) == tfd.ErrSDropped {
+								sDropped.Inc()
+							}
 						}
 						sOps.Inc()
 					} else {
-						vr.Route(fp.KeyID).Enqueue(env)
-						vSink.Append(env)
+						vr.Route(fp.KeyID).EnqueuePersist(env, vSink.Append)
 						vOps.Inc()
 					}
 				}
@@ -0,0 +1,106 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultEventsInterval is how often /events checks a key for a change in availability
+// unless ServerOptions.EventsInterval is set.
+const DefaultEventsInterval = 100 * time.Millisecond
+
+// CloseStreams ends every open /events subscription, and any started later, so that
+// http.Server.Shutdown, which waits for active requests, is not held up by long-lived
+// streams. Register it with http.Server.RegisterOnShutdown. It is safe to call more
+// than once.
+func (s *Server) CloseStreams() {
+	s.closeStreams.Do(func() { close(s.streamsDone) })
+}
+
+// handleEvents streams a key's availability as Server-Sent Events for live dashboards:
+// GET /events?api_key=K sends an "availability" event carrying the /status fields
+// ({"scalar","vector","available"}) when the subscription starts and whenever the
+// available budget changes afterwards, until the client disconnects or the server
+// shuts down (CloseStreams).
+//
+// The key is polled every ServerOptions.EventsInterval without creating or touching it,
+// so a subscription neither consumes budget nor keeps an idle key from being evicted;
+// events start once the key exists and pause while it does not.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	key := r.URL.Query().Get("api_key")
+	if key == "" {
+		http.Error(w, "API key is required", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var last statusResponse
+	sent := false
+	emit := func() error {
+		v, ok := s.store.Get(key)
+		if !ok {
+			return nil
+		}
+		st := snapshot(v)
+		if sent && st.Available == last.Available {
+			return nil
+		}
+		data, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: availability\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		last, sent = st, true
+		return nil
+	}
+
+	if emit() != nil {
+		return
+	}
+	ticker := time.NewTicker(s.eventsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.streamsDone:
+			return
+		case <-ticker.C:
+			if emit() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+
+	"vsa/internal/ratelimiter/api/ratelimitpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer exposes the rate limiter over gRPC for internal services that prefer RPC
+// over HTTP. It wraps a Server, so both transports share the same Store, reservations,
+// and global budget, and a unit consumed over one is visible to the other.
+type GRPCServer struct {
+	ratelimitpb.UnimplementedRateLimiterServer
+	s *Server
+}
+
+// NewGRPCServer creates the gRPC service backed by s.
+func NewGRPCServer(s *Server) *GRPCServer {
+	return &GRPCServer{s: s}
+}
+
+// Register attaches the RateLimiter service to gs.
+func (g *GRPCServer) Register(gs *grpc.Server) {
+	ratelimitpb.RegisterRateLimiterServer(gs, g)
+}
+
+// APIKeyUnaryInterceptor is the gRPC counterpart of APIKeyAuth: it rejects calls whose
+// API key v does not accept with Unauthenticated before the handler runs. The key is
+// taken from the x-api-key metadata entry, else from the request's api_key. A call whose
+// x-api-key differs from its api_key is rejected with PermissionDenied, so one valid key
+// cannot spend, refund, or inspect another key's budget.
+func APIKeyUnaryInterceptor(v KeyValidator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var key, reqKey string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vals := md.Get("x-api-key"); len(vals) > 0 {
+				key = vals[0]
+			}
+		}
+		if r, ok := req.(interface{ GetApiKey() string }); ok {
+			reqKey = r.GetApiKey()
+		}
+		if key == "" {
+			key = reqKey
+		} else if reqKey != "" && reqKey != key {
+			return nil, status.Error(codes.PermissionDenied, "API key does not match the requested key")
+		}
+		if key == "" || !v.ValidKey(key) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing API key")
+		}
+		return handler(context.WithValue(ctx, authKeyKey{}, key), req)
+	}
+}
+
+// Check mirrors /check: it consumes req.Cost units (default 1) for the key. A denial is
+// a normal response with Allowed=false and the denial reason, not an RPC error.
+func (g *GRPCServer) Check(_ context.Context, req *ratelimitpb.CheckRequest) (*ratelimitpb.CheckResponse, error) {
+	start := checkStart()
+	key := req.GetApiKey()
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "API key is required")
+	}
+	cost := req.GetCost()
+	if cost == 0 {
+		cost = 1
+	}
+	if cost < 0 {
+		return nil, status.Error(codes.InvalidArgument, "cost must be a positive integer")
+	}
+
+	remaining, limit, reason := g.s.check(start, key, cost, req.GetReserve())
+	if reason != "" {
+		return &ratelimitpb.CheckResponse{
+			Limit:     limit,
+			Remaining: remaining,
+			Reason:    string(reason),
+		}, nil
+	}
+	resp := &ratelimitpb.CheckResponse{
+		Allowed:   true,
+		Limit:     limit,
+		Remaining: remaining,
+	}
+	if req.GetReserve() {
+		resp.ReservationToken = g.s.reservations.add(key, cost)
+	}
+	return resp, nil
+}
+
+// Release mirrors /release: with a reservation token it cancels that reservation
+// (NotFound for unknown tokens); otherwise it refunds one unit for the key.
+func (g *GRPCServer) Release(_ context.Context, req *ratelimitpb.ReleaseRequest) (*ratelimitpb.ReleaseResponse, error) {
+	if token := req.GetReservationToken(); token != "" {
+		res, ok := g.s.reservations.remove(token)
+		if !ok {
+			return nil, status.Error(codes.NotFound, "unknown reservation token")
+		}
+		g.s.refundReservation(res)
+		return &ratelimitpb.ReleaseResponse{}, nil
+	}
+	key := req.GetApiKey()
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "API key is required")
+	}
+	g.s.refundOne(key)
+	return &ratelimitpb.ReleaseResponse{}, nil
+}
+
+// Status mirrors /status: it reports a key's state without consuming or creating it,
+// returning NotFound for keys not in memory.
+func (g *GRPCServer) Status(_ context.Context, req *ratelimitpb.StatusRequest) (*ratelimitpb.StatusResponse, error) {
+	key := req.GetApiKey()
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "API key is required")
+	}
+	userVSA, ok := g.s.store.Get(key)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown key")
+	}
+	st := snapshot(userVSA)
+	return &ratelimitpb.StatusResponse{Scalar: st.Scalar, Vector: st.Vector, Available: st.Available}, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"vsa/internal/ratelimiter/api/ratelimitpb"
+	"vsa/internal/ratelimiter/core"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGRPCClient serves srv over an in-process bufconn listener and returns a client.
+func newTestGRPCClient(t *testing.T, srv *Server, opts ...grpc.ServerOption) ratelimitpb.RateLimiterClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(opts...)
+	NewGRPCServer(srv).Register(gs)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return ratelimitpb.NewRateLimiterClient(conn)
+}
+
+// TestGRPCServer_AdmitUntilLimitAndRelease checks Check/Release/Status over an in-process
+// gRPC connection and that they share state with the HTTP handlers' Store.
+func TestGRPCServer_AdmitUntilLimitAndRelease(t *testing.T) {
+	store := core.NewStore(3)
+	client := newTestGRPCClient(t, NewServer(store, 3))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Status(ctx, &ratelimitpb.StatusRequest{ApiKey: "rpc"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Status before first use: err=%v want NotFound", err)
+	}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Check(ctx, &ratelimitpb.CheckRequest{ApiKey: "rpc"})
+		if err != nil {
+			t.Fatalf("Check #%d: %v", i+1, err)
+		}
+		if !resp.GetAllowed() || resp.GetRemaining() != int64(2-i) || resp.GetLimit() != 3 {
+			t.Fatalf("Check #%d = %+v; want allowed with remaining %d", i+1, resp, 2-i)
+		}
+	}
+	resp, err := client.Check(ctx, &ratelimitpb.CheckRequest{ApiKey: "rpc"})
+	if err != nil {
+		t.Fatalf("Check at limit: %v", err)
+	}
+	if resp.GetAllowed() || resp.GetReason() != string(ReasonKeyLimit) {
+		t.Fatalf("Check at limit = %+v; want denied with key_limit", resp)
+	}
+
+	if _, err := client.Release(ctx, &ratelimitpb.ReleaseRequest{ApiKey: "rpc"}); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if got := store.GetOrCreate("rpc").Available(); got != 1 {
+		t.Fatalf("store Available()=%d after Release, want 1", got)
+	}
+	if resp, err := client.Check(ctx, &ratelimitpb.CheckRequest{ApiKey: "rpc"}); err != nil || !resp.GetAllowed() {
+		t.Fatalf("Check after Release = %+v, %v; want allowed", resp, err)
+	}
+
+	st, err := client.Status(ctx, &ratelimitpb.StatusRequest{ApiKey: "rpc"})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if st.GetScalar() != 3 || st.GetVector() != 3 || st.GetAvailable() != 0 {
+		t.Fatalf("Status = %+v; want scalar 3, vector 3, available 0", st)
+	}
+
+	if _, err := client.Check(ctx, &ratelimitpb.CheckRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Check without key: err=%v want InvalidArgument", err)
+	}
+}
+
+// TestGRPCServer_ReserveAndReleaseToken verifies reservations issued over gRPC can be
+// cancelled by token, refunding their units.
+func TestGRPCServer_ReserveAndReleaseToken(t *testing.T) {
+	store := core.NewStore(5)
+	client := newTestGRPCClient(t, NewServer(store, 5))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := client.Check(ctx, &ratelimitpb.CheckRequest{ApiKey: "rsv", Cost: 4, Reserve: true})
+	if err != nil || !resp.GetAllowed() || resp.GetReservationToken() == "" {
+		t.Fatalf("reserving Check = %+v, %v", resp, err)
+	}
+	if _, err := client.Release(ctx, &ratelimitpb.ReleaseRequest{ReservationToken: resp.GetReservationToken()}); err != nil {
+		t.Fatalf("Release token: %v", err)
+	}
+	if got := store.GetOrCreate("rsv").Available(); got != 5 {
+		t.Fatalf("Available()=%d after cancelling reservation, want 5", got)
+	}
+	if _, err := client.Release(ctx, &ratelimitpb.ReleaseRequest{ReservationToken: resp.GetReservationToken()}); status.Code(err) != codes.NotFound {
+		t.Fatalf("second Release: err=%v want NotFound", err)
+	}
+}
+
+// TestGRPCServer_APIKeyInterceptor checks that APIKeyUnaryInterceptor applies the same
+// rules as APIKeyAuth: unlisted or missing keys are Unauthenticated, a credential naming
+// another key is PermissionDenied, and neither consumes budget.
+func TestGRPCServer_APIKeyInterceptor(t *testing.T) {
+	store := core.NewStore(5)
+	client := newTestGRPCClient(t, NewServer(store, 5),
+		grpc.UnaryInterceptor(APIKeyUnaryInterceptor(NewKeySet("alice", "bob"))))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	as := func(key string) context.Context { return metadata.AppendToOutgoingContext(ctx, "x-api-key", key) }
+
+	if _, err := client.Check(ctx, &ratelimitpb.CheckRequest{ApiKey: "mallory"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Check with unlisted key: err=%v want Unauthenticated", err)
+	}
+	if _, err := client.Check(as("mallory"), &ratelimitpb.CheckRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Check with unlisted credential: err=%v want Unauthenticated", err)
+	}
+	if _, err := client.Check(as("alice"), &ratelimitpb.CheckRequest{ApiKey: "bob", Cost: 5}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Check for another key: err=%v want PermissionDenied", err)
+	}
+	if _, err := client.Release(as("alice"), &ratelimitpb.ReleaseRequest{ApiKey: "bob"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Release for another key: err=%v want PermissionDenied", err)
+	}
+	if _, ok := store.Get("bob"); ok {
+		t.Fatal("rejected calls created key bob")
+	}
+	if _, ok := store.Get("mallory"); ok {
+		t.Fatal("rejected calls created key mallory")
+	}
+
+	if resp, err := client.Check(as("alice"), &ratelimitpb.CheckRequest{ApiKey: "alice"}); err != nil || !resp.GetAllowed() {
+		t.Fatalf("Check with matching credential = %+v, %v; want allowed", resp, err)
+	}
+	if resp, err := client.Check(ctx, &ratelimitpb.CheckRequest{ApiKey: "bob"}); err != nil || !resp.GetAllowed() {
+		t.Fatalf("Check with listed api_key = %+v, %v; want allowed", resp, err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// LimitProvider supplies the per-key rate limit. The server consults it whenever it
+// needs a key's limit: a key missing from the store is created with that scalar
+// (core.Store.GetOrCreateWithScalar), and the X-RateLimit-Limit header, JSON "limit"
+// fields and Retry-After are derived from it. Limit is called on every request, so it
+// should be fast and safe for concurrent use.
+//
+// A key keeps the scalar it was created with until it is evicted; a provider whose
+// answer changes over time therefore takes effect for existing keys only after
+// eviction.
+type LimitProvider interface {
+	Limit(key string) int64
+}
+
+// StaticLimit is a LimitProvider granting every key the same limit. It is the default
+// provider, using the server's rate limit.
+type StaticLimit int64
+
+// Limit implements LimitProvider.
+func (l StaticLimit) Limit(string) int64 { return int64(l) }
+
+// MapLimits is a LimitProvider with per-key overrides: keys in Keys get their mapped
+// limit, every other key gets Default. Keys must not be modified once the server uses it.
+type MapLimits struct {
+	Default int64
+	Keys    map[string]int64
+}
+
+// Limit implements LimitProvider.
+func (m MapLimits) Limit(key string) int64 {
+	if l, ok := m.Keys[key]; ok {
+		return l
+	}
+	return m.Default
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Request metrics are opt-in: until EnableRequestMetrics is called the handlers skip
+// both the clock read and the counter updates, keeping the hot path free of telemetry
+// cost when no metrics endpoint is exposed.
+var (
+	requestMetricsEnabled  atomic.Bool
+	registerRequestMetrics sync.Once
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ratelimiter_requests_total",
+		Help: "Rate-limit checks by outcome (ok = admitted, rejected = denied with 429)",
+	}, []string{"result"})
+	requestsOK       = requestsTotal.WithLabelValues("ok")
+	requestsRejected = requestsTotal.WithLabelValues("rejected")
+
+	checkDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ratelimiter_check_duration_seconds",
+		Help:    "Latency of rate-limit checks, from request parsing to the admit/reject decision",
+		Buckets: []float64{1e-6, 2.5e-6, 5e-6, 1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 5e-3, 1e-2},
+	})
+)
+
+// EnableRequestMetrics registers ratelimiter_requests_total and
+// ratelimiter_check_duration_seconds with the default Prometheus registry and starts
+// recording them for /check (and gRPC Check). Call it when a metrics endpoint is
+// exposed; it is safe to call more than once.
+func EnableRequestMetrics() {
+	registerRequestMetrics.Do(func() {
+		prometheus.MustRegister(requestsTotal, checkDuration)
+	})
+	requestMetricsEnabled.Store(true)
+}
+
+// checkStart returns the start time for latency measurement, or the zero time when
+// request metrics are disabled.
+func checkStart() time.Time {
+	if !requestMetricsEnabled.Load() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observeCheck records a check's outcome and latency; start comes from checkStart.
+func observeCheck(start time.Time, admitted bool) {
+	if start.IsZero() {
+		return
+	}
+	checkDuration.Observe(time.Since(start).Seconds())
+	if admitted {
+		requestsOK.Inc()
+	} else {
+		requestsRejected.Inc()
+	}
+}
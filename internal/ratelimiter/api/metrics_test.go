@@ -0,0 +1,63 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vsa/internal/ratelimiter/core"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestRequestMetrics_CountOutcomesOnlyWhenEnabled verifies /check feeds
+// ratelimiter_requests_total and the latency histogram only after EnableRequestMetrics.
+func TestRequestMetrics_CountOutcomesOnlyWhenEnabled(t *testing.T) {
+	store := core.NewStore(1)
+	mux := http.NewServeMux()
+	NewServer(store, 1).RegisterRoutes(mux)
+	check := func(key string) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/check?api_key="+key, nil))
+	}
+
+	okBefore, rejBefore := testutil.ToFloat64(requestsOK), testutil.ToFloat64(requestsRejected)
+	if !requestMetricsEnabled.Load() {
+		check("disabled")
+		check("disabled")
+		if testutil.ToFloat64(requestsOK) != okBefore || testutil.ToFloat64(requestsRejected) != rejBefore {
+			t.Fatalf("request metrics changed while disabled")
+		}
+	}
+
+	EnableRequestMetrics()
+	EnableRequestMetrics() // idempotent
+	check("enabled")       // admitted
+	check("enabled")       // rejected
+	check("enabled")       // rejected
+	if got := testutil.ToFloat64(requestsOK) - okBefore; got != 1 {
+		t.Fatalf("ok delta=%v want 1", got)
+	}
+	if got := testutil.ToFloat64(requestsRejected) - rejBefore; got != 2 {
+		t.Fatalf("rejected delta=%v want 2", got)
+	}
+	if n := testutil.CollectAndCount(checkDuration); n != 1 {
+		t.Fatalf("latency histogram series=%d want 1", n)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Middleware wraps an HTTP handler, e.g. to authenticate or annotate requests before
+// they reach the rate limiter. ServerOptions.Middleware applies a chain of them to
+// every API route.
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps h so that mw[0] runs first (outermost).
+func chain(h http.Handler, mw []Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// RequestIDHeader carries the request ID set by RequestID.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns a middleware that tags every request with an ID: the client's
+// X-Request-ID when present, else a random one. The ID is echoed in the response's
+// X-Request-ID header and available to handlers via RequestIDFrom.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				var b [8]byte
+				_, _ = rand.Read(b[:])
+				id = hex.EncodeToString(b[:])
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestIDFrom returns the request ID set by RequestID, or "" if there is none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// KeyValidator decides whether an API key may use the service. It is called on every
+// request behind APIKeyAuth, so it should be fast and safe for concurrent use.
+type KeyValidator interface {
+	ValidKey(key string) bool
+}
+
+// KeySet is a KeyValidator accepting a fixed set of keys.
+type KeySet map[string]struct{}
+
+// NewKeySet returns a KeySet accepting keys.
+func NewKeySet(keys ...string) KeySet {
+	s := make(KeySet, len(keys))
+	for _, k := range keys {
+		s[k] = struct{}{}
+	}
+	return s
+}
+
+// ValidKey implements KeyValidator.
+func (s KeySet) ValidKey(key string) bool {
+	_, ok := s[key]
+	return ok
+}
+
+type authKeyKey struct{}
+
+// APIKeyAuth returns a middleware that rejects requests whose API key v does not
+// accept with 401, before any handler runs, so an unauthorized request never creates
+// a key or consumes budget. The key is taken from the X-API-Key header, else from the
+// api_key query parameter; requests carrying neither (e.g. /commit without the
+// header, or a JSON body naming the key) are rejected too.
+//
+// Credentials only cover the key they name: a request whose X-API-Key differs from its
+// api_key is rejected with 403, and handlers taking keys from a JSON body (/v1/check,
+// /v1/bulk-check) reject any body key other than the authenticated one (see
+// AuthenticatedKey), so one valid key cannot spend or create another key's budget.
+func APIKeyAuth(v KeyValidator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if q := r.URL.Query().Get("api_key"); key == "" {
+				key = q
+			} else if q != "" && q != key {
+				http.Error(w, "API key does not match the requested key", http.StatusForbidden)
+				return
+			}
+			if key == "" || !v.ValidKey(key) {
+				http.Error(w, "invalid or missing API key", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authKeyKey{}, key)))
+		})
+	}
+}
+
+// AuthenticatedKey returns the API key APIKeyAuth accepted for the request, or "" when
+// the request did not pass through APIKeyAuth.
+func AuthenticatedKey(ctx context.Context) string {
+	key, _ := ctx.Value(authKeyKey{}).(string)
+	return key
+}
+
+// authorizeKey rejects with 403, and reports false, a request for key when APIKeyAuth
+// authenticated a different key.
+func authorizeKey(w http.ResponseWriter, r *http.Request, key string) bool {
+	if auth := AuthenticatedKey(r.Context()); auth != "" && auth != key {
+		http.Error(w, "API key does not match the requested key", http.StatusForbidden)
+		return false
+	}
+	return true
+}
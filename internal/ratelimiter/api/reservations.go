@@ -0,0 +1,136 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// reservation is a unit of budget consumed on behalf of a client that has not
+// yet been confirmed or cancelled.
+type reservation struct {
+	key   string
+	n     int64
+	timer *time.Timer // expiry timer; nil when reservations do not expire
+}
+
+// reservationTable tracks outstanding reservations by token and counts them per key.
+// The per-key count is bounded by maxPerKey (0 = unlimited), so a client cannot tie
+// up budget with an unbounded number of open reservations.
+//
+// When ttl > 0, a reservation that is neither committed nor cancelled within ttl is
+// retired automatically and handed to onExpire (which refunds its budget).
+type reservationTable struct {
+	mu        sync.Mutex
+	byToken   map[string]reservation
+	perKey    map[string]int
+	maxPerKey int
+	ttl       time.Duration
+	onExpire  func(reservation)
+}
+
+func newReservationTable(maxPerKey int, ttl time.Duration, onExpire func(reservation)) *reservationTable {
+	return &reservationTable{
+		byToken:   make(map[string]reservation),
+		perKey:    make(map[string]int),
+		maxPerKey: maxPerKey,
+		ttl:       ttl,
+		onExpire:  onExpire,
+	}
+}
+
+// acquire claims a reservation slot for key. It returns false when the key already
+// holds maxPerKey outstanding reservations. A successful acquire must be followed by
+// either add (budget consumed) or releaseSlot (budget denied).
+func (t *reservationTable) acquire(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.maxPerKey > 0 && t.perKey[key] >= t.maxPerKey {
+		return false
+	}
+	t.perKey[key]++
+	return true
+}
+
+// releaseSlot returns a slot claimed by acquire that never became a reservation.
+func (t *reservationTable) releaseSlot(key string) {
+	t.mu.Lock()
+	t.decLocked(key)
+	t.mu.Unlock()
+}
+
+// add records a reservation for a previously acquired slot and returns its token.
+func (t *reservationTable) add(key string, n int64) string {
+	token := newReservationToken()
+	r := reservation{key: key, n: n}
+	t.mu.Lock()
+	if t.ttl > 0 {
+		r.timer = time.AfterFunc(t.ttl, func() { t.expire(token) })
+	}
+	t.byToken[token] = r
+	t.mu.Unlock()
+	return token
+}
+
+// remove retires the reservation for token and frees its slot.
+// It returns false if the token is unknown (already retired or never issued).
+func (t *reservationTable) remove(token string) (reservation, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.byToken[token]
+	if !ok {
+		return reservation{}, false
+	}
+	delete(t.byToken, token)
+	t.decLocked(r.key)
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	return r, true
+}
+
+// expire retires token if it is still outstanding. Racing with commit/cancel is safe:
+// whichever removes the token first wins and the other observes an unknown token.
+func (t *reservationTable) expire(token string) {
+	if r, ok := t.remove(token); ok && t.onExpire != nil {
+		t.onExpire(r)
+	}
+}
+
+// outstanding returns the number of open reservations for key.
+func (t *reservationTable) outstanding(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.perKey[key]
+}
+
+func (t *reservationTable) decLocked(key string) {
+	if c := t.perKey[key]; c > 1 {
+		t.perKey[key] = c - 1
+	} else {
+		delete(t.perKey, key)
+	}
+}
+
+func newReservationToken() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
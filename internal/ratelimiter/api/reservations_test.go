@@ -0,0 +1,289 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"vsa/internal/ratelimiter/core"
+)
+
+// TestServer_Reservations_CapAndCancel creates reservations up to the per-key cap,
+// asserts the next one is denied although budget remains, and checks that cancelling
+// one frees a slot and refunds its unit.
+func TestServer_Reservations_CapAndCancel(t *testing.T) {
+	store := core.NewStore(100)
+	srv := NewServerWithOptions(store, 100, ServerOptions{MaxReservationsPerKey: 2})
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+	key := "holder"
+
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL + "/check?reserve=1&api_key=" + key)
+		if err != nil {
+			t.Fatalf("reserve %d: %v", i+1, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 on reserve %d, got %d", i+1, resp.StatusCode)
+		}
+		tok := resp.Header.Get("X-Reservation-Token")
+		if tok == "" {
+			t.Fatalf("reserve %d: missing X-Reservation-Token", i+1)
+		}
+		tokens = append(tokens, tok)
+	}
+
+	// Third reservation exceeds the cap even though 98 units remain.
+	resp, err := client.Get(ts.URL + "/check?reserve=1&api_key=" + key)
+	if err != nil {
+		t.Fatalf("reserve over cap: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 over the reservation cap, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-RateLimit-Status"); got != "ReservationLimit" {
+		t.Fatalf("expected X-RateLimit-Status=ReservationLimit, got %q", got)
+	}
+	if got := store.GetOrCreate(key).Available(); got != 98 {
+		t.Fatalf("denied reservation must not consume budget: available=%d want 98", got)
+	}
+
+	// Plain admits are not subject to the reservation cap.
+	resp, err = client.Get(ts.URL + "/check?api_key=" + key)
+	if err != nil {
+		t.Fatalf("plain check: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for plain check, got %d", resp.StatusCode)
+	}
+
+	// Cancel one reservation: its unit is refunded and the slot is freed.
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/release?token="+tokens[0], nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 on cancel, got %d", resp.StatusCode)
+	}
+	if got := store.GetOrCreate(key).Available(); got != 98 {
+		t.Fatalf("available after cancel=%d want 98", got)
+	}
+	if got := srv.reservations.outstanding(key); got != 1 {
+		t.Fatalf("outstanding after cancel=%d want 1", got)
+	}
+
+	resp, err = client.Get(ts.URL + "/check?reserve=1&api_key=" + key)
+	if err != nil {
+		t.Fatalf("reserve after cancel: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after cancel freed a slot, got %d", resp.StatusCode)
+	}
+
+	// A retired token cannot be cancelled twice.
+	req, _ = http.NewRequest(http.MethodPost, ts.URL+"/release?token="+tokens[0], nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("double cancel: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a retired token, got %d", resp.StatusCode)
+	}
+}
+
+// TestServer_Reservations_DeniedBudgetFreesSlot ensures a reservation rejected for lack of
+// budget does not leak a slot.
+func TestServer_Reservations_DeniedBudgetFreesSlot(t *testing.T) {
+	store := core.NewStore(1)
+	srv := NewServerWithOptions(store, 1, ServerOptions{MaxReservationsPerKey: 5})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		resp, err := ts.Client().Get(ts.URL + "/check?reserve=1&api_key=k")
+		if err != nil {
+			t.Fatalf("reserve %d: %v", i+1, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("reserve %d: got %d want %d", i+1, resp.StatusCode, want)
+		}
+	}
+	if got := srv.reservations.outstanding("k"); got != 1 {
+		t.Fatalf("outstanding=%d want 1", got)
+	}
+}
+
+// TestServer_ReserveCommitCancel covers the two-phase endpoints: reserve holds N units,
+// commit keeps them consumed, cancel refunds them, and retired tokens return 404.
+func TestServer_ReserveCommitCancel(t *testing.T) {
+	store := core.NewStore(10)
+	srv := NewServer(store, 10)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	post := func(path string) *http.Response {
+		t.Helper()
+		resp, err := client.Post(ts.URL+path, "", nil)
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post("/reserve?api_key=k&n=4")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reserve: got %d", resp.StatusCode)
+	}
+	committed := resp.Header.Get("X-Reservation-Token")
+	resp = post("/reserve?api_key=k&n=3")
+	cancelled := resp.Header.Get("X-Reservation-Token")
+	if got := store.GetOrCreate("k").Available(); got != 3 {
+		t.Fatalf("available after reserving 7=%d want 3", got)
+	}
+	if resp = post("/reserve?api_key=k&n=4"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("reserve beyond budget: got %d want 429", resp.StatusCode)
+	}
+
+	if resp = post("/commit?token=" + committed); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("commit: got %d", resp.StatusCode)
+	}
+	if resp = post("/cancel?token=" + cancelled); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("cancel: got %d", resp.StatusCode)
+	}
+	if got := store.GetOrCreate("k").Available(); got != 6 {
+		t.Fatalf("available after commit(4)+cancel(3)=%d want 6", got)
+	}
+	for _, path := range []string{"/commit?token=" + committed, "/cancel?token=" + cancelled} {
+		if resp = post(path); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("%s on retired token: got %d want 404", path, resp.StatusCode)
+		}
+	}
+
+	for _, path := range []string{"/reserve?api_key=k&n=0", "/reserve?api_key=k&n=x", "/reserve?n=1", "/commit", "/cancel"} {
+		if resp = post(path); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: got %d want 400", path, resp.StatusCode)
+		}
+	}
+	getResp, err := client.Get(ts.URL + "/reserve?api_key=k")
+	if err != nil {
+		t.Fatalf("GET /reserve: %v", err)
+	}
+	getResp.Body.Close()
+	if getResp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /reserve: got %d want 405", getResp.StatusCode)
+	}
+}
+
+// TestServer_Reserve_ExpiryRefunds verifies abandoned reservations are refunded after the TTL.
+func TestServer_Reserve_ExpiryRefunds(t *testing.T) {
+	store := core.NewStore(5)
+	srv := NewServerWithOptions(store, 5, ServerOptions{ReservationTTL: 20 * time.Millisecond})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := ts.Client().Post(ts.URL+"/reserve?api_key=k&n=5", "", nil)
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	resp.Body.Close()
+	token := resp.Header.Get("X-Reservation-Token")
+	if got := store.GetOrCreate("k").Available(); got != 0 {
+		t.Fatalf("available after reserve=%d want 0", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for store.GetOrCreate("k").Available() != 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := store.GetOrCreate("k").Available(); got != 5 {
+		t.Fatalf("available after expiry=%d want 5", got)
+	}
+	resp, err = ts.Client().Post(ts.URL+"/commit?token="+token, "", nil)
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("commit after expiry: got %d want 404", resp.StatusCode)
+	}
+}
+
+// TestServer_Reserve_RefundShortfall checks that a cancel or expiry whose key no longer
+// holds the reserved units reports the shortfall instead of dropping it silently.
+func TestServer_Reserve_RefundShortfall(t *testing.T) {
+	store := core.NewStore(5)
+	srv := NewServerWithOptions(store, 5, ServerOptions{ReservationTTL: 20 * time.Millisecond})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	post := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		return rec
+	}
+
+	cancelled := post("/reserve?api_key=k&n=2").Header().Get("X-Reservation-Token")
+	rec := post("/cancel?token=" + cancelled)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Refunded") != "2" {
+		t.Fatalf("cancel = %d, refunded %q; want 204, 2", rec.Code, rec.Header().Get("X-RateLimit-Refunded"))
+	}
+	if got := srv.RefundShortfall(); got != 0 {
+		t.Fatalf("shortfall after a full refund = %d, want 0", got)
+	}
+
+	// Evicting the key while holds are open leaves the recreated key nothing to refund.
+	cancelled = post("/reserve?api_key=k&n=2").Header().Get("X-Reservation-Token")
+	post("/reserve?api_key=k&n=3")
+	store.Delete("k")
+	if rec = post("/cancel?token=" + cancelled); rec.Header().Get("X-RateLimit-Refunded") != "0" {
+		t.Fatalf("cancel after eviction refunded %q, want 0", rec.Header().Get("X-RateLimit-Refunded"))
+	}
+	if got := srv.RefundShortfall(); got != 2 {
+		t.Fatalf("shortfall after cancel = %d, want 2", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.RefundShortfall() != 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := srv.RefundShortfall(); got != 5 {
+		t.Fatalf("shortfall after expiry = %d, want 5", got)
+	}
+	if got := store.GetOrCreate("k").Available(); got != 5 {
+		t.Fatalf("recreated key available=%d want 5", got)
+	}
+}
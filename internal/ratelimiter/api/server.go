@@ -20,10 +20,16 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"vsa"
 	"vsa/internal/ratelimiter/core"
 	"vsa/internal/ratelimiter/telemetry/churn"
 
@@ -33,30 +39,190 @@ import (
 // Server handles the HTTP requests for the rate limiter service.
 // It is configured with a VSA store and the rate limit policies.
 type Server struct {
-	store     *core.Store
-	rateLimit int64
+	store        *core.Store
+	rateLimit    int64
+	limits       LimitProvider
+	middleware   []Middleware
+	reservations *reservationTable
+	global       *vsa.VSA // shared budget across all keys; nil when disabled
+	window       time.Duration
+	retryAfter   time.Duration
+	denyBody     DenyBody
+	drainer      Drainer
+
+	refundShortfall atomic.Int64 // reserved units a cancel or expiry could not refund
+
+	eventsInterval time.Duration
+	streamsDone    chan struct{} // closed by CloseStreams to end /events subscriptions
+	closeStreams   sync.Once
+}
+
+// DenyReason identifies the constraint that rejected a request. Every 429 from
+// /check and /reserve reports it in the X-RateLimit-Reason header so clients can
+// tell a per-key limit from a shared one and pick a retry strategy accordingly.
+// Constraints are checked in the order reservation cap, global, key; the first
+// one that denies is reported.
+type DenyReason string
+
+const (
+	// ReasonKeyLimit: the key's own budget cannot cover the request cost.
+	ReasonKeyLimit DenyReason = "key_limit"
+	// ReasonGlobalLimit: the shared budget across all keys (ServerOptions.GlobalLimit)
+	// is exhausted, even though the key itself still has budget.
+	ReasonGlobalLimit DenyReason = "global_limit"
+	// ReasonReservationCap: the key holds ServerOptions.MaxReservationsPerKey open reservations.
+	ReasonReservationCap DenyReason = "reservation_cap"
+	// ReasonOverageDisabled: the cost exceeds the key's whole limit, so it could only be
+	// admitted as overage beyond the limit, which the server does not offer. Unlike
+	// ReasonKeyLimit, retrying the same cost never succeeds.
+	ReasonOverageDisabled DenyReason = "overage_disabled"
+)
+
+// ServerOptions configures optional API behavior.
+type ServerOptions struct {
+	// MaxReservationsPerKey caps the outstanding reservations (/check?reserve=1)
+	// a single key may hold. Further reservations are denied even if budget
+	// exists until one is cancelled. 0 means unlimited.
+	MaxReservationsPerKey int
+
+	// ReservationTTL bounds how long a reservation may stay open. Reservations that
+	// are neither committed nor cancelled within the TTL are refunded automatically.
+	// 0 disables expiry.
+	ReservationTTL time.Duration
+
+	// GlobalLimit caps the units admitted across all keys combined, on top of each
+	// key's own limit. Like per-key budgets it only replenishes via refunds
+	// (/release, /cancel, reservation expiry). 0 disables the global budget.
+	GlobalLimit int64
+
+	// Window is the worker's replenishment window (core.Worker.SetWindow). When set,
+	// Retry-After on key-limit denials is the time until enough of the key's budget
+	// has been refilled to cover the request. 0 means the budget does not replenish.
+	Window time.Duration
+
+	// RetryAfter, when > 0, fixes the Retry-After of every denial instead of computing
+	// it. Without an override or a Window, Retry-After is DefaultRetryAfter.
+	RetryAfter time.Duration
+
+	// DenyBody selects the body of 429 responses from GET /check and /reserve.
+	// The default is DenyBodyPlain.
+	DenyBody DenyBody
+
+	// Limits supplies per-key limits (see LimitProvider). nil grants every key the
+	// server's rate limit.
+	Limits LimitProvider
+
+	// Middleware wraps every API route registered by RegisterRoutes, first element
+	// outermost (e.g. RequestID, then APIKeyAuth). /metrics is left unwrapped so
+	// scrapers need no credentials.
+	Middleware []Middleware
+
+	// EventsInterval is how often GET /events checks the key for a change in
+	// availability. 0 means DefaultEventsInterval.
+	EventsInterval time.Duration
+
+	// Drainer serves POST /drain (see Drainer). nil answers /drain with 501.
+	Drainer Drainer
+}
+
+// Drainer gradually lowers a key's scalar; core.Worker implements it with DrainToTarget.
+type Drainer interface {
+	DrainToTarget(key string, target int64, over, tick time.Duration) error
+}
+
+// DenyBody is the format of 429 response bodies.
+type DenyBody string
+
+const (
+	// DenyBodyPlain is a short text message, e.g. "Too Many Requests".
+	DenyBodyPlain DenyBody = "plain"
+	// DenyBodyJSON is a deniedResponse object.
+	DenyBodyJSON DenyBody = "json"
+)
+
+// DefaultRetryAfter is the Retry-After of denials whose budget does not replenish on its
+// own (no Window, global limit, reservation cap), unless ServerOptions.RetryAfter is set.
+const DefaultRetryAfter = 60 * time.Second
+
+// deniedResponse is the 429 body with DenyBodyJSON.
+type deniedResponse struct {
+	Allowed    bool       `json:"allowed"`
+	Reason     DenyReason `json:"reason"`
+	Remaining  int64      `json:"remaining"`
+	Limit      int64      `json:"limit"`
+	RetryAfter int64      `json:"retry_after"` // seconds, as in the Retry-After header
 }
 
 // NewServer creates and configures a new API server.
 // It requires a configured VSA store and the rate limit policy.
 func NewServer(store *core.Store, rateLimit int64) *Server {
-	return &Server{
-		store:     store,
-		rateLimit: rateLimit,
+	return NewServerWithOptions(store, rateLimit, ServerOptions{})
+}
+
+// NewServerWithOptions creates an API server with explicit options.
+func NewServerWithOptions(store *core.Store, rateLimit int64, opts ServerOptions) *Server {
+	s := &Server{
+		store:      store,
+		rateLimit:  rateLimit,
+		window:     opts.Window,
+		retryAfter: opts.RetryAfter,
+		denyBody:   opts.DenyBody,
+		limits:     opts.Limits,
+		middleware: opts.Middleware,
+		drainer:    opts.Drainer,
+
+		eventsInterval: opts.EventsInterval,
+		streamsDone:    make(chan struct{}),
 	}
+	if s.eventsInterval <= 0 {
+		s.eventsInterval = DefaultEventsInterval
+	}
+	if s.limits == nil {
+		s.limits = StaticLimit(rateLimit)
+	}
+	s.reservations = newReservationTable(opts.MaxReservationsPerKey, opts.ReservationTTL, func(res reservation) {
+		if refunded := s.refundReservation(res); refunded < res.n {
+			log.Printf("reservation for key %q expired: refunded %d of %d units", res.key, refunded, res.n)
+		}
+	})
+	if opts.GlobalLimit > 0 {
+		s.global = vsa.New(opts.GlobalLimit)
+	}
+	return s
 }
 
 // RegisterRoutes sets up the HTTP routes for the server on the given ServeMux.
+// API routes are wrapped in ServerOptions.Middleware.
 func (s *Server) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/check", s.handleCheckRateLimit)
-	mux.HandleFunc("/release", s.handleRelease)
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, chain(h, s.middleware))
+	}
+	handle("/check", s.handleCheckRateLimit)
+	handle("/v1/check", s.handleCheckV1)
+	handle("/v1/bulk-check", s.handleBulkCheck)
+	handle("/release", s.handleRelease)
+	handle("/reserve", s.handleReserve)
+	handle("/commit", s.handleCommit)
+	handle("/cancel", s.handleCancel)
+	handle("/status", s.handleStatus)
+	handle("/drain", s.handleDrain)
+	handle("/events", s.handleEvents)
 	// Expose Prometheus metrics on the same server for E2E and ops.
 	mux.Handle("/metrics", promhttp.Handler())
 }
 
 // handleCheckRateLimit is the main HTTP handler for checking and updating the rate limit.
 // It is designed to be as fast as possible.
+//
+// With cost=C a single request consumes C units (default 1), e.g. for expensive
+// endpoints; it is admitted only if the full cost is available.
+//
+// With reserve=1 the admitted units are held as a reservation: the response carries an
+// X-Reservation-Token that can be passed to /release?token=T to cancel it. Keys holding
+// the maximum number of outstanding reservations are denied with 429.
 func (s *Server) handleCheckRateLimit(w http.ResponseWriter, r *http.Request) {
+	start := checkStart()
+
 	// 1. Identify the user. In a real system, you'd get this from an API key
 	// in the Authorization header, a JWT, or the client's IP address.
 	key := r.URL.Query().Get("api_key")
@@ -65,43 +231,324 @@ func (s *Server) handleCheckRateLimit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 2. Get or create the VSA instance for this user from the store.
-	// This is an extremely fast, in-memory operation.
-	userVSA := s.store.GetOrCreate(key)
-
-	// 3. Atomically check-and-consume 1 unit to avoid oversubscription under concurrency.
-	core.RecordAttempt(1)
-	if !userVSA.TryConsume(1) {
-		// Telemetry: record rejection
-		churn.ObserveRequest(key, false)
-		// Provide complete headers on denial as well
-		remaining := userVSA.Available()
-		w.Header().Set("X-RateLimit-Status", "Exceeded")
-		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", s.rateLimit))
-		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
-		// Adding a Retry-After header is a good practice for rate limiting.
-		w.Header().Set("Retry-After", "60") // Retry after 60 seconds
-		w.WriteHeader(http.StatusTooManyRequests)
-		_, _ = w.Write([]byte("Too Many Requests"))
+	cost, ok := parsePositiveInt(r.URL.Query().Get("cost"), 1)
+	if !ok {
+		http.Error(w, "cost must be a positive integer", http.StatusBadRequest)
 		return
 	}
 
-	// Telemetry: record admitted request
-	core.RecordAdmit(1)
-	churn.ObserveRequest(key, true)
+	// 2-3. Get or create the key's VSA and atomically check-and-consume the cost.
+	reserve := r.URL.Query().Get("reserve") == "1"
+	remaining, limit, reason := s.check(start, key, cost, reserve)
+	if reason != "" {
+		s.writeDenied(w, reason, cost, remaining, limit)
+		return
+	}
 
-	// 4. Success: compute remaining after consumption for accurate headers.
-	remaining := userVSA.Available()
+	// 4. Success: remaining was read atomically with the consumption (see admit).
+	if reserve {
+		w.Header().Set("X-Reservation-Token", s.reservations.add(key, cost))
+	}
 
 	// 5. Return a successful response.
 	// Add headers to give the client visibility into their current limit status.
-	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", s.rateLimit))
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
 	w.Header().Set("X-RateLimit-Status", "OK")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "OK")
 }
 
+// check gets or creates key's VSA, admits cost units (see admit) and records the
+// request telemetry. It returns the key's remaining budget, its limit and "" on admit
+// or the denial reason.
+func (s *Server) check(start time.Time, key string, cost int64, reserve bool) (int64, int64, DenyReason) {
+	// Get or create the VSA instance for this user from the store.
+	// This is an extremely fast, in-memory operation.
+	userVSA, limit := s.keyVSA(key)
+
+	// Atomically check-and-consume the request cost to avoid oversubscription under concurrency.
+	core.RecordAttempt(cost)
+	remaining, reason := s.admit(key, userVSA, cost, limit, reserve)
+	if reason != "" {
+		// Telemetry: record rejection
+		churn.ObserveRequestCost(key, false, cost)
+		observeCheck(start, false)
+		return remaining, limit, reason
+	}
+
+	// Telemetry: record admitted request
+	core.RecordAdmit(cost)
+	churn.ObserveRequestCost(key, true, cost)
+	observeCheck(start, true)
+	return remaining, limit, ""
+}
+
+// keyVSA gets or creates key's VSA, seeding a new key with its limit from the
+// LimitProvider, and returns it with that limit.
+func (s *Server) keyVSA(key string) (*vsa.VSA, int64) {
+	limit := s.limits.Limit(key)
+	return s.store.GetOrCreateWithScalar(key, limit), limit
+}
+
+// checkRequest is the JSON body accepted by POST /v1/check.
+type checkRequest struct {
+	Key  string `json:"key"`
+	Cost int64  `json:"cost"` // 0 or omitted means 1
+}
+
+// checkResponse is the JSON body returned by POST /v1/check, for both 200 and 429.
+type checkResponse struct {
+	Allowed   bool       `json:"allowed"`
+	Remaining int64      `json:"remaining"`
+	Limit     int64      `json:"limit"`
+	Reason    DenyReason `json:"reason,omitempty"` // set on 429
+}
+
+// maxCheckBody bounds the JSON body of POST /v1/check.
+const maxCheckBody = 64 << 10
+
+// handleCheckV1 is the JSON variant of /check for typed clients:
+// POST /v1/check with {"key","cost"} returns {"allowed","remaining","limit"} with 200
+// when admitted or 429 (plus "reason") when denied. The X-RateLimit-* and Retry-After
+// headers match GET /check. Keys travel in the body, so they need no URL encoding.
+func (s *Server) handleCheckV1(w http.ResponseWriter, r *http.Request) {
+	start := checkStart()
+	if !requirePost(w, r) {
+		return
+	}
+	var req checkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCheckBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	if !authorizeKey(w, r, req.Key) {
+		return
+	}
+	if req.Cost == 0 {
+		req.Cost = 1
+	}
+	if req.Cost < 0 {
+		http.Error(w, "cost must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	remaining, limit, reason := s.check(start, req.Key, req.Cost, false)
+	resp := checkResponse{Allowed: reason == "", Remaining: remaining, Limit: limit, Reason: reason}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", resp.Remaining))
+	status := http.StatusOK
+	if reason != "" {
+		w.Header().Set("X-RateLimit-Reason", string(reason))
+		w.Header().Set("X-RateLimit-Status", "Exceeded")
+		w.Header().Set("Retry-After", strconv.FormatInt(s.retryAfterSeconds(reason, req.Cost, remaining, limit), 10))
+		status = http.StatusTooManyRequests
+	} else {
+		w.Header().Set("X-RateLimit-Status", "OK")
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// bulkResult is one entry of the POST /v1/bulk-check response, in request order.
+type bulkResult struct {
+	Key       string     `json:"key"`
+	Allowed   bool       `json:"allowed"`
+	Remaining int64      `json:"remaining"`
+	Reason    DenyReason `json:"reason,omitempty"`
+}
+
+// maxBulkItems bounds the number of checks in one POST /v1/bulk-check.
+const maxBulkItems = 1000
+
+// handleBulkCheck admits several keys in one round-trip:
+// POST /v1/bulk-check with [{"key","cost"},...] returns [{"key","allowed","remaining"},...]
+// in request order.
+//
+// By default each item is checked independently (best effort) and the response is 200.
+// With ?atomic=1 the items are all-or-nothing: they are consumed together via
+// vsa.TryConsumeAll, or none is; on denial every item reports allowed=false, the
+// blocking items carry the reason, and the response is 429.
+//
+// X-RateLimit-Limit carries the server's default limit; keys with their own limit
+// (ServerOptions.Limits) report it on /check and /v1/check.
+func (s *Server) handleBulkCheck(w http.ResponseWriter, r *http.Request) {
+	start := checkStart()
+	if !requirePost(w, r) {
+		return
+	}
+	var items []checkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCheckBody)).Decode(&items); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 || len(items) > maxBulkItems {
+		http.Error(w, fmt.Sprintf("between 1 and %d items are required", maxBulkItems), http.StatusBadRequest)
+		return
+	}
+	for i := range items {
+		if items[i].Key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		if !authorizeKey(w, r, items[i].Key) {
+			return
+		}
+		if items[i].Cost == 0 {
+			items[i].Cost = 1
+		}
+		if items[i].Cost < 0 {
+			http.Error(w, "cost must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := make([]bulkResult, len(items))
+	status := http.StatusOK
+	if r.URL.Query().Get("atomic") == "1" {
+		if !s.admitAll(start, items, results) {
+			status = http.StatusTooManyRequests
+		}
+	} else {
+		for i, it := range items {
+			remaining, _, reason := s.check(start, it.Key, it.Cost, false)
+			results[i] = bulkResult{Key: it.Key, Allowed: reason == "", Remaining: remaining, Reason: reason}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", s.rateLimit))
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+// admitAll consumes every item or none, filling results. The global budget (if any) is
+// taken first for the total cost and given back if the keys cannot all be admitted.
+func (s *Server) admitAll(start time.Time, items []checkRequest, results []bulkResult) bool {
+	vs := make([]*vsa.VSA, len(items))
+	costs := make([]int64, len(items))
+	overage := make([]bool, len(items))
+	var total int64
+	var reason DenyReason
+	for i, it := range items {
+		var limit int64
+		vs[i], limit = s.keyVSA(it.Key)
+		costs[i] = it.Cost
+		total += it.Cost
+		core.RecordAttempt(it.Cost)
+		if it.Cost > limit {
+			overage[i], reason = true, ReasonOverageDisabled
+		}
+	}
+	// An item beyond its key's whole limit can never be admitted; then nothing is taken.
+	if reason == "" && s.global != nil && !s.global.TryConsume(total) {
+		reason = ReasonGlobalLimit
+	} else if reason == "" && !vsa.TryConsumeAll(vs, costs) {
+		if s.global != nil {
+			s.global.TryRefund(total)
+		}
+		reason = ReasonKeyLimit
+	}
+	for i, it := range items {
+		results[i] = bulkResult{Key: it.Key, Allowed: reason == "", Remaining: vs[i].Available()}
+		if reason == ReasonGlobalLimit || (reason == ReasonKeyLimit && results[i].Remaining < it.Cost) || overage[i] {
+			results[i].Reason = reason
+		}
+		if reason == "" {
+			core.RecordAdmit(it.Cost)
+		}
+		churn.ObserveRequestCost(it.Key, reason == "", it.Cost)
+	}
+	observeCheck(start, reason == "")
+	return reason == ""
+}
+
+// admit consumes cost units for key from the key's budget and, when enabled, from the
+// global budget. With reserve it also claims a reservation slot. It returns the key's
+// remaining budget and "" on success or the reason for denial; a denied request leaves
+// no budget or slot held. The key's budget is taken through core.Store.ConsumeReport,
+// so remaining is read atomically with the consumption (X-RateLimit-Remaining never
+// reflects a concurrent request that landed in between) and exhausted keys are denied
+// without their gate lock. A key evicted mid-request is denied like an exhausted one
+// (the retry lands on the recreated key). A cost above the key's limit is denied up
+// front with ReasonOverageDisabled.
+func (s *Server) admit(key string, userVSA *vsa.VSA, cost, limit int64, reserve bool) (int64, DenyReason) {
+	if cost > limit {
+		return userVSA.Available(), ReasonOverageDisabled
+	}
+	if reserve && !s.reservations.acquire(key) {
+		return userVSA.Available(), ReasonReservationCap
+	}
+	// The global budget is taken first because it is never committed, so giving it
+	// back on a per-key denial is exact.
+	if s.global != nil && !s.global.TryConsume(cost) {
+		if reserve {
+			s.reservations.releaseSlot(key)
+		}
+		return userVSA.Available(), ReasonGlobalLimit
+	}
+	remaining, err := s.store.ConsumeReport(key, userVSA, cost)
+	if err != nil {
+		if s.global != nil {
+			s.global.TryRefund(cost)
+		}
+		if reserve {
+			s.reservations.releaseSlot(key)
+		}
+		return remaining, ReasonKeyLimit
+	}
+	return remaining, ""
+}
+
+// writeDenied writes a 429 for a request of cost units carrying the denial reason and
+// the key's remaining budget, with a plain or JSON body per ServerOptions.DenyBody.
+// Reservation-cap and overage denials carry no Retry-After: the former clear when the
+// client commits or cancels a reservation, the latter never, so waiting does not help.
+func (s *Server) writeDenied(w http.ResponseWriter, reason DenyReason, cost, remaining, limit int64) {
+	w.Header().Set("X-RateLimit-Reason", string(reason))
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+	msg := "Too Many Requests"
+	var retryAfter int64
+	if reason == ReasonReservationCap {
+		w.Header().Set("X-RateLimit-Status", "ReservationLimit")
+		msg = "Too Many Outstanding Reservations"
+	} else {
+		w.Header().Set("X-RateLimit-Status", "Exceeded")
+		if reason != ReasonOverageDisabled {
+			retryAfter = s.retryAfterSeconds(reason, cost, remaining, limit)
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		}
+	}
+	if s.denyBody == DenyBodyJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_ = json.NewEncoder(w).Encode(deniedResponse{Reason: reason, Remaining: remaining, Limit: limit, RetryAfter: retryAfter})
+		return
+	}
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, _ = w.Write([]byte(msg))
+}
+
+// retryAfterSeconds is the Retry-After for a denied request of cost units: the
+// configured override, else for key-limit denials under a Window the time until the
+// refills of the key's limit cover the shortfall, else DefaultRetryAfter. It is always
+// at least 1.
+func (s *Server) retryAfterSeconds(reason DenyReason, cost, remaining, limit int64) int64 {
+	d := s.retryAfter
+	if d <= 0 {
+		d = DefaultRetryAfter
+		if reason == ReasonKeyLimit && s.window > 0 {
+			d = core.WindowRefillDelay(s.window, limit, cost-remaining)
+		}
+	}
+	return max(1, int64((d+time.Second-1)/time.Second))
+}
+
 // ListenAndServe starts the HTTP server on the specified address.
 // It includes setup for graceful shutdown.
 func (s *Server) ListenAndServe(addr string) error {
@@ -115,6 +562,7 @@ func (s *Server) ListenAndServe(addr string) error {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	httpServer.RegisterOnShutdown(s.CloseStreams)
 
 	fmt.Printf("Rate limiter API server listening on %s\n", addr)
 	return httpServer.ListenAndServe()
@@ -122,16 +570,271 @@ func (s *Server) ListenAndServe(addr string) error {
 
 // handleRelease provides a simple refund (undo) endpoint that attempts to refund
 // 1 unit for the given key. If there is nothing to refund, it is a no-op.
-// Semantics: returns 204 No Content on success or no-op; 400 on missing key.
+// Semantics: returns 204 No Content on success or no-op; 400 on missing key. The
+// X-RateLimit-Refunded (units actually refunded, 0 for a no-op) and
+// X-RateLimit-Remaining headers report the effect, read atomically with the refund
+// (VSA.TryRefundReport).
+//
+// With token=T it cancels that reservation instead: its units are refunded and
+// the key's reservation slot is freed. Unknown tokens return 404.
 func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		s.cancelReservation(w, token)
+		return
+	}
 	key := r.URL.Query().Get("api_key")
 	if key == "" {
 		http.Error(w, "API key is required", http.StatusBadRequest)
 		return
 	}
-	userVSA := s.store.GetOrCreate(key)
-	if userVSA.TryRefund(1) {
-		core.RecordRefund(1)
+	refunded, remaining := s.refundOne(key)
+	w.Header().Set("X-RateLimit-Refunded", fmt.Sprintf("%d", refunded))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReserve tentatively holds n units (default 1) for a key:
+// POST /reserve?api_key=K&n=N. On success it returns 200 with the reservation token
+// in the body and in X-Reservation-Token. The hold must be confirmed via /commit or
+// released via /cancel; with a ReservationTTL, abandoned holds are refunded on expiry.
+func (s *Server) handleReserve(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
 	}
+	key := r.URL.Query().Get("api_key")
+	if key == "" {
+		http.Error(w, "API key is required", http.StatusBadRequest)
+		return
+	}
+	n, ok := parsePositiveInt(r.URL.Query().Get("n"), 1)
+	if !ok {
+		http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	userVSA, limit := s.keyVSA(key)
+	core.RecordAttempt(n)
+	remaining, reason := s.admit(key, userVSA, n, limit, true)
+	if reason != "" {
+		churn.ObserveRequestCost(key, false, n)
+		s.writeDenied(w, reason, n, remaining, limit)
+		return
+	}
+	core.RecordAdmit(n)
+	churn.ObserveRequestCost(key, true, n)
+	token := s.reservations.add(key, n)
+	w.Header().Set("X-Reservation-Token", token)
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+	w.Header().Set("X-RateLimit-Status", "OK")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(token))
+}
+
+// handleCommit confirms a reservation: POST /commit?token=T. The units stay consumed
+// and the token is retired. Returns 204, or 404 for unknown/expired tokens.
+func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.reservations.remove(token); !ok {
+		http.Error(w, "unknown reservation token", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCancel releases a reservation: POST /cancel?token=T refunds its units.
+// Returns 204, or 404 for unknown/expired tokens.
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	s.cancelReservation(w, token)
+}
+
+// cancelReservation retires token and refunds its units. X-RateLimit-Refunded reports
+// the units actually refunded, which is less than the reservation when the key's
+// vector no longer covers it (see refundReservation).
+func (s *Server) cancelReservation(w http.ResponseWriter, token string) {
+	res, ok := s.reservations.remove(token)
+	if !ok {
+		http.Error(w, "unknown reservation token", http.StatusNotFound)
+		return
+	}
+	refunded := s.refundReservation(res)
+	w.Header().Set("X-RateLimit-Refunded", fmt.Sprintf("%d", refunded))
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// refundReservation returns a retired reservation's units to its key, and to the global
+// budget only as many units as the key actually took back (VSA.TryRefundReport clamps
+// to its net vector), so the two budgets stay in step. It returns the units refunded;
+// any shortfall (e.g. the key was evicted and recreated while the hold was open) is
+// added to RefundShortfall.
+func (s *Server) refundReservation(res reservation) int64 {
+	v, _ := s.keyVSA(res.key)
+	ok, refunded, _ := v.TryRefundReport(res.n)
+	if !ok {
+		refunded = 0
+	}
+	if refunded > 0 {
+		core.RecordRefund(refunded)
+		s.store.ClearExhausted(res.key)
+		s.refundGlobal(refunded)
+	}
+	if refunded < res.n {
+		s.refundShortfall.Add(res.n - refunded)
+	}
+	return refunded
+}
+
+// RefundShortfall returns the total reserved units that cancelled or expired
+// reservations could not return to their key, because its vector no longer covered them.
+func (s *Server) RefundShortfall() int64 {
+	return s.refundShortfall.Load()
+}
+
+// refundOne refunds a single unit for key, if it has anything to refund, and returns
+// the units refunded and the key's availability afterwards.
+func (s *Server) refundOne(key string) (refunded, remaining int64) {
+	v, _ := s.keyVSA(key)
+	ok, refunded, remaining := v.TryRefundReport(1)
+	if ok {
+		core.RecordRefund(refunded)
+		s.store.ClearExhausted(key)
+		s.refundGlobal(refunded)
+	}
+	return refunded, remaining
+}
+
+// refundGlobal returns n units to the global budget, if one is configured.
+func (s *Server) refundGlobal(n int64) {
+	if s.global != nil {
+		s.global.TryRefund(n)
+	}
+}
+
+// parsePositiveInt parses a positive integer query value, returning def when raw is empty.
+func parsePositiveInt(raw string, def int64) (int64, bool) {
+	if raw == "" {
+		return def, true
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// requirePost rejects non-POST requests with 405 and reports whether to continue.
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	return requireMethod(w, r, http.MethodPost)
+}
+
+// requireMethod rejects requests not using method with 405 and reports whether to continue.
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// statusResponse is the JSON body returned by /status.
+type statusResponse struct {
+	Scalar    int64 `json:"scalar"`
+	Vector    int64 `json:"vector"`
+	Available int64 `json:"available"`
+}
+
+// handleStatus reports a key's state without consuming or creating it:
+// GET /status?api_key=K returns {"scalar","vector","available"}; 404 if the key is unknown.
+// All three fields come from a single State() snapshot so they are mutually consistent.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	key := r.URL.Query().Get("api_key")
+	if key == "" {
+		http.Error(w, "API key is required", http.StatusBadRequest)
+		return
+	}
+	userVSA, ok := s.store.Get(key)
+	if !ok {
+		http.Error(w, "unknown key", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(snapshot(userVSA))
+}
+
+// handleDrain starts a gradual downgrade of a key:
+// POST /drain?api_key=K&target=T&over=D[&tick=D] lowers the key's scalar to T over
+// duration D via the configured Drainer and returns 202 once the drain has started.
+// It is 404 if the key is not in memory, 400 for invalid parameters or a target not
+// below the current scalar, and 501 without a Drainer.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	if s.drainer == nil {
+		http.Error(w, "drain is not enabled", http.StatusNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	key := q.Get("api_key")
+	if key == "" {
+		http.Error(w, "API key is required", http.StatusBadRequest)
+		return
+	}
+	target, err := strconv.ParseInt(q.Get("target"), 10, 64)
+	if err != nil || target < 0 {
+		http.Error(w, "target must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	over, err := time.ParseDuration(q.Get("over"))
+	if err != nil || over <= 0 {
+		http.Error(w, "over must be a positive duration", http.StatusBadRequest)
+		return
+	}
+	var tick time.Duration
+	if raw := q.Get("tick"); raw != "" {
+		if tick, err = time.ParseDuration(raw); err != nil || tick <= 0 {
+			http.Error(w, "tick must be a positive duration", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, ok := s.store.Get(key); !ok {
+		http.Error(w, "unknown key", http.StatusNotFound)
+		return
+	}
+	if err := s.drainer.DrainToTarget(key, target, over, tick); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// snapshot derives a key's status from a single State() read so the fields are
+// mutually consistent. Available is clamped at 0 like VSA.Available, so an overdrawn
+// key (vector beyond its scalar) reports no budget rather than a negative one.
+func snapshot(v *vsa.VSA) statusResponse {
+	scalar, vector := v.State()
+	available := scalar - vector
+	if vector < 0 {
+		available = scalar + vector
+	}
+	available = max(available, 0)
+	return statusResponse{Scalar: scalar, Vector: vector, Available: available}
+}
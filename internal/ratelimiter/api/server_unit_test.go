@@ -17,9 +17,17 @@
 package api
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 	"vsa/internal/ratelimiter/core"
 )
 
@@ -71,6 +79,9 @@ func TestServer_ReleaseEndpoint_RefundFlow(t *testing.T) {
 	if resp.StatusCode != http.StatusNoContent {
 		t.Fatalf("expected 204 from /release, got %d", resp.StatusCode)
 	}
+	if got, rem := resp.Header.Get("X-RateLimit-Refunded"), resp.Header.Get("X-RateLimit-Remaining"); got != "1" || rem != "1" {
+		t.Fatalf("/release headers refunded=%q remaining=%q, want 1,1", got, rem)
+	}
 	resp.Body.Close()
 
 	// Now one admit should succeed (200)
@@ -94,6 +105,53 @@ func TestServer_ReleaseEndpoint_RefundFlow(t *testing.T) {
 	resp.Body.Close()
 }
 
+// With SetFastReject, a key consumed to zero is denied from its mark without
+// consuming, and a refund clears the mark so the refunded unit can be admitted again.
+func TestServer_ExhaustedFastReject(t *testing.T) {
+	store := core.NewStore(2)
+	store.SetFastReject(true)
+	srv := NewServer(store, 2)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	check := func(want int) {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/check?api_key=k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("/check status=%d want %d", resp.StatusCode, want)
+		}
+	}
+	check(http.StatusOK)
+	if store.Exhausted("k") {
+		t.Fatalf("key marked exhausted with budget left")
+	}
+	check(http.StatusOK)
+	if !store.Exhausted("k") {
+		t.Fatalf("key not marked after reaching zero availability")
+	}
+	check(http.StatusTooManyRequests)
+
+	resp, err := ts.Client().Post(ts.URL+"/release?api_key=k", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if store.Exhausted("k") {
+		t.Fatalf("refund did not clear the mark")
+	}
+	check(http.StatusOK)
+	check(http.StatusTooManyRequests)
+	if v, _ := store.Get("k"); v.Available() != 0 {
+		t.Fatalf("available=%d want 0", v.Available())
+	}
+}
+
 // TestServer_ReleaseEndpoint_MissingKey checks that /release without api_key yields 400.
 func TestServer_ReleaseEndpoint_MissingKey(t *testing.T) {
 	store := core.NewStore(1)
@@ -152,3 +210,623 @@ func TestServer_ListenAndServe_InvalidAddr(t *testing.T) {
 		t.Fatalf("expected ListenAndServe to return an error for invalid addr")
 	}
 }
+
+// TestServer_CheckEndpoint_Cost verifies weighted consumption via ?cost=C and rejects invalid costs.
+func TestServer_CheckEndpoint_Cost(t *testing.T) {
+	store := core.NewStore(10)
+	srv := NewServer(store, 10)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	for _, tc := range []struct {
+		query     string
+		status    int
+		remaining string
+	}{
+		{"cost=7", http.StatusOK, "3"},
+		{"cost=4", http.StatusTooManyRequests, "3"},
+		{"cost=3", http.StatusOK, "0"},
+		{"cost=0", http.StatusBadRequest, ""},
+		{"cost=-2", http.StatusBadRequest, ""},
+		{"cost=abc", http.StatusBadRequest, ""},
+	} {
+		resp, err := client.Get(ts.URL + "/check?api_key=weighted&" + tc.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s: got %d want %d", tc.query, resp.StatusCode, tc.status)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != tc.remaining {
+			t.Fatalf("%s: X-RateLimit-Remaining=%q want %q", tc.query, got, tc.remaining)
+		}
+	}
+}
+
+// TestServer_CheckV1_JSON exercises POST /v1/check: JSON admits, the JSON 429 body,
+// bad bodies and the method guard.
+func TestServer_CheckV1_JSON(t *testing.T) {
+	store := core.NewStore(3)
+	srv := NewServer(store, 3)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	for _, tc := range []struct {
+		body   string
+		status int
+		want   checkResponse
+	}{
+		{`{"key":"json/key?&","cost":2}`, http.StatusOK, checkResponse{Allowed: true, Remaining: 1, Limit: 3}},
+		{`{"key":"json/key?&","cost":2}`, http.StatusTooManyRequests, checkResponse{Remaining: 1, Limit: 3, Reason: ReasonKeyLimit}},
+		{`{"key":"json/key?&"}`, http.StatusOK, checkResponse{Allowed: true, Remaining: 0, Limit: 3}},
+	} {
+		resp, err := client.Post(ts.URL+"/v1/check", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got checkResponse
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tc.body, err)
+		}
+		if resp.StatusCode != tc.status || got != tc.want {
+			t.Fatalf("%s: got %d %+v want %d %+v", tc.body, resp.StatusCode, got, tc.status, tc.want)
+		}
+		if h := resp.Header.Get("X-RateLimit-Remaining"); h != strconv.FormatInt(tc.want.Remaining, 10) {
+			t.Fatalf("%s: X-RateLimit-Remaining=%q", tc.body, h)
+		}
+	}
+	// The key in the body is used verbatim, with no URL decoding.
+	if v, ok := store.Get("json/key?&"); !ok || v.Available() != 0 {
+		t.Fatalf("JSON key not stored verbatim")
+	}
+
+	for _, body := range []string{`not json`, `{"cost":1}`, `{"key":"k","cost":-1}`} {
+		resp, err := client.Post(ts.URL+"/v1/check", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: got %d want 400", body, resp.StatusCode)
+		}
+	}
+	resp, err := client.Get(ts.URL + "/v1/check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /v1/check: got %d want 405", resp.StatusCode)
+	}
+}
+
+// TestServer_APIKeyAuth_KeyBinding verifies that credentials for one key cannot spend
+// or create another: a header/query mismatch and a JSON body naming another key (single
+// or bulk) are rejected with 403 before anything is consumed.
+func TestServer_APIKeyAuth_KeyBinding(t *testing.T) {
+	store := core.NewStore(3)
+	srv := NewServerWithOptions(store, 3, ServerOptions{Middleware: []Middleware{APIKeyAuth(NewKeySet("good", "other"))}})
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	do := func(method, path, apiKey, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, tc := range []struct {
+		method, path, apiKey, body string
+		want                       int
+	}{
+		{http.MethodGet, "/check?api_key=other", "good", "", http.StatusForbidden},
+		{http.MethodGet, "/status?api_key=intruder", "good", "", http.StatusForbidden},
+		{http.MethodPost, "/v1/check", "good", `{"key":"other"}`, http.StatusForbidden},
+		{http.MethodPost, "/v1/bulk-check", "good", `[{"key":"good"},{"key":"other"}]`, http.StatusForbidden},
+		{http.MethodPost, "/v1/check", "", `{"key":"good"}`, http.StatusUnauthorized},
+		{http.MethodGet, "/check?api_key=intruder", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/check?api_key=good", "good", "", http.StatusOK},
+		{http.MethodPost, "/v1/check", "good", `{"key":"good"}`, http.StatusOK},
+		{http.MethodPost, "/v1/bulk-check", "good", `[{"key":"good"}]`, http.StatusOK},
+	} {
+		if got := do(tc.method, tc.path, tc.apiKey, tc.body); got != tc.want {
+			t.Fatalf("%s %s (X-API-Key=%q) %s: got %d want %d", tc.method, tc.path, tc.apiKey, tc.body, got, tc.want)
+		}
+	}
+	if _, ok := store.Get("other"); ok {
+		t.Fatalf("rejected requests must not create the other key")
+	}
+	if v, ok := store.Get("good"); !ok || v.Available() != 0 {
+		t.Fatalf("good should have spent its 3 units")
+	}
+}
+
+// TestServer_BulkCheck covers both POST /v1/bulk-check modes: best effort admits
+// what fits per key, atomic admits all items or none.
+func TestServer_BulkCheck(t *testing.T) {
+	store := core.NewStore(3)
+	srv := NewServer(store, 3)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	post := func(query, body string) (int, []bulkResult) {
+		t.Helper()
+		resp, err := client.Post(ts.URL+"/v1/bulk-check"+query, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var got []bulkResult
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusTooManyRequests {
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("%s: decode: %v", body, err)
+			}
+		}
+		return resp.StatusCode, got
+	}
+
+	code, got := post("", `[{"key":"a","cost":2},{"key":"b","cost":4},{"key":"a"}]`)
+	want := []bulkResult{
+		{Key: "a", Allowed: true, Remaining: 1},
+		{Key: "b", Remaining: 3, Reason: ReasonOverageDisabled}, // 4 exceeds the whole limit of 3
+		{Key: "a", Allowed: true, Remaining: 0},
+	}
+	if code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("best effort: got %d %+v want %+v", code, got, want)
+	}
+
+	// "a" is exhausted, so the atomic request must leave "b" untouched.
+	code, got = post("?atomic=1", `[{"key":"b","cost":2},{"key":"a"}]`)
+	want = []bulkResult{
+		{Key: "b", Remaining: 3},
+		{Key: "a", Remaining: 0, Reason: ReasonKeyLimit},
+	}
+	if code != http.StatusTooManyRequests || !reflect.DeepEqual(got, want) {
+		t.Fatalf("atomic denial: got %d %+v want %+v", code, got, want)
+	}
+	code, got = post("?atomic=1", `[{"key":"b","cost":1},{"key":"c","cost":9}]`)
+	want = []bulkResult{
+		{Key: "b", Remaining: 3},
+		{Key: "c", Remaining: 3, Reason: ReasonOverageDisabled},
+	}
+	if code != http.StatusTooManyRequests || !reflect.DeepEqual(got, want) {
+		t.Fatalf("atomic overage: got %d %+v want %+v", code, got, want)
+	}
+	code, got = post("?atomic=1", `[{"key":"b","cost":2},{"key":"c","cost":3}]`)
+	want = []bulkResult{
+		{Key: "b", Allowed: true, Remaining: 1},
+		{Key: "c", Allowed: true, Remaining: 0},
+	}
+	if code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("atomic admit: got %d %+v want %+v", code, got, want)
+	}
+
+	for _, body := range []string{`{"key":"a"}`, `[]`, `[{"cost":1}]`, `[{"key":"a","cost":-1}]`} {
+		if code, _ := post("", body); code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d want 400", body, code)
+		}
+	}
+}
+
+// TestServer_StatusEndpoint verifies /status reports state without consuming and 404s unknown keys
+// without creating them.
+func TestServer_StatusEndpoint(t *testing.T) {
+	store := core.NewStore(10)
+	srv := NewServer(store, 10)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	resp, err := client.Get(ts.URL + "/status?api_key=ghost")
+	if err != nil {
+		t.Fatalf("status unknown: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown key, got %d", resp.StatusCode)
+	}
+	if _, ok := store.Get("ghost"); ok {
+		t.Fatalf("/status must not create keys")
+	}
+
+	store.GetOrCreate("k").TryConsume(3)
+	for i := 0; i < 2; i++ { // repeated reads must not mutate state
+		resp, err = client.Get(ts.URL + "/status?api_key=k")
+		if err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		var got statusResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		resp.Body.Close()
+		if want := (statusResponse{Scalar: 10, Vector: 3, Available: 7}); got != want {
+			t.Fatalf("status=%+v want %+v", got, want)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("Content-Type=%q", ct)
+		}
+	}
+
+	// An overdrawn key (ungated updates past its scalar) reports 0 available, not a
+	// negative budget.
+	store.GetOrCreate("over").Update(15)
+	resp, err = client.Get(ts.URL + "/status?api_key=over")
+	if err != nil {
+		t.Fatalf("status overdrawn: %v", err)
+	}
+	var over statusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&over); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	resp.Body.Close()
+	if want := (statusResponse{Scalar: 10, Vector: 15, Available: 0}); over != want {
+		t.Fatalf("overdrawn status=%+v want %+v", over, want)
+	}
+
+	resp, err = client.Post(ts.URL+"/status?api_key=k", "", nil)
+	if err != nil {
+		t.Fatalf("POST status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for POST /status, got %d", resp.StatusCode)
+	}
+}
+
+// TestServer_EventsStreamAvailability subscribes to /events, consumes budget, and
+// expects availability events for the initial state and for each change, ending when
+// the client disconnects.
+func TestServer_EventsStreamAvailability(t *testing.T) {
+	store := core.NewStore(10)
+	srv := NewServerWithOptions(store, 10, ServerOptions{EventsInterval: 5 * time.Millisecond})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	if resp, err := ts.Client().Get(ts.URL + "/events"); err != nil {
+		t.Fatalf("events without key: %v", err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without api_key, got %d", resp.StatusCode)
+	}
+
+	store.GetOrCreate("k")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events?api_key=k", nil)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type=%q want text/event-stream", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() statusResponse {
+		t.Helper()
+		for lines.Scan() {
+			data, ok := strings.CutPrefix(lines.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var st statusResponse
+			if err := json.Unmarshal([]byte(data), &st); err != nil {
+				t.Fatalf("decode event %q: %v", data, err)
+			}
+			return st
+		}
+		t.Fatalf("stream ended before the next event: %v", lines.Err())
+		return statusResponse{}
+	}
+
+	if st := next(); st.Available != 10 {
+		t.Fatalf("initial event available=%d want 10", st.Available)
+	}
+	for want := int64(7); want >= 1; want -= 3 {
+		resp, err := ts.Client().Get(ts.URL + "/check?api_key=k&cost=3")
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		resp.Body.Close()
+		if st := next(); st.Available != want || st.Vector != 10-want {
+			t.Fatalf("event after consume = %+v want available=%d", st, want)
+		}
+	}
+
+	cancel() // the stream must end once the client goes away
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "data: ") {
+			t.Fatalf("unexpected event without a budget change: %q", lines.Text())
+		}
+	}
+}
+
+// TestServer_EventsEndOnShutdown verifies that an open /events stream does not hold
+// up http.Server.Shutdown once CloseStreams is registered.
+func TestServer_EventsEndOnShutdown(t *testing.T) {
+	store := core.NewStore(10)
+	store.GetOrCreate("k")
+	srv := NewServerWithOptions(store, 10, ServerOptions{EventsInterval: 5 * time.Millisecond})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewUnstartedServer(mux)
+	ts.Config.RegisterOnShutdown(srv.CloseStreams)
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/events?api_key=k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+		t.Fatalf("no event before shutdown: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := ts.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown with an open stream: %v", err)
+	}
+}
+
+// TestServer_DenyReasons verifies every 429 reports the constraint that denied it via
+// X-RateLimit-Reason, and that a denial holds no budget.
+func TestServer_DenyReasons(t *testing.T) {
+	store := core.NewStore(3)
+	srv := NewServerWithOptions(store, 3, ServerOptions{MaxReservationsPerKey: 1, GlobalLimit: 5})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	do := func(method, path string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	expectDenied := func(resp *http.Response, want DenyReason) {
+		t.Helper()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("status=%d want 429", resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-RateLimit-Reason"); got != string(want) {
+			t.Fatalf("X-RateLimit-Reason=%q want %q", got, want)
+		}
+	}
+
+	// key_limit: "a" exhausts its own budget of 3.
+	if resp := do(http.MethodGet, "/check?api_key=a&cost=3"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first check status=%d", resp.StatusCode)
+	}
+	expectDenied(do(http.MethodGet, "/check?api_key=a"), ReasonKeyLimit)
+
+	// reservation_cap: "b" holds its single reservation slot.
+	resp := do(http.MethodPost, "/reserve?api_key=b")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reserve status=%d", resp.StatusCode)
+	}
+	token := resp.Header.Get("X-Reservation-Token")
+	expectDenied(do(http.MethodPost, "/reserve?api_key=b"), ReasonReservationCap)
+	expectDenied(do(http.MethodGet, "/check?api_key=b&reserve=1"), ReasonReservationCap)
+
+	// global_limit: 4 of the 5 global units are in use, so "c" is denied for cost 2
+	// even though its own budget is untouched.
+	expectDenied(do(http.MethodGet, "/check?api_key=c&cost=2"), ReasonGlobalLimit)
+	if got := store.GetOrCreate("c").Available(); got != 3 {
+		t.Fatalf("global denial consumed key budget: available=%d want 3", got)
+	}
+	expectDenied(do(http.MethodPost, "/reserve?api_key=c&n=2"), ReasonGlobalLimit)
+
+	// Cancelling "b"'s reservation returns its unit to the global budget.
+	if resp := do(http.MethodPost, "/cancel?token="+token); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("cancel status=%d", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/check?api_key=c"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("check after cancel status=%d want 200", resp.StatusCode)
+	}
+
+	// A key-limit denial must not leak global budget: "a" is still exhausted and the
+	// remaining global unit stays available to others.
+	expectDenied(do(http.MethodGet, "/check?api_key=a"), ReasonKeyLimit)
+	resp = do(http.MethodGet, "/check?api_key=d")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("last global unit should admit: status=%d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-RateLimit-Reason"); got != "" {
+		t.Fatalf("admitted response carries a reason: %q", got)
+	}
+
+	// overage_disabled: a cost above the key's whole limit of 3 can never fit, so it is
+	// denied without a Retry-After, ahead of the (now exhausted) global budget.
+	resp = do(http.MethodGet, "/check?api_key=e&cost=4")
+	expectDenied(resp, ReasonOverageDisabled)
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		t.Fatalf("overage denial carries Retry-After=%q", ra)
+	}
+	expectDenied(do(http.MethodPost, "/reserve?api_key=e&n=4"), ReasonOverageDisabled)
+	if got := store.GetOrCreate("e").Available(); got != 3 {
+		t.Fatalf("overage denial consumed key budget: available=%d want 3", got)
+	}
+}
+
+// TestServer_RefundReservation_GlobalFollowsKey verifies that cancelling a reservation
+// returns to the global budget only what the key itself took back.
+func TestServer_RefundReservation_GlobalFollowsKey(t *testing.T) {
+	store := core.NewStore(3)
+	srv := NewServerWithOptions(store, 3, ServerOptions{GlobalLimit: 10})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+
+	post := func(path string) *http.Response {
+		t.Helper()
+		resp, err := client.Post(ts.URL+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	token := post("/reserve?api_key=k&n=2").Header.Get("X-Reservation-Token")
+	if token == "" {
+		t.Fatalf("reserve returned no token")
+	}
+	// The key's vector is committed meanwhile, so its refund clamps to nothing.
+	store.GetOrCreate("k").Commit(2)
+	if resp := post("/cancel?token=" + token); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("cancel status=%d", resp.StatusCode)
+	}
+	if got := srv.global.Available(); got != 8 {
+		t.Fatalf("global available=%d want 8: the key refunded nothing", got)
+	}
+}
+
+// A key evicted between lookup and consume is denied, and its units go back to the
+// stale instance and the global budget; the retry lands on the recreated key.
+func TestServer_AdmitEvictedKey(t *testing.T) {
+	store := core.NewStore(5)
+	srv := NewServerWithOptions(store, 5, ServerOptions{GlobalLimit: 10})
+	v, limit := srv.keyVSA("k")
+	store.Delete("k")
+	if remaining, reason := srv.admit("k", v, 2, limit, false); reason != ReasonKeyLimit || remaining != 5 {
+		t.Fatalf("admit on an evicted key = %d, %q; want 5, %q", remaining, reason, ReasonKeyLimit)
+	}
+	if v.Available() != 5 || srv.global.Available() != 10 {
+		t.Fatalf("denied admit kept units: key=%d global=%d, want 5 and 10", v.Available(), srv.global.Available())
+	}
+	if remaining, _, reason := srv.check(time.Now(), "k", 2, false); reason != "" || remaining != 3 {
+		t.Fatalf("retry = %d, %q; want 3 admitted", remaining, reason)
+	}
+}
+
+// TestServer_ConcurrentRemainingHeaders checks that X-RateLimit-Remaining is read in the
+// same critical section as the consume: with one admit per unit, concurrent callers must
+// each observe a distinct remaining value, never a value shared with (or skipped by) a
+// racing admit.
+func TestServer_ConcurrentRemainingHeaders(t *testing.T) {
+	const limit = 64
+	store := core.NewStore(limit)
+	srv := NewServer(store, limit)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]int)
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/check?api_key=racy", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("want 200, got %d", rec.Code)
+				return
+			}
+			mu.Lock()
+			seen[rec.Header().Get("X-RateLimit-Remaining")]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	for want := 0; want < limit; want++ {
+		if n := seen[strconv.Itoa(want)]; n != 1 {
+			t.Fatalf("X-RateLimit-Remaining=%d reported %d times, want once (seen %v)", want, n, seen)
+		}
+	}
+}
+
+// TestServer_DrainEndpoint starts a drain through POST /drain backed by a core.Worker and
+// checks the error statuses and that the key's scalar reaches the target.
+func TestServer_DrainEndpoint(t *testing.T) {
+	store := core.NewStore(100)
+	worker := core.NewWorker(store, core.NewMockPersister(), 1_000_000, 0, time.Hour, 0, time.Hour, time.Hour)
+	defer worker.Stop()
+	srv := NewServerWithOptions(store, 100, ServerOptions{Drainer: worker})
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	store.GetOrCreate("tenant")
+
+	post := func(query string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain?"+query, nil))
+		return rec.Code
+	}
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"api_key=missing&target=10&over=1s", http.StatusNotFound},
+		{"api_key=tenant&target=100&over=1s", http.StatusBadRequest},
+		{"api_key=tenant&target=-1&over=1s", http.StatusBadRequest},
+		{"api_key=tenant&target=10", http.StatusBadRequest},
+		{"api_key=tenant&target=10&over=1s&tick=0s", http.StatusBadRequest},
+		{"api_key=tenant&target=40&over=50ms&tick=5ms", http.StatusAccepted},
+	} {
+		if got := post(tc.query); got != tc.want {
+			t.Fatalf("POST /drain?%s = %d, want %d", tc.query, got, tc.want)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		v, _ := store.Get("tenant")
+		if s, _ := v.State(); s == 40 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scalar did not reach the drain target")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	NewServer(store, 100).handleDrain(rec, httptest.NewRequest(http.MethodPost, "/drain?api_key=tenant&target=1&over=1s", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("drain without a Drainer = %d, want 501", rec.Code)
+	}
+}
@@ -70,3 +70,57 @@ func itoa(i int) string {
 	}
 	return string(buf[b:])
 }
+
+// Benchmark_VSA_Update_HotKey_Adaptive compares parallel Update throughput on a hot key that
+// stays single-stripe against one the adaptive store policy has upgraded.
+func Benchmark_VSA_Update_HotKey_Adaptive(b *testing.B) {
+	for _, tc := range []struct {
+		name    string
+		upgrade bool
+	}{{"single-stripe", false}, {"upgraded", true}} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := corepkg.NewStoreWithPolicy(1000, vsa.Options{}, corepkg.StripePolicy{Adaptive: true, UpgradeAccesses: 1 << 62})
+			v := s.GetOrCreate("hot")
+			if tc.upgrade {
+				v.Upgrade(0)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					v.Update(1)
+				}
+			})
+		})
+	}
+}
+
+// Benchmark_Store_SaturatedHotKey_Deny measures parallel denials on a hot key at zero
+// availability through Store.ConsumeReport, the API's admit path: with the exact gate
+// (every request takes the VSA's lock) and with the store's exhausted-key fast
+// rejection (Store.SetFastReject).
+func Benchmark_Store_SaturatedHotKey_Deny(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		fast bool
+	}{{"exact", false}, {"fast-reject", true}} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := corepkg.NewStore(1)
+			s.SetFastReject(tc.fast)
+			v := s.GetOrCreate("hot")
+			if _, err := s.ConsumeReport("hot", v, 1); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := s.ConsumeReport("hot", v, 1); err == nil {
+						b.Error("saturated key admitted a request")
+						return
+					}
+				}
+			})
+		})
+	}
+}
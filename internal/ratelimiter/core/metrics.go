@@ -22,6 +22,7 @@ package core
 
 import (
 	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,6 +32,7 @@ var (
 	attempted atomic.Int64
 	admits    atomic.Int64
 	refunds   atomic.Int64
+	writes    atomic.Int64
 
 	// thresholds holds human-readable configuration thresholds captured at runtime.
 	thresholdsMu sync.RWMutex
@@ -58,6 +60,13 @@ func RecordRefund(n int64) {
 	}
 }
 
+// RecordWrites increments the number of commits (rows) successfully handed to the persister.
+func RecordWrites(n int64) {
+	if n > 0 {
+		writes.Add(n)
+	}
+}
+
 // Threshold setters capture important runtime thresholds/config knobs for final printing.
 func SetThreshold(name string, value string) {
 	thresholdsMu.Lock()
@@ -75,6 +84,55 @@ func getEventTotals() (attemptedN, admitsN, refundsN int64) {
 	return attempted.Load(), admits.Load(), refunds.Load()
 }
 
+// writeReduction formats 1 - writes/events as a percentage clamped to [0,100], or "n/a"
+// before any events.
+func writeReduction(writesN, events int64) string {
+	if events <= 0 {
+		return "n/a"
+	}
+	wr := 1.0 - float64(writesN)/float64(events)
+	if wr < 0 {
+		wr = 0
+	}
+	if wr > 1 {
+		wr = 1
+	}
+	return fmt.Sprintf("%.1f%%", wr*100)
+}
+
+// writeReductionLine is the compact running summary printed by StartMetricsLogger.
+func writeReductionLine(now time.Time) string {
+	_, admitsN, refundsN := getEventTotals()
+	writesN := writes.Load()
+	return fmt.Sprintf("[%s] admits=%d refunds=%d writes=%d write_reduction=%s\n",
+		now.Format(time.RFC3339), admitsN, refundsN, writesN, writeReduction(writesN, admitsN+refundsN))
+}
+
+// StartMetricsLogger prints a one-line write-reduction summary (admits, refunds, writes
+// and the reduction over admits+refunds, as in the final summary) to out every
+// interval, so long-running processes show the benefit before shutdown. It returns a
+// function that stops the logger; interval <= 0 starts nothing.
+func StartMetricsLogger(out io.Writer, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				_, _ = io.WriteString(out, writeReductionLine(now))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(done) }) }
+}
+
 // getThresholdSnapshot returns a copy of thresholds for stable iteration/printing.
 func getThresholdSnapshot() map[string]string {
 	thresholdsMu.RLock()
@@ -91,6 +149,7 @@ func resetEventTotals() {
 	attempted.Store(0)
 	admits.Store(0)
 	refunds.Store(0)
+	writes.Store(0)
 	// Do not reset thresholds here; tests may set them explicitly per case.
 }
 
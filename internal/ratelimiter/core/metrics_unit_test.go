@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -118,3 +119,62 @@ func TestFinalMetrics_PrintsThresholds(t *testing.T) {
 		}
 	}
 }
+
+// lockedBuffer is a bytes.Buffer safe for the logger goroutine and the test to share.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestMetricsLogger_ReflectsAccumulatedEvents ensures the periodic summary reports the
+// running admit/refund/write totals and the same write reduction as the final summary,
+// and picks up events recorded after it started.
+func TestMetricsLogger_ReflectsAccumulatedEvents(t *testing.T) {
+	resetEventTotals()
+	defer resetEventTotals()
+
+	RecordAdmit(90)
+	RecordRefund(10)
+	RecordWrites(5)
+
+	var out lockedBuffer
+	stop := StartMetricsLogger(&out, 2*time.Millisecond)
+	defer stop()
+
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("no summary containing %q; output:\n%s", want, out.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor("admits=90 refunds=10 writes=5 write_reduction=95.0%")
+
+	RecordAdmit(100)
+	RecordWrites(15)
+	waitFor("admits=190 refunds=10 writes=20 write_reduction=90.0%")
+
+	stop()
+	stop() // idempotent
+	if got := writeReductionLine(time.Now()); !strings.HasSuffix(got, "\n") {
+		t.Fatalf("summary line must be newline-terminated: %q", got)
+	}
+	if noop := StartMetricsLogger(&out, 0); noop == nil {
+		t.Fatalf("a disabled logger must still return a stop function")
+	}
+}
@@ -26,9 +26,15 @@ import (
 )
 
 // Commit represents a single key and the vector value to be committed.
+//
+// CommitID, when set, is an idempotency key for the commit. The Worker sets it to
+// "<epoch>:<cycle>:<key>" and resubmits a failed batch with the same ids and vectors, so
+// idempotent adapters (e.g. Postgres applied_commits) skip a retry whose first attempt
+// was in fact applied. Adapters generate their own id when it is empty.
 type Commit struct {
-	Key    string
-	Vector int64
+	Key      string
+	Vector   int64
+	CommitID string
 }
 
 // Persister is the interface for any persistent storage implementation.
@@ -131,19 +137,7 @@ func (p *mockPersister) PrintFinalMetrics() {
 	reset := "\x1b[0m"
 	now := time.Now().Format(time.RFC3339)
 
-	var wrPctStr string
-	if events > 0 {
-		wr := 1.0 - float64(totalWrites)/float64(events)
-		if wr < 0 {
-			wr = 0
-		}
-		if wr > 1 {
-			wr = 1
-		}
-		wrPctStr = fmt.Sprintf("%.1f%%", wr*100)
-	} else {
-		wrPctStr = "n/a"
-	}
+	wrPctStr := writeReduction(totalWrites, events)
 
 	// Pretty, columnar output
 	sep := strings.Repeat("-", 60)
@@ -19,12 +19,22 @@
 package core
 
 import (
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
 	"vsa"
 )
 
+// Consume errors, for callers that log or answer denials differently by cause.
+var (
+	// ErrBudgetExhausted: the key's budget cannot cover the requested units.
+	ErrBudgetExhausted = errors.New("core: budget exhausted")
+	// ErrKeyEvicted: the key was evicted while the request was consuming from it, so the
+	// units were not admitted; retrying consumes from the key's fresh instance.
+	ErrKeyEvicted = errors.New("core: key evicted during consume")
+)
+
 // managedVSA is a wrapper around a VSA instance that includes metadata
 // required for managing its lifecycle, like its last access time and
 // hysteresis state used by the background committer.
@@ -41,9 +51,38 @@ import (
 // and optional max-age flushes.
 type managedVSA struct {
 	instance *vsa.VSA
+	// limit is the scalar the key was created with; windowed refills restore toward it.
+	limit int64
 	// lastAccessed stores the last access time in UnixNano to allow atomic access across goroutines.
 	lastAccessed int64
+	// pendingSince is when the key's uncommitted debt started (UnixNano on the store's
+	// clock), 0 while it has none; see markPending and OldestPendingAge.
+	pendingSince int64
 	armed        atomic.Bool
+
+	// heat counts accesses since heatStart (UnixNano); only used by the adaptive stripe policy.
+	heat      atomic.Int64
+	heatStart atomic.Int64
+
+	// exhausted marks a key last seen at zero availability; see Store.SetFastReject.
+	exhausted atomic.Bool
+}
+
+// markPending stamps the start of the key's debt on the first access since it was last
+// clean. Accesses are what precede updates, so this is the time of the first update
+// after a commit, without a write on the hot path while debt is already pending.
+func (m *managedVSA) markPending(now int64) {
+	if atomic.LoadInt64(&m.pendingSince) == 0 {
+		atomic.CompareAndSwapInt64(&m.pendingSince, 0, now)
+	}
+}
+
+// clearExhausted drops the exhausted mark, without writing the shared cache line when
+// it is not set.
+func (m *managedVSA) clearExhausted() {
+	if m.exhausted.Load() {
+		m.exhausted.Store(false)
+	}
 }
 
 // Store manages a collection of VSA instances in memory.
@@ -52,6 +91,33 @@ type Store struct {
 	counters      sync.Map
 	initialScalar int64 // The rate limit value to initialize new VSAs with
 	vsaOptions    vsa.Options
+	stripePolicy  StripePolicy
+	onCreate      func(key string)
+	clock         Clock // nil uses the system clock
+	fastReject    bool  // exhausted-key fast rejection (SetFastReject)
+}
+
+// Clock is the time source for access timestamps and the worker's max-age and
+// eviction decisions, so tests can advance time deterministically instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// StripePolicy decides how many stripes each key's VSA uses.
+//
+// With Adaptive set, every key starts as a lean single-stripe VSA (vsa.Options.SingleStripe:
+// one unpadded counter), which keeps the long tail of cold keys small. A key accessed at
+// least UpgradeAccesses times within one Window is considered contended and is promoted in
+// place to HotStripes padded stripes (vsa.VSA.Upgrade). Promotion keeps the same instance,
+// so scalar, vector and pointers held by callers all stay valid.
+type StripePolicy struct {
+	Adaptive bool
+	// UpgradeAccesses is the access count within Window that marks a key hot. Default 1024.
+	UpgradeAccesses int64
+	// Window is the heat measurement window. Default 100ms.
+	Window time.Duration
+	// HotStripes is the stripe count for upgraded keys. 0 uses the VSA default.
+	HotStripes int
 }
 
 // NewStore creates and initializes a new VSA store.
@@ -69,6 +135,100 @@ func NewStoreWithOptions(initialScalar int64, opts vsa.Options) *Store {
 	}
 }
 
+// NewAdaptiveStore creates a store whose keys start lean and are promoted to striped VSAs
+// once accessed promoteAfter times within the default heat window (see StripePolicy).
+func NewAdaptiveStore(initialScalar, promoteAfter int64) *Store {
+	return NewStoreWithPolicy(initialScalar, vsa.Options{}, StripePolicy{Adaptive: true, UpgradeAccesses: promoteAfter})
+}
+
+// NewStoreWithPolicy creates a store that sizes per-key stripes according to policy.
+// When policy.Adaptive is set, opts.Stripes is ignored: keys start with a single stripe.
+func NewStoreWithPolicy(initialScalar int64, opts vsa.Options, policy StripePolicy) *Store {
+	if policy.Adaptive {
+		opts.Stripes = 1
+		opts.SingleStripe = true
+		if policy.UpgradeAccesses <= 0 {
+			policy.UpgradeAccesses = 1024
+		}
+		if policy.Window <= 0 {
+			policy.Window = 100 * time.Millisecond
+		}
+	}
+	return &Store{
+		initialScalar: initialScalar,
+		vsaOptions:    opts,
+		stripePolicy:  policy,
+	}
+}
+
+// OnCreate registers f to be called once for every key the store creates, by
+// GetOrCreate or Preload, after the key is visible to other callers. It runs on the
+// creating request's goroutine (once per key, not per access), so it should be quick.
+// nil disables the hook. It must be set before the store is shared.
+func (s *Store) OnCreate(f func(key string)) {
+	s.onCreate = f
+}
+
+// SetClock replaces the time source used to stamp key accesses and, through the
+// store, by Worker's max-age and eviction checks. nil (the default) uses the system
+// clock. It must be set before the store is shared.
+func (s *Store) SetClock(c Clock) {
+	s.clock = c
+}
+
+// SetFastReject enables fast rejection of exhausted keys: once the admit path sees a
+// key at zero availability it marks the key (MarkExhausted), and Exhausted then lets
+// later requests be denied without taking the VSA's gate lock. Refunds through the API
+// clear the mark (ClearExhausted), and the Worker drops every mark on each commit
+// cycle and window refill. The mark can only cause denials, never admissions: a mark
+// that outlives the exhaustion (e.g. set by a request racing with a refund, or after
+// availability was raised by a path that does not clear it) lasts at most until the
+// next commit cycle, after which the next request takes the exact path again. Without
+// a running Worker, only ClearExhausted drops marks. Disabled by default. It must be
+// set before the store is shared.
+func (s *Store) SetFastReject(enabled bool) {
+	s.fastReject = enabled
+}
+
+// Exhausted reports whether key is marked exhausted (see SetFastReject). It takes no
+// lock and never creates the key.
+func (s *Store) Exhausted(key string) bool {
+	if !s.fastReject {
+		return false
+	}
+	actual, ok := s.counters.Load(key)
+	return ok && actual.(*managedVSA).exhausted.Load()
+}
+
+// MarkExhausted records that key was just seen at zero availability. It is a no-op
+// when fast rejection is disabled or the key does not exist.
+func (s *Store) MarkExhausted(key string) {
+	if !s.fastReject {
+		return
+	}
+	if actual, ok := s.counters.Load(key); ok {
+		actual.(*managedVSA).exhausted.Store(true)
+	}
+}
+
+// ClearExhausted drops key's exhausted mark, e.g. after a refund made room.
+func (s *Store) ClearExhausted(key string) {
+	if !s.fastReject {
+		return
+	}
+	if actual, ok := s.counters.Load(key); ok {
+		actual.(*managedVSA).clearExhausted()
+	}
+}
+
+// now returns the current time in UnixNano from the store's clock.
+func (s *Store) now() int64 {
+	if s.clock == nil {
+		return time.Now().UnixNano()
+	}
+	return s.clock.Now().UnixNano()
+}
+
 // GetOrCreate returns the VSA instance for a given key.
 // It also updates the lastAccessed timestamp for the instance.
 //
@@ -77,17 +237,35 @@ func NewStoreWithOptions(initialScalar int64, opts vsa.Options) *Store {
 // managedVSA + VSA and attempt a LoadOrStore. In a race where another goroutine
 // creates the key first, the extra allocation is rare and immediately discarded.
 func (s *Store) GetOrCreate(key string) *vsa.VSA {
+	return s.getOrCreate(key, s.initialScalar)
+}
+
+// GetOrCreateWithScalar is GetOrCreate for keys whose limit differs from the store's
+// initial scalar: a newly created key starts at scalar, which is also the limit window
+// refills restore it to (see Worker.SetWindow). An existing key is returned unchanged,
+// so a changed limit only applies once the key is evicted and recreated.
+func (s *Store) GetOrCreateWithScalar(key string, scalar int64) *vsa.VSA {
+	return s.getOrCreate(key, scalar)
+}
+
+func (s *Store) getOrCreate(key string, scalar int64) *vsa.VSA {
 	// Fast path: key already present → no allocations.
 	if actual, ok := s.counters.Load(key); ok {
 		managed := actual.(*managedVSA)
-		atomic.StoreInt64(&managed.lastAccessed, time.Now().UnixNano())
+		now := s.now()
+		atomic.StoreInt64(&managed.lastAccessed, now)
+		managed.markPending(now)
+		if s.stripePolicy.Adaptive {
+			s.observeHeat(managed, now)
+		}
 		return managed.instance
 	}
 
 	// Miss: lazily allocate only now.
-	now := time.Now().UnixNano()
-	inst := vsa.NewWithOptions(s.initialScalar, s.vsaOptions)
-	newManaged := &managedVSA{instance: inst, lastAccessed: now}
+	now := s.now()
+	inst := vsa.NewWithOptions(scalar, s.vsaOptions)
+	newManaged := &managedVSA{instance: inst, limit: scalar, lastAccessed: now, pendingSince: now}
+	newManaged.heatStart.Store(now)
 	// Newly created keys start in the "armed" state so they can commit once they reach the high watermark.
 	newManaged.armed.Store(true)
 
@@ -95,12 +273,146 @@ func (s *Store) GetOrCreate(key string) *vsa.VSA {
 	if actual, loaded := s.counters.LoadOrStore(key, newManaged); loaded {
 		managed := actual.(*managedVSA)
 		atomic.StoreInt64(&managed.lastAccessed, now)
+		managed.markPending(now)
 		return managed.instance
 	}
 	// We stored our new instance.
+	if s.onCreate != nil {
+		s.onCreate(key)
+	}
 	return newManaged.instance
 }
 
+// Consume gets or creates key's VSA (touching it like GetOrCreate) and atomically
+// consumes n units from it. It returns (true, nil) on success and false with
+// ErrBudgetExhausted or ErrKeyEvicted otherwise. Eviction is detected by checking that
+// the key still maps to the same instance after consuming; a request racing with the
+// eviction's final commit may then be denied with its units already persisted, which
+// errs on the side of under-admission.
+func (s *Store) Consume(key string, n int64) (bool, error) {
+	if n <= 0 {
+		return false, errors.New("core: consume amount must be positive")
+	}
+	_, err := s.ConsumeReport(key, s.GetOrCreate(key), n)
+	return err == nil, err
+}
+
+// ConsumeReport is Consume for a caller that already holds key's VSA v (from
+// GetOrCreate or GetOrCreateWithScalar) and needs the remaining budget, read
+// atomically with the consumption (vsa.VSA.TryConsumeReport). A key marked exhausted
+// (SetFastReject) is denied without taking its gate lock, and a consume that leaves
+// the key at zero availability marks it. n must be positive.
+func (s *Store) ConsumeReport(key string, v *vsa.VSA, n int64) (int64, error) {
+	if s.Exhausted(key) {
+		return 0, ErrBudgetExhausted
+	}
+	ok, remaining := v.TryConsumeReport(n)
+	if remaining == 0 {
+		s.MarkExhausted(key)
+	}
+	if !ok {
+		return remaining, ErrBudgetExhausted
+	}
+	if cur, ok := s.counters.Load(key); !ok || cur.(*managedVSA).instance != v {
+		v.TryRefund(n)
+		return v.Available(), ErrKeyEvicted
+	}
+	return remaining, nil
+}
+
+// Preload seeds keys from durably persisted scalars, typically recovered after a
+// restart (e.g. persistence.FilePersister.Recover). Each value is the key's net
+// adjustment in the adapter convention (scalar = scalar - Vector from 0), so the key
+// starts at initialScalar+adjustment. Keys already present are left untouched; call it
+// before serving traffic.
+func (s *Store) Preload(scalars map[string]int64) {
+	now := s.now()
+	for key, adj := range scalars {
+		m := &managedVSA{instance: vsa.NewWithOptions(s.initialScalar+adj, s.vsaOptions), limit: s.initialScalar, lastAccessed: now}
+		m.heatStart.Store(now)
+		m.armed.Store(true)
+		if _, loaded := s.counters.LoadOrStore(key, m); !loaded && s.onCreate != nil {
+			s.onCreate(key)
+		}
+	}
+}
+
+// VSAState is one key's entry in a Store snapshot: its VSA's scalar and uncommitted
+// net vector (vsa.VSA.Snapshot) plus the limit window refills restore it to.
+type VSAState struct {
+	Scalar int64 `json:"scalar"`
+	Vector int64 `json:"vector"`
+	Limit  int64 `json:"limit"`
+}
+
+// Snapshot captures every key's state for backup or for handing in-flight state to
+// another process (see RestoreStore). Each key is read consistently on its own, but
+// keys are visited one at a time while traffic continues, so take it after traffic has
+// stopped (e.g. once the HTTP server has shut down) for a point-in-time copy.
+func (s *Store) Snapshot() map[string]VSAState {
+	out := make(map[string]VSAState)
+	s.ForEach(func(key string, m *managedVSA) {
+		snap := m.instance.Snapshot()
+		out[key] = VSAState{Scalar: snap.Scalar, Vector: snap.Vector, Limit: m.limit}
+	})
+	return out
+}
+
+// RestoreStore rebuilds the keys of snap in s with the store's VSA options, each with
+// the snapshotted scalar, vector and limit (0 means the store's initial scalar), so
+// availability matches the store the snapshot was taken from. Like Preload, keys
+// already present are left untouched; call it before serving traffic.
+func (s *Store) RestoreStore(snap map[string]VSAState) {
+	now := s.now()
+	for key, st := range snap {
+		limit := st.Limit
+		if limit == 0 {
+			limit = s.initialScalar
+		}
+		m := &managedVSA{instance: vsa.NewFromState(st.Scalar, st.Vector, s.vsaOptions), limit: limit, lastAccessed: now}
+		if st.Vector != 0 {
+			m.pendingSince = now
+		}
+		m.heatStart.Store(now)
+		m.armed.Store(true)
+		if _, loaded := s.counters.LoadOrStore(key, m); loaded {
+			m.instance.Close()
+		} else if s.onCreate != nil {
+			s.onCreate(key)
+		}
+	}
+}
+
+// Get returns the VSA instance for key if it exists. Unlike GetOrCreate it never
+// creates a key and does not count as an access (lastAccessed is left untouched),
+// so read-only inspection does not keep idle keys from being evicted.
+func (s *Store) Get(key string) (*vsa.VSA, bool) {
+	actual, ok := s.counters.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return actual.(*managedVSA).instance, true
+}
+
+// observeHeat counts an access toward the key's current window and upgrades the VSA
+// once the window's access count reaches the policy threshold.
+func (s *Store) observeHeat(m *managedVSA, now int64) {
+	if m.instance.StripeCount() > 1 {
+		return // already upgraded
+	}
+	start := m.heatStart.Load()
+	if now-start >= int64(s.stripePolicy.Window) {
+		// Start a new window; a lost CAS means another goroutine already did.
+		if m.heatStart.CompareAndSwap(start, now) {
+			m.heat.Store(0)
+		}
+		return
+	}
+	if m.heat.Add(1) >= s.stripePolicy.UpgradeAccesses {
+		m.instance.Upgrade(s.stripePolicy.HotStripes)
+	}
+}
+
 // ForEach allows iterating over all managed VSA instances in the store.
 func (s *Store) ForEach(f func(key string, v *managedVSA)) {
 	s.counters.Range(func(key, value interface{}) bool {
@@ -109,6 +421,81 @@ func (s *Store) ForEach(f func(key string, v *managedVSA)) {
 	})
 }
 
+// markCommitted restarts key's debt clock after a commit, if key still maps to inst:
+// a key left clean waits for its next access, while a remainder that arrived during
+// the commit is pending from now.
+func (s *Store) markCommitted(key string, inst *vsa.VSA, now int64) {
+	if actual, ok := s.counters.Load(key); ok {
+		if m := actual.(*managedVSA); m.instance == inst {
+			if _, vec := inst.State(); vec == 0 {
+				atomic.StoreInt64(&m.pendingSince, 0)
+			} else {
+				atomic.StoreInt64(&m.pendingSince, now)
+			}
+		}
+	}
+}
+
+// OldestPendingAge returns how long the oldest uncommitted debt has been waiting: the
+// largest time since a key's debt started (its first access after it was last clean)
+// over keys with a non-zero vector, on the store's clock. It is 0 when nothing is
+// pending. Alerting when it exceeds a bound enforces "no pending debt older than X"
+// and catches commits falling behind. It scans every key, and clears the stamp of
+// keys accessed without leaving debt; a key updated through a VSA pointer held since
+// it was clean is counted from the first scan that sees its debt.
+func (s *Store) OldestPendingAge() time.Duration {
+	now := s.now()
+	var oldest int64
+	s.ForEach(func(_ string, m *managedVSA) {
+		since := atomic.LoadInt64(&m.pendingSince)
+		if _, vec := m.instance.State(); vec == 0 {
+			if since != 0 {
+				atomic.CompareAndSwapInt64(&m.pendingSince, since, 0)
+			}
+			return
+		}
+		if since == 0 {
+			atomic.CompareAndSwapInt64(&m.pendingSince, 0, now)
+			since = now
+		}
+		oldest = max(oldest, now-since)
+	})
+	return time.Duration(oldest)
+}
+
+// StoreStats is a point-in-time aggregate over all keys in a Store.
+type StoreStats struct {
+	// TotalKeys is the number of keys currently held.
+	TotalKeys int
+	// SumAbsVector is the sum of |vector| across keys: the pending durable debt
+	// not yet committed to storage.
+	SumAbsVector int64
+	// PendingKeys counts keys with a non-zero vector.
+	PendingKeys int
+	// SumAvailable is the sum of per-key availability (scalar - |vector|, clamped at 0
+	// per key as in VSA.Available).
+	SumAvailable int64
+}
+
+// GetStats aggregates the state of every key. Keys are read one at a time while
+// traffic continues, so the totals are not a consistent snapshot across keys.
+func (s *Store) GetStats() StoreStats {
+	var st StoreStats
+	s.ForEach(func(_ string, m *managedVSA) {
+		scalar, vec := m.instance.State()
+		if vec < 0 {
+			vec = -vec
+		}
+		st.TotalKeys++
+		st.SumAbsVector += vec
+		st.SumAvailable += max(scalar-vec, 0)
+		if vec != 0 {
+			st.PendingKeys++
+		}
+	})
+	return st
+}
+
 // Delete removes a key from the store. This is used by the eviction worker.
 func (s *Store) Delete(key string) {
 	if v, ok := s.counters.LoadAndDelete(key); ok {
@@ -18,6 +18,11 @@
 package core
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -138,3 +143,386 @@ func TestStore_ForEachAndDelete(t *testing.T) {
 		t.Fatalf("expected keys 'a' and 'c' to remain after deletion")
 	}
 }
+
+// TestStore_GetStats seeds known vectors (positive, negative, zero and overdrawn) and
+// checks the aggregates; an overdrawn key adds no availability rather than a negative one.
+func TestStore_GetStats(t *testing.T) {
+	store := NewStore(100)
+	store.GetOrCreate("a").Update(30)
+	store.GetOrCreate("b").Update(-5)
+	_ = store.GetOrCreate("c") // idle: zero vector
+	d := store.GetOrCreate("d")
+	d.Update(10)
+	d.Commit(10) // committed: vector back to zero, scalar 90
+	// ungated past the budget: overdrawn by 50
+	store.GetOrCreate("e").Update(150)
+
+	got := store.GetStats()
+	want := StoreStats{TotalKeys: 5, SumAbsVector: 185, PendingKeys: 3, SumAvailable: 70 + 95 + 100 + 90 + 0}
+	if got != want {
+		t.Fatalf("GetStats()=%+v want %+v", got, want)
+	}
+	if got := NewStore(1).GetStats(); got != (StoreStats{}) {
+		t.Fatalf("empty store GetStats()=%+v want zero", got)
+	}
+}
+
+func TestStore_Preload(t *testing.T) {
+	store := NewStore(100)
+	store.GetOrCreate("live").Update(7)
+	store.Preload(map[string]int64{"a": -40, "b": 5, "live": -90})
+
+	for key, want := range map[string]int64{"a": 60, "b": 105, "live": 93} {
+		v, ok := store.Get(key)
+		if !ok {
+			t.Fatalf("key %q missing after Preload", key)
+		}
+		if got := v.Available(); got != want {
+			t.Fatalf("%s: Available()=%d want %d", key, got, want)
+		}
+	}
+}
+
+// TestStore_SnapshotRestore snapshots a populated store (pending, committed and
+// negative vectors, per-key limits), round-trips it through JSON, restores it into a
+// fresh store and expects the same availability, state and limit for every key.
+func TestStore_SnapshotRestore(t *testing.T) {
+	src := NewStore(100)
+	src.GetOrCreate("pending").Update(30)
+	src.GetOrCreate("refunded").Update(-5)
+	c := src.GetOrCreate("committed")
+	c.Update(40)
+	c.Commit(25)
+	src.GetOrCreateWithScalar("vip", 1000).TryConsume(300)
+	_ = src.GetOrCreate("idle")
+
+	snap := src.Snapshot()
+	if len(snap) != 5 {
+		t.Fatalf("Snapshot has %d keys, want 5", len(snap))
+	}
+	if got, want := snap["committed"], (VSAState{Scalar: 75, Vector: 15, Limit: 100}); got != want {
+		t.Fatalf("snapshot[committed] = %+v, want %+v", got, want)
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded map[string]VSAState
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	dst := NewStoreWithOptions(100, vsa.Options{Stripes: 8})
+	dst.RestoreStore(decoded)
+	src.ForEach(func(key string, m *managedVSA) {
+		v, ok := dst.Get(key)
+		if !ok {
+			t.Fatalf("key %q missing after RestoreStore", key)
+		}
+		if got, want := v.Available(), m.instance.Available(); got != want {
+			t.Fatalf("%s: Available()=%d want %d", key, got, want)
+		}
+		gs, gv := v.State()
+		ws, wv := m.instance.State()
+		if gs != ws || gv != wv {
+			t.Fatalf("%s: State()=(%d,%d) want (%d,%d)", key, gs, gv, ws, wv)
+		}
+		if m2, _ := dst.counters.Load(key); m2.(*managedVSA).limit != m.limit {
+			t.Fatalf("%s: limit=%d want %d", key, m2.(*managedVSA).limit, m.limit)
+		}
+	})
+}
+
+// TestStore_Consume covers the success and exhausted paths: success consumes and
+// touches the key, exhaustion reports ErrBudgetExhausted and leaves the budget intact.
+func TestStore_Consume(t *testing.T) {
+	store := NewStore(5)
+	if ok, err := store.Consume("k", 3); !ok || err != nil {
+		t.Fatalf("Consume(3) = %v, %v; want true, nil", ok, err)
+	}
+	v, ok := store.Get("k")
+	if !ok || v.Available() != 2 {
+		t.Fatalf("key missing or wrong availability after Consume")
+	}
+	if ok, err := store.Consume("k", 3); ok || !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("Consume(3) over budget = %v, %v; want false, ErrBudgetExhausted", ok, err)
+	}
+	if v.Available() != 2 {
+		t.Fatalf("denied Consume changed availability to %d", v.Available())
+	}
+	if ok, err := store.Consume("k", 0); ok || err == nil || errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("Consume(0) = %v, %v; want an invalid-amount error", ok, err)
+	}
+}
+
+// A key evicted between fetching its VSA and consuming is denied with ErrKeyEvicted,
+// and the units go back to the stale instance.
+func TestStore_ConsumeReport_Evicted(t *testing.T) {
+	store := NewStore(5)
+	v := store.GetOrCreate("k")
+	store.Delete("k")
+	if remaining, err := store.ConsumeReport("k", v, 2); !errors.Is(err, ErrKeyEvicted) || remaining != 5 {
+		t.Fatalf("ConsumeReport on an evicted key = %d, %v; want 5, ErrKeyEvicted", remaining, err)
+	}
+	if v.Available() != 5 {
+		t.Fatalf("evicted instance kept the units: available=%d want 5", v.Available())
+	}
+	if remaining, err := store.ConsumeReport("k", store.GetOrCreate("k"), 2); err != nil || remaining != 3 {
+		t.Fatalf("ConsumeReport on the recreated key = %d, %v; want 3, nil", remaining, err)
+	}
+}
+
+// The exhausted mark is dropped by ClearExhausted and by the worker's commit cycle,
+// and is inert when fast rejection is disabled or the key does not exist.
+func TestStore_ExhaustedMark(t *testing.T) {
+	s := NewStore(1)
+	s.GetOrCreate("k")
+	s.MarkExhausted("k")
+	if s.Exhausted("k") {
+		t.Fatalf("mark must be inert while disabled")
+	}
+
+	s.SetFastReject(true)
+	s.MarkExhausted("k")
+	s.MarkExhausted("missing")
+	if !s.Exhausted("k") || s.Exhausted("missing") {
+		t.Fatalf("Exhausted(k)=%v Exhausted(missing)=%v want true,false", s.Exhausted("k"), s.Exhausted("missing"))
+	}
+	s.ClearExhausted("k")
+	if s.Exhausted("k") {
+		t.Fatalf("mark survived ClearExhausted")
+	}
+
+	s.MarkExhausted("k")
+	NewWorker(s, &errPersister{}, 100, 0, time.Hour, 0, time.Hour, time.Hour).runCommitCycle()
+	if s.Exhausted("k") {
+		t.Fatalf("stale mark survived a commit cycle")
+	}
+}
+
+// OldestPendingAge tracks the key whose debt has waited longest since it started (the
+// first update after the key was created or last committed), ignoring keys with
+// nothing pending.
+func TestStore_OldestPendingAge(t *testing.T) {
+	clk := &fakeClock{}
+	clk.Advance(time.Hour)
+	s := NewStore(1000)
+	s.SetClock(clk)
+	w := NewWorker(s, &errPersister{}, 10, 0, time.Hour, 0, time.Hour, time.Hour)
+	if got := s.OldestPendingAge(); got != 0 {
+		t.Fatalf("empty store: age=%v want 0", got)
+	}
+
+	s.GetOrCreate("hot").Update(5) // below the threshold: stays pending
+	clk.Advance(2 * time.Second)
+	s.GetOrCreate("busy").Update(20)
+	w.runCommitCycle() // commits busy only
+	clk.Advance(3 * time.Second)
+
+	if got := s.OldestPendingAge(); got != 5*time.Second {
+		t.Fatalf("age=%v want 5s (hot never committed)", got)
+	}
+	s.GetOrCreate("hot").Update(5)
+	w.runCommitCycle() // hot reaches the threshold
+	if got := s.OldestPendingAge(); got != 0 {
+		t.Fatalf("age=%v want 0 (everything committed)", got)
+	}
+
+	// busy stayed clean for 3s after its commit; its new debt counts from the update.
+	s.GetOrCreate("busy").Update(1)
+	clk.Advance(time.Second)
+	s.GetOrCreate("busy").Update(1)
+	if got := s.OldestPendingAge(); got != time.Second {
+		t.Fatalf("age=%v want 1s (busy's debt since its first update after the commit)", got)
+	}
+
+	// An access that leaves no debt does not start the clock.
+	s.GetOrCreate("idle")
+	s.OldestPendingAge()
+	clk.Advance(time.Minute)
+	s.GetOrCreate("idle").Update(1)
+	if got := s.OldestPendingAge(); got != time.Minute+time.Second {
+		t.Fatalf("age=%v want busy's 1m1s, not idle's creation time", got)
+	}
+	clk.Advance(time.Second)
+	w.runFinalFlush() // commits busy and idle, below the threshold
+	s.GetOrCreate("idle").Update(1)
+	if got := s.OldestPendingAge(); got != 0 {
+		t.Fatalf("age=%v want 0 right after idle's first update", got)
+	}
+}
+
+// TestStore_OnCreate verifies the hook fires once per created key (GetOrCreate and
+// Preload) and not for accesses or preloads of existing keys.
+func TestStore_OnCreate(t *testing.T) {
+	store := NewStore(100)
+	var created []string
+	store.OnCreate(func(key string) { created = append(created, key) })
+
+	store.GetOrCreate("a")
+	store.GetOrCreate("a")
+	store.Preload(map[string]int64{"a": 1, "b": 2})
+	store.GetOrCreate("b")
+	if !reflect.DeepEqual(created, []string{"a", "b"}) {
+		t.Fatalf("OnCreate saw %v, want [a b]", created)
+	}
+}
+
+// TestNewAdaptiveStore_PromotesHotKey drives one hot and many cold keys through an
+// adaptive store: only the hot key is striped, its accounting survives the promotion,
+// and cold keys use the lean single-stripe layout (smaller than a padded single stripe).
+func TestNewAdaptiveStore_PromotesHotKey(t *testing.T) {
+	store := NewAdaptiveStore(100, 50)
+	for i := 0; i < 60; i++ {
+		if !store.GetOrCreate("hot").TryConsume(1) {
+			t.Fatalf("hot key denied at %d", i)
+		}
+	}
+	const cold = 2000
+	for i := 0; i < cold; i++ {
+		store.GetOrCreate("cold:" + strconv.Itoa(i)).Update(1)
+	}
+
+	hot := store.GetOrCreate("hot")
+	if hot.StripeCount() <= 1 {
+		t.Fatalf("hot key not promoted: StripeCount()=%d", hot.StripeCount())
+	}
+	if s, vec := hot.State(); s != 100 || vec != 60 || hot.Available() != 40 {
+		t.Fatalf("hot key after promotion: State()=(%d,%d) Available()=%d", s, vec, hot.Available())
+	}
+	promoted := 0
+	store.ForEach(func(key string, mv *managedVSA) {
+		if mv.instance.StripeCount() > 1 {
+			promoted++
+		}
+	})
+	if promoted != 1 {
+		t.Fatalf("expected exactly one promoted key, got %d", promoted)
+	}
+
+	perKey := func(opts vsa.Options) uint64 {
+		keep := make([]*vsa.VSA, cold)
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for i := range keep {
+			keep[i] = vsa.NewWithOptions(100, opts)
+		}
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(keep)
+		return (after.TotalAlloc - before.TotalAlloc) / cold
+	}
+	if lean, padded := perKey(store.vsaOptions), perKey(vsa.Options{Stripes: 1}); lean >= padded {
+		t.Fatalf("cold keys should be lean: %dB/key vs %dB/key padded", lean, padded)
+	}
+}
+
+// TestStore_AdaptiveStripes_UpgradesOnlyHotKeys creates a large cold key population and one
+// hammered key. Cold keys must stay single-stripe (small per-key footprint) while the hot key
+// is upgraded to multiple stripes.
+func TestStore_AdaptiveStripes_UpgradesOnlyHotKeys(t *testing.T) {
+	const keys = 5000
+	perKeyBytes := func(store *Store) uint64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for i := 0; i < keys; i++ {
+			store.GetOrCreate("cold:" + strconv.Itoa(i)).Update(1)
+		}
+		runtime.ReadMemStats(&after)
+		return (after.TotalAlloc - before.TotalAlloc) / keys
+	}
+	adaptive := NewStoreWithPolicy(1000, vsa.Options{}, StripePolicy{Adaptive: true, UpgradeAccesses: 200, Window: time.Second, HotStripes: 16})
+	adaptiveBytes := perKeyBytes(adaptive)
+	defaultBytes := perKeyBytes(NewStoreWithOptions(1000, vsa.Options{Stripes: 64}))
+	t.Logf("bytes/key: adaptive=%d default(64 stripes)=%d", adaptiveBytes, defaultBytes)
+	if adaptiveBytes*4 > defaultBytes {
+		t.Fatalf("adaptive store should keep cold keys small: adaptive=%dB default=%dB", adaptiveBytes, defaultBytes)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				adaptive.GetOrCreate("hot").Update(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := adaptive.GetOrCreate("hot").StripeCount(); got != 16 {
+		t.Fatalf("hot key StripeCount()=%d want 16", got)
+	}
+	if _, vec := adaptive.GetOrCreate("hot").State(); vec != 800 {
+		t.Fatalf("hot key vector=%d want 800", vec)
+	}
+	upgraded := 0
+	adaptive.ForEach(func(key string, mv *managedVSA) {
+		if mv.instance.StripeCount() > 1 {
+			upgraded++
+		}
+	})
+	if upgraded != 1 {
+		t.Fatalf("expected exactly one upgraded key, got %d", upgraded)
+	}
+}
+
+// TestStore_AdaptiveStripes_UpgradeImprovesThroughput hammers a hot key from every CPU
+// before and after the adaptive policy upgrades it. The upgraded key must never be much
+// slower, and with at least 4 CPUs (where a single stripe's cache line is contended) it
+// must be faster.
+func TestStore_AdaptiveStripes_UpgradeImprovesThroughput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("throughput measurement skipped in -short mode")
+	}
+	const opsPerWorker = 200_000
+	workers := runtime.GOMAXPROCS(0) * 2
+	// opsPerSec returns the best of three parallel Update runs, to damp scheduler noise.
+	opsPerSec := func(v *vsa.VSA) float64 {
+		best := 0.0
+		for round := 0; round < 3; round++ {
+			var wg sync.WaitGroup
+			start := time.Now()
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < opsPerWorker; i++ {
+						v.Update(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if rate := float64(workers*opsPerWorker) / time.Since(start).Seconds(); rate > best {
+				best = rate
+			}
+		}
+		return best
+	}
+
+	policy := StripePolicy{Adaptive: true, UpgradeAccesses: 64, Window: time.Minute, HotStripes: 64}
+	cold := NewStoreWithPolicy(1<<40, vsa.Options{}, policy).GetOrCreate("hot")
+	single := opsPerSec(cold)
+
+	s := NewStoreWithPolicy(1<<40, vsa.Options{}, policy)
+	for i := 0; i < 64; i++ {
+		s.GetOrCreate("hot")
+	}
+	hot := s.GetOrCreate("hot")
+	if got := hot.StripeCount(); got != 64 {
+		t.Fatalf("hot key StripeCount()=%d want 64 after crossing UpgradeAccesses", got)
+	}
+	upgraded := opsPerSec(hot)
+	t.Logf("parallel Update with %d workers: single-stripe=%.0f ops/s upgraded=%.0f ops/s (%.2fx)",
+		workers, single, upgraded, upgraded/single)
+
+	if upgraded < single/2 {
+		t.Fatalf("upgraded key is much slower: %.0f ops/s vs %.0f single-stripe", upgraded, single)
+	}
+	if runtime.NumCPU() >= 4 && upgraded <= single {
+		t.Fatalf("upgrade did not improve contended throughput on %d CPUs: %.0f ops/s vs %.0f single-stripe",
+			runtime.NumCPU(), upgraded, single)
+	}
+}
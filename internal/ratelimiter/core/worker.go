@@ -20,7 +20,12 @@
 package core
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,20 +33,62 @@ import (
 	"vsa/internal/ratelimiter/telemetry/churn"
 )
 
+// ErrDrainTimeout is returned by StopWithTimeout when the background loops (including the
+// final flush) do not exit within the given duration, e.g. because the persister hangs.
+var ErrDrainTimeout = errors.New("worker: drain timed out")
+
 // Worker manages the background tasks for the VSA store, including
-// committing and evicting VSA instances.
+// committing and evicting VSA instances. Key ages for max-age commits and eviction are
+// measured on the store's clock (Store.SetClock); the loops' tickers use real time.
 type Worker struct {
 	store              *Store
 	persister          Persister
 	commitThreshold    int64
+	thresholdFor       ThresholdProvider // nil: commitThreshold for every key
 	lowCommitThreshold int64
 	commitInterval     time.Duration
 	commitMaxAge       time.Duration
+	commitMaxAgeJitter time.Duration
 	evictionAge        time.Duration
 	evictionInterval   time.Duration
+	window             time.Duration
 	stopChan           chan struct{}
 	wg                 sync.WaitGroup
 	stopped            uint32
+
+	// stopMu orders stopping against goroutines joining wg after Start (DrainToTarget):
+	// stopped is set under it, so no wg.Add can race with Stop's wg.Wait.
+	stopMu sync.Mutex
+
+	// Commit ids: "<epoch>:<cycle>:<key>", cycle counting persisted batches.
+	epoch string
+	cycle uint64
+
+	// commitMu serializes commit cycles: the commit loop, FlushNow, and eviction's final
+	// commits share the cycle counter and the pending batch.
+	commitMu sync.Mutex
+
+	// pending is a batch whose CommitBatch failed; it is resubmitted unchanged (same
+	// ids and vectors) before anything else is committed. Guarded by pendingMu, since
+	// eviction must not commit a key with a pending commit.
+	pendingMu sync.Mutex
+	pending   []Commit
+	pendingV  []*vsa.VSA
+
+	onEvict  func(key string, finalVector int64)
+	onCommit func(batch []Commit)
+	evictLog *json.Encoder // nil when SetEvictionLog is unset
+}
+
+// ThresholdProvider returns the commit threshold (high watermark) for key. A value
+// <= 0 falls back to the worker's global threshold.
+type ThresholdProvider func(key string) int64
+
+// EvictionRecord is one line of the eviction log (SetEvictionLog).
+type EvictionRecord struct {
+	Key    string    `json:"key"`
+	Vector int64     `json:"vector"` // the final vector committed on eviction
+	Time   time.Time `json:"time"`   // on the store's clock
 }
 
 // NewWorker creates and configures a new background worker.
@@ -66,6 +113,122 @@ func NewWorker(store *Store, persister Persister, commitThreshold, lowCommitThre
 		evictionAge:        evictionAge,
 		evictionInterval:   evictionInterval,
 		stopChan:           make(chan struct{}),
+		epoch:              strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// SetCommitIDEpoch sets the epoch that namespaces the worker's commit ids. It must differ
+// across process restarts, because the cycle counter restarts at 1 (see
+// persistence.NextFileEpoch); the default derives it from the start time. It must be
+// called before Start.
+func (w *Worker) SetCommitIDEpoch(epoch string) {
+	w.epoch = epoch
+}
+
+// OnEvict registers f to be called after a key has been evicted from the store, with the
+// vector committed for it on the way out (0 if it had none). It runs on the eviction
+// goroutine. nil disables the hook. It must be called before Start.
+func (w *Worker) OnEvict(f func(key string, finalVector int64)) {
+	w.onEvict = f
+}
+
+// SetEvictionLog records every key evicted with a non-zero final vector to out, one
+// JSON EvictionRecord per line, as an audit trail of cold-key churn next to the
+// persister's commit. Records are written after the final commit succeeded and the key
+// was removed, from the eviction goroutine; a write error is logged and does not affect
+// eviction. out is not closed by the worker. nil disables the log. It must be called
+// before Start.
+func (w *Worker) SetEvictionLog(out io.Writer) {
+	w.evictLog = nil
+	if out != nil {
+		w.evictLog = json.NewEncoder(out)
+	}
+}
+
+// OnCommit registers f to be called after each batch has been persisted and folded into
+// the VSAs, including retried batches, the final flush and eviction commits. It runs on
+// the worker goroutine and must not retain or modify batch. nil disables the hook. It
+// must be called before Start.
+func (w *Worker) OnCommit(f func(batch []Commit)) {
+	w.onCommit = f
+}
+
+// commitID returns the id of key's commit within cycle.
+func (w *Worker) commitID(cycle uint64, key string) string {
+	return w.epoch + ":" + strconv.FormatUint(cycle, 10) + ":" + key
+}
+
+// persist stamps commits with the next cycle's ids and writes them. On failure the
+// batch is kept as pending so the next attempt resubmits it verbatim.
+func (w *Worker) persist(commits []Commit, vs []*vsa.VSA) error {
+	w.cycle++
+	for i := range commits {
+		commits[i].CommitID = w.commitID(w.cycle, commits[i].Key)
+	}
+	if err := w.commitBatch(commits); err != nil {
+		w.pendingMu.Lock()
+		w.pending, w.pendingV = commits, vs
+		w.pendingMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// commitBatch hands commits to the persister and records the call's duration (see
+// churn.ObserveCommitLatency) and, on success, the rows written (RecordWrites); the
+// batch size is recorded per successful batch by applyCommitted.
+func (w *Worker) commitBatch(commits []Commit) error {
+	start := time.Now()
+	err := w.persister.CommitBatch(commits)
+	churn.ObserveCommitLatency(time.Since(start))
+	if err == nil {
+		RecordWrites(int64(len(commits)))
+	}
+	return err
+}
+
+// retryPending resubmits a previously failed batch with its original ids and vectors and
+// folds it into the VSAs on success. It returns the error while the batch still fails, in
+// which case nothing else may be committed: later vectors include the pending amounts.
+func (w *Worker) retryPending() error {
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+	if len(w.pending) == 0 {
+		return nil
+	}
+	if err := w.commitBatch(w.pending); err != nil {
+		fmt.Printf("ERROR: Failed to retry commit batch: %v\n", err)
+		churn.ObserveCommitError(1)
+		return err
+	}
+	w.applyCommitted(w.pending, w.pendingV)
+	w.pending, w.pendingV = nil, nil
+	return nil
+}
+
+// hasPending reports whether key has a commit awaiting retry.
+func (w *Worker) hasPending(key string) bool {
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+	for _, c := range w.pending {
+		if c.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// applyCommitted records telemetry for a persisted batch and folds each vector into its VSA.
+func (w *Worker) applyCommitted(commits []Commit, vs []*vsa.VSA) {
+	churn.ObserveBatch(len(commits))
+	now := w.store.now()
+	for i, c := range commits {
+		churn.ObserveCommit(c.Key, c.Vector)
+		vs[i].Commit(c.Vector)
+		w.store.markCommitted(c.Key, vs[i], now)
+	}
+	if w.onCommit != nil {
+		w.onCommit(commits)
 	}
 }
 
@@ -81,11 +244,97 @@ func (w *Worker) Start() {
 		defer w.wg.Done()
 		w.evictionLoop()
 	}()
+	if w.window > 0 {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.windowLoop()
+		}()
+	}
+}
+
+// windowSteps is the number of refills per window: each refill restores 1/windowSteps
+// of the limit, so a fully drained key is back to its limit once a window has elapsed.
+const windowSteps = 10
+
+// windowTick is the interval between refills for window.
+func windowTick(window time.Duration) time.Duration {
+	return max(window/windowSteps, time.Millisecond)
+}
+
+// WindowRefillDelay bounds how long a key takes to regain deficit units when the worker
+// replenishes limit over window (see SetWindow): refills land every window/10 and restore
+// a tenth of the limit each. It returns 0 when window <= 0 or there is nothing to regain.
+func WindowRefillDelay(window time.Duration, limit, deficit int64) time.Duration {
+	if window <= 0 || limit <= 0 || deficit <= 0 {
+		return 0
+	}
+	step := (limit + windowSteps - 1) / windowSteps
+	return time.Duration((deficit+step-1)/step) * windowTick(window)
+}
+
+// SetThresholdProvider lets the commit cycle use a per-key threshold instead of the
+// global one, so hot keys can commit less often (fewer writes) and cold keys sooner. It
+// is consulted once per key per cycle and must be cheap and safe for concurrent use;
+// keys for which it returns <= 0 use the global threshold. The low watermark
+// (hysteresis) stays global. nil (the default) restores the global threshold for every
+// key. It must be called before Start.
+func (w *Worker) SetThresholdProvider(p ThresholdProvider) {
+	w.thresholdFor = p
+}
+
+// thresholdOf returns key's effective commit threshold (see SetThresholdProvider).
+func (w *Worker) thresholdOf(key string) int64 {
+	if w.thresholdFor != nil {
+		if t := w.thresholdFor(key); t > 0 {
+			return t
+		}
+	}
+	return w.commitThreshold
+}
+
+// SetWindow turns the budget into a sliding window: every key's availability is
+// replenished toward its limit (the scalar it was created with) in steps, recovering the
+// full limit over each window (e.g. 1m for a per-minute limit). Replenishment is
+// in-memory via VSA.RaiseScalar and never pushes availability above the limit, which
+// also undoes reductions made by DrainToTarget. 0 (the default) keeps the plain budget
+// that only replenishes via refunds. It must be called before Start.
+func (w *Worker) SetWindow(window time.Duration) {
+	w.window = window
+}
+
+// SetCommitMaxAgeJitter spreads age-based commits: each key's effective max-age becomes
+// commitMaxAge ± jitter, scaled by a fraction derived from a hash of the key, so keys
+// that went idle together are flushed over several cycles instead of one large batch.
+// The offset is deterministic per key. jitter is capped at commitMaxAge/2 so no key's
+// max-age drops below half the configured value; 0 (the default) disables jitter. It
+// must be called before Start.
+func (w *Worker) SetCommitMaxAgeJitter(jitter time.Duration) {
+	w.commitMaxAgeJitter = min(max(jitter, 0), w.commitMaxAge/2)
+}
+
+// maxAgeFor returns key's effective commit max-age (see SetCommitMaxAgeJitter).
+func (w *Worker) maxAgeFor(key string) time.Duration {
+	if w.commitMaxAgeJitter <= 0 {
+		return w.commitMaxAge
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	// FNV's high bits barely change across similar keys ("k1", "k2", ...): finalize
+	// with the murmur3 mixer, then map to [-1, 1).
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	f := float64(x>>11)/float64(1<<52) - 1
+	return w.commitMaxAge + time.Duration(f*float64(w.commitMaxAgeJitter))
 }
 
 // Stop gracefully stops the background worker.
 func (w *Worker) Stop() {
-	if !atomic.CompareAndSwapUint32(&w.stopped, 0, 1) {
+	if !w.markStopped() {
 		return
 	}
 	fmt.Println("Stopping background worker...")
@@ -93,6 +342,114 @@ func (w *Worker) Stop() {
 	w.wg.Wait()
 }
 
+// StopWithTimeout is Stop with a bound: it signals the loops to stop (triggering the
+// final flush) and waits at most d for them to exit. On timeout it returns
+// ErrDrainTimeout; the loops are left to finish in the background and pending vectors
+// that were not flushed may be lost. Calling it on a stopped worker returns nil.
+func (w *Worker) StopWithTimeout(d time.Duration) error {
+	if !w.markStopped() {
+		return nil
+	}
+	fmt.Println("Stopping background worker...")
+	close(w.stopChan)
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-t.C:
+		return ErrDrainTimeout
+	}
+}
+
+// markStopped flags the worker as stopped, reporting false if it already was. Once it
+// returns, no new goroutine can join wg, so waiting on it is safe.
+func (w *Worker) markStopped() bool {
+	w.stopMu.Lock()
+	defer w.stopMu.Unlock()
+	return atomic.CompareAndSwapUint32(&w.stopped, 0, 1)
+}
+
+// DrainToTarget gradually lowers key's scalar to target over roughly the given duration,
+// stepping every tick (default 100ms when tick <= 0), so in-flight clients see availability
+// degrade smoothly instead of snapping. Each step uses VSA.LowerScalar, so availability
+// never drops below target and never goes negative: while admitted units exceed the next
+// step, the drain pauses until commits or refunds make room and may overrun the duration.
+//
+// The drain runs on the worker's goroutine group and ends when the target is reached, the
+// key is evicted, or the worker stops. The reduction is in-memory only.
+func (w *Worker) DrainToTarget(key string, target int64, over, tick time.Duration) error {
+	if over <= 0 {
+		return errors.New("drain duration must be positive")
+	}
+	if tick <= 0 {
+		tick = 100 * time.Millisecond
+	}
+	inst, ok := w.store.Get(key)
+	if !ok {
+		return fmt.Errorf("drain: unknown key %q", key)
+	}
+	scalar, _ := inst.State()
+	if target >= scalar {
+		return fmt.Errorf("drain: target %d must be lower than current scalar %d", target, scalar)
+	}
+	steps := int64(over / tick)
+	if steps < 1 {
+		steps = 1
+	}
+	step := (scalar - target + steps - 1) / steps
+
+	w.stopMu.Lock()
+	defer w.stopMu.Unlock()
+	if atomic.LoadUint32(&w.stopped) == 1 {
+		return errors.New("drain: worker is stopped")
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if cur, ok := w.store.Get(key); !ok || cur != inst {
+					return // evicted (or replaced); the new instance starts from its own budget
+				}
+				if inst.LowerScalar(step, target) <= target {
+					return
+				}
+			case <-w.stopChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// windowLoop periodically replenishes every key's budget while a window is configured.
+func (w *Worker) windowLoop() {
+	tick := windowTick(w.window)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.store.ForEach(func(_ string, v *managedVSA) {
+				v.instance.RaiseScalar((v.limit+windowSteps-1)/windowSteps, v.limit)
+				v.clearExhausted()
+			})
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
 // commitLoop periodically checks for and persists VSA instances that have
 // crossed the commit threshold.
 func (w *Worker) commitLoop() {
@@ -113,11 +470,15 @@ func (w *Worker) commitLoop() {
 
 // runCommitCycle collects all necessary commits and persists them as a batch.
 func (w *Worker) runCommitCycle() {
+	w.commitMu.Lock()
+	defer w.commitMu.Unlock()
+	if w.retryPending() != nil {
+		return
+	}
 	var commits []Commit
 	var vsaToCommit []*vsa.VSA
-	var vectorsToCommit []int64
 
-	now := time.Now()
+	now := time.Unix(0, w.store.now())
 	w.store.ForEach(func(key string, v *managedVSA) {
 		// Decide based on thresholds (with hysteresis) and optional max-age freshness.
 		_, vec := v.instance.State()
@@ -126,10 +487,10 @@ func (w *Worker) runCommitCycle() {
 			absVec = -absVec
 		}
 		// High watermark check
-		commitByThreshold := absVec >= w.commitThreshold
+		commitByThreshold := absVec >= w.thresholdOf(key)
 		// Max-age: commit if no recent changes and there is a remainder
 		last := atomic.LoadInt64(&v.lastAccessed)
-		commitByMaxAge := w.commitMaxAge > 0 && vec != 0 && now.Sub(time.Unix(0, last)) >= w.commitMaxAge
+		commitByMaxAge := w.commitMaxAge > 0 && vec != 0 && now.Sub(time.Unix(0, last)) >= w.maxAgeFor(key)
 
 		shouldCommit := false
 		if commitByThreshold {
@@ -146,10 +507,11 @@ func (w *Worker) runCommitCycle() {
 			shouldCommit = true
 		}
 
+		// Drop any exhausted mark, bounding a stale one to one cycle (Store.SetFastReject).
+		v.clearExhausted()
 		if shouldCommit {
 			commits = append(commits, Commit{Key: key, Vector: vec})
 			vsaToCommit = append(vsaToCommit, v.instance)
-			vectorsToCommit = append(vectorsToCommit, vec)
 			// Disarm to enforce low watermark before the next threshold-based commit
 			v.armed.Store(false)
 		}
@@ -159,61 +521,63 @@ func (w *Worker) runCommitCycle() {
 		return
 	}
 
-	// Persist the batch of commits.
-	err := w.persister.CommitBatch(commits)
-	if err != nil {
+	// Persist the batch of commits; a failed batch is retried verbatim next cycle.
+	if err := w.persist(commits, vsaToCommit); err != nil {
 		fmt.Printf("ERROR: Failed to commit batch: %v\n", err)
 		// First-class KPI: record commit error
 		churn.ObserveCommitError(1)
-		// In a real system, you would have retry logic here.
 		return
 	}
 
-	// Telemetry: record batch size and per-key vectors
-	churn.ObserveBatch(len(commits))
-	for _, c := range commits {
-		churn.ObserveCommit(c.Key, c.Vector)
-	}
+	// On successful persistence, record telemetry and update each VSA's internal state.
+	w.applyCommitted(commits, vsaToCommit)
+}
 
-	// On successful persistence, update the internal state of each VSA.
-	for i := range vsaToCommit {
-		vsaToCommit[i].Commit(vectorsToCommit[i])
-	}
+// FlushNow synchronously commits every non-zero vector regardless of thresholds, like
+// the final flush on Stop but without stopping the worker (e.g. before a deploy). It is
+// serialized with the commit loop and returns the persister's error; a failed batch
+// stays pending and is retried by the next cycle as usual.
+func (w *Worker) FlushNow() error {
+	return w.flushAll()
 }
 
 // runFinalFlush commits any non-zero vectors regardless of threshold. It is intended for shutdown.
 func (w *Worker) runFinalFlush() {
+	if err := w.flushAll(); err != nil {
+		fmt.Printf("ERROR: Failed to commit final batch: %v\n", err)
+	}
+}
+
+// flushAll commits every non-zero vector, after any pending batch, and returns the
+// persister's error.
+func (w *Worker) flushAll() error {
+	w.commitMu.Lock()
+	defer w.commitMu.Unlock()
+	if err := w.retryPending(); err != nil {
+		return err
+	}
 	var commits []Commit
 	var vsaToCommit []*vsa.VSA
-	var vectorsToCommit []int64
 
 	w.store.ForEach(func(key string, v *managedVSA) {
 		_, vector := v.instance.State()
 		if vector != 0 {
 			commits = append(commits, Commit{Key: key, Vector: vector})
 			vsaToCommit = append(vsaToCommit, v.instance)
-			vectorsToCommit = append(vectorsToCommit, vector)
 		}
 	})
 
 	if len(commits) == 0 {
-		return
+		return nil
 	}
 
-	if err := w.persister.CommitBatch(commits); err != nil {
-		fmt.Printf("ERROR: Failed to commit final batch: %v\n", err)
-		// First-class KPI: record commit error on final flush
+	if err := w.persist(commits, vsaToCommit); err != nil {
+		// First-class KPI: record commit error on flush
 		churn.ObserveCommitError(1)
-		return
-	}
-	// Telemetry: record batch size and per-key vectors for final flush
-	churn.ObserveBatch(len(commits))
-	for _, c := range commits {
-		churn.ObserveCommit(c.Key, c.Vector)
-	}
-	for i := range vsaToCommit {
-		vsaToCommit[i].Commit(vectorsToCommit[i])
+		return err
 	}
+	w.applyCommitted(commits, vsaToCommit)
+	return nil
 }
 
 // evictionLoop periodically removes old, unused VSA instances from memory.
@@ -234,7 +598,7 @@ func (w *Worker) evictionLoop() {
 // runEvictionCycle finds and removes stale VSA instances.
 func (w *Worker) runEvictionCycle() {
 	var keysToEvict []string
-	now := time.Now()
+	now := time.Unix(0, w.store.now())
 
 	w.store.ForEach(func(key string, v *managedVSA) {
 		last := atomic.LoadInt64(&v.lastAccessed)
@@ -247,26 +611,60 @@ func (w *Worker) runEvictionCycle() {
 		return
 	}
 
+	// Final commits share the commit loop's ids and pending batch, so they run under
+	// commitMu after any pending batch; while that still fails, keys with a vector stay.
+	// A retried final commit still counts toward its key's final vector.
+	w.commitMu.Lock()
+	defer w.commitMu.Unlock()
+	retried := make(map[string]int64)
+	w.pendingMu.Lock()
+	for _, c := range w.pending {
+		retried[c.Key] += c.Vector
+	}
+	w.pendingMu.Unlock()
+	canCommit := w.retryPending() == nil
+	if !canCommit {
+		clear(retried)
+	}
+
 	fmt.Printf("Evicting %d stale VSA instances...\n", len(keysToEvict))
 	for _, key := range keysToEvict {
 		// Before evicting, do a final commit if needed and re-check staleness.
 		if vsaInstance, ok := w.store.counters.Load(key); ok {
 			managed := vsaInstance.(*managedVSA)
 			last := atomic.LoadInt64(&managed.lastAccessed)
-			if time.Since(time.Unix(0, last)) <= w.evictionAge {
-				// Touched recently; skip eviction.
+			if w.store.now()-last <= int64(w.evictionAge) || w.hasPending(key) {
+				// Touched recently, or a failed commit awaits its retry; skip eviction.
 				continue
 			}
 			_, vector := managed.instance.State()
 			if vector != 0 {
+				if !canCommit {
+					continue
+				}
 				fmt.Printf("  - Final commit for %s, vector: %d\n", key, vector)
-				if err := w.persister.CommitBatch([]Commit{{Key: key, Vector: vector}}); err != nil {
+				batch := []Commit{{Key: key, Vector: vector}}
+				vs := []*vsa.VSA{managed.instance}
+				if err := w.persist(batch, vs); err != nil {
+					// Kept as pending: the next cycle retries it and this key stays until then.
 					fmt.Printf("ERROR: Failed to commit batch: %v\n", err)
+					churn.ObserveCommitError(1)
+					canCommit = false
 					continue
 				}
-				managed.instance.Commit(vector)
+				w.applyCommitted(batch, vs)
 			}
+			vector += retried[key]
 			w.store.Delete(key)
+			if w.evictLog != nil && vector != 0 {
+				rec := EvictionRecord{Key: key, Vector: vector, Time: time.Unix(0, w.store.now()).UTC()}
+				if err := w.evictLog.Encode(rec); err != nil {
+					fmt.Printf("ERROR: Failed to write eviction log: %v\n", err)
+				}
+			}
+			if w.onEvict != nil {
+				w.onEvict(key, vector)
+			}
 		}
 	}
 }
@@ -18,10 +18,18 @@
 package core
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"reflect"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"vsa/internal/ratelimiter/telemetry/churn"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // errPersister can be toggled to return an error for CommitBatch to test error paths.
@@ -81,6 +89,51 @@ func TestWorker_Hysteresis_DisarmAndRearm(t *testing.T) {
 	}
 }
 
+// TestWorker_ThresholdProvider verifies that a per-key threshold decides each key's
+// commit: with the same vector, the hot key (larger threshold) keeps accumulating while
+// the cold key commits; keys the provider does not know use the global threshold.
+func TestWorker_ThresholdProvider(t *testing.T) {
+	store := NewStore(100)
+	p := &errPersister{}
+	w := NewWorker(store, p, 5, 0, time.Hour, 0, time.Hour, time.Hour)
+	w.SetThresholdProvider(func(key string) int64 {
+		switch key {
+		case "hot":
+			return 20
+		case "cold":
+			return 2
+		}
+		return 0
+	})
+
+	for _, k := range []string{"hot", "cold", "plain"} {
+		v := store.GetOrCreate(k)
+		for i := 0; i < 5; i++ {
+			v.Update(1)
+		}
+	}
+	w.runCommitCycle()
+	if len(p.batches) != 1 {
+		t.Fatalf("expected one batch, got %#v", p.batches)
+	}
+	got := map[string]int64{}
+	for _, c := range p.batches[0] {
+		got[c.Key] = c.Vector
+	}
+	if want := map[string]int64{"cold": 5, "plain": 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("committed %v; want %v (hot stays below its threshold)", got, want)
+	}
+
+	hot := store.GetOrCreate("hot")
+	for i := 0; i < 15; i++ {
+		hot.Update(1)
+	}
+	w.runCommitCycle()
+	if len(p.batches) != 2 || len(p.batches[1]) != 1 || p.batches[1][0].Key != "hot" || p.batches[1][0].Vector != 20 {
+		t.Fatalf("expected hot to commit 20 at its threshold, got %#v", p.batches)
+	}
+}
+
 // TestWorker_MaxAgeCommit verifies that a small non-zero remainder below threshold
 // is committed when it exceeds commitMaxAge without recent activity.
 func TestWorker_MaxAgeCommit(t *testing.T) {
@@ -102,6 +155,229 @@ func TestWorker_MaxAgeCommit(t *testing.T) {
 	}
 }
 
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct{ ns atomic.Int64 }
+
+func (c *fakeClock) Now() time.Time          { return time.Unix(0, c.ns.Load()) }
+func (c *fakeClock) Advance(d time.Duration) { c.ns.Add(int64(d)) }
+
+// TestWorker_FakeClock_MaxAgeAndEviction drives max-age commits and eviction with a
+// fake clock: nothing happens until the clock passes each bound, with no sleeps.
+func TestWorker_FakeClock_MaxAgeAndEviction(t *testing.T) {
+	clock := &fakeClock{}
+	clock.ns.Store(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	store := NewStore(100)
+	store.SetClock(clock)
+	p := &errPersister{}
+	w := NewWorker(store, p, 1000, 0, time.Hour, time.Minute, 10*time.Minute, time.Hour)
+
+	store.GetOrCreate("idle").Update(3)
+	clock.Advance(time.Minute - time.Nanosecond)
+	w.runCommitCycle()
+	if len(p.batches) != 0 {
+		t.Fatalf("committed before max-age elapsed: %#v", p.batches)
+	}
+	clock.Advance(time.Nanosecond)
+	w.runCommitCycle()
+	if len(p.batches) != 1 || !reflect.DeepEqual(p.batches[0], []Commit{{Key: "idle", Vector: 3, CommitID: p.batches[0][0].CommitID}}) {
+		t.Fatalf("expected one max-age commit of idle=3, got %#v", p.batches)
+	}
+
+	store.GetOrCreate("idle") // touch: resets the eviction age
+	clock.Advance(10 * time.Minute)
+	w.runEvictionCycle()
+	if _, ok := store.Get("idle"); !ok {
+		t.Fatal("evicted at exactly eviction_age")
+	}
+	clock.Advance(time.Nanosecond)
+	w.runEvictionCycle()
+	if _, ok := store.Get("idle"); ok {
+		t.Fatal("expected idle key to be evicted once past eviction_age")
+	}
+}
+
+// TestWorker_EvictionLog verifies that a key evicted with a non-zero vector is recorded
+// with its final vector and eviction time, and that zero-vector evictions are not.
+func TestWorker_EvictionLog(t *testing.T) {
+	clock := &fakeClock{}
+	clock.ns.Store(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	store := NewStore(100)
+	store.SetClock(clock)
+	p := &errPersister{}
+	w := NewWorker(store, p, 1000, 0, time.Hour, 0, time.Minute, time.Hour)
+	var out bytes.Buffer
+	w.SetEvictionLog(&out)
+
+	store.GetOrCreate("cold").Update(4)
+	store.GetOrCreate("idle")
+	clock.Advance(2 * time.Minute)
+	w.runEvictionCycle()
+
+	var recs []EvictionRecord
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r EvictionRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("decode eviction log: %v", err)
+		}
+		recs = append(recs, r)
+	}
+	want := []EvictionRecord{{Key: "cold", Vector: 4, Time: clock.Now().UTC()}}
+	if !reflect.DeepEqual(recs, want) {
+		t.Fatalf("eviction log = %+v, want %+v", recs, want)
+	}
+}
+
+// TestWorker_EvictionCommitIDs verifies that eviction's final commits take ids from the
+// commit cycle like regular batches, and that a failed one stays pending: the key is
+// kept and the retry resubmits the same id before the key is evicted.
+func TestWorker_EvictionCommitIDs(t *testing.T) {
+	clock := &fakeClock{}
+	clock.ns.Store(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	store := NewStore(100)
+	store.SetClock(clock)
+	p := &errPersister{}
+	w := NewWorker(store, p, 1, 0, time.Hour, 0, time.Minute, time.Hour)
+
+	store.GetOrCreate("hot").Update(2)
+	w.runCommitCycle()
+	store.GetOrCreate("cold").Update(4)
+	store.GetOrCreate("idle")
+	clock.Advance(2 * time.Minute)
+
+	p.returnErr.Store(true)
+	w.runEvictionCycle()
+	if _, ok := store.Get("cold"); !ok {
+		t.Fatal("evicted cold although its final commit failed")
+	}
+	if _, ok := store.Get("idle"); ok {
+		t.Fatal("a failed final commit kept a zero-vector key from being evicted")
+	}
+
+	p.returnErr.Store(false)
+	w.runEvictionCycle()
+	if _, ok := store.Get("cold"); ok {
+		t.Fatal("expected cold to be evicted once its final commit was persisted")
+	}
+	if len(p.batches) != 2 {
+		t.Fatalf("batches = %#v, want the regular commit and the retried final commit", p.batches)
+	}
+	regular, final := p.batches[0][0], p.batches[1][0]
+	if final.Key != "cold" || final.Vector != 4 || final.CommitID == "" || final.CommitID == regular.CommitID {
+		t.Fatalf("final commit = %+v after regular %+v; want cold=4 with its own id", final, regular)
+	}
+	if want := w.commitID(2, "cold"); final.CommitID != want {
+		t.Fatalf("final commit id %q, want the next cycle's %q", final.CommitID, want)
+	}
+}
+
+// blockingPersister blocks every CommitBatch until release is closed.
+type blockingPersister struct {
+	release chan struct{}
+	calls   atomic.Int64
+}
+
+func (p *blockingPersister) PrintFinalMetrics() {}
+
+func (p *blockingPersister) CommitBatch(commits []Commit) error {
+	p.calls.Add(1)
+	<-p.release
+	return nil
+}
+
+// TestWorker_StopWithTimeout_HungPersister verifies that a hanging final flush makes
+// StopWithTimeout return ErrDrainTimeout instead of blocking, and that a healthy drain
+// returns nil.
+func TestWorker_StopWithTimeout_HungPersister(t *testing.T) {
+	store := NewStore(100)
+	p := &blockingPersister{release: make(chan struct{})}
+	w := NewWorker(store, p, 1000, 0, time.Hour, 0, time.Hour, time.Hour)
+	store.GetOrCreate("k").Update(3)
+	w.Start()
+
+	start := time.Now()
+	if err := w.StopWithTimeout(50 * time.Millisecond); !errors.Is(err, ErrDrainTimeout) {
+		t.Fatalf("StopWithTimeout err=%v want ErrDrainTimeout", err)
+	}
+	if el := time.Since(start); el > time.Second {
+		t.Fatalf("StopWithTimeout took %v; the timeout did not fire", el)
+	}
+	if p.calls.Load() != 1 {
+		t.Fatalf("final flush should have reached the persister, calls=%d", p.calls.Load())
+	}
+	if err := w.StopWithTimeout(time.Millisecond); err != nil {
+		t.Fatalf("second StopWithTimeout err=%v want nil", err)
+	}
+	// Unblock the persister: the loops finish and the flush is applied.
+	close(p.release)
+	w.wg.Wait()
+	if _, vec := store.GetOrCreate("k").State(); vec != 0 {
+		t.Fatalf("vector=%d after the delayed flush, want 0", vec)
+	}
+
+	healthy := NewWorker(NewStore(100), &errPersister{}, 1000, 0, time.Hour, 0, time.Hour, time.Hour)
+	healthy.Start()
+	if err := healthy.StopWithTimeout(time.Second); err != nil {
+		t.Fatalf("healthy StopWithTimeout err=%v", err)
+	}
+}
+
+// TestWorker_MaxAgeJitter_SpreadsCommits idles many keys at the same instant and ages
+// them step by step: without jitter they all flush in one batch, with jitter the
+// age-based commits are spread over several cycles.
+func TestWorker_MaxAgeJitter_SpreadsCommits(t *testing.T) {
+	const keys = 200
+	const maxAge = 100 * time.Millisecond
+	run := func(jitter time.Duration) [][]Commit {
+		store := NewStore(1000)
+		p := &errPersister{}
+		w := NewWorker(store, p, 1000, 0, time.Hour, maxAge, time.Hour, time.Hour)
+		w.SetCommitMaxAgeJitter(jitter)
+		for i := 0; i < keys; i++ {
+			store.GetOrCreate("k" + strconv.Itoa(i)).Update(1)
+		}
+		// Age every key to maxAge-jitter, then in 10ms steps past maxAge+jitter.
+		for age := maxAge - 50*time.Millisecond; age <= maxAge+60*time.Millisecond; age += 10 * time.Millisecond {
+			last := time.Now().Add(-age).UnixNano()
+			store.ForEach(func(_ string, mv *managedVSA) {
+				atomic.StoreInt64(&mv.lastAccessed, last)
+			})
+			w.runCommitCycle()
+		}
+		total := 0
+		for _, b := range p.batches {
+			total += len(b)
+		}
+		if total != keys {
+			t.Fatalf("jitter=%v: committed %d keys, want %d", jitter, total, keys)
+		}
+		return p.batches
+	}
+
+	if b := run(0); len(b) != 1 {
+		t.Fatalf("without jitter expected a single batch, got %d", len(b))
+	}
+	batches := run(40 * time.Millisecond)
+	largest := 0
+	for _, b := range batches {
+		largest = max(largest, len(b))
+	}
+	if len(batches) < 5 || largest > keys/2 {
+		t.Fatalf("with jitter expected commits spread over cycles: batches=%d largest=%d", len(batches), largest)
+	}
+
+	// The effective max-age is deterministic per key and within the capped range.
+	w := NewWorker(NewStore(1), &errPersister{}, 1, 0, time.Hour, maxAge, time.Hour, time.Hour)
+	w.SetCommitMaxAgeJitter(time.Hour) // capped at maxAge/2
+	for i := 0; i < 50; i++ {
+		k := "k" + strconv.Itoa(i)
+		a := w.maxAgeFor(k)
+		if a != w.maxAgeFor(k) || a < maxAge/2 || a > maxAge*3/2 {
+			t.Fatalf("maxAgeFor(%q)=%v not deterministic or outside [%v,%v]", k, a, maxAge/2, maxAge*3/2)
+		}
+	}
+}
+
 // TestWorker_PersisterError_DoesNotApplyCommit ensures that when persister fails,
 // the VSA state is not committed and remains pending; armed stays false.
 func TestWorker_PersisterError_DoesNotApplyCommit(t *testing.T) {
@@ -132,6 +408,102 @@ func TestWorker_PersisterError_DoesNotApplyCommit(t *testing.T) {
 	}
 }
 
+// TestWorker_FailedBatchRetriedWithSameIDs verifies that a failed batch is resubmitted
+// verbatim (same CommitIDs and vectors) even after more traffic, that nothing else is
+// committed meanwhile, and that later cycles get fresh ids.
+func TestWorker_FailedBatchRetriedWithSameIDs(t *testing.T) {
+	store := NewStore(100)
+	p := &errPersister{}
+	w := NewWorker(store, p, 3, 0, time.Hour, 0, time.Hour, time.Hour)
+	w.SetCommitIDEpoch("e1")
+
+	store.GetOrCreate("a").Update(3)
+	store.GetOrCreate("b").Update(4)
+	p.returnErr.Store(true)
+	w.runCommitCycle()
+	store.GetOrCreate("a").Update(5) // grows the vector while the batch is pending
+	w.runCommitCycle()               // retry fails again: no new batch is formed
+	if len(p.batches) != 0 {
+		t.Fatalf("nothing should be persisted while the persister fails, got %v", p.batches)
+	}
+
+	p.returnErr.Store(false)
+	w.runCommitCycle()
+	if len(p.batches) != 2 {
+		t.Fatalf("want the retried batch plus one new batch, got %v", p.batches)
+	}
+	retried := map[string]Commit{}
+	for _, c := range p.batches[0] {
+		retried[c.Key] = c
+	}
+	if retried["a"] != (Commit{Key: "a", Vector: 3, CommitID: "e1:1:a"}) || retried["b"] != (Commit{Key: "b", Vector: 4, CommitID: "e1:1:b"}) {
+		t.Fatalf("retry must reuse the original ids and vectors, got %v", p.batches[0])
+	}
+	if got := p.batches[1]; len(got) != 1 || got[0] != (Commit{Key: "a", Vector: 5, CommitID: "e1:2:a"}) {
+		t.Fatalf("follow-up batch = %v, want a=5 with a fresh id", got)
+	}
+	if s, vec := store.GetOrCreate("a").State(); s != 92 || vec != 0 {
+		t.Fatalf("a = (%d,%d), want (92,0)", s, vec)
+	}
+}
+
+// slowPersister delays every CommitBatch, to make commit latency observable.
+type slowPersister struct{ delay time.Duration }
+
+func (p *slowPersister) PrintFinalMetrics() {}
+
+func (p *slowPersister) CommitBatch([]Commit) error {
+	time.Sleep(p.delay)
+	return nil
+}
+
+// histogramSample returns the sample count and sum of the named histogram in the
+// default Prometheus registry.
+func histogramSample(t *testing.T, name string) (uint64, float64) {
+	t.Helper()
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			h := mf.GetMetric()[0].GetHistogram()
+			return h.GetSampleCount(), h.GetSampleSum()
+		}
+	}
+	t.Fatalf("histogram %s not registered", name)
+	return 0, 0
+}
+
+// TestWorker_CommitMetrics verifies that each commit cycle records the CommitBatch
+// duration and the batch size when telemetry is enabled.
+func TestWorker_CommitMetrics(t *testing.T) {
+	churn.Enable(churn.Config{Enabled: true})
+	defer churn.Enable(churn.Config{})
+
+	const delay = 20 * time.Millisecond
+	store := NewStore(100)
+	w := NewWorker(store, &slowPersister{delay: delay}, 1, 0, time.Hour, 0, time.Hour, time.Hour)
+	durN, durSum := histogramSample(t, "vsa_commit_batch_duration_seconds")
+	sizeN, sizeSum := histogramSample(t, "vsa_rows_per_batch")
+
+	for _, k := range []string{"a", "b", "c"} {
+		store.GetOrCreate(k).Update(2)
+	}
+	w.runCommitCycle()
+	store.GetOrCreate("a").Update(2)
+	w.runCommitCycle()
+
+	n, sum := histogramSample(t, "vsa_commit_batch_duration_seconds")
+	if n-durN != 2 || sum-durSum < 2*delay.Seconds() {
+		t.Fatalf("duration observations=%d sum=%.3fs, want 2 and >= %.3fs", n-durN, sum-durSum, 2*delay.Seconds())
+	}
+	n, sum = histogramSample(t, "vsa_rows_per_batch")
+	if n-sizeN != 2 || sum-sizeSum != 4 {
+		t.Fatalf("batch size observations=%d rows=%v, want 2 batches of 3+1 rows", n-sizeN, sum-sizeSum)
+	}
+}
+
 // TestWorker_FinalFlush_CommitsRemainders ensures runFinalFlush persists sub-threshold
 // remainders and applies VSA.Commit.
 func TestWorker_FinalFlush_CommitsRemainders(t *testing.T) {
@@ -156,6 +528,45 @@ func TestWorker_FinalFlush_CommitsRemainders(t *testing.T) {
 	}
 }
 
+// TestWorker_FlushNow_MidRun verifies that FlushNow commits every pending vector while
+// the commit loop is ticking, and that it surfaces the persister's error.
+func TestWorker_FlushNow_MidRun(t *testing.T) {
+	store := NewStore(50)
+	p := &errPersister{}
+	w := NewWorker(store, p, 1000, 0, time.Millisecond, 0, time.Hour, time.Hour)
+	w.Start()
+
+	a := store.GetOrCreate("a")
+	b := store.GetOrCreate("b")
+	a.Update(2)
+	b.Update(3)
+	time.Sleep(5 * time.Millisecond) // a few sub-threshold cycles commit nothing
+
+	if err := w.FlushNow(); err != nil {
+		t.Fatalf("FlushNow: %v", err)
+	}
+	if len(p.batches) != 1 || len(p.batches[0]) != 2 {
+		t.Fatalf("expected 1 batch with 2 commits, got %#v", p.batches)
+	}
+	if s, v := a.State(); s != 48 || v != 0 {
+		t.Fatalf("after flush a=(48,0), got (%d,%d)", s, v)
+	}
+	if s, v := b.State(); s != 47 || v != 0 {
+		t.Fatalf("after flush b=(47,0), got (%d,%d)", s, v)
+	}
+
+	a.Update(1)
+	p.returnErr.Store(true)
+	if err := w.FlushNow(); err == nil {
+		t.Fatalf("FlushNow should return the persister error")
+	}
+	p.returnErr.Store(false)
+	w.Stop() // the pending batch is retried before the final flush
+	if s, v := a.State(); s != 47 || v != 0 {
+		t.Fatalf("after stop a=(47,0), got (%d,%d)", s, v)
+	}
+}
+
 // TestWorker_Eviction_ErrorKeepsKey verifies that if eviction's final commit fails,
 // the key is not deleted.
 func TestWorker_Eviction_ErrorKeepsKey(t *testing.T) {
@@ -176,3 +587,160 @@ func TestWorker_Eviction_ErrorKeepsKey(t *testing.T) {
 		t.Fatalf("expected stale key to remain after commit error during eviction")
 	}
 }
+
+// TestWorker_Hooks verifies OnCommit fires with each persisted batch (cycle and
+// eviction) and OnEvict with the evicted key and its final committed vector, and that
+// neither fires for a key whose eviction commit failed.
+func TestWorker_Hooks(t *testing.T) {
+	store := NewStore(100)
+	p := &errPersister{}
+	w := NewWorker(store, p, 5, 0, time.Hour, 0, time.Millisecond, time.Hour)
+	w.SetCommitIDEpoch("e1")
+	var commits [][]Commit
+	evicted := map[string]int64{}
+	w.OnCommit(func(batch []Commit) { commits = append(commits, append([]Commit(nil), batch...)) })
+	w.OnEvict(func(key string, finalVector int64) { evicted[key] = finalVector })
+
+	store.GetOrCreate("hot").Update(6)
+	w.runCommitCycle()
+	if len(commits) != 1 || !reflect.DeepEqual(commits[0], []Commit{{Key: "hot", Vector: 6, CommitID: "e1:1:hot"}}) {
+		t.Fatalf("OnCommit after cycle saw %v", commits)
+	}
+
+	store.GetOrCreate("idle").Update(2)
+	store.ForEach(func(_ string, mv *managedVSA) {
+		atomic.StoreInt64(&mv.lastAccessed, time.Now().Add(-time.Hour).UnixNano())
+	})
+	p.returnErr.Store(true)
+	w.runEvictionCycle()
+	// "hot" has nothing left to commit and goes; "idle" stays because its commit failed.
+	if len(commits) != 1 || !reflect.DeepEqual(evicted, map[string]int64{"hot": 0}) {
+		t.Fatalf("after a failed eviction commit: commits=%v evicted=%v", commits, evicted)
+	}
+	p.returnErr.Store(false)
+	w.runEvictionCycle()
+	if !reflect.DeepEqual(evicted, map[string]int64{"hot": 0, "idle": 2}) {
+		t.Fatalf("OnEvict saw %v, want hot=0 idle=2", evicted)
+	}
+	if len(commits) != 2 || !reflect.DeepEqual(commits[1], []Commit{{Key: "idle", Vector: 2, CommitID: "e1:2:idle"}}) {
+		t.Fatalf("OnCommit after eviction saw %v", commits)
+	}
+}
+
+// TestWorker_DrainToTarget verifies that a drain lowers availability gradually toward the
+// target over the configured window, never dropping below it and never oversubscribing.
+func TestWorker_DrainToTarget(t *testing.T) {
+	store := NewStore(1000)
+	w := NewWorker(store, &errPersister{}, 1_000_000, 0, time.Hour, 0, time.Hour, time.Hour)
+	v := store.GetOrCreate("tenant")
+	for i := 0; i < 100; i++ {
+		v.TryConsume(1)
+	}
+
+	if err := w.DrainToTarget("missing", 10, time.Second, 0); err == nil {
+		t.Fatalf("expected error for unknown key")
+	}
+	if err := w.DrainToTarget("tenant", 1000, time.Second, 0); err == nil {
+		t.Fatalf("expected error for a target not below the current scalar")
+	}
+	if err := w.DrainToTarget("tenant", 400, 0, 0); err == nil {
+		t.Fatalf("expected error for non-positive duration")
+	}
+
+	start := time.Now()
+	if err := w.DrainToTarget("tenant", 400, 200*time.Millisecond, 10*time.Millisecond); err != nil {
+		t.Fatalf("DrainToTarget: %v", err)
+	}
+	prev := v.Available()
+	sawIntermediate := false
+	for time.Since(start) < 2*time.Second {
+		s, _ := v.State()
+		avail := v.Available()
+		if s < 400 || avail < 0 {
+			t.Fatalf("drain overshot: scalar=%d available=%d", s, avail)
+		}
+		if avail > prev {
+			t.Fatalf("availability increased during drain: %d -> %d", prev, avail)
+		}
+		if avail > 300 && avail < 900 {
+			sawIntermediate = true
+		}
+		prev = avail
+		if s == 400 {
+			break
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	if s, _ := v.State(); s != 400 {
+		t.Fatalf("scalar=%d want 400 after drain", s)
+	}
+	if !sawIntermediate {
+		t.Fatalf("drain should pass through intermediate availability, not snap")
+	}
+	if elapsed < 150*time.Millisecond {
+		t.Fatalf("drain finished too quickly (%v) for a 200ms window", elapsed)
+	}
+	w.Stop()
+	if err := w.DrainToTarget("tenant", 100, time.Second, 0); err == nil {
+		t.Fatalf("expected error after Stop")
+	}
+}
+
+// TestWorker_DrainToTarget_ConcurrentStop races drains against Stop: every drain either
+// starts before Stop waits on it or is refused, and Stop returns once the started ones
+// have exited (run with -race to catch a wg.Add racing wg.Wait).
+func TestWorker_DrainToTarget_ConcurrentStop(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		store := NewStore(1000)
+		w := NewWorker(store, &errPersister{}, 1_000_000, 0, time.Hour, 0, time.Hour, time.Hour)
+		store.GetOrCreate("tenant")
+		w.Start()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					if err := w.DrainToTarget("tenant", 10, time.Hour, time.Millisecond); err != nil {
+						return
+					}
+				}
+			}()
+		}
+		w.Stop()
+		wg.Wait()
+		if err := w.DrainToTarget("tenant", 10, time.Second, 0); err == nil {
+			t.Fatal("expected error after Stop")
+		}
+	}
+}
+
+// TestWorker_Window_Replenishes verifies that with a window configured an exhausted key
+// recovers its full limit after one window, and never exceeds it.
+func TestWorker_Window_Replenishes(t *testing.T) {
+	store := NewStore(20)
+	w := NewWorker(store, &errPersister{}, 1_000_000, 0, time.Hour, 0, time.Hour, time.Hour)
+	w.SetWindow(100 * time.Millisecond)
+	v := store.GetOrCreate("k")
+	for v.TryConsume(1) {
+	}
+	w.Start()
+	defer w.Stop()
+
+	time.Sleep(30 * time.Millisecond)
+	if got := v.Available(); got >= 20 {
+		t.Fatalf("after part of a window Available()=%d, want a partial refill", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for v.Available() < 20 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := v.Available(); got != 20 {
+		t.Fatalf("after a window Available()=%d want 20", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := v.Available(); got != 20 {
+		t.Fatalf("refill overshot the limit: Available()=%d", got)
+	}
+}
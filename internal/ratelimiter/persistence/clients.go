@@ -18,6 +18,7 @@ package persistence
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -87,4 +88,8 @@ type DemoOptions struct {
 	RedisMarkerTTL time.Duration
 	RedisAddr      string
 	KafkaTopic     string
+	// PostgresDB is an opened handle (driver registered by the caller) for adapter=postgres.
+	PostgresDB *sql.DB
+	// Epoch namespaces the postgres adapter's commit ids; empty uses BootEpoch.
+	Epoch string
 }
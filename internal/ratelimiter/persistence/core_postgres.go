@@ -0,0 +1,81 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"vsa/internal/ratelimiter/core"
+)
+
+// CorePostgresAdapter lets core.Worker drive a PostgresPersister directly.
+//
+// core.Persister has no context and no CommitID, so the adapter:
+//   - injects context.Background() (PostgresPersister applies its default timeout),
+//   - numbers every CommitBatch call as a cycle, and
+//   - derives a deterministic CommitID per (epoch, cycle, key): "<epoch>:<cycle>:<key>".
+//
+// Unlike IdemShim's random IDs, the same (key, cycle) always maps to the same id within
+// an epoch, so a caller replaying a cycle is deduplicated by applied_commits. The epoch
+// changes per process lifetime so restarted cycle numbers never collide with old ids.
+//
+// A non-empty core.Commit.CommitID (as stamped by core.Worker) is used as is; the worker
+// then owns the id and resubmits a failed batch with the same ids, which makes the retry
+// a no-op in applied_commits even though the adapter counts it as a new cycle.
+type CorePostgresAdapter struct {
+	pg    *PostgresPersister
+	epoch string
+	cycle atomic.Uint64
+}
+
+// NewCorePostgresAdapter wraps pg so it satisfies core.Persister, namespacing commit ids
+// with BootEpoch.
+func NewCorePostgresAdapter(pg *PostgresPersister) *CorePostgresAdapter {
+	return NewCorePostgresAdapterWithEpoch(pg, BootEpoch())
+}
+
+// NewCorePostgresAdapterWithEpoch wraps pg using an explicit commit-id epoch, e.g. one
+// obtained from NextFileEpoch. The epoch must differ across process restarts.
+func NewCorePostgresAdapterWithEpoch(pg *PostgresPersister, epoch string) *CorePostgresAdapter {
+	return &CorePostgresAdapter{pg: pg, epoch: epoch}
+}
+
+// CommitBatch maps core.Commit -> CommitEntry for the next cycle and applies it.
+func (a *CorePostgresAdapter) CommitBatch(commits []core.Commit) error {
+	if len(commits) == 0 {
+		return nil
+	}
+	cycle := a.cycle.Add(1)
+	entries := make([]CommitEntry, len(commits))
+	for i, c := range commits {
+		id := c.CommitID
+		if id == "" {
+			id = coreCommitID(a.epoch, cycle, c.Key)
+		}
+		entries[i] = CommitEntry{Key: c.Key, Vector: c.Vector, CommitID: id}
+	}
+	return a.pg.CommitBatch(context.Background(), entries)
+}
+
+// PrintFinalMetrics is a no-op; global metrics are printed by the mock persister path.
+func (a *CorePostgresAdapter) PrintFinalMetrics() {}
+
+// coreCommitID returns the deterministic commit id for key within cycle of epoch.
+func coreCommitID(epoch string, cycle uint64, key string) string {
+	return fmt.Sprintf("%s:%d:%s", epoch, cycle, key)
+}
@@ -0,0 +1,178 @@
+package persistence
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"vsa/internal/ratelimiter/core"
+)
+
+func TestCorePostgresAdapter_WorkerCycle(t *testing.T) {
+	f := &fakeDB{}
+	db := newSQLDBWithFake(f)
+	adapter := NewCorePostgresAdapterWithEpoch(NewPostgresPersister(db, true), "e0")
+
+	store := core.NewStore(100)
+	w := core.NewWorker(store, adapter, 5, 0, 5*time.Millisecond, 0, time.Hour, time.Hour)
+	w.SetCommitIDEpoch("e1") // worker-stamped ids take precedence over the adapter's
+	for i := 0; i < 7; i++ {
+		if !store.GetOrCreate("alice").TryConsume(1) {
+			t.Fatalf("consume %d denied", i)
+		}
+	}
+	w.Start()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, vec := store.GetOrCreate("alice").State(); vec == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// A sub-threshold remainder for a second key is persisted by the final flush.
+	store.GetOrCreate("bob").TryConsume(1)
+	w.Stop()
+
+	if f.commitCount != 2 || f.rollbackCount != 0 {
+		t.Fatalf("want 2 committed transactions, got commit=%d rollback=%d", f.commitCount, f.rollbackCount)
+	}
+	var ids []string
+	for i, q := range f.execs {
+		if strings.Contains(q, "INSERT INTO applied_commits") {
+			ids = append(ids, f.execArgs[i][0].Value.(string))
+			if got := f.execArgs[i][2].Value.(int64); got <= 0 {
+				t.Fatalf("unexpected vector %d for %v", got, ids[len(ids)-1])
+			}
+		}
+	}
+	if len(ids) != 2 || ids[0] != "e1:1:alice" || ids[1] != "e1:2:bob" {
+		t.Fatalf("unexpected commit ids: %v", ids)
+	}
+	for _, k := range []string{"alice", "bob"} {
+		if _, vec := store.GetOrCreate(k).State(); vec != 0 {
+			t.Fatalf("%s vector should be folded after commit, got %d", k, vec)
+		}
+	}
+}
+
+// ambiguousPersister applies a batch and then reports failure on its first call, like a
+// commit whose acknowledgement was lost.
+type ambiguousPersister struct {
+	core.Persister
+	failed atomic.Bool
+}
+
+func (p *ambiguousPersister) CommitBatch(commits []core.Commit) error {
+	err := p.Persister.CommitBatch(commits)
+	if err == nil && p.failed.CompareAndSwap(false, true) {
+		return errors.New("ack lost")
+	}
+	return err
+}
+
+// TestWorker_RetriedBatchIsNoOpEndToEnd drives worker-stamped CommitIDs through IdemShim
+// into an idempotent FilePersister: the batch whose acknowledgement was lost is
+// resubmitted with the same ids and skipped, so the durable scalars count it once.
+func TestWorker_RetriedBatchIsNoOpEndToEnd(t *testing.T) {
+	fp, err := NewFilePersister(t.TempDir(), FilePersisterOptions{NoSync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	store := core.NewStore(100)
+	p := &ambiguousPersister{Persister: NewIdemShim(fp)}
+	w := core.NewWorker(store, p, 1, 0, 5*time.Millisecond, 0, time.Hour, time.Hour)
+	store.GetOrCreate("k").Update(6)
+	w.Start()
+	for deadline := time.Now().Add(time.Second); !p.failed.Load() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	w.Stop() // the next cycle or the final flush retries the ambiguous batch
+
+	if got := fp.Recover()["k"]; got != -6 {
+		t.Fatalf("durable scalar = %d, want -6 (applied exactly once)", got)
+	}
+	if s, vec := store.GetOrCreate("k").State(); s != 94 || vec != 0 {
+		t.Fatalf("in-memory state = (%d,%d), want (94,0)", s, vec)
+	}
+}
+
+func TestCorePostgresAdapter_EmptyAndDeterministicIDs(t *testing.T) {
+	f := &fakeDB{}
+	adapter := NewCorePostgresAdapter(NewPostgresPersister(newSQLDBWithFake(f), false))
+	if err := adapter.CommitBatch(nil); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if len(f.execs) != 0 {
+		t.Fatalf("empty batch should not touch the db")
+	}
+	if coreCommitID("e", 3, "k") != coreCommitID("e", 3, "k") || coreCommitID("e", 3, "k") == coreCommitID("e", 4, "k") {
+		t.Fatalf("commit ids must be stable per (key, cycle) and differ across cycles")
+	}
+	adapter.PrintFinalMetrics()
+}
+
+// TestCorePostgresAdapter_EpochsDoNotCollide simulates a crash/restart: the cycle counter
+// restarts at 1, but the new epoch keeps commit ids distinct, so applied_commits dedupes
+// retries within an epoch while legitimate post-restart commits are still applied.
+func TestCorePostgresAdapter_EpochsDoNotCollide(t *testing.T) {
+	epochFile := filepath.Join(t.TempDir(), "commit.epoch")
+	f := &fakeDB{}
+	db := newSQLDBWithFake(f)
+	applied := map[string]bool{} // emulates the applied_commits primary key
+	apply := func(a *CorePostgresAdapter, commits []core.Commit) (fresh int) {
+		t.Helper()
+		start := len(f.execs)
+		if err := a.CommitBatch(commits); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		for i := start; i < len(f.execs); i++ {
+			if strings.Contains(f.execs[i], "INSERT INTO applied_commits") {
+				id := f.execArgs[i][0].Value.(string)
+				if !applied[id] {
+					applied[id] = true
+					fresh++
+				}
+			}
+		}
+		return fresh
+	}
+
+	epoch1, err := NextFileEpoch(epochFile)
+	if err != nil || epoch1 != "1" {
+		t.Fatalf("first epoch=%q err=%v; want 1", epoch1, err)
+	}
+	before := NewCorePostgresAdapterWithEpoch(NewPostgresPersister(db, false), epoch1)
+	if n := apply(before, []core.Commit{{Key: "k", Vector: 5}}); n != 1 {
+		t.Fatalf("first commit should apply, fresh=%d", n)
+	}
+	// A retry of the same cycle in the same epoch reuses the id and is deduplicated.
+	if id := coreCommitID(epoch1, 1, "k"); !applied[id] {
+		t.Fatalf("expected %s to be recorded", id)
+	}
+
+	// Restart: new process, new epoch, cycle numbering starts over.
+	epoch2, err := NextFileEpoch(epochFile)
+	if err != nil || epoch2 != "2" {
+		t.Fatalf("second epoch=%q err=%v; want 2", epoch2, err)
+	}
+	after := NewCorePostgresAdapterWithEpoch(NewPostgresPersister(db, false), epoch2)
+	if n := apply(after, []core.Commit{{Key: "k", Vector: 3}}); n != 1 {
+		t.Fatalf("post-restart commit for cycle 1 must not collide with the pre-crash id, fresh=%d", n)
+	}
+	// Without an epoch change the same cycle would have collided.
+	sameEpoch := NewCorePostgresAdapterWithEpoch(NewPostgresPersister(db, false), epoch1)
+	if n := apply(sameEpoch, []core.Commit{{Key: "k", Vector: 2}}); n != 0 {
+		t.Fatalf("reusing an epoch should collide (dedupe), fresh=%d", n)
+	}
+}
+
+func TestBootEpoch_DiffersAcrossCalls(t *testing.T) {
+	a := BootEpoch()
+	time.Sleep(time.Microsecond)
+	if b := BootEpoch(); a == "" || a == b {
+		t.Fatalf("boot epochs should be non-empty and distinct: %q %q", a, b)
+	}
+}
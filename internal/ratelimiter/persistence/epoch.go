@@ -0,0 +1,69 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit-id epochs namespace per-process commit sequences.
+//
+// Sequences such as CorePostgresAdapter's cycle counter restart at 1 after a crash,
+// so without a namespace a post-restart "1:key" would collide with a pre-crash "1:key"
+// already recorded in applied_commits and be silently dropped as a duplicate. Prefixing
+// ids with an epoch that differs per process lifetime keeps them globally unique while
+// ids stay deterministic (and therefore deduplicated) within an epoch.
+
+// BootEpoch derives an epoch from the wall clock at call time (base-36 UnixNano).
+// It is unique per process start as long as the clock does not step backwards
+// across restarts; use NextFileEpoch when that cannot be guaranteed.
+func BootEpoch() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// NextFileEpoch increments and persists a counter stored at path and returns the new
+// value. A missing file starts at 0, so the first call returns "1". The counter is
+// written to a temporary file and renamed into place, so a crash never leaves it torn.
+func NextFileEpoch(path string) (string, error) {
+	var cur uint64
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		cur, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("parse epoch file %s: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return "", fmt.Errorf("read epoch file %s: %w", path, err)
+	}
+	next := strconv.FormatUint(cur+1, 10)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(next+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("write epoch file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("rename epoch file %s: %w", path, err)
+	}
+	return next, nil
+}
@@ -28,7 +28,9 @@ import (
 //   - "mock": in-process logger (default; existing behavior)
 //   - "redis": idempotent Redis adapter using a logging client (no external dep)
 //   - "kafka": idempotent Kafka adapter using a logging producer (no broker)
-//   - "postgres": not wired for demo (returns error to avoid hidden nil DB usage)
+//   - "postgres": CorePostgresAdapter over opts.PostgresDB, namespaced by opts.Epoch
+//     (BootEpoch when empty); returns an error when no *sql.DB is supplied (avoids
+//     hidden nil DB usage)
 //
 // The purpose is to let users try different idempotent adapters in the demo without
 // requiring infrastructure. For production, supply real clients and wire them directly.
@@ -59,7 +61,14 @@ func BuildPersister(adapter string, opts DemoOptions) (core.Persister, error) {
 		k := NewKafkaPersister(LoggingKafkaProducer{}, topic)
 		return NewIdemShim(k), nil
 	case "postgres":
-		return nil, errors.New("postgres adapter is not enabled in the demo build; please wire a real *sql.DB and create tables")
+		if opts.PostgresDB != nil {
+			pg := NewPostgresPersister(opts.PostgresDB, true)
+			if opts.Epoch != "" {
+				return NewCorePostgresAdapterWithEpoch(pg, opts.Epoch), nil
+			}
+			return NewCorePostgresAdapter(pg), nil
+		}
+		return nil, errors.New("postgres adapter needs DemoOptions.PostgresDB (an open *sql.DB, e.g. from --postgres_dsn) and the counters/applied_commits tables")
 	default:
 		return nil, fmt.Errorf("unknown persistence adapter: %s", adapter)
 	}
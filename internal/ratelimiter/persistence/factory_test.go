@@ -67,3 +67,27 @@ func TestBuildPersister_UnknownAdapter(t *testing.T) {
 	if !errors.Is(err, err) { /* satisfy staticcheck about err usage */
 	}
 }
+
+func TestBuildPersister_PostgresWithDB(t *testing.T) {
+	f := &fakeDB{}
+	p, err := BuildPersister("postgres", DemoOptions{PostgresDB: newSQLDBWithFake(f)})
+	if err != nil || p == nil {
+		t.Fatalf("unexpected: %v %v", p, err)
+	}
+	if err := p.CommitBatch([]core.Commit{{Key: "k", Vector: 2}}); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if f.commitCount != 1 {
+		t.Fatalf("expected one transaction, got %d", f.commitCount)
+	}
+}
+
+func TestBuildPersister_PostgresEpoch(t *testing.T) {
+	p, err := BuildPersister("postgres", DemoOptions{PostgresDB: newSQLDBWithFake(&fakeDB{}), Epoch: "7"})
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if got := p.(*CorePostgresAdapter).epoch; got != "7" {
+		t.Fatalf("epoch = %q, want 7", got)
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FilePersister provides durability without a database: every CommitBatch is appended
+// to a write-ahead log (wal.log) as one length-prefixed, checksummed record, and the
+// accumulated per-key scalars are periodically compacted into snapshot.bin.
+//
+// Scalars follow the adapter convention (scalar = scalar - Vector, starting at 0), so a
+// recovered value is the key's net adjustment relative to its configured limit; see
+// core.Store.Preload.
+//
+// Recovery replays the snapshot and then every WAL record with a sequence number past
+// the one the snapshot covers. A torn record at the end of the WAL (crash mid-append)
+// fails its checksum and is discarded together with anything after it. A failed append
+// is cut off right away, so later records never land behind a torn one.
+//
+// CommitIDs applied since the last compaction are remembered, so a retried entry is a
+// no-op within that window; compaction forgets them. A CommitID repeated within one
+// batch is applied once. FencingToken is ignored.
+type FilePersister struct {
+	mu   sync.Mutex
+	dir  string
+	opts FilePersisterOptions
+	wal  walHandle
+	size int64 // WAL offset just past the last intact record
+
+	scalars map[string]int64
+	applied map[string]string // CommitID -> Key, since the last compaction
+	seq     uint64            // sequence of the last record in the WAL
+	pending int               // WAL records since the last compaction
+}
+
+// FilePersisterOptions configures a FilePersister.
+type FilePersisterOptions struct {
+	// CompactEvery is the number of WAL records after which the state is written to a
+	// new snapshot and the WAL is truncated. Default 1024.
+	CompactEvery int
+	// NoSync skips the fsync after each appended batch. Faster, but a machine crash
+	// (not just a process crash) may lose the most recent batches.
+	NoSync bool
+}
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.bin"
+)
+
+// maxRecordSize bounds a WAL record, so replay never allocates an arbitrary length
+// read from a corrupt header. CommitBatch rejects larger batches.
+const maxRecordSize = 64 << 20
+
+var (
+	crcTable        = crc32.MakeTable(crc32.Castagnoli)
+	errCorruptFrame = errors.New("persistence: corrupt file record")
+)
+
+// walHandle is the part of *os.File the WAL uses.
+type walHandle interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// NewFilePersister opens (or creates) a file-backed persister in dir, recovering any
+// state left by a previous process.
+func NewFilePersister(dir string, opts FilePersisterOptions) (*FilePersister, error) {
+	if opts.CompactEvery <= 0 {
+		opts.CompactEvery = 1024
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create %s: %w", dir, err)
+	}
+	p := &FilePersister{dir: dir, opts: opts, scalars: make(map[string]int64), applied: make(map[string]string)}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Recover returns a copy of the per-key scalars rebuilt from the snapshot plus the WAL
+// tail, suitable for core.Store.Preload.
+func (p *FilePersister) Recover() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]int64, len(p.scalars))
+	for k, v := range p.scalars {
+		out[k] = v
+	}
+	return out
+}
+
+// CommitBatch appends the entries not applied yet as one WAL record and applies them to
+// the in-memory state once the record is durable.
+func (p *FilePersister) CommitBatch(ctx context.Context, entries []CommitEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.wal == nil {
+		return errors.New("persistence: file persister is closed")
+	}
+	fresh := make([]CommitEntry, 0, len(entries))
+	batch := make(map[string]string)
+	for _, e := range entries {
+		if e.CommitID != "" {
+			key, ok := p.applied[e.CommitID]
+			if !ok {
+				key, ok = batch[e.CommitID]
+			}
+			if ok {
+				if key != e.Key {
+					return fmt.Errorf("persistence: commit id %q already applied to key %q", e.CommitID, key)
+				}
+				continue
+			}
+			batch[e.CommitID] = e.Key
+		}
+		fresh = append(fresh, e)
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	rec := encodeWALRecord(p.seq+1, fresh)
+	if len(rec) > maxRecordSize {
+		return fmt.Errorf("persistence: batch of %d entries exceeds the %d-byte record limit", len(fresh), maxRecordSize)
+	}
+	fr := frame(rec)
+	if _, err := p.wal.Write(fr); err != nil {
+		return p.cutTornAppend(fmt.Errorf("append wal: %w", err))
+	}
+	if !p.opts.NoSync {
+		if err := p.wal.Sync(); err != nil {
+			return p.cutTornAppend(fmt.Errorf("sync wal: %w", err))
+		}
+	}
+	p.size += int64(len(fr))
+	p.seq++
+	p.apply(fresh)
+	p.pending++
+	if p.pending >= p.opts.CompactEvery {
+		return p.compactLocked()
+	}
+	return nil
+}
+
+// cutTornAppend truncates the WAL back to the last intact record after a failed append,
+// so the batch is reported failed and nothing is written behind a partial frame. If
+// even that fails the persister closes itself: later batches must not be acknowledged
+// while replay would stop before them.
+func (p *FilePersister) cutTornAppend(err error) error {
+	terr := p.wal.Truncate(p.size)
+	if terr == nil {
+		return err
+	}
+	_ = p.wal.Close()
+	p.wal = nil
+	return errors.Join(err, fmt.Errorf("truncate torn wal append (persister closed): %w", terr))
+}
+
+// Compact writes the current state to a new snapshot and truncates the WAL.
+func (p *FilePersister) Compact() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.wal == nil {
+		return errors.New("persistence: file persister is closed")
+	}
+	return p.compactLocked()
+}
+
+// Close syncs and closes the WAL. The state stays recoverable from disk.
+func (p *FilePersister) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.wal == nil {
+		return nil
+	}
+	err := p.wal.Sync()
+	if cerr := p.wal.Close(); err == nil {
+		err = cerr
+	}
+	p.wal = nil
+	return err
+}
+
+func (p *FilePersister) apply(entries []CommitEntry) {
+	for _, e := range entries {
+		p.scalars[e.Key] -= e.Vector
+		if e.CommitID != "" {
+			p.applied[e.CommitID] = e.Key
+		}
+	}
+}
+
+// compactLocked writes the snapshot through a temporary file and rename, then truncates
+// the WAL. The snapshot records the last sequence it covers, so a crash between the two
+// steps only leaves WAL records that recovery skips.
+func (p *FilePersister) compactLocked() error {
+	path := filepath.Join(p.dir, snapshotFile)
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, frame(encodeSnapshot(p.seq, p.scalars))); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename snapshot: %w", err)
+	}
+	if err := p.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	p.size = 0
+	p.pending = 0
+	p.applied = make(map[string]string)
+	return nil
+}
+
+// load rebuilds the state from disk and opens the WAL for appending, cutting off a torn
+// tail so new records are never written after garbage. The WAL is opened O_APPEND so
+// writes land at the end after compaction truncates it.
+func (p *FilePersister) load() error {
+	b, err := os.ReadFile(filepath.Join(p.dir, snapshotFile))
+	switch {
+	case err == nil:
+		rec, ferr := unframe(b)
+		if ferr != nil {
+			return fmt.Errorf("read snapshot: %w", ferr)
+		}
+		if p.seq, p.scalars, err = decodeSnapshot(rec); err != nil {
+			return fmt.Errorf("read snapshot: %w", err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	wal, err := os.OpenFile(filepath.Join(p.dir, walFile), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	good, err := p.replay(wal)
+	if err == nil {
+		err = wal.Truncate(good)
+	}
+	if err != nil {
+		_ = wal.Close()
+		return fmt.Errorf("recover wal: %w", err)
+	}
+	p.wal, p.size = wal, good
+	return nil
+}
+
+// replay applies the WAL records newer than the snapshot and returns the offset just
+// past the last intact record.
+func (p *FilePersister) replay(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var good int64
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			return good, nil // clean end or torn header
+		}
+		n := binary.LittleEndian.Uint32(hdr[:4])
+		if n > maxRecordSize {
+			return good, nil // corrupt length
+		}
+		rec := make([]byte, n)
+		if _, err := io.ReadFull(br, rec); err != nil || crc32.Checksum(rec, crcTable) != binary.LittleEndian.Uint32(hdr[4:]) {
+			return good, nil // torn or corrupt tail
+		}
+		seq, entries, err := decodeWALRecord(rec)
+		if err != nil {
+			return good, err
+		}
+		if seq > p.seq {
+			p.apply(entries)
+			p.seq = seq
+			p.pending++
+		}
+		good += int64(len(hdr)) + int64(n)
+	}
+}
+
+// frame prefixes rec with its length and CRC-32C (little endian).
+func frame(rec []byte) []byte {
+	out := make([]byte, 8, 8+len(rec))
+	binary.LittleEndian.PutUint32(out[:4], uint32(len(rec)))
+	binary.LittleEndian.PutUint32(out[4:], crc32.Checksum(rec, crcTable))
+	return append(out, rec...)
+}
+
+// unframe returns the framed record at the start of b.
+func unframe(b []byte) ([]byte, error) {
+	if len(b) < 8 {
+		return nil, errCorruptFrame
+	}
+	n := binary.LittleEndian.Uint32(b[:4])
+	if uint64(len(b)-8) < uint64(n) {
+		return nil, errCorruptFrame
+	}
+	rec := b[8 : 8+n]
+	if crc32.Checksum(rec, crcTable) != binary.LittleEndian.Uint32(b[4:8]) {
+		return nil, errCorruptFrame
+	}
+	return rec, nil
+}
+
+// WAL record: uvarint seq, uvarint count, then per entry: key, varint vector, commit id
+// (strings are uvarint length + bytes).
+func encodeWALRecord(seq uint64, entries []CommitEntry) []byte {
+	b := binary.AppendUvarint(nil, seq)
+	b = binary.AppendUvarint(b, uint64(len(entries)))
+	for _, e := range entries {
+		b = appendString(b, e.Key)
+		b = binary.AppendVarint(b, e.Vector)
+		b = appendString(b, e.CommitID)
+	}
+	return b
+}
+
+func decodeWALRecord(b []byte) (uint64, []CommitEntry, error) {
+	d := decoder{b: b}
+	seq := d.uvarint()
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(b)) {
+		return 0, nil, errCorruptFrame
+	}
+	entries := make([]CommitEntry, 0, n)
+	for i := uint64(0); i < n; i++ {
+		e := CommitEntry{Key: d.string()}
+		e.Vector = d.varint()
+		e.CommitID = d.string()
+		entries = append(entries, e)
+	}
+	return seq, entries, d.err
+}
+
+// Snapshot: uvarint last covered seq, uvarint count, then per key: key, varint scalar.
+func encodeSnapshot(seq uint64, scalars map[string]int64) []byte {
+	b := binary.AppendUvarint(nil, seq)
+	b = binary.AppendUvarint(b, uint64(len(scalars)))
+	for k, v := range scalars {
+		b = appendString(b, k)
+		b = binary.AppendVarint(b, v)
+	}
+	return b
+}
+
+func decodeSnapshot(b []byte) (uint64, map[string]int64, error) {
+	d := decoder{b: b}
+	seq := d.uvarint()
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(b)) {
+		return 0, nil, errCorruptFrame
+	}
+	scalars := make(map[string]int64, n)
+	for i := uint64(0); i < n; i++ {
+		k := d.string()
+		scalars[k] = d.varint()
+	}
+	return seq, scalars, d.err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads the varint encoding above; the first error sticks.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errCorruptFrame
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errCorruptFrame
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.b)) {
+		d.err = errCorruptFrame
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+// writeFileSync writes data to path and fsyncs it before closing.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestFilePersister_RecoverAfterCrash writes batches across a compaction, abandons the
+// persister without Close (crash) after a torn append, and checks that a reopened
+// persister recovers exactly the committed scalars and keeps appending cleanly.
+func TestFilePersister_RecoverAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	p, err := NewFilePersister(dir, FilePersisterOptions{CompactEvery: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := [][]CommitEntry{
+		{{Key: "a", Vector: 10, CommitID: "1"}, {Key: "b", Vector: 4, CommitID: "2"}},
+		{{Key: "a", Vector: 5, CommitID: "3"}},
+		{{Key: "c", Vector: -2, CommitID: "4"}}, // third record: compaction
+		{{Key: "b", Vector: 6, CommitID: "5"}},
+		{{Key: "b", Vector: 6, CommitID: "5"}}, // retry: no-op
+		{{Key: "a", Vector: 1}},
+	}
+	for _, b := range batches {
+		if err := p.CommitBatch(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatalf("no snapshot after compaction: %v", err)
+	}
+	want := map[string]int64{"a": -16, "b": -10, "c": 2}
+	if got := p.Recover(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("live state %v want %v", got, want)
+	}
+
+	// Crash mid-append: a partial frame at the WAL tail, and no Close.
+	torn := frame(encodeWALRecord(99, []CommitEntry{{Key: "a", Vector: 1000}}))
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write(torn[:len(torn)-3])
+	_ = f.Close()
+
+	p2, err := NewFilePersister(dir, FilePersisterOptions{CompactEvery: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p2.Recover(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("recovered %v want %v", got, want)
+	}
+	// Ids since the last compaction survive the restart.
+	if err := p2.CommitBatch(ctx, []CommitEntry{{Key: "b", Vector: 6, CommitID: "5"}, {Key: "d", Vector: 3, CommitID: "6"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p3, err := NewFilePersister(dir, FilePersisterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p3.Close()
+	want["d"] = -3
+	if got := p3.Recover(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after torn tail + append: %v want %v", got, want)
+	}
+}
+
+func TestFilePersister_CommitIDConflict(t *testing.T) {
+	p, err := NewFilePersister(t.TempDir(), FilePersisterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx := context.Background()
+	if err := p.CommitBatch(ctx, []CommitEntry{{Key: "a", Vector: 1, CommitID: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CommitBatch(ctx, []CommitEntry{{Key: "b", Vector: 1, CommitID: "x"}}); err == nil {
+		t.Fatal("expected conflict for a commit id reused on another key")
+	}
+}
+
+// tornWAL makes the next Write persist only half of its frame and fail, like a disk
+// running full mid-append.
+type tornWAL struct {
+	walHandle
+	tear bool
+}
+
+func (w *tornWAL) Write(b []byte) (int, error) {
+	if !w.tear {
+		return w.walHandle.Write(b)
+	}
+	w.tear = false
+	n, _ := w.walHandle.Write(b[:len(b)/2])
+	return n, errors.New("disk full")
+}
+
+// TestFilePersister_FailedAppendIsCutOff verifies that a failed append leaves no partial
+// frame behind, so batches acknowledged after it survive a restart.
+func TestFilePersister_FailedAppendIsCutOff(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	p, err := NewFilePersister(dir, FilePersisterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CommitBatch(ctx, []CommitEntry{{Key: "a", Vector: 1, CommitID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	w := &tornWAL{walHandle: p.wal, tear: true}
+	p.wal = w
+	if err := p.CommitBatch(ctx, []CommitEntry{{Key: "a", Vector: 100, CommitID: "2"}}); err == nil {
+		t.Fatal("expected the torn append to fail")
+	}
+	if err := p.CommitBatch(ctx, []CommitEntry{{Key: "b", Vector: 2, CommitID: "3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := NewFilePersister(dir, FilePersisterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	if got, want := p2.Recover(), map[string]int64{"a": -1, "b": -2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("recovered %v want %v", got, want)
+	}
+}
+
+// TestFilePersister_DuplicateIDsInBatch verifies a CommitID repeated within one batch is
+// applied once, and that reusing it for another key in the same batch is a conflict.
+func TestFilePersister_DuplicateIDsInBatch(t *testing.T) {
+	p, err := NewFilePersister(t.TempDir(), FilePersisterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx := context.Background()
+	if err := p.CommitBatch(ctx, []CommitEntry{{Key: "a", Vector: 5, CommitID: "x"}, {Key: "a", Vector: 5, CommitID: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Recover()["a"]; got != -5 {
+		t.Fatalf("a=%d want -5", got)
+	}
+	if err := p.CommitBatch(ctx, []CommitEntry{{Key: "b", Vector: 1, CommitID: "y"}, {Key: "c", Vector: 1, CommitID: "y"}}); err == nil {
+		t.Fatal("expected conflict for a commit id reused on another key in one batch")
+	}
+}
+
+// TestFilePersister_OversizedLengthIsCorruptTail verifies replay does not trust a huge
+// length from a corrupt header: the record is treated as a torn tail.
+func TestFilePersister_OversizedLengthIsCorruptTail(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewFilePersister(dir, FilePersisterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CommitBatch(context.Background(), []CommitEntry{{Key: "a", Vector: 1, CommitID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[:4], 0xFFFFFFFF)
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write(hdr[:])
+	_ = f.Close()
+
+	p2, err := NewFilePersister(dir, FilePersisterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	if got := p2.Recover()["a"]; got != -1 {
+		t.Fatalf("a=%d want -1", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MySQL schema (reference):
+//
+// CREATE TABLE IF NOT EXISTS counters (
+//   `key` VARCHAR(255) PRIMARY KEY,
+//   scalar BIGINT NOT NULL,
+//   last_token BIGINT NULL
+// ) ENGINE=InnoDB;
+//
+// CREATE TABLE IF NOT EXISTS applied_commits (
+//   commit_id VARCHAR(255) PRIMARY KEY,
+//   `key` VARCHAR(255) NOT NULL,
+//   vc BIGINT NOT NULL,
+//   ts TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+//   INDEX idx_applied_commits_key (`key`)
+// ) ENGINE=InnoDB;
+//
+// Idempotent transaction per commit entry:
+//   INSERT INTO applied_commits(commit_id, `key`, vc) VALUES (?,?,?)
+//     ON DUPLICATE KEY UPDATE commit_id = commit_id;
+//   -- 1 row affected: first sighting, apply it. 0 rows: duplicate, skip the rest.
+//   UPDATE counters SET scalar = scalar - ? WHERE `key` = ?;
+//
+// The duplicate check relies on MySQL reporting 0 affected rows for an ON DUPLICATE KEY
+// UPDATE that changes nothing, so the DSN must not enable clientFoundRows (the
+// go-sql-driver/mysql default leaves it off). The tables must use a transactional
+// engine (InnoDB) so a failed batch leaves neither markers nor counter updates behind.
+
+// MySQLPersister is the MySQL counterpart of PostgresPersister: it applies commits
+// idempotently using the pattern above, with the same CommitBatch contract and
+// optional fencing tokens. It can optionally auto-create missing counter keys with
+// scalar=0.
+type MySQLPersister struct {
+	db                *sql.DB
+	createMissingKeys bool
+	// Optional: per-call timeout fallback if ctx has no deadline
+	defaultTimeout time.Duration
+	isolation      sql.IsolationLevel
+}
+
+// MySQLOptions configures MySQLPersister construction.
+type MySQLOptions struct {
+	// CreateMissingKeys inserts counters rows with scalar=0 on first sight.
+	CreateMissingKeys bool
+
+	// Isolation is the isolation level of each batch transaction. sql.LevelDefault (the
+	// zero value) selects sql.LevelReadCommitted, as for Postgres; the marker insert
+	// serializes duplicates through the primary key under any level.
+	Isolation sql.IsolationLevel
+
+	// StatementTimeout bounds a CommitBatch call whose ctx carries no deadline. 0 keeps
+	// the default of 10s; a negative value disables the fallback.
+	StatementTimeout time.Duration
+}
+
+// NewMySQLPersister creates a persister.
+// If createMissingKeys is true, the persister will INSERT counters rows with scalar=0 on first sight.
+func NewMySQLPersister(db *sql.DB, createMissingKeys bool) *MySQLPersister {
+	return NewMySQLPersisterWithOptions(db, MySQLOptions{CreateMissingKeys: createMissingKeys})
+}
+
+// NewMySQLPersisterWithOptions creates a persister with explicit options.
+func NewMySQLPersisterWithOptions(db *sql.DB, opts MySQLOptions) *MySQLPersister {
+	p := &MySQLPersister{
+		db:                db,
+		createMissingKeys: opts.CreateMissingKeys,
+		defaultTimeout:    10 * time.Second,
+		isolation:         sql.LevelReadCommitted,
+	}
+	if opts.Isolation != sql.LevelDefault {
+		p.isolation = opts.Isolation
+	}
+	if opts.StatementTimeout != 0 {
+		p.defaultTimeout = opts.StatementTimeout
+	}
+	return p
+}
+
+// CommitBatch applies the provided entries within a single transaction.
+// Each entry remains idempotent: if the commit_id already exists, its effects are skipped.
+func (p *MySQLPersister) CommitBatch(ctx context.Context, entries []CommitEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Provide a default timeout if caller didn't bound it.
+	if _, ok := ctx.Deadline(); !ok && p.defaultTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.defaultTimeout)
+		defer cancel()
+	}
+
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: p.isolation})
+	if err != nil {
+		return err
+	}
+	// Ensure rollback on any failure.
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if p.createMissingKeys {
+		for _, e := range entries {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO counters(`key`, scalar) VALUES (?, 0) ON DUPLICATE KEY UPDATE `key` = `key`", e.Key); err != nil {
+				return fmt.Errorf("insert counters(%s): %w", e.Key, err)
+			}
+		}
+	}
+
+	for _, e := range entries {
+		if e.CommitID == "" {
+			return errors.New("CommitEntry.CommitID must be set")
+		}
+		// Applied marker first; 0 affected rows means the commit was applied before.
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO applied_commits(commit_id, `key`, vc) VALUES (?,?,?) ON DUPLICATE KEY UPDATE commit_id = commit_id",
+			e.CommitID, e.Key, e.Vector)
+		if err != nil {
+			return fmt.Errorf("insert applied_commits(%s): %w", e.CommitID, err)
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("insert applied_commits(%s): %w", e.CommitID, err)
+		}
+		if inserted == 0 {
+			continue
+		}
+		// Optional fencing: only move last_token forward.
+		if e.FencingToken != nil {
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE counters SET last_token = ? WHERE `key` = ? AND (last_token IS NULL OR last_token <= ?)",
+				*e.FencingToken, e.Key, *e.FencingToken); err != nil {
+				return fmt.Errorf("update last_token(%s): %w", e.Key, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE counters SET scalar = scalar - ? WHERE `key` = ?",
+			e.Vector, e.Key); err != nil {
+			return fmt.Errorf("update counters(%s): %w", e.Key, err)
+		}
+	}
+
+	return tx.Commit()
+}
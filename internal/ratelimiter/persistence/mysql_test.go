@@ -0,0 +1,116 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMySQLPersister_Empty(t *testing.T) {
+	p := NewMySQLPersister(newSQLDBWithFake(&fakeDB{}), false)
+	if err := p.CommitBatch(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+}
+
+func TestMySQLPersister_CreateMissingKeys_AndApply(t *testing.T) {
+	f := &fakeDB{}
+	p := NewMySQLPersister(newSQLDBWithFake(f), true)
+	entries := []CommitEntry{{Key: "k1", Vector: 5, CommitID: "c1"}, {Key: "k2", Vector: -2, CommitID: "c2"}}
+	if err := p.CommitBatch(context.Background(), entries); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if f.commitCount != 1 || f.rollbackCount != 0 {
+		t.Fatalf("commit/rollback mismatch: %d/%d", f.commitCount, f.rollbackCount)
+	}
+	if f.isolation != driver.IsolationLevel(sql.LevelReadCommitted) || !f.hadDeadline {
+		t.Fatalf("BeginTx isolation=%v deadline=%v, want read committed with the default timeout", sql.IsolationLevel(f.isolation), f.hadDeadline)
+	}
+	want := []string{"INSERT INTO counters", "INSERT INTO counters", "INSERT INTO applied_commits", "UPDATE counters SET scalar", "INSERT INTO applied_commits", "UPDATE counters SET scalar"}
+	if len(f.execs) != len(want) {
+		t.Fatalf("want %d execs, got %d: %v", len(want), len(f.execs), f.execs)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(f.execs[i], prefix) {
+			t.Fatalf("exec %d: want %q..., got %q", i+1, prefix, f.execs[i])
+		}
+	}
+	if !strings.Contains(f.execs[2], "ON DUPLICATE KEY UPDATE") {
+		t.Fatalf("applied marker must be an upsert: %s", f.execs[2])
+	}
+}
+
+func TestMySQLPersister_DuplicateIsNoOp(t *testing.T) {
+	// The marker insert for c1 (exec 1) reports 0 rows: c1 was applied before.
+	f := &fakeDB{rowsAt: map[int]int64{1: 0}}
+	p := NewMySQLPersister(newSQLDBWithFake(f), false)
+	ft := int64(7)
+	entries := []CommitEntry{{Key: "k", Vector: 5, CommitID: "c1", FencingToken: &ft}, {Key: "k", Vector: 2, CommitID: "c2"}}
+	if err := p.CommitBatch(context.Background(), entries); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	var updates []driver.NamedValue
+	for i, q := range f.execs {
+		if strings.HasPrefix(q, "UPDATE counters") {
+			updates = append(updates, f.execArgs[i]...)
+		}
+	}
+	// Only c2's scalar update runs: no fencing or scalar update for the duplicate.
+	if len(f.execs) != 3 || len(updates) != 2 || updates[0].Value != int64(2) {
+		t.Fatalf("duplicate commit was applied: execs=%v", f.execs)
+	}
+	if f.commitCount != 1 {
+		t.Fatalf("expected one commit, got %d", f.commitCount)
+	}
+}
+
+func TestMySQLPersister_FencingToken_Update(t *testing.T) {
+	f := &fakeDB{}
+	p := NewMySQLPersister(newSQLDBWithFake(f), false)
+	ft := int64(99)
+	if err := p.CommitBatch(context.Background(), []CommitEntry{{Key: "k", Vector: 1, CommitID: "c", FencingToken: &ft}}); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if len(f.execs) != 3 || !strings.HasPrefix(f.execs[1], "UPDATE counters SET last_token") {
+		t.Fatalf("expected a last_token update between marker and scalar update, got: %v", f.execs)
+	}
+}
+
+func TestMySQLPersister_ExecError_Rollback(t *testing.T) {
+	f := &fakeDB{failExecAt: map[int]error{2: errors.New("boom")}}
+	p := NewMySQLPersister(newSQLDBWithFake(f), false)
+	err := p.CommitBatch(context.Background(), []CommitEntry{{Key: "k", Vector: 1, CommitID: "c"}})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if f.rollbackCount != 1 || f.commitCount != 0 {
+		t.Fatalf("expected rollback only, got c=%d r=%d", f.commitCount, f.rollbackCount)
+	}
+}
+
+func TestMySQLPersister_MissingCommitID_RollsBack(t *testing.T) {
+	f := &fakeDB{}
+	p := NewMySQLPersister(newSQLDBWithFake(f), false)
+	err := p.CommitBatch(context.Background(), []CommitEntry{{Key: "a"}})
+	if err == nil || err.Error() != "CommitEntry.CommitID must be set" {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if f.rollbackCount != 1 || f.commitCount != 0 || len(f.execs) != 0 {
+		t.Fatalf("expected rollback with no execs, got c=%d r=%d execs=%d", f.commitCount, f.rollbackCount, len(f.execs))
+	}
+}
+
+func TestMySQLPersister_CommitError(t *testing.T) {
+	f := &fakeDB{failCommit: errors.New("commit-fail")}
+	p := NewMySQLPersister(newSQLDBWithFake(f), false)
+	err := p.CommitBatch(context.Background(), []CommitEntry{{Key: "k", Vector: 1, CommitID: "c"}})
+	if err == nil || err.Error() != "commit-fail" {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if f.commitCount != 1 {
+		t.Fatalf("expected one commit attempt")
+	}
+}
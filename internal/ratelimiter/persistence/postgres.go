@@ -21,6 +21,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -39,6 +40,7 @@ import (
 //   ts TIMESTAMPTZ NOT NULL DEFAULT now()
 // );
 // CREATE INDEX IF NOT EXISTS idx_applied_commits_key ON applied_commits(key);
+// CREATE INDEX IF NOT EXISTS idx_applied_commits_ts ON applied_commits(ts); -- for PruneApplied
 //
 // Idempotent transaction per commit entry:
 //   INSERT INTO applied_commits(commit_id, key, vc) VALUES ($1,$2,$3)
@@ -50,6 +52,18 @@ import (
 //       SELECT 1 FROM applied_commits WHERE commit_id = $1
 //     );
 // Optionally, pre-create the counter row to avoid UPDATE=0 when key is unknown.
+//
+// Bulk mode (PostgresOptions.BulkUpdateThreshold) replaces the per-entry UPDATE with a
+// single statement per chunk. Entries repeating a CommitID are dropped first (the first
+// occurrence wins), so no commit reaches two VALUES rows or two chunks. The guard runs
+// before the markers are inserted, and deltas are summed per key:
+//   UPDATE counters SET scalar = scalar - d.delta
+//     FROM (SELECT v.key, SUM(v.delta) AS delta
+//             FROM (VALUES ($1::text,$2::text,$3::bigint), ...) AS v(commit_id, key, delta)
+//            WHERE NOT EXISTS (SELECT 1 FROM applied_commits a WHERE a.commit_id = v.commit_id)
+//            GROUP BY v.key) AS d
+//    WHERE counters.key = d.key;
+//   INSERT INTO applied_commits(commit_id, key, vc) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING; -- per entry
 
 // PostgresPersister applies commits idempotently using the safe pattern above.
 // It can optionally auto-create missing counter keys with scalar=0.
@@ -58,12 +72,59 @@ type PostgresPersister struct {
 	createMissingKeys bool
 	// Optional: per-call timeout fallback if ctx has no deadline
 	defaultTimeout time.Duration
+	// bulkThreshold > 0 enables the multi-row UPDATE path for batches of at least this size.
+	bulkThreshold int
+	isolation     sql.IsolationLevel
+}
+
+// PostgresOptions configures PostgresPersister construction.
+type PostgresOptions struct {
+	// CreateMissingKeys inserts counters rows with scalar=0 on first sight.
+	CreateMissingKeys bool
+
+	// BulkUpdateThreshold > 0 applies all non-duplicate commits of a batch with one
+	// multi-row UPDATE (chunked at postgresBulkChunk rows) when the batch has at least
+	// this many entries. Smaller batches, and batches carrying fencing tokens, keep the
+	// per-entry path. Default 0 (disabled).
+	BulkUpdateThreshold int
+
+	// Isolation is the isolation level of each batch transaction. sql.LevelDefault (the
+	// zero value) keeps sql.LevelReadCommitted, which the idempotency guard is designed
+	// for; sql.LevelSerializable trades throughput under contention for stricter
+	// guarantees, and callers must then retry serialization failures.
+	Isolation sql.IsolationLevel
+
+	// StatementTimeout bounds a CommitBatch call whose ctx carries no deadline. 0 keeps
+	// the default of 10s; a negative value disables the fallback.
+	StatementTimeout time.Duration
 }
 
+// postgresBulkChunk bounds the rows per bulk UPDATE to stay well below the
+// 65535 bind-parameter limit of the Postgres wire protocol (3 params per row).
+const postgresBulkChunk = 1000
+
 // NewPostgresPersister creates a persister.
 // If createMissingKeys is true, the persister will INSERT counters rows with scalar=0 on first sight.
 func NewPostgresPersister(db *sql.DB, createMissingKeys bool) *PostgresPersister {
-	return &PostgresPersister{db: db, createMissingKeys: createMissingKeys, defaultTimeout: 10 * time.Second}
+	return NewPostgresPersisterWithOptions(db, PostgresOptions{CreateMissingKeys: createMissingKeys})
+}
+
+// NewPostgresPersisterWithOptions creates a persister with explicit options.
+func NewPostgresPersisterWithOptions(db *sql.DB, opts PostgresOptions) *PostgresPersister {
+	p := &PostgresPersister{
+		db:                db,
+		createMissingKeys: opts.CreateMissingKeys,
+		defaultTimeout:    10 * time.Second,
+		bulkThreshold:     opts.BulkUpdateThreshold,
+		isolation:         sql.LevelReadCommitted,
+	}
+	if opts.Isolation != sql.LevelDefault {
+		p.isolation = opts.Isolation
+	}
+	if opts.StatementTimeout != 0 {
+		p.defaultTimeout = opts.StatementTimeout
+	}
+	return p
 }
 
 // CommitBatch applies the provided entries within a single transaction.
@@ -82,7 +143,7 @@ func (p *PostgresPersister) CommitBatch(ctx context.Context, entries []CommitEnt
 		defer cancel()
 	}
 
-	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: p.isolation})
 	if err != nil {
 		return err
 	}
@@ -102,6 +163,13 @@ func (p *PostgresPersister) CommitBatch(ctx context.Context, entries []CommitEnt
 		}
 	}
 
+	if p.useBulk(entries) {
+		if err := p.applyBulk(ctx, tx, entries); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
 	for _, e := range entries {
 		if e.CommitID == "" {
 			return errors.New("CommitEntry.CommitID must be set")
@@ -136,3 +204,101 @@ func (p *PostgresPersister) CommitBatch(ctx context.Context, entries []CommitEnt
 	}
 	return nil
 }
+
+// PruneApplied deletes the applied-commit markers recorded more than olderThan ago and
+// returns the number removed, so applied_commits and its index stop growing without
+// bound. Dropping a marker is safe once its commit can no longer be retried: the
+// counter update it guarded is already durable. olderThan must therefore exceed any
+// retry window (a worker resubmits a failed batch with the same ids until it
+// succeeds); a retry of a pruned commit would be applied twice. olderThan <= 0 is
+// rejected. A ctx without a deadline gets the StatementTimeout fallback.
+func (p *PostgresPersister) PruneApplied(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if olderThan <= 0 {
+		return 0, errors.New("PruneApplied: olderThan must be positive")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok && p.defaultTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.defaultTimeout)
+		defer cancel()
+	}
+	cutoff := time.Now().Add(-olderThan)
+	res, err := p.db.ExecContext(ctx, `DELETE FROM applied_commits WHERE ts < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("prune applied_commits: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// useBulk reports whether the batch qualifies for the multi-row UPDATE path.
+// Fencing tokens need per-entry conditional updates, so such batches stay per-entry.
+func (p *PostgresPersister) useBulk(entries []CommitEntry) bool {
+	if p.bulkThreshold <= 0 || len(entries) < p.bulkThreshold {
+		return false
+	}
+	for _, e := range entries {
+		if e.FencingToken != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// applyBulk updates counters with one statement per chunk, then records the applied markers.
+// The UPDATE must run before the markers are inserted so its NOT EXISTS guard only skips
+// commits applied by earlier batches; the guard cannot see a CommitID repeated within the
+// batch, so repeats are dropped beforehand.
+func (p *PostgresPersister) applyBulk(ctx context.Context, tx *sql.Tx, entries []CommitEntry) error {
+	seen := make(map[string]struct{}, len(entries))
+	uniq := make([]CommitEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.CommitID == "" {
+			return errors.New("CommitEntry.CommitID must be set")
+		}
+		if _, dup := seen[e.CommitID]; dup {
+			continue
+		}
+		seen[e.CommitID] = struct{}{}
+		uniq = append(uniq, e)
+	}
+	entries = uniq
+	for start := 0; start < len(entries); start += postgresBulkChunk {
+		end := min(start+postgresBulkChunk, len(entries))
+		query, args := bulkUpdateQuery(entries[start:end])
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("bulk update counters(%d entries): %w", end-start, err)
+		}
+	}
+	for _, e := range entries {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO applied_commits(commit_id, key, vc) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`,
+			e.CommitID, e.Key, e.Vector); err != nil {
+			return fmt.Errorf("insert applied_commits(%s): %w", e.CommitID, err)
+		}
+	}
+	return nil
+}
+
+// bulkUpdateQuery builds the multi-row UPDATE and its positional arguments for the given entries.
+func bulkUpdateQuery(entries []CommitEntry) (string, []interface{}) {
+	var b strings.Builder
+	args := make([]interface{}, 0, 3*len(entries))
+	b.WriteString(`UPDATE counters SET scalar = scalar - d.delta
+               FROM (SELECT v.key, SUM(v.delta) AS delta
+                       FROM (VALUES `)
+	for i, e := range entries {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		n := 3 * i
+		fmt.Fprintf(&b, "($%d::text,$%d::text,$%d::bigint)", n+1, n+2, n+3)
+		args = append(args, e.CommitID, e.Key, e.Vector)
+	}
+	b.WriteString(`) AS v(commit_id, key, delta)
+                      WHERE NOT EXISTS (SELECT 1 FROM applied_commits a WHERE a.commit_id = v.commit_id)
+                      GROUP BY v.key) AS d
+              WHERE counters.key = d.key`)
+	return b.String(), args
+}
@@ -5,19 +5,25 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Minimal fake SQL driver to exercise PostgresPersister transaction and Exec paths.
 
 type fakeDB struct {
 	execs         []string
+	execArgs      [][]driver.NamedValue
 	failBegin     error
 	failCommit    error
 	failExecAt    map[int]error // 1-based index of exec call -> error
+	rowsAt        map[int]int64 // 1-based index of exec call -> rows affected (default 1)
 	commitCount   int
 	rollbackCount int
+	isolation     driver.IsolationLevel // of the last BeginTx
+	hadDeadline   bool                  // whether the last BeginTx ctx had a deadline
 }
 
 type fakeDriver struct{}
@@ -31,8 +37,8 @@ type fakeTx struct {
 
 type fakeResult int
 
-func (fakeResult) LastInsertId() (int64, error) { return 0, nil }
-func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+func (fakeResult) LastInsertId() (int64, error)   { return 0, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return int64(r), nil }
 
 func (fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{db: testFakeDB}, nil }
 
@@ -47,17 +53,23 @@ func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.T
 	if c.db.failBegin != nil {
 		return nil, c.db.failBegin
 	}
+	c.db.isolation = opts.Isolation
+	_, c.db.hadDeadline = ctx.Deadline()
 	return &fakeTx{db: c.db}, nil
 }
 func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
 	// Record queries
 	c.db.execs = append(c.db.execs, query)
+	c.db.execArgs = append(c.db.execArgs, args)
 	idx := len(c.db.execs)
 	if c.db.failExecAt != nil {
 		if err, ok := c.db.failExecAt[idx]; ok {
 			return nil, err
 		}
 	}
+	if n, ok := c.db.rowsAt[idx]; ok {
+		return fakeResult(n), nil
+	}
 	return fakeResult(1), nil
 }
 
@@ -101,6 +113,38 @@ func TestPostgresPersister_Empty(t *testing.T) {
 	}
 }
 
+func TestPostgresPersister_IsolationAndTimeoutOptions(t *testing.T) {
+	entries := []CommitEntry{{Key: "k", Vector: 1, CommitID: "c1"}}
+	for _, tc := range []struct {
+		name         string
+		opts         PostgresOptions
+		wantIso      sql.IsolationLevel
+		wantDeadline bool
+	}{
+		{"defaults", PostgresOptions{}, sql.LevelReadCommitted, true},
+		{"serializable", PostgresOptions{Isolation: sql.LevelSerializable}, sql.LevelSerializable, true},
+		{"no timeout", PostgresOptions{StatementTimeout: -1}, sql.LevelReadCommitted, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeDB{}
+			p := NewPostgresPersisterWithOptions(newSQLDBWithFake(f), tc.opts)
+			if err := p.CommitBatch(context.Background(), entries); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			if f.isolation != driver.IsolationLevel(tc.wantIso) {
+				t.Fatalf("BeginTx isolation=%v want %v", sql.IsolationLevel(f.isolation), tc.wantIso)
+			}
+			if f.hadDeadline != tc.wantDeadline {
+				t.Fatalf("BeginTx ctx deadline=%v want %v", f.hadDeadline, tc.wantDeadline)
+			}
+		})
+	}
+	p := NewPostgresPersisterWithOptions(nil, PostgresOptions{StatementTimeout: 3 * time.Second})
+	if p.defaultTimeout != 3*time.Second {
+		t.Fatalf("defaultTimeout=%v want 3s", p.defaultTimeout)
+	}
+}
+
 func TestPostgresPersister_MissingCommitID_RollsBack(t *testing.T) {
 	f := &fakeDB{}
 	db := newSQLDBWithFake(f)
@@ -198,3 +242,146 @@ func TestPostgresPersister_CommitError(t *testing.T) {
 		t.Fatalf("expected one commit attempt")
 	}
 }
+
+func TestPostgresPersister_BulkUpdate_SingleStatement(t *testing.T) {
+	f := &fakeDB{}
+	db := newSQLDBWithFake(f)
+	p := NewPostgresPersisterWithOptions(db, PostgresOptions{BulkUpdateThreshold: 100})
+	entries := make([]CommitEntry, 500)
+	for i := range entries {
+		entries[i] = CommitEntry{Key: fmt.Sprintf("k%d", i%50), Vector: int64(i%7 - 3), CommitID: fmt.Sprintf("c%d", i)}
+	}
+	if err := p.CommitBatch(context.Background(), entries); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	var updates, applied int
+	for _, q := range f.execs {
+		if strings.Contains(q, "UPDATE counters SET scalar = scalar - d.delta") {
+			updates++
+		}
+		if strings.Contains(q, "INSERT INTO applied_commits") {
+			applied++
+		}
+	}
+	if updates != 1 || applied != 500 || len(f.execs) != 501 {
+		t.Fatalf("want 1 bulk update + 500 applied inserts, got updates=%d applied=%d execs=%d", updates, applied, len(f.execs))
+	}
+	// The bulk UPDATE must run before the markers so its guard only skips earlier batches.
+	if !strings.Contains(f.execs[0], "NOT EXISTS") || !strings.Contains(f.execs[0], "GROUP BY v.key") {
+		t.Fatalf("first exec should be the guarded bulk update, got: %s", f.execs[0])
+	}
+	if f.commitCount != 1 {
+		t.Fatalf("expected one commit, got %d", f.commitCount)
+	}
+}
+
+func TestPostgresPersister_BulkUpdate_FallsBackBelowThresholdOrWithFencing(t *testing.T) {
+	f := &fakeDB{}
+	db := newSQLDBWithFake(f)
+	p := NewPostgresPersisterWithOptions(db, PostgresOptions{BulkUpdateThreshold: 3})
+	if err := p.CommitBatch(context.Background(), []CommitEntry{{Key: "a", Vector: 1, CommitID: "c1"}, {Key: "b", Vector: 1, CommitID: "c2"}}); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	ft := int64(1)
+	if err := p.CommitBatch(context.Background(), []CommitEntry{
+		{Key: "a", Vector: 1, CommitID: "c3"}, {Key: "b", Vector: 1, CommitID: "c4"}, {Key: "c", Vector: 1, CommitID: "c5", FencingToken: &ft},
+	}); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	for _, q := range f.execs {
+		if strings.Contains(q, "d.delta") {
+			t.Fatalf("bulk path should not be used: %v", f.execs)
+		}
+	}
+}
+
+func TestPostgresPersister_BulkUpdate_ChunksLargeBatches(t *testing.T) {
+	f := &fakeDB{}
+	db := newSQLDBWithFake(f)
+	p := NewPostgresPersisterWithOptions(db, PostgresOptions{BulkUpdateThreshold: 1})
+	n := postgresBulkChunk*2 + 1
+	entries := make([]CommitEntry, n)
+	for i := range entries {
+		entries[i] = CommitEntry{Key: "k", Vector: 1, CommitID: fmt.Sprintf("c%d", i)}
+	}
+	if err := p.CommitBatch(context.Background(), entries); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	var updates int
+	for _, q := range f.execs {
+		if strings.Contains(q, "d.delta") {
+			updates++
+		}
+	}
+	if updates != 3 {
+		t.Fatalf("expected 3 chunked updates, got %d", updates)
+	}
+}
+
+// TestPostgresPersister_BulkUpdate_DedupesCommitIDs verifies that a CommitID repeated
+// within a batch, including across chunk boundaries, reaches the bulk UPDATE once.
+func TestPostgresPersister_BulkUpdate_DedupesCommitIDs(t *testing.T) {
+	f := &fakeDB{}
+	p := NewPostgresPersisterWithOptions(newSQLDBWithFake(f), PostgresOptions{BulkUpdateThreshold: 1})
+	entries := make([]CommitEntry, 0, postgresBulkChunk+2)
+	for i := 0; i < postgresBulkChunk; i++ {
+		entries = append(entries, CommitEntry{Key: "k", Vector: 1, CommitID: fmt.Sprintf("c%d", i)})
+	}
+	// c0 again lands in a second chunk without deduplication; c1 repeats within the batch.
+	entries = append(entries, CommitEntry{Key: "k", Vector: 1, CommitID: "c0"}, CommitEntry{Key: "k", Vector: 1, CommitID: "c1"})
+	if err := p.CommitBatch(context.Background(), entries); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	var updates, applied int
+	ids := map[string]int{}
+	for i, q := range f.execs {
+		switch {
+		case strings.Contains(q, "d.delta"):
+			updates++
+			for j := 0; j < len(f.execArgs[i]); j += 3 {
+				ids[f.execArgs[i][j].Value.(string)]++
+			}
+		case strings.Contains(q, "INSERT INTO applied_commits"):
+			applied++
+		}
+	}
+	if updates != 1 || applied != postgresBulkChunk || len(ids) != postgresBulkChunk {
+		t.Fatalf("want 1 update over %d unique ids and as many markers, got updates=%d ids=%d applied=%d", postgresBulkChunk, updates, len(ids), applied)
+	}
+	for id, n := range ids {
+		if n != 1 {
+			t.Fatalf("commit %s appears %d times in the bulk update", id, n)
+		}
+	}
+}
+
+func TestPostgresPersister_PruneApplied(t *testing.T) {
+	f := &fakeDB{rowsAt: map[int]int64{1: 42}}
+	p := NewPostgresPersister(newSQLDBWithFake(f), false)
+	before := time.Now()
+	n, err := p.PruneApplied(context.Background(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if n != 42 {
+		t.Fatalf("removed=%d want 42", n)
+	}
+	if len(f.execs) != 1 || !strings.Contains(f.execs[0], "DELETE FROM applied_commits WHERE ts < $1") {
+		t.Fatalf("expected one DELETE on applied_commits, got %v", f.execs)
+	}
+	cutoff, ok := f.execArgs[0][0].Value.(time.Time)
+	if !ok {
+		t.Fatalf("cutoff arg = %#v, want time.Time", f.execArgs[0][0].Value)
+	}
+	if lo, hi := before.Add(-time.Hour), time.Now().Add(-time.Hour); cutoff.Before(lo) || cutoff.After(hi) {
+		t.Fatalf("cutoff=%v want within [%v, %v]", cutoff, lo, hi)
+	}
+
+	if _, err := p.PruneApplied(context.Background(), 0); err == nil {
+		t.Fatalf("olderThan=0 must be rejected")
+	}
+	f.failExecAt = map[int]error{2: errors.New("boom")}
+	if _, err := p.PruneApplied(context.Background(), time.Hour); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected exec error, got %v", err)
+	}
+}
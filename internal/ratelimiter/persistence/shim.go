@@ -25,7 +25,8 @@ import (
 )
 
 // IdemShim adapts an IdempotentPersister to the existing core.Persister interface
-// used by the worker. It generates idempotency CommitIDs for each entry.
+// used by the worker. It forwards core.Commit.CommitID when set and otherwise generates
+// an idempotency CommitID for the entry.
 //
 // Note: In production, you should provide stable IDs across retries. This shim
 // generates fresh random IDs per call, which is sufficient for the demo wiring
@@ -44,7 +45,10 @@ func (s *IdemShim) CommitBatch(commits []core.Commit) error {
 	entries := make([]CommitEntry, len(commits))
 	now := time.Now().UnixNano()
 	for i, c := range commits {
-		id := randomID()
+		id := c.CommitID
+		if id == "" {
+			id = randomID()
+		}
 		entries[i] = CommitEntry{Key: c.Key, Vector: c.Vector, CommitID: id}
 		// note: FencingToken omitted in demo
 		_ = now // reserved in case we switch to time-based ULIDs later
@@ -14,7 +14,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package persistence provides idempotent persistence adapters for Postgres, Redis, and Kafka.
+// Package persistence provides idempotent persistence adapters for Postgres, MySQL, Redis, and Kafka.
 //
 // These adapters implement a common Commit shape that includes an idempotency key (commit_id)
 // and an optional fencing token. The goal is that if a commit is retried (crash, timeout,
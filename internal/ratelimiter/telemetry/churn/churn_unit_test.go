@@ -1,12 +1,16 @@
 package churn
 
 import (
+	"encoding/json"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"runtime"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -58,6 +62,37 @@ func TestEnableSamplingAndRequests(t *testing.T) {
 	ObserveCommit("key-1", 3)
 }
 
+// TestObserveRequestCost_ScalesBaseline verifies that weighted admits grow the naive
+// baseline (Prometheus counter, unsampled and sampled totals) by their cost, that
+// rejections add nothing, and that ObserveRequest stays a cost-1 shim.
+func TestObserveRequestCost_ScalesBaseline(t *testing.T) {
+	Enable(Config{Enabled: true, SampleRate: 1, LogInterval: 0})
+	t.Cleanup(func() { Enable(Config{Enabled: false, LogInterval: 0}) })
+
+	prom, all, internal := testutil.ToFloat64(naiveWritesTotal), naiveWritesAll.Load(), naiveWritesInternal.Load()
+	check := func(stage string, want int64) {
+		t.Helper()
+		if d := testutil.ToFloat64(naiveWritesTotal) - prom; d != float64(want) {
+			t.Fatalf("%s: naiveWritesTotal delta = %v, want %d", stage, d, want)
+		}
+		if d := naiveWritesAll.Load() - all; d != want {
+			t.Fatalf("%s: naiveWritesAll delta = %d, want %d", stage, d, want)
+		}
+		if d := naiveWritesInternal.Load() - internal; d != want {
+			t.Fatalf("%s: naiveWritesInternal delta = %d, want %d", stage, d, want)
+		}
+	}
+
+	ObserveRequestCost("weighted", true, 5)
+	check("cost 5", 5)
+	ObserveRequestCost("weighted", false, 7)
+	check("rejected", 5)
+	ObserveRequest("weighted", true)
+	check("cost-1 shim", 6)
+	ObserveRequestCost("weighted", true, 0)
+	check("non-positive cost", 7)
+}
+
 // TestExporterSnapshotAndGauges exercises publishSnapshot and KPI gauges across a short window.
 func TestExporterSnapshotAndGauges(t *testing.T) {
 	t.Setenv("VSA_CHURN_LIVE", "0") // force non-live rendering path for deterministic output
@@ -272,3 +307,211 @@ func TestEnableStartsMetricsEndpoint(t *testing.T) {
 	// Turn off
 	Enable(Config{Enabled: false, LogInterval: 0})
 }
+
+// TestChurnKeyEndpoint drives admits and commits for a key, then queries /churn/key by
+// full hash and by logged prefix, and checks the 404/400 paths.
+func TestChurnKeyEndpoint(t *testing.T) {
+	Enable(Config{Enabled: true, SampleRate: 1, LogInterval: 0})
+	t.Cleanup(func() { Enable(Config{Enabled: false, LogInterval: 0}) })
+
+	const key = "churn-endpoint-key"
+	for i := 0; i < 6; i++ {
+		ObserveRequest(key, true)
+	}
+	ObserveCommit(key, 2)
+	ObserveCommit(key, -1)
+
+	get := func(hash string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleChurnKey(rec, httptest.NewRequest(http.MethodGet, "/churn/key?hash="+hash, nil))
+		return rec
+	}
+	full := shortHash(hashKey(key), 16)
+	for _, h := range []string{full, "0x" + full, full[:10]} {
+		rec := get(h)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("hash=%s: status=%d body=%s", h, rec.Code, rec.Body.String())
+		}
+		var got struct {
+			Hash        string    `json:"hash"`
+			Abs         int64     `json:"abs"`
+			Net         int64     `json:"net"`
+			ChurnFactor float64   `json:"churnFactor"`
+			LastUpdate  time.Time `json:"lastUpdate"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash != full || got.Abs != 6 || got.Net != 3 || got.ChurnFactor != 2 {
+			t.Fatalf("hash=%s: got %+v, want abs=6 net=3 churnFactor=2", h, got)
+		}
+		if time.Since(got.LastUpdate) > time.Minute {
+			t.Fatalf("lastUpdate=%v not recent", got.LastUpdate)
+		}
+	}
+	if rec := get(shortHash(hashKey("never-seen-key"), 16)); rec.Code != http.StatusNotFound {
+		t.Fatalf("untracked key: status=%d, want 404", rec.Code)
+	}
+	if rec := get("xyz"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad hash: status=%d, want 400", rec.Code)
+	}
+}
+
+// TestChurnSnapshotEndpoint drives activity between two recorded points and checks
+// that /churn/snapshot reports the noisiest key on top plus the windowed KPIs.
+func TestChurnSnapshotEndpoint(t *testing.T) {
+	t.Setenv("VSA_CHURN_LIVE", "0")
+	Enable(Config{Enabled: true, SampleRate: 1, LogInterval: 0, Window: time.Minute, TopN: 3})
+	t.Cleanup(func() { Enable(Config{Enabled: false, LogInterval: 0}) })
+
+	ResetAggregates() // drop keys and points recorded by earlier tests
+	publishSnapshot() // window baseline
+	const hot = "snapshot-hot-key"
+	for i := 0; i < 500; i++ {
+		ObserveRequest(hot, true)
+	}
+	ObserveBatch(1)
+	ObserveCommit(hot, 1)
+
+	rec := httptest.NewRecorder()
+	handleChurnSnapshot(rec, httptest.NewRequest(http.MethodGet, "/churn/snapshot", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d", rec.Code)
+	}
+	var got struct {
+		TopKeys []struct {
+			KeyHash     string  `json:"keyHash"`
+			Abs         int64   `json:"abs"`
+			Net         int64   `json:"net"`
+			ChurnFactor float64 `json:"churnFactor"`
+		} `json:"topKeys"`
+		KeysTracked    int     `json:"keysTracked"`
+		WriteReduction float64 `json:"writeReduction"`
+		Churn          float64 `json:"churn"`
+		Naive          int64   `json:"naive"`
+		Commits        int64   `json:"commits"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	if len(got.TopKeys) == 0 || len(got.TopKeys) > 3 || got.KeysTracked < 1 {
+		t.Fatalf("unexpected rows: %+v", got)
+	}
+	top := got.TopKeys[0]
+	if top.KeyHash != shortHash(hashKey(hot), 16) || top.Abs != 500 || top.Net != 1 || top.ChurnFactor != 500 {
+		t.Fatalf("top key=%+v, want %s abs=500 net=1 churn=500", top, shortHash(hashKey(hot), 16))
+	}
+	if got.Naive != 500 || got.Commits != 1 || got.WriteReduction != 1-1.0/500 || got.Churn != 500 {
+		t.Fatalf("windowed KPIs: %+v", got)
+	}
+}
+
+// TestResetAggregates verifies the in-process churn state is cleared while the
+// Prometheus counters keep their totals.
+func TestResetAggregates(t *testing.T) {
+	t.Setenv("VSA_CHURN_LIVE", "0")
+	Enable(Config{Enabled: true, SampleRate: 1, LogInterval: 0, Window: time.Minute})
+	t.Cleanup(func() { Enable(Config{Enabled: false, LogInterval: 0}) })
+
+	for _, k := range []string{"reset-a", "reset-b", "reset-c"} {
+		ObserveRequest(k, true)
+		ObserveCommit(k, 1)
+	}
+	ObserveBatch(3)
+	publishSnapshot()
+	if got := testutil.ToFloat64(keysTracked); got < 3 {
+		t.Fatalf("keysTracked=%v before reset, want >= 3", got)
+	}
+	naiveBefore := testutil.ToFloat64(naiveWritesTotal)
+	rowsBefore := testutil.ToFloat64(commitsRowsTotal)
+
+	ResetAggregates()
+	if got := testutil.ToFloat64(keysTracked); got != 0 {
+		t.Fatalf("keysTracked=%v after reset, want 0", got)
+	}
+	publishSnapshot()
+	if got := testutil.ToFloat64(keysTracked); got != 0 {
+		t.Fatalf("keysTracked=%v on the next snapshot, want 0", got)
+	}
+	if sumAbsGlobal.Load() != 0 || sumNetGlobal.Load() != 0 || naiveWritesInternal.Load() != 0 {
+		t.Fatalf("global sums not zeroed")
+	}
+	windowMu.Lock()
+	n := len(windowPoints)
+	windowMu.Unlock()
+	if n != 1 {
+		t.Fatalf("window should restart from the post-reset snapshot, have %d points", n)
+	}
+	if testutil.ToFloat64(naiveWritesTotal) != naiveBefore || testutil.ToFloat64(commitsRowsTotal) != rowsBefore {
+		t.Fatalf("Prometheus counters must keep their totals across a reset")
+	}
+}
+
+// churnFactorHistogram returns the vsa_key_churn_factor sample count, sum and
+// cumulative bucket counts keyed by upper bound.
+func churnFactorHistogram(t *testing.T) (uint64, float64, map[float64]uint64) {
+	t.Helper()
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "vsa_key_churn_factor" {
+			continue
+		}
+		h := mf.GetMetric()[0].GetHistogram()
+		buckets := map[float64]uint64{}
+		for _, b := range h.GetBucket() {
+			buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+		}
+		return h.GetSampleCount(), h.GetSampleSum(), buckets
+	}
+	t.Fatalf("vsa_key_churn_factor not registered")
+	return 0, 0, nil
+}
+
+// TestKeyChurnFactorHistogram drives keys with known churn factors and checks each is
+// observed once per snapshot in the right bucket.
+func TestKeyChurnFactorHistogram(t *testing.T) {
+	t.Setenv("VSA_CHURN_LIVE", "0")
+	Enable(Config{Enabled: true, SampleRate: 1, LogInterval: 0, Window: time.Minute})
+	t.Cleanup(func() { Enable(Config{Enabled: false, LogInterval: 0}) })
+	ResetAggregates()
+
+	factors := map[string]int{"cf-1": 1, "cf-5": 5, "cf-20": 20, "cf-80": 80}
+	for k, f := range factors {
+		for i := 0; i < f; i++ {
+			ObserveRequest(k, true)
+		}
+		ObserveCommit(k, 1)
+	}
+	count0, sum0, buckets0 := churnFactorHistogram(t)
+	publishSnapshot()
+	count, sum, buckets := churnFactorHistogram(t)
+	if count-count0 != 4 || sum-sum0 != 106 {
+		t.Fatalf("observations: count delta=%d sum delta=%v, want 4 and 106", count-count0, sum-sum0)
+	}
+	bounds := prometheus.ExponentialBucketsRange(1, 100, 11)
+	if bounds[0] != 1 || math.Abs(bounds[len(bounds)-1]-100) > 1e-9 {
+		t.Fatalf("buckets should span 1..100, got %v", bounds)
+	}
+	// Each factor lands in its own log-scale bucket: the cumulative count grows by
+	// one at the first bound >= factor.
+	for _, f := range []float64{1, 5, 20, 80} {
+		var below, at float64
+		for _, b := range bounds {
+			if b >= f {
+				at = b
+				break
+			}
+			below = b
+		}
+		step := (buckets[at] - buckets0[at]) - (buckets[below] - buckets0[below])
+		if below == 0 {
+			step = buckets[at] - buckets0[at]
+		}
+		if step != 1 {
+			t.Fatalf("factor %v: bucket (%v,%v] grew by %d, want 1", f, below, at, step)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package churn
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"runtime"
 	"sort"
@@ -108,35 +110,74 @@ func exporterLoop(stop <-chan struct{}, done chan<- struct{}) {
 	}
 }
 
-func publishSnapshot() {
-	// Load current config snapshot safely
-	cfgAny := currCfg.Load()
-	cfg, _ := cfgAny.(Config)
-	// Snapshot aggregates and evict idle keys beyond 2x Window
+// ResetAggregates clears the in-process churn state: per-key aggregates, the sampled
+// global sums behind the churn KPI, and the rolling KPI window, and sets
+// vsa_keys_tracked to zero. It affects only the in-process churn KPIs (/churn/*,
+// console summary, ratio gauges after the next snapshot); the registered Prometheus
+// counters keep their monotonic totals. Use it in long-lived processes to start a
+// fresh inspection period.
+func ResetAggregates() {
+	agg.Range(func(k, _ any) bool {
+		agg.Delete(k)
+		return true
+	})
+	sumAbsGlobal.Store(0)
+	sumNetGlobal.Store(0)
+	naiveWritesInternal.Store(0)
+	windowMu.Lock()
+	windowPoints = nil
+	windowMu.Unlock()
+	keysTracked.Set(0)
+}
+
+// snapshotRow is one top-N key in a snapshot.
+type snapshotRow struct {
+	KeyHash     string  `json:"keyHash"` // 16 hex chars, as accepted by /churn/key
+	Abs         int64   `json:"abs"`
+	Net         int64   `json:"net"`
+	ChurnFactor float64 `json:"churnFactor"`
+
+	hash uint64
+}
+
+// snapshot is the exporter's view at one instant: the top-N keys by churn factor plus
+// the KPIs over the rolling window. It is what the terminal renderer prints and what
+// /churn/snapshot serves.
+type snapshot struct {
+	At             time.Time     `json:"at"`
+	KeysTracked    int           `json:"keysTracked"`
+	TopKeys        []snapshotRow `json:"topKeys"`
+	WriteReduction float64       `json:"writeReduction"`
+	Churn          float64       `json:"churn"`
+	Naive          int64         `json:"naive"`   // admitted requests in the window
+	Commits        int64         `json:"commits"` // committed rows in the window
+	SampleRate     float64       `json:"sampleRate"`
+}
+
+// buildSnapshot computes a snapshot as of now without side effects: idle keys are
+// skipped rather than evicted, and the window baseline is the oldest recorded point
+// inside cfg.Window (or the current totals when there is none).
+func buildSnapshot(cfg Config, now time.Time) snapshot {
+	snap := snapshot{At: now, SampleRate: cfg.SampleRate, TopKeys: []snapshotRow{}}
+	cutoff := now.Add(-cfg.Window * 2).UnixNano()
 	type row struct {
 		keyHash     uint64
 		abs, net    int64
 		churnFactor float64
 	}
 	rows := make([]row, 0, 1024)
-	var tracked int
-	idleTTL := cfg.Window * 2
-	cutoff := time.Now().Add(-idleTTL).UnixNano()
 	agg.Range(func(k, v any) bool {
 		ka := v.(*keyAgg)
-		last := ka.lastUpdate.Load()
-		if last > 0 && last < cutoff {
-			agg.Delete(k)
+		if last := ka.lastUpdate.Load(); last > 0 && last < cutoff {
 			return true
 		}
-		tracked++
 		a := ka.abs.Load()
 		n := ka.net.Load()
 		cf := float64(a) / float64(max64(1, abs64(n)))
 		rows = append(rows, row{keyHash: k.(uint64), abs: a, net: n, churnFactor: cf})
 		return true
 	})
-	keysTracked.Set(float64(tracked))
+	snap.KeysTracked = len(rows)
 
 	// Pick TopN by churnFactor then by abs desc
 	sort.Slice(rows, func(i, j int) bool {
@@ -148,9 +189,11 @@ func publishSnapshot() {
 	if len(rows) > cfg.TopN {
 		rows = rows[:cfg.TopN]
 	}
+	for _, r := range rows {
+		snap.TopKeys = append(snap.TopKeys, snapshotRow{KeyHash: shortHash(r.keyHash, 16), hash: r.keyHash, Abs: r.abs, Net: r.net, ChurnFactor: r.churnFactor})
+	}
 
-	// Windowed KPIs using rolling points
-	now := time.Now()
+	// Windowed KPIs against the oldest point still inside the window
 	pt := point{
 		ts:      now,
 		naive:   naiveWritesAll.Load(),
@@ -158,10 +201,53 @@ func publishSnapshot() {
 		sumAbs:  sumAbsGlobal.Load(),
 		sumNet:  sumNetGlobal.Load(),
 	}
-	// Protect windowPoints against concurrent publisher/test calls
+	old := pt
+	winStart := now.Add(-cfg.Window)
+	windowMu.Lock()
+	for _, p := range windowPoints {
+		if !p.ts.Before(winStart) {
+			old = p
+			break
+		}
+	}
+	windowMu.Unlock()
+	snap.Naive = pt.naive - old.naive
+	snap.Commits = pt.commits - old.commits
+	dAbs := pt.sumAbs - old.sumAbs
+	dNet := pt.sumNet - old.sumNet
+	snap.WriteReduction = 1.0 - float64(snap.Commits)/float64(max64(1, snap.Naive))
+	snap.Churn = float64(dAbs) / float64(max64(1, abs64(dNet)))
+	return snap
+}
+
+func publishSnapshot() {
+	// Load current config snapshot safely
+	cfgAny := currCfg.Load()
+	cfg, _ := cfgAny.(Config)
+	now := time.Now()
+
+	// Evict idle keys beyond 2x Window; observe the churn factor of the rest
+	cutoff := now.Add(-cfg.Window * 2).UnixNano()
+	agg.Range(func(k, v any) bool {
+		ka := v.(*keyAgg)
+		if last := ka.lastUpdate.Load(); last > 0 && last < cutoff {
+			agg.Delete(k)
+			return true
+		}
+		keyChurnFactor.Observe(float64(ka.abs.Load()) / float64(max64(1, abs64(ka.net.Load()))))
+		return true
+	})
+
+	// Record a KPI point and prune points older than the window
+	// (protect windowPoints against concurrent publisher/test calls)
 	windowMu.Lock()
-	windowPoints = append(windowPoints, pt)
-	// prune old
+	windowPoints = append(windowPoints, point{
+		ts:      now,
+		naive:   naiveWritesAll.Load(),
+		commits: commitRowsInternal.Load(),
+		sumAbs:  sumAbsGlobal.Load(),
+		sumNet:  sumNetGlobal.Load(),
+	})
 	winStart := now.Add(-cfg.Window)
 	idx := 0
 	for idx < len(windowPoints) && windowPoints[idx].ts.Before(winStart) {
@@ -170,15 +256,12 @@ func publishSnapshot() {
 	if idx > 0 {
 		windowPoints = windowPoints[idx:]
 	}
-	old := windowPoints[0]
 	windowMu.Unlock()
 
-	dNaive := pt.naive - old.naive
-	dCommits := pt.commits - old.commits
-	dAbs := pt.sumAbs - old.sumAbs
-	dNet := pt.sumNet - old.sumNet
-	wrWindow := 1.0 - float64(dCommits)/float64(max64(1, dNaive))
-	churnWin := float64(dAbs) / float64(max64(1, abs64(dNet)))
+	snap := buildSnapshot(cfg, now)
+	keysTracked.Set(float64(snap.KeysTracked))
+	wrWindow, churnWin := snap.WriteReduction, snap.Churn
+	dNaive, dCommits := snap.Naive, snap.Commits
 	// Set KPI gauges
 	writeReductionRatio.Set(wrWindow)
 	churnRatio.Set(churnWin)
@@ -194,14 +277,14 @@ func publishSnapshot() {
 		cfTxt, wrTxt, dNaive, dCommits, cfg.SampleRate, cfg.TopN)
 
 	var topLine string
-	if len(rows) > 0 {
-		first := rows[0]
-		churnTxt := fmt.Sprintf("%.3f", first.churnFactor)
+	if len(snap.TopKeys) > 0 {
+		first := snap.TopKeys[0]
+		churnTxt := fmt.Sprintf("%.3f", first.ChurnFactor)
 		if colorOn.Load() {
-			churnTxt = colorCF(first.churnFactor, churnTxt)
+			churnTxt = colorCF(first.ChurnFactor, churnTxt)
 		}
 		topLine = fmt.Sprintf("top key=%s churn=%s abs=%d net=%d",
-			shortHash(first.keyHash, cfg.KeyHashLen), churnTxt, first.abs, first.net)
+			shortHash(first.hash, cfg.KeyHashLen), churnTxt, first.Abs, first.Net)
 	} else {
 		topLine = "top key: (none yet)"
 	}
@@ -244,13 +327,13 @@ func sampleRate() float64 {
 
 // --- recording helpers (called from prom_counters.go) ---
 
-func exporterRecordAdmit(keyHash uint64) {
+func exporterRecordAdmit(keyHash uint64, cost int64) {
 	ka := getAgg(keyHash)
-	ka.abs.Add(1)
+	ka.abs.Add(cost)
 	ka.lastUpdate.Store(time.Now().UnixNano())
-	naiveWritesInternal.Add(1)
+	naiveWritesInternal.Add(cost)
 	// Update global sampled abs sum for churn KPI
-	sumAbsGlobal.Add(1)
+	sumAbsGlobal.Add(cost)
 }
 
 func exporterRecordCommit(keyHash uint64, vector int64) {
@@ -265,6 +348,73 @@ func exporterRecordCommit(keyHash uint64, vector int64) {
 	sumNetGlobal.Add(v)
 }
 
+// handleChurnSnapshot serves /churn/snapshot: the current top-N keys and windowed
+// KPIs as JSON, so dashboards can poll without scraping Prometheus text. It does not
+// record a KPI point; the window baseline comes from the exporter loop, so with the
+// loop disabled (LogInterval 0) the windowed deltas stay at zero.
+func handleChurnSnapshot(w http.ResponseWriter, _ *http.Request) {
+	cfg, _ := currCfg.Load().(Config)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(buildSnapshot(cfg, time.Now()))
+}
+
+// keyStats is the /churn/key response for one tracked key.
+type keyStats struct {
+	Hash        string    `json:"hash"`
+	Abs         int64     `json:"abs"`
+	Net         int64     `json:"net"`
+	ChurnFactor float64   `json:"churnFactor"`
+	LastUpdate  time.Time `json:"lastUpdate"`
+}
+
+// handleChurnKey serves /churn/key?hash=H with the aggregates of one tracked key.
+// H is the key's hex hash as logged by the exporter; a prefix (e.g. the KeyHashLen
+// characters in the top-key line) works as long as it is unambiguous. It answers 404
+// for keys not tracked (unsampled, never seen, or evicted) and 409 for an ambiguous prefix.
+func handleChurnKey(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("hash"), "0x"))
+	if prefix == "" || len(prefix) > 16 {
+		http.Error(w, "hash must be 1..16 hex characters", http.StatusBadRequest)
+		return
+	}
+	if _, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2)); err != nil {
+		http.Error(w, "hash must be 1..16 hex characters", http.StatusBadRequest)
+		return
+	}
+	var (
+		found   *keyAgg
+		hash    uint64
+		matches int
+	)
+	agg.Range(func(k, v any) bool {
+		if strings.HasPrefix(shortHash(k.(uint64), 16), prefix) {
+			matches++
+			found, hash = v.(*keyAgg), k.(uint64)
+		}
+		return matches < 2
+	})
+	switch {
+	case matches == 0:
+		http.Error(w, "key not tracked", http.StatusNotFound)
+		return
+	case matches > 1:
+		http.Error(w, "hash prefix matches several keys", http.StatusConflict)
+		return
+	}
+	a, n := found.abs.Load(), found.net.Load()
+	resp := keyStats{
+		Hash:        shortHash(hash, 16),
+		Abs:         a,
+		Net:         n,
+		ChurnFactor: float64(a) / float64(max64(1, abs64(n))),
+	}
+	if last := found.lastUpdate.Load(); last > 0 {
+		resp.LastUpdate = time.Unix(0, last)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 func getAgg(keyHash uint64) *keyAgg {
 	if v, ok := agg.Load(keyHash); ok {
 		return v.(*keyAgg)
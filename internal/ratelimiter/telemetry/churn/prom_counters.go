@@ -18,7 +18,9 @@ import (
 //
 // Notes:
 //   - SampleRate is deterministic per key using a fast FNV-1a 64-bit hash to avoid RNG cost.
-//   - MetricsAddr, when non-empty, starts a dedicated HTTP server that serves /metrics.
+//   - MetricsAddr, when non-empty, starts a dedicated HTTP server that serves /metrics and
+//     /churn/key?hash=H (JSON aggregates of one tracked key, for debugging hot keys) and
+//     /churn/snapshot (the exporter's top-N rows and windowed KPIs as JSON).
 //     If you already expose Prometheus elsewhere, leave it empty and register promhttp yourself.
 //   - LogInterval and TopN are used by the exporter (see exporter.go). If LogInterval == 0, the
 //     exporter loop is disabled.
@@ -53,6 +55,11 @@ var (
 		Help:    "Distribution of rows per commit batch",
 		Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024},
 	})
+	commitBatchSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "vsa_commit_batch_duration_seconds",
+		Help:    "Duration of persister CommitBatch calls (successful or not), including retries",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms .. ~4s
+	})
 	// First-class KPIs (Gauges) over a rolling window
 	writeReductionRatio = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "vsa_write_reduction_ratio",
@@ -70,11 +77,17 @@ var (
 		Name: "vsa_commit_errors_total",
 		Help: "Total number of commit batch errors (failed persistence attempts)",
 	})
+	// Distribution of per-key churn factors, observed once per tracked key per snapshot.
+	keyChurnFactor = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "vsa_key_churn_factor",
+		Help:    "Per-key churn factor (abs updates / |net commits|), observed once per tracked key per exporter snapshot",
+		Buckets: prometheus.ExponentialBucketsRange(1, 100, 11), // 1 .. 100, log scale
+	})
 )
 
 func init() {
 	// Register metrics eagerly. If no Prometheus endpoint is exposed, the registration is harmless.
-	prometheus.MustRegister(naiveWritesTotal, commitsRowsTotal, rowsPerBatch, writeReductionRatio, churnRatio, keysTracked, commitErrorsTotal)
+	prometheus.MustRegister(naiveWritesTotal, commitsRowsTotal, rowsPerBatch, commitBatchSeconds, writeReductionRatio, churnRatio, keysTracked, commitErrorsTotal, keyChurnFactor)
 }
 
 // Enable configures the module. Safe to call multiple times; subsequent calls replace config.
@@ -129,19 +142,30 @@ func Enable(cfg Config) {
 func Enabled() bool { return modEnabled.Load() }
 
 // ObserveRequest records an API request outcome. Call on hot path after deciding admit/reject.
-//
-// admitted=true increments naiveWritesTotal (since naive impl would write per admitted request)
-// and feeds the exporter per-key aggregates if the key is sampled.
+// It is ObserveRequestCost with cost 1.
 func ObserveRequest(key string, admitted bool) {
+	ObserveRequestCost(key, admitted, 1)
+}
+
+// ObserveRequestCost records the outcome of a request weighing cost units (e.g. /check
+// with cost=C). Call on hot path after deciding admit/reject.
+//
+// admitted=true increments naiveWritesTotal by cost (a naive impl would write each
+// consumed unit) and feeds the exporter per-key aggregates if the key is sampled, so the
+// write-reduction baseline is not understated under weighted limiting. cost < 1 counts as 1.
+func ObserveRequestCost(key string, admitted bool, cost int64) {
 	if !modEnabled.Load() {
 		return
 	}
+	if cost < 1 {
+		cost = 1
+	}
 	if admitted {
-		naiveWritesTotal.Inc()
+		naiveWritesTotal.Add(float64(cost))
 		// Increment unsampled naive baseline so write_reduction_est remains accurate even at low sampling rates
-		naiveWritesAll.Add(1)
+		naiveWritesAll.Add(cost)
 		if key != "" && sampled(key) {
-			exporterRecordAdmit(hashKey(key))
+			exporterRecordAdmit(hashKey(key), cost)
 		}
 	} else {
 		// Rejections do not impact vector or naive writes; we track nothing to keep noise low.
@@ -158,6 +182,14 @@ func ObserveBatch(size int) {
 	exporterObserveBatchInternal(size)
 }
 
+// ObserveCommitLatency records how long one CommitBatch call took, whether it succeeded or not.
+func ObserveCommitLatency(d time.Duration) {
+	if !modEnabled.Load() {
+		return
+	}
+	commitBatchSeconds.Observe(d.Seconds())
+}
+
 // ObserveCommit records a single key's commit vector. Call for each Commit after a successful batch.
 func ObserveCommit(key string, vector int64) {
 	if !modEnabled.Load() || key == "" || vector == 0 {
@@ -176,12 +208,15 @@ func ObserveCommitError(n int) {
 	commitErrorsTotal.Add(float64(n))
 }
 
-// startMetricsEndpoint exposes /metrics on the given addr in a background goroutine.
+// startMetricsEndpoint exposes /metrics, /churn/key and /churn/snapshot on the given
+// addr in a background goroutine.
 // Safe to call multiple times; only one server per unique addr will be started (best-effort).
 func startMetricsEndpoint(addr string) {
 	// To keep it simple and dependency-free, we do not deduplicate addr strictly.
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/churn/key", handleChurnKey)
+	mux.HandleFunc("/churn/snapshot", handleChurnSnapshot)
 	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
 	go func() {
 		_ = server.ListenAndServe()
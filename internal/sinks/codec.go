@@ -0,0 +1,222 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// Format selects how a file sink encodes records.
+type Format int
+
+const (
+	// FormatJSONL writes one JSON object per line (default; human-readable).
+	FormatJSONL Format = iota
+	// FormatBinary writes a magic header followed by length-prefixed records with
+	// fixed little-endian fields, for compact high-throughput logs.
+	FormatBinary
+)
+
+// Binary log layout:
+//
+//	header: 4-byte magic ("VSAS" for S-batches, "VSAV" for envelopes) + 1-byte version
+//	record: uint32 LE payload length, then the payload
+//
+// SBatch payload (32 bytes): KeyID u64, BucketID u64, NetDelta i64, SeqEnd u64.
+// Envelope payload (51 bytes): Channel u8, KeyID u64, BucketID u64, All u8, Scope u8,
+// Delta i64, SeqEnd u64, HashPrev [16]byte.
+//
+// Readers detect the format from the header, so JSONL and binary logs can be read by
+// the same ReadAllSLog/ReadAllVLog calls.
+const binaryVersion = 1
+
+var (
+	sLogMagic = [4]byte{'V', 'S', 'A', 'S'}
+	vLogMagic = [4]byte{'V', 'S', 'A', 'V'}
+)
+
+const (
+	sBatchRecordSize   = 32
+	envelopeRecordSize = 51
+	binaryHeaderSize   = 5
+)
+
+func binaryHeader(magic [4]byte) []byte {
+	return append(magic[:], binaryVersion)
+}
+
+// appendSBatchRecord appends the length-prefixed binary encoding of b to dst.
+func appendSBatchRecord(dst []byte, b *tfd.SBatch) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, sBatchRecordSize)
+	dst = binary.LittleEndian.AppendUint64(dst, b.KeyID)
+	dst = binary.LittleEndian.AppendUint64(dst, b.BucketID)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(b.NetDelta))
+	return binary.LittleEndian.AppendUint64(dst, b.SeqEnd)
+}
+
+// appendEnvelopeRecord appends the length-prefixed binary encoding of e to dst.
+func appendEnvelopeRecord(dst []byte, e *tfd.Envelope) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, envelopeRecordSize)
+	dst = append(dst, byte(e.Channel))
+	dst = binary.LittleEndian.AppendUint64(dst, e.Footprint.KeyID)
+	dst = binary.LittleEndian.AppendUint64(dst, e.Footprint.Time.BucketID)
+	dst = append(dst, boolByte(e.Footprint.Time.All), byte(e.Footprint.Scope))
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(e.Delta))
+	dst = binary.LittleEndian.AppendUint64(dst, e.SeqEnd)
+	return append(dst, e.HashPrev[:]...)
+}
+
+func decodeSBatch(p []byte) (tfd.SBatch, error) {
+	if len(p) < sBatchRecordSize {
+		return tfd.SBatch{}, fmt.Errorf("short s-batch record: %d bytes", len(p))
+	}
+	return tfd.SBatch{
+		KeyID:    binary.LittleEndian.Uint64(p[0:]),
+		BucketID: binary.LittleEndian.Uint64(p[8:]),
+		NetDelta: int64(binary.LittleEndian.Uint64(p[16:])),
+		SeqEnd:   binary.LittleEndian.Uint64(p[24:]),
+	}, nil
+}
+
+func decodeEnvelope(p []byte) (tfd.Envelope, error) {
+	if len(p) < envelopeRecordSize {
+		return tfd.Envelope{}, fmt.Errorf("short envelope record: %d bytes", len(p))
+	}
+	var e tfd.Envelope
+	e.Channel = tfd.Channel(p[0])
+	e.Footprint.KeyID = binary.LittleEndian.Uint64(p[1:])
+	e.Footprint.Time.BucketID = binary.LittleEndian.Uint64(p[9:])
+	e.Footprint.Time.All = p[17] != 0
+	e.Footprint.Scope = tfd.Channel(p[18])
+	e.Delta = int64(binary.LittleEndian.Uint64(p[19:]))
+	e.SeqEnd = binary.LittleEndian.Uint64(p[27:])
+	copy(e.HashPrev[:], p[35:51])
+	return e, nil
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readBinaryRecords calls fn with each record payload after the header. A record
+// truncated by a crash mid-write ends the log without error.
+func readBinaryRecords(r *bufio.Reader, fn func([]byte) error) error {
+	var lenBuf [4]byte
+	var payload []byte
+	for {
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		n := binary.LittleEndian.Uint32(lenBuf[:])
+		if n > 1<<20 {
+			return fmt.Errorf("corrupt binary log: record length %d", n)
+		}
+		if cap(payload) < int(n) {
+			payload = make([]byte, n)
+		}
+		payload = payload[:n]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if err := fn(payload); err != nil {
+			return err
+		}
+	}
+}
+
+// hasHeader reports whether r starts with the binary header for magic, consuming it if so.
+func hasHeader(r *bufio.Reader, magic [4]byte) (bool, error) {
+	head, err := r.Peek(binaryHeaderSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+	if len(head) < binaryHeaderSize || !bytes.Equal(head[:4], magic[:]) {
+		return false, nil
+	}
+	if head[4] != binaryVersion {
+		return false, fmt.Errorf("unsupported binary log version %d", head[4])
+	}
+	_, _ = r.Discard(binaryHeaderSize)
+	return true, nil
+}
+
+var errFormatMismatch = errors.New("existing log file uses a different format or compression")
+
+// JSONL records carry a Version field so the line schema can evolve; the binary format
+// versions its header instead. Lines without the field were written before versioning
+// and are v0. v0 and v1 share the same fields, so migrating a v0 line is the identity.
+// Lines of a newer version than the reader knows are rejected rather than misread.
+const jsonlVersion = 1
+
+var errUnsupportedVersion = errors.New("unsupported log record version")
+
+// sBatchLine and envelopeLine are the JSONL encodings of tfd.SBatch and tfd.Envelope:
+// the record's fields plus Version.
+type sBatchLine struct {
+	Version int
+	tfd.SBatch
+}
+
+type envelopeLine struct {
+	Version int
+	tfd.Envelope
+}
+
+// checkLineVersion reports whether a JSONL record of version v can be read.
+func checkLineVersion(v int) error {
+	if v < 0 || v > jsonlVersion {
+		return fmt.Errorf("%w %d (reader supports up to %d)", errUnsupportedVersion, v, jsonlVersion)
+	}
+	return nil
+}
+
+// eachJSONLine calls fn with each well-formed JSON line of r, skipping malformed ones,
+// and stops at the first error fn returns.
+func eachJSONLine[T any](r io.Reader, fn func(T) error) error {
+	scanner := bufio.NewScanner(r)
+	buf := make([]byte, 0, 1<<20)
+	scanner.Buffer(buf, 1<<26)
+	for scanner.Scan() {
+		var v T
+		if err := json.Unmarshal(scanner.Bytes(), &v); err == nil {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return nil // compressed log truncated by a crash mid-write
+}
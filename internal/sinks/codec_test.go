@@ -0,0 +1,284 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// sampleLogs returns a deterministic mix of S-batches and V-envelopes.
+func sampleLogs() ([]tfd.SBatch, []tfd.Envelope) {
+	var sb []tfd.SBatch
+	var venvs []tfd.Envelope
+	for i := uint64(0); i < 500; i++ {
+		sb = append(sb, tfd.SBatch{KeyID: tfd.HashKey("k") + i%7, BucketID: i % 3, NetDelta: int64(i%11) - 5, SeqEnd: 1_700_000_000_000_000_000 + i})
+		venvs = append(venvs, tfd.Envelope{
+			Channel:   tfd.ChannelVector,
+			Footprint: tfd.Footprint{KeyID: tfd.HashKey("k") + i%5, Time: tfd.TimeFootprint{BucketID: i % 3, All: i%13 == 0}, Scope: tfd.ChannelVector},
+			Delta:     -int64(i % 4),
+			SeqEnd:    1_700_000_000_000_000_000 + i,
+			HashPrev:  tfd.Hash128(i, i*31),
+		})
+	}
+	return sb, venvs
+}
+
+// writeLogs writes sb and venvs through file sinks using format and returns the paths.
+func writeLogs(t *testing.T, dir string, format Format, sb []tfd.SBatch, venvs []tfd.Envelope) (string, string) {
+	t.Helper()
+	return writeLogsWithOptions(t, dir, FileSinkOptions{Format: format}, sb, venvs)
+}
+
+func writeLogsWithOptions(t *testing.T, dir string, opts FileSinkOptions, sb []tfd.SBatch, venvs []tfd.Envelope) (string, string) {
+	t.Helper()
+	sPath, vPath := filepath.Join(dir, "s.log"), filepath.Join(dir, "v.log")
+	ss, err := NewSBatchFileSinkWithOptions(sPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := NewVEnvFileSinkWithOptions(vPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.OnSBatches(sb[:len(sb)/2])
+	ss.OnSBatches(sb[len(sb)/2:])
+	vs.Append(venvs[0])
+	vs.AppendAll(venvs[1:])
+	if err := ss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sPath, vPath
+}
+
+// TestFileSinks_BinaryCodecRoundTrip verifies that both codecs decode to the written
+// records, reconstruct identical state, and that the binary logs are much smaller.
+func TestFileSinks_BinaryCodecRoundTrip(t *testing.T) {
+	sb, venvs := sampleLogs()
+	sizes := map[Format]int64{}
+	states := map[Format]map[[2]uint64]int64{}
+	for _, format := range []Format{FormatJSONL, FormatBinary} {
+		sPath, vPath := writeLogs(t, t.TempDir(), format, sb, venvs)
+		gotS, err := ReadAllSLog(sPath)
+		if err != nil {
+			t.Fatalf("format %d: ReadAllSLog: %v", format, err)
+		}
+		gotV, err := ReadAllVLog(vPath)
+		if err != nil {
+			t.Fatalf("format %d: ReadAllVLog: %v", format, err)
+		}
+		if !reflect.DeepEqual(gotS, sb) || !reflect.DeepEqual(gotV, venvs) {
+			t.Fatalf("format %d: decoded records differ from written ones", format)
+		}
+		st := tfd.NewState()
+		if err := st.Reconstruct(gotS, gotV); err != nil {
+			t.Fatal(err)
+		}
+		states[format] = st.Cells()
+		for _, p := range []string{sPath, vPath} {
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sizes[format] += fi.Size()
+		}
+	}
+	if !reflect.DeepEqual(states[FormatJSONL], states[FormatBinary]) {
+		t.Fatalf("reconstruction differs between codecs")
+	}
+	t.Logf("log bytes: jsonl=%d binary=%d", sizes[FormatJSONL], sizes[FormatBinary])
+	if sizes[FormatBinary]*2 > sizes[FormatJSONL] {
+		t.Fatalf("binary logs should be under half of JSONL: binary=%d jsonl=%d", sizes[FormatBinary], sizes[FormatJSONL])
+	}
+}
+
+// TestFileSinks_FormatMismatchRejected verifies a sink refuses to append records of a
+// different format to an existing log, and that reopening with the same format appends.
+func TestFileSinks_FormatMismatchRejected(t *testing.T) {
+	sb, venvs := sampleLogs()
+	dir := t.TempDir()
+	sPath, vPath := writeLogs(t, dir, FormatBinary, sb[:10], venvs[:10])
+	if _, err := NewSBatchFileSink(sPath); err == nil {
+		t.Fatalf("opening a binary s.log as JSONL should fail")
+	}
+	if _, err := NewVEnvFileSink(vPath); err == nil {
+		t.Fatalf("opening a binary v.log as JSONL should fail")
+	}
+	ss, err := NewSBatchFileSinkWithOptions(sPath, FileSinkOptions{Format: FormatBinary})
+	if err != nil {
+		t.Fatalf("reopen binary: %v", err)
+	}
+	ss.OnSBatches(sb[10:20])
+	_ = ss.Close()
+	got, err := ReadAllSLog(sPath)
+	if err != nil || !reflect.DeepEqual(got, sb[:20]) {
+		t.Fatalf("appended binary log = %d records, %v; want the first 20 batches", len(got), err)
+	}
+}
+
+// TestFileSinks_CompressedRoundTrip verifies gzip-compressed logs (in both codecs) are
+// detected and decompressed transparently, including after reopening to append, and
+// reconstruct the same state as the uncompressed logs.
+func TestFileSinks_CompressedRoundTrip(t *testing.T) {
+	sb, venvs := sampleLogs()
+	plain := tfd.NewState()
+	if err := plain.Reconstruct(append([]tfd.SBatch(nil), sb...), append([]tfd.Envelope(nil), venvs...)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []Format{FormatJSONL, FormatBinary} {
+		opts := FileSinkOptions{Format: format, Compressed: true}
+		dir := t.TempDir()
+		// Write the first half, then reopen and append the rest as a second gzip member.
+		sPath, vPath := writeLogsWithOptions(t, dir, opts, sb[:250], venvs[:250])
+		writeLogsWithOptions(t, dir, opts, sb[250:], venvs[250:])
+
+		raw, err := os.ReadFile(sPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) < 2 || raw[0] != 0x1f || raw[1] != 0x8b {
+			t.Fatalf("format %d: s.log is not gzip", format)
+		}
+		if _, err := NewSBatchFileSinkWithOptions(sPath, FileSinkOptions{Format: format}); err == nil {
+			t.Fatalf("format %d: reopening a compressed log uncompressed should fail", format)
+		}
+
+		gotS, err := ReadAllSLog(sPath)
+		if err != nil {
+			t.Fatalf("format %d: ReadAllSLog: %v", format, err)
+		}
+		gotV, err := ReadAllVLog(vPath)
+		if err != nil {
+			t.Fatalf("format %d: ReadAllVLog: %v", format, err)
+		}
+		if !reflect.DeepEqual(gotS, sb) || !reflect.DeepEqual(gotV, venvs) {
+			t.Fatalf("format %d: decompressed records differ (s=%d v=%d)", format, len(gotS), len(gotV))
+		}
+		st := tfd.NewState()
+		if err := st.Reconstruct(gotS, gotV); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(st.Cells(), plain.Cells()) {
+			t.Fatalf("format %d: compressed reconstruction differs", format)
+		}
+	}
+}
+
+// TestFileSinks_CompressedFlushVisibleWhileOpen verifies Flush makes compressed records
+// readable before the sink is closed, as /state relies on.
+func TestFileSinks_CompressedFlushVisibleWhileOpen(t *testing.T) {
+	sb, _ := sampleLogs()
+	path := filepath.Join(t.TempDir(), "s.log")
+	s, err := NewSBatchFileSinkWithOptions(path, FileSinkOptions{Compressed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.OnSBatches(sb[:10])
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadAllSLog(path)
+	if err != nil {
+		t.Fatalf("ReadAllSLog on open compressed log: %v", err)
+	}
+	if !reflect.DeepEqual(got, sb[:10]) {
+		t.Fatalf("read %d records from open compressed log, want 10", len(got))
+	}
+}
+
+// TestFileSinks_JSONLVersions verifies that a JSONL log mixing v0 lines (written before
+// the Version field existed) and v1 lines reads back in full, and that a line from a
+// newer schema is rejected instead of misread.
+func TestFileSinks_JSONLVersions(t *testing.T) {
+	dir := t.TempDir()
+	sPath, vPath := filepath.Join(dir, "s.log"), filepath.Join(dir, "v.log")
+	sb, venvs := sampleLogs()
+	writeV0 := func(path string, rec any) {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, append(line, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeV0(sPath, sb[0])
+	writeV0(vPath, venvs[0])
+
+	ss, err := NewSBatchFileSink(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := NewVEnvFileSink(vPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.OnSBatches(sb[1:2])
+	vs.Append(venvs[1])
+	if err := ss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Split(bytes.TrimSpace(raw), []byte("\n")); len(lines) != 2 || bytes.Contains(lines[0], []byte(`"Version"`)) || !bytes.Contains(lines[1], []byte(`"Version":1`)) {
+		t.Fatalf("want a v0 line followed by a v1 line, got:\n%s", raw)
+	}
+
+	gotS, err := ReadAllSLog(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotS, sb[:2]) {
+		t.Fatalf("S log = %+v, want %+v", gotS, sb[:2])
+	}
+	gotV, err := ReadAllVLog(vPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotV, venvs[:2]) {
+		t.Fatalf("V log = %+v, want %+v", gotV, venvs[:2])
+	}
+
+	f, err := os.OpenFile(sPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"Version":2,"KeyID":1}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if _, err := ReadAllSLog(sPath); !errors.Is(err, errUnsupportedVersion) {
+		t.Fatalf("newer version: err=%v, want errUnsupportedVersion", err)
+	}
+}
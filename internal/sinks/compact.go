@@ -0,0 +1,214 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"errors"
+	"os"
+	"sort"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// Compact folds the S and V logs (including rotated segments) and any existing
+// checkpoint at outState into a new checkpoint, then truncates the logs so later
+// reconstruction only replays the checkpoint plus the tail written after it.
+//
+// The checkpoint is itself a binary S-log holding one SBatch per (key, bucket) cell
+// with the cell's net value and the highest SeqEnd seen for it, so
+// State.Reconstruct(checkpoint, tailS+tailV) equals reconstructing from scratch.
+// Cells that net to zero are kept so the reconstructed cell set is identical.
+//
+// The logs must not be open for writing while Compact runs (e.g. compact at
+// startup, before the sinks are opened). The new checkpoint is written to
+// outState.tmp and synced, then a marker file (outState.compacting) records that it
+// holds everything in the logs; only then are the logs truncated and the checkpoint
+// renamed into place. A crash before the marker leaves the old checkpoint and logs
+// as they were; a crash after it is finished by the next Compact, so the logs are
+// never replayed on top of a checkpoint that already holds them.
+func Compact(sLog, vLog, outState string) error {
+	if err := finishCompaction(sLog, vLog, outState); err != nil {
+		return err
+	}
+	base, err := ReadCheckpoint(outState)
+	if err != nil {
+		return err
+	}
+	sb, err := ReadAllSLogRotated(sLog)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	ve, err := ReadAllVLogRotated(vLog)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	st := tfd.NewState()
+	if err := st.Reconstruct(append(base, sb...), ve); err != nil {
+		return err
+	}
+	seq := make(map[[2]uint64]uint64, len(st.Cells()))
+	for _, b := range base {
+		seq[[2]uint64{b.KeyID, b.BucketID}] = max(seq[[2]uint64{b.KeyID, b.BucketID}], b.SeqEnd)
+	}
+	for _, b := range sb {
+		seq[[2]uint64{b.KeyID, b.BucketID}] = max(seq[[2]uint64{b.KeyID, b.BucketID}], b.SeqEnd)
+	}
+	for _, e := range ve {
+		k := [2]uint64{e.Footprint.KeyID, e.Footprint.Time.BucketID}
+		seq[k] = max(seq[k], e.SeqEnd)
+	}
+	cells := make([]tfd.SBatch, 0, len(st.Cells()))
+	for k, net := range st.Cells() {
+		cells = append(cells, tfd.SBatch{KeyID: k[0], BucketID: k[1], NetDelta: net, SeqEnd: seq[k]})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].KeyID != cells[j].KeyID {
+			return cells[i].KeyID < cells[j].KeyID
+		}
+		return cells[i].BucketID < cells[j].BucketID
+	})
+
+	tmp := outState + ".tmp"
+	cp, err := NewSBatchFileSinkWithOptions(tmp, FileSinkOptions{Format: FormatBinary})
+	if err != nil {
+		return err
+	}
+	cp.OnSBatches(cells)
+	err = cp.Flush()
+	if err == nil {
+		err = cp.lf.sync()
+	}
+	if cerr := cp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeMarker(outState + ".compacting"); err != nil {
+		return err
+	}
+	return finishCompaction(sLog, vLog, outState)
+}
+
+// ErrCompactionInterrupted reports a checkpoint whose compaction stopped after the
+// new checkpoint was complete but before the logs were truncated. Replaying it with
+// the logs would count them twice; the next Compact finishes it.
+var ErrCompactionInterrupted = errors.New("sinks: interrupted compaction (run Compact to finish it)")
+
+// finishCompaction completes a compaction of the logs into outState once its marker
+// has been written: outState.tmp already holds the logs, so they are truncated, the
+// checkpoint is moved into place and the marker removed. Each step may be repeated,
+// so it is safe to run again after a crash at any point. Without a marker, a
+// leftover outState.tmp is incomplete and is discarded.
+func finishCompaction(sLog, vLog, outState string) error {
+	marker, tmp := outState+".compacting", outState+".tmp"
+	if _, err := os.Stat(marker); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	for _, path := range []string{sLog, vLog} {
+		if err := truncateLog(path); err != nil {
+			return err
+		}
+	}
+	// A missing tmp means the rename already happened before the crash.
+	if err := os.Rename(tmp, outState); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Remove(marker)
+}
+
+// writeMarker creates path and syncs it, so it survives a crash right after.
+func writeMarker(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReconstructState rebuilds state from the checkpoint (if present) plus the S and V
+// logs written since, including rotated segments. The S log is streamed rather than
+// loaded, so its size does not bound memory; the V log is read whole for its per-key
+// sort.
+func ReconstructState(sLog, vLog, checkpoint string) (*tfd.State, error) {
+	base, err := ReadCheckpoint(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	ve, err := ReadAllVLogRotated(vLog)
+	if err != nil {
+		return nil, err
+	}
+	sb := make(chan tfd.SBatch, 1024)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(sb)
+		for _, b := range base {
+			sb <- b
+		}
+		errc <- StreamSLogRotated(sLog, sb)
+	}()
+	st := tfd.NewState()
+	rerr := st.ReconstructStream(sb, ve)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+	return st, nil
+}
+
+// ReadCheckpoint reads a checkpoint written by Compact; a missing one is empty. It
+// returns ErrCompactionInterrupted while a compaction into path is unfinished.
+func ReadCheckpoint(path string) ([]tfd.SBatch, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(path + ".compacting"); err == nil {
+		return nil, ErrCompactionInterrupted
+	}
+	cells, err := ReadAllSLog(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return cells, err
+}
+
+// truncateLog empties path and removes its rotated segments.
+func truncateLog(path string) error {
+	segs := logSegments(path)
+	for _, seg := range segs[:len(segs)-1] {
+		if err := os.Remove(seg); err != nil {
+			return err
+		}
+	}
+	if err := os.Truncate(path, 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// TestCompact_CheckpointEquivalence verifies that reconstruction from a checkpoint plus
+// the log tail matches reconstruction from scratch, before and after further writes and
+// across repeated compactions.
+func TestCompact_CheckpointEquivalence(t *testing.T) {
+	sb, venvs := sampleLogs()
+	full := func(sb []tfd.SBatch, venvs []tfd.Envelope) map[[2]uint64]int64 {
+		st := tfd.NewState()
+		if err := st.Reconstruct(append([]tfd.SBatch(nil), sb...), append([]tfd.Envelope(nil), venvs...)); err != nil {
+			t.Fatal(err)
+		}
+		return st.Cells()
+	}
+	for name, opts := range map[string]FileSinkOptions{
+		"jsonl":             {},
+		"binary-compressed": {Format: FormatBinary, Compressed: true},
+		"rotated":           {Format: FormatBinary, MaxBytes: 2 << 10, MaxBackups: 100},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			cp := filepath.Join(dir, "state.ckpt")
+			half, halfV := len(sb)/2, len(venvs)/2
+			sPath, vPath := writeChunked(t, dir, opts, 20, sb[:half], venvs[:halfV])
+			if err := Compact(sPath, vPath, cp); err != nil {
+				t.Fatalf("Compact: %v", err)
+			}
+			for _, p := range []string{sPath, vPath} {
+				if fi, err := os.Stat(p); err != nil || fi.Size() != 0 {
+					t.Fatalf("%s not truncated: %v", p, err)
+				}
+				if segs := logSegments(p); len(segs) != 1 {
+					t.Fatalf("%s: rotated segments survived compaction: %v", p, segs)
+				}
+			}
+			checkpoint, err := ReadAllSLog(cp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st := tfd.NewState()
+			if err := st.Reconstruct(checkpoint, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(st.Cells(), full(sb[:half], venvs[:halfV])) {
+				t.Fatalf("checkpoint state differs from reconstruction from scratch")
+			}
+
+			// Keep appending after compaction: checkpoint + tail must equal the full history.
+			writeChunked(t, dir, opts, 20, sb[half:], venvs[halfV:])
+			got, err := ReconstructState(sPath, vPath, cp)
+			if err != nil {
+				t.Fatalf("ReconstructState: %v", err)
+			}
+			want := full(sb, venvs)
+			if !reflect.DeepEqual(got.Cells(), want) {
+				t.Fatalf("checkpoint+tail differs from reconstruction from scratch")
+			}
+
+			// Compacting again folds the previous checkpoint in.
+			if err := Compact(sPath, vPath, cp); err != nil {
+				t.Fatalf("second Compact: %v", err)
+			}
+			got, err = ReconstructState(sPath, vPath, cp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Cells(), want) {
+				t.Fatalf("state changed across a second compaction")
+			}
+		})
+	}
+}
+
+// TestCompact_FinishesInterruptedCompaction recreates the files a crash leaves
+// between the compaction marker and the log truncation, and verifies that readers
+// refuse the checkpoint and the next Compact finishes the job without counting the
+// logs twice.
+func TestCompact_FinishesInterruptedCompaction(t *testing.T) {
+	sb, venvs := sampleLogs()
+	want := tfd.NewState()
+	if err := want.Reconstruct(append([]tfd.SBatch(nil), sb...), append([]tfd.Envelope(nil), venvs...)); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cp := filepath.Join(dir, "state.ckpt")
+	sPath, vPath := writeChunked(t, dir, FileSinkOptions{Format: FormatBinary}, 20, sb, venvs)
+	saved := map[string][]byte{}
+	for _, p := range []string{sPath, vPath} {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved[p] = b
+	}
+	// Compact elsewhere, then put back the untruncated logs and stage the new
+	// checkpoint as the crashed run would have left it.
+	if err := Compact(sPath, vPath, filepath.Join(dir, "done.ckpt")); err != nil {
+		t.Fatal(err)
+	}
+	for p, b := range saved {
+		if err := os.WriteFile(p, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Rename(filepath.Join(dir, "done.ckpt"), cp+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cp+".compacting", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReconstructState(sPath, vPath, cp); !errors.Is(err, ErrCompactionInterrupted) {
+		t.Fatalf("ReconstructState err=%v, want ErrCompactionInterrupted", err)
+	}
+	if err := Compact(sPath, vPath, cp); err != nil {
+		t.Fatalf("Compact after interruption: %v", err)
+	}
+	for _, p := range []string{cp + ".tmp", cp + ".compacting"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("%s left behind: %v", filepath.Base(p), err)
+		}
+	}
+	got, err := ReconstructState(sPath, vPath, cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Cells(), want.Cells()) {
+		t.Fatalf("interrupted compaction double-applied the logs")
+	}
+
+	// A leftover tmp without a marker is an incomplete checkpoint and is discarded.
+	if err := os.WriteFile(cp+".tmp", []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Compact(sPath, vPath, cp); err != nil {
+		t.Fatalf("Compact with a stale tmp: %v", err)
+	}
+	if got, err = ReconstructState(sPath, vPath, cp); err != nil || !reflect.DeepEqual(got.Cells(), want.Cells()) {
+		t.Fatalf("state after discarding a stale tmp differs (err=%v)", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// KafkaProducer publishes a single message. It has the same shape as
+// persistence.KafkaProducer, so the same client (or the demo LoggingKafkaProducer)
+// can back both the rate limiter's commit adapter and this sink.
+//
+// Note: We intentionally avoid importing a specific Kafka library.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key []byte, value []byte, headers map[string]string) error
+}
+
+// KafkaSBatchSink publishes S-batches to a Kafka topic, one message per batch.
+// Messages are keyed by the decimal KeyID so all batches for a key land on the same
+// partition and keep their relative order; the value is the same JSON object a line
+// of SBatchFileSink holds, so consumers can share decoding with ReadAllSLog.
+//
+// Publishing is serialized, so batches leave in the order OnSBatches receives them.
+// OnSBatches cannot report errors; failed publishes are logged and counted (see Errors).
+type KafkaSBatchSink struct {
+	mu       sync.Mutex
+	producer KafkaProducer
+	topic    string
+	timeout  time.Duration
+	errors   atomic.Uint64
+}
+
+// NewKafkaSBatchSink creates a sink publishing to topic through p.
+func NewKafkaSBatchSink(p KafkaProducer, topic string) *KafkaSBatchSink {
+	return &KafkaSBatchSink{producer: p, topic: topic, timeout: 10 * time.Second}
+}
+
+// OnSBatches publishes each batch as its own message, in order.
+func (s *KafkaSBatchSink) OnSBatches(b []tfd.SBatch) {
+	if len(b) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	headers := map[string]string{"content-type": "application/json"}
+	for i := range b {
+		value, err := json.Marshal(&b[i])
+		if err != nil {
+			s.errors.Add(1)
+			continue
+		}
+		key := strconv.AppendUint(nil, b[i].KeyID, 10)
+		if err := s.producer.Produce(ctx, s.topic, key, value, headers); err != nil {
+			if s.errors.Add(1) == 1 {
+				log.Printf("kafka s-batch sink: produce topic=%s key=%s: %v", s.topic, key, err)
+			}
+		}
+	}
+}
+
+// Errors returns the number of batches that could not be published.
+func (s *KafkaSBatchSink) Errors() uint64 { return s.errors.Load() }
@@ -0,0 +1,103 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	tfd "vsa/plugin/tfd"
+)
+
+type producedMsg struct {
+	topic   string
+	key     string
+	value   []byte
+	headers map[string]string
+}
+
+type mockKafkaProducer struct {
+	msgs []producedMsg
+	fail map[uint64]bool // KeyIDs whose publish fails
+}
+
+func (m *mockKafkaProducer) Produce(ctx context.Context, topic string, key []byte, value []byte, headers map[string]string) error {
+	if id, _ := strconv.ParseUint(string(key), 10, 64); m.fail[id] {
+		return errors.New("broker unavailable")
+	}
+	m.msgs = append(m.msgs, producedMsg{topic: topic, key: string(key), value: append([]byte(nil), value...), headers: headers})
+	return nil
+}
+
+// TestKafkaSBatchSink_PublishesInOrderKeyedByKeyID verifies each batch becomes one
+// message keyed by KeyID, in arrival order, with a value that decodes back to the batch.
+func TestKafkaSBatchSink_PublishesInOrderKeyedByKeyID(t *testing.T) {
+	mp := &mockKafkaProducer{}
+	sink := NewKafkaSBatchSink(mp, "tfd-sbatches")
+	first := []tfd.SBatch{
+		{KeyID: 7, BucketID: 1, NetDelta: 5, SeqEnd: 10},
+		{KeyID: 3, BucketID: 2, NetDelta: -2, SeqEnd: 11},
+	}
+	second := []tfd.SBatch{{KeyID: 7, BucketID: 1, NetDelta: 1, SeqEnd: 12}}
+	sink.OnSBatches(first)
+	sink.OnSBatches(nil)
+	sink.OnSBatches(second)
+
+	want := append(append([]tfd.SBatch(nil), first...), second...)
+	if len(mp.msgs) != len(want) {
+		t.Fatalf("published %d messages, want %d", len(mp.msgs), len(want))
+	}
+	for i, m := range mp.msgs {
+		if m.topic != "tfd-sbatches" {
+			t.Fatalf("msg %d topic=%q", i, m.topic)
+		}
+		if m.key != strconv.FormatUint(want[i].KeyID, 10) {
+			t.Fatalf("msg %d key=%q want KeyID %d", i, m.key, want[i].KeyID)
+		}
+		if m.headers["content-type"] != "application/json" {
+			t.Fatalf("msg %d headers=%v", i, m.headers)
+		}
+		var got tfd.SBatch
+		if err := json.Unmarshal(m.value, &got); err != nil {
+			t.Fatalf("msg %d decode: %v", i, err)
+		}
+		if got != want[i] {
+			t.Fatalf("msg %d = %+v, want %+v (out of order or corrupted)", i, got, want[i])
+		}
+	}
+	if sink.Errors() != 0 {
+		t.Fatalf("Errors()=%d want 0", sink.Errors())
+	}
+}
+
+// TestKafkaSBatchSink_CountsFailedPublishes verifies a failed publish is counted and
+// does not stop the remaining batches.
+func TestKafkaSBatchSink_CountsFailedPublishes(t *testing.T) {
+	mp := &mockKafkaProducer{fail: map[uint64]bool{2: true}}
+	sink := NewKafkaSBatchSink(mp, "t")
+	multi := MultiSSink{sink}
+	multi.OnSBatches([]tfd.SBatch{{KeyID: 1}, {KeyID: 2}, {KeyID: 3}})
+	if sink.Errors() != 1 || multi.Errors() != 1 {
+		t.Fatalf("Errors()=%d, MultiSSink.Errors()=%d want 1", sink.Errors(), multi.Errors())
+	}
+	if len(mp.msgs) != 2 || mp.msgs[0].key != "1" || mp.msgs[1].key != "3" {
+		t.Fatalf("published %+v; want keys 1 and 3", mp.msgs)
+	}
+}
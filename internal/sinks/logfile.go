@@ -0,0 +1,285 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// flushInterval bounds how long written records may sit in memory buffers before
+// reaching the file (data loss on crash, visibility to /state readers).
+const flushInterval = 100 * time.Millisecond
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// logFile is the append-only file plumbing shared by the S-batch and envelope sinks:
+// a buffered writer over the file, optionally through a gzip stream. Callers
+// serialize access.
+type logFile struct {
+	f      *os.File
+	cw     *countingWriter
+	zw     *gzip.Writer // nil when uncompressed
+	w      *bufio.Writer
+	path   string
+	format Format
+	opts   FileSinkOptions
+	magic  [4]byte
+
+	lastFlush time.Time
+	// err is the first rotation or flush failure seen by maybeFlush, which runs inside
+	// write calls that cannot return it; the next flush or close reports it.
+	err error
+}
+
+// countingWriter tracks the bytes that reached the file, for size-based rotation.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openLogFile opens (or creates) path for appending with the given options. A new
+// binary log starts with the header for magic; an existing log must match the
+// requested format and compression, so records are never mixed.
+//
+// Reopening a compressed log appends a new gzip member; readers decode the members as
+// one stream.
+func openLogFile(path string, opts FileSinkOptions, magic [4]byte) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err == nil && st.Size() > 0 {
+		err = checkExistingLog(f, st.Size(), opts, magic)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	l := &logFile{f: f, path: path, format: opts.Format, opts: opts, magic: magic, lastFlush: time.Now()}
+	l.cw = &countingWriter{w: f, n: st.Size()}
+	var dst io.Writer = l.cw
+	if opts.Compressed {
+		l.zw = gzip.NewWriter(l.cw)
+		dst = l.zw
+	}
+	l.w = bufio.NewWriterSize(dst, 1<<20 /*1MiB*/)
+	if st.Size() == 0 && opts.Format == FormatBinary {
+		_, _ = l.w.Write(binaryHeader(magic))
+	}
+	return l, nil
+}
+
+// checkExistingLog verifies that the first bytes of an existing log match opts.
+func checkExistingLog(f *os.File, size int64, opts FileSinkOptions, magic [4]byte) error {
+	var r io.Reader = io.NewSectionReader(f, 0, size)
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(2)
+	if bytes.Equal(head, gzipMagic) != opts.Compressed {
+		return errFormatMismatch
+	}
+	if opts.Compressed {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		br = bufio.NewReader(zr)
+	}
+	head, err := br.Peek(binaryHeaderSize)
+	if err != nil && len(head) == 0 {
+		return nil // nothing decodable yet (e.g. crash before the first flush)
+	}
+	isBinary := len(head) == binaryHeaderSize && bytes.Equal(head[:4], magic[:])
+	if isBinary != (opts.Format == FormatBinary) {
+		return errFormatMismatch
+	}
+	return nil
+}
+
+// flush pushes buffered records through the compressor (if any) into the file. It
+// also reports (once) a failure recorded by an earlier maybeFlush.
+func (l *logFile) flush() error {
+	l.lastFlush = time.Now()
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	if l.zw != nil {
+		if err := l.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	return l.takeErr()
+}
+
+// maybeFlush runs after each write call: it rotates the file when it has outgrown
+// opts.MaxBytes and otherwise flushes once flushInterval has passed since the last flush.
+// Failures are logged and kept for the next flush or close to return.
+func (l *logFile) maybeFlush() {
+	if err := l.rotateIfNeeded(); err != nil {
+		l.setErr(fmt.Errorf("rotate %s: %w", l.path, err))
+	}
+	if time.Since(l.lastFlush) > flushInterval {
+		if err := l.flush(); err != nil {
+			l.setErr(fmt.Errorf("flush %s: %w", l.path, err))
+		}
+	}
+}
+
+// setErr records err unless an earlier failure is still unreported.
+func (l *logFile) setErr(err error) {
+	if l.err == nil {
+		log.Printf("log sink: %v", err)
+		l.err = err
+	}
+}
+
+func (l *logFile) takeErr() error {
+	err := l.err
+	l.err = nil
+	return err
+}
+
+// close flushes, terminates the gzip stream if any, and closes the file.
+func (l *logFile) close() error {
+	err := l.finish()
+	if perr := l.takeErr(); err == nil {
+		err = perr
+	}
+	return err
+}
+
+// finish flushes, terminates the gzip stream if any, and closes the file, returning
+// the first error.
+func (l *logFile) finish() error {
+	err := l.w.Flush()
+	if l.zw != nil {
+		if zerr := l.zw.Close(); err == nil {
+			err = zerr
+		}
+	}
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sync commits the file's contents to stable storage; flush first.
+func (l *logFile) sync() error {
+	return l.f.Sync()
+}
+
+// rotateIfNeeded starts a new segment once the file has reached opts.MaxBytes. It is
+// called between write calls, so segments always end on a record boundary and each
+// one is independently readable (binary segments get their own header, compressed
+// ones their own gzip stream). Buffered bytes count toward the size before
+// compression, so compressed logs may rotate slightly early.
+//
+// The current file becomes path.1, older segments shift to path.2 … path.MaxBackups,
+// and the oldest beyond MaxBackups is removed. With MaxBackups 0 there is nowhere to
+// keep the current data, so the file is not rotated.
+//
+// The next segment is opened (as path.next) before the current handle is given up,
+// and any failure before the switch leaves the current handle in place, so records
+// keep landing in the current segment (under path or path.1) instead of being lost;
+// rotation is retried after the next write call.
+func (l *logFile) rotateIfNeeded() error {
+	if l.opts.MaxBytes <= 0 || l.opts.MaxBackups <= 0 || l.cw.n+int64(l.w.Buffered()) < l.opts.MaxBytes {
+		return nil
+	}
+	tmp := l.path + ".next"
+	_ = os.Remove(tmp)
+	next, err := openLogFile(tmp, l.opts, l.magic)
+	if err != nil {
+		return err
+	}
+	abandon := func(err error) error {
+		_ = next.f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	_ = os.Remove(segmentPath(l.path, l.opts.MaxBackups))
+	for i := l.opts.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(segmentPath(l.path, i), segmentPath(l.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return abandon(err)
+		}
+	}
+	if err := os.Rename(l.path, segmentPath(l.path, 1)); err != nil {
+		return abandon(err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return abandon(err)
+	}
+	next.path = l.path
+	// The buffered tail still belongs to the old segment, now path.1.
+	err = l.finish()
+	next.err = l.err
+	*l = *next
+	return err
+}
+
+// segmentPath names the i-th rotated segment of path (1 = most recent).
+func segmentPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// logSegments lists the rotated segments of path oldest first, followed by path itself.
+func logSegments(path string) []string {
+	var rotated []string
+	for i := 1; ; i++ {
+		p := segmentPath(path, i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		rotated = append(rotated, p)
+	}
+	out := make([]string, 0, len(rotated)+1)
+	for i := len(rotated) - 1; i >= 0; i-- {
+		out = append(out, rotated[i])
+	}
+	return append(out, path)
+}
+
+// openLogReader opens path for reading, transparently decompressing gzip logs.
+func openLogReader(path string) (*bufio.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReaderSize(f, 1<<20)
+	if head, _ := r.Peek(2); bytes.Equal(head, gzipMagic) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		r = bufio.NewReaderSize(zr, 1<<20)
+	}
+	return r, f, nil
+}
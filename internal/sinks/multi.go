@@ -0,0 +1,106 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"errors"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// MultiSSink fans each flush out to several S-batch sinks, e.g. to keep the local
+// s.log for /state and audit while also publishing to Kafka. Every child receives the
+// same batches in the same order: children are called one after another, each with
+// the full slice, so a slow child delays the ones after it.
+type MultiSSink []tfd.SBatchesSink
+
+// OnSBatches forwards b to every sink in order.
+func (m MultiSSink) OnSBatches(b []tfd.SBatch) {
+	for _, s := range m {
+		s.OnSBatches(b)
+	}
+}
+
+// Errors sums the failure counts of the children that keep one (see
+// KafkaSBatchSink.Errors).
+func (m MultiSSink) Errors() uint64 { return sumErrors(m) }
+
+// Flush flushes every child that buffers and joins their errors.
+func (m MultiSSink) Flush() error { return flushAll(m) }
+
+// Close closes every child that holds resources and joins their errors.
+func (m MultiSSink) Close() error { return closeAll(m) }
+
+// VEnvSink persists V-lane envelopes one at a time, like VEnvFileSink.Append (the
+// persist callback of VActor.EnqueuePersist).
+type VEnvSink interface {
+	Append(tfd.Envelope)
+}
+
+// MultiVSink fans each V-envelope out to several sinks, in the same order for each.
+// Used as the persist callback under the per-key actor lock, it keeps every child's
+// per-key chain order.
+type MultiVSink []VEnvSink
+
+// Append forwards env to every sink in order.
+func (m MultiVSink) Append(env tfd.Envelope) {
+	for _, s := range m {
+		s.Append(env)
+	}
+}
+
+// Errors sums the failure counts of the children that keep one.
+func (m MultiVSink) Errors() uint64 { return sumErrors(m) }
+
+// Flush flushes every child that buffers and joins their errors.
+func (m MultiVSink) Flush() error { return flushAll(m) }
+
+// Close closes every child that holds resources and joins their errors.
+func (m MultiVSink) Close() error { return closeAll(m) }
+
+// sumErrors adds up Errors() over the children that implement it.
+func sumErrors[T any](children []T) uint64 {
+	var n uint64
+	for _, c := range children {
+		if e, ok := any(c).(interface{ Errors() uint64 }); ok {
+			n += e.Errors()
+		}
+	}
+	return n
+}
+
+// flushAll calls Flush on the children that implement it and joins the errors.
+func flushAll[T any](children []T) error {
+	var errs []error
+	for _, c := range children {
+		if f, ok := any(c).(interface{ Flush() error }); ok {
+			errs = append(errs, f.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeAll calls Close on the children that implement it and joins the errors.
+func closeAll[T any](children []T) error {
+	var errs []error
+	for _, c := range children {
+		if cl, ok := any(c).(interface{ Close() error }); ok {
+			errs = append(errs, cl.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
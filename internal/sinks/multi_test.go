@@ -0,0 +1,68 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// memSink records everything it receives and reports closeErr from Close.
+type memSink struct {
+	batches  []tfd.SBatch
+	envs     []tfd.Envelope
+	closeErr error
+}
+
+func (m *memSink) OnSBatches(b []tfd.SBatch) { m.batches = append(m.batches, b...) }
+func (m *memSink) Append(env tfd.Envelope)   { m.envs = append(m.envs, env) }
+func (m *memSink) Close() error              { return m.closeErr }
+
+// TestMultiSinks_FanOutInOrder verifies both children of MultiSSink and MultiVSink
+// receive identical batches and envelopes in delivery order, and that Close joins
+// the children's errors.
+func TestMultiSinks_FanOutInOrder(t *testing.T) {
+	a, b := &memSink{}, &memSink{closeErr: errors.New("b closed")}
+	ms := MultiSSink{a, b}
+	ms.OnSBatches([]tfd.SBatch{{KeyID: 1, NetDelta: 5, SeqEnd: 1}, {KeyID: 2, NetDelta: -1, SeqEnd: 2}})
+	ms.OnSBatches([]tfd.SBatch{{KeyID: 1, BucketID: 3, NetDelta: 3, SeqEnd: 3}})
+	mv := MultiVSink{a, b}
+	for seq := uint64(1); seq <= 3; seq++ {
+		mv.Append(tfd.Envelope{Channel: tfd.ChannelVector, Delta: int64(seq), SeqEnd: seq})
+	}
+
+	wantS := []tfd.SBatch{{KeyID: 1, NetDelta: 5, SeqEnd: 1}, {KeyID: 2, NetDelta: -1, SeqEnd: 2}, {KeyID: 1, BucketID: 3, NetDelta: 3, SeqEnd: 3}}
+	for _, s := range []*memSink{a, b} {
+		if !reflect.DeepEqual(s.batches, wantS) {
+			t.Fatalf("batches = %+v, want %+v", s.batches, wantS)
+		}
+		if len(s.envs) != 3 {
+			t.Fatalf("got %d envelopes, want 3", len(s.envs))
+		}
+		for i, env := range s.envs {
+			if env.SeqEnd != uint64(i+1) {
+				t.Fatalf("envelopes out of order: %+v", s.envs)
+			}
+		}
+	}
+	if err := ms.Close(); err == nil || err.Error() != "b closed" {
+		t.Fatalf("Close() = %v, want the child's error", err)
+	}
+}
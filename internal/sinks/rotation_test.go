@@ -0,0 +1,218 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// writeChunked writes sb and venvs in chunks of n records so rotation has call
+// boundaries to act on, and returns the active log paths.
+func writeChunked(t *testing.T, dir string, opts FileSinkOptions, n int, sb []tfd.SBatch, venvs []tfd.Envelope) (string, string) {
+	t.Helper()
+	sPath, vPath := filepath.Join(dir, "s.log"), filepath.Join(dir, "v.log")
+	ss, err := NewSBatchFileSinkWithOptions(sPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := NewVEnvFileSinkWithOptions(vPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(sb); i += n {
+		ss.OnSBatches(sb[i:min(i+n, len(sb))])
+	}
+	for i := 0; i < len(venvs); i += n {
+		vs.AppendAll(venvs[i:min(i+n, len(venvs))])
+	}
+	if err := ss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sPath, vPath
+}
+
+// TestFileSinks_RotationReconstructsAcrossSegments writes past MaxBytes and verifies
+// that the logs rotate into bounded segments and that reading across them yields the
+// written records in order and the same reconstruction as an unrotated log.
+func TestFileSinks_RotationReconstructsAcrossSegments(t *testing.T) {
+	sb, venvs := sampleLogs()
+	want := tfd.NewState()
+	if err := want.Reconstruct(sb, venvs); err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string]FileSinkOptions{
+		"jsonl":      {MaxBytes: 4 << 10, MaxBackups: 100},
+		"binary":     {Format: FormatBinary, MaxBytes: 2 << 10, MaxBackups: 100},
+		"compressed": {Format: FormatBinary, Compressed: true, MaxBytes: 2 << 10, MaxBackups: 100},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sPath, vPath := writeChunked(t, t.TempDir(), opts, 20, sb, venvs)
+			for _, p := range []string{sPath, vPath} {
+				segs := logSegments(p)
+				if len(segs) < 3 {
+					t.Fatalf("%s: %d segments, want rotation into at least 3", filepath.Base(p), len(segs))
+				}
+				if opts.Compressed {
+					continue // sizes are only estimated before compression
+				}
+				for _, seg := range segs {
+					fi, err := os.Stat(seg)
+					if err != nil {
+						t.Fatal(err)
+					}
+					// A segment may overshoot by at most one write call (20 records).
+					if fi.Size() > opts.MaxBytes+20*200 {
+						t.Fatalf("%s is %d bytes, limit %d", seg, fi.Size(), opts.MaxBytes)
+					}
+				}
+			}
+			gotS, err := ReadAllSLogRotated(sPath)
+			if err != nil {
+				t.Fatalf("ReadAllSLogRotated: %v", err)
+			}
+			gotV, err := ReadAllVLogRotated(vPath)
+			if err != nil {
+				t.Fatalf("ReadAllVLogRotated: %v", err)
+			}
+			if !reflect.DeepEqual(gotS, sb) || !reflect.DeepEqual(gotV, venvs) {
+				t.Fatalf("records read across segments differ from written ones (s=%d/%d v=%d/%d)", len(gotS), len(sb), len(gotV), len(venvs))
+			}
+			if active, _ := ReadAllSLog(sPath); len(active) >= len(sb) {
+				t.Fatalf("ReadAllSLog should only read the active segment, got %d records", len(active))
+			}
+			st := tfd.NewState()
+			if err := st.Reconstruct(gotS, gotV); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(st.Cells(), want.Cells()) {
+				t.Fatalf("reconstruction across segments differs from the unrotated state")
+			}
+		})
+	}
+}
+
+// TestFileSinks_RotationKeepsMaxBackups verifies that only MaxBackups rotated segments
+// survive and that the rotated reader returns the retained suffix of the log.
+func TestFileSinks_RotationKeepsMaxBackups(t *testing.T) {
+	sb, venvs := sampleLogs()
+	opts := FileSinkOptions{Format: FormatBinary, MaxBytes: 1 << 10, MaxBackups: 2}
+	sPath, _ := writeChunked(t, t.TempDir(), opts, 20, sb, venvs)
+	for i := 1; i <= 2; i++ {
+		if _, err := os.Stat(segmentPath(sPath, i)); err != nil {
+			t.Fatalf("segment %d missing: %v", i, err)
+		}
+	}
+	if _, err := os.Stat(segmentPath(sPath, 3)); !os.IsNotExist(err) {
+		t.Fatalf("segment 3 should have been deleted, stat err=%v", err)
+	}
+	got, err := ReadAllSLogRotated(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || len(got) >= len(sb) {
+		t.Fatalf("retained %d of %d records; want a proper suffix", len(got), len(sb))
+	}
+	if !reflect.DeepEqual(got, sb[len(sb)-len(got):]) {
+		t.Fatalf("retained records are not the tail of the log")
+	}
+}
+
+// TestFileSinks_RotationWithoutBackupsKeepsData verifies that MaxBackups 0 does not
+// rotate (there is nowhere to keep the old data) instead of discarding the file.
+func TestFileSinks_RotationWithoutBackupsKeepsData(t *testing.T) {
+	sb, venvs := sampleLogs()
+	opts := FileSinkOptions{Format: FormatBinary, MaxBytes: 1 << 10}
+	sPath, vPath := writeChunked(t, t.TempDir(), opts, 20, sb, venvs)
+	if _, err := os.Stat(segmentPath(sPath, 1)); !os.IsNotExist(err) {
+		t.Fatalf("MaxBackups 0 should keep no rotated segment, stat err=%v", err)
+	}
+	gotS, err := ReadAllSLog(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotV, err := ReadAllVLog(vPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotS, sb) || !reflect.DeepEqual(gotV, venvs) {
+		t.Fatalf("records lost without backups (s=%d/%d v=%d/%d)", len(gotS), len(sb), len(gotV), len(venvs))
+	}
+}
+
+// TestFileSinks_FailedRotationKeepsWriting blocks the rename to path.1 and verifies
+// that the sink keeps appending to the current file, reports the failure, and
+// rotates once the obstacle is gone.
+func TestFileSinks_FailedRotationKeepsWriting(t *testing.T) {
+	sb, _ := sampleLogs()
+	dir := t.TempDir()
+	sPath := filepath.Join(dir, "s.log")
+	// A non-empty directory at s.log.1 cannot be removed or renamed over.
+	blocker := segmentPath(sPath, 1)
+	if err := os.MkdirAll(filepath.Join(blocker, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := NewSBatchFileSinkWithOptions(sPath, FileSinkOptions{Format: FormatBinary, MaxBytes: 1 << 10, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := len(sb) / 2
+	for i := 0; i < half; i += 20 {
+		ss.OnSBatches(sb[i:min(i+20, half)])
+	}
+	if err := ss.Flush(); err == nil {
+		t.Fatal("Flush did not report the failed rotation")
+	}
+	if _, err := os.Stat(sPath + ".next"); !os.IsNotExist(err) {
+		t.Fatalf("abandoned next segment left behind, stat err=%v", err)
+	}
+	if got, err := ReadAllSLog(sPath); err != nil || !reflect.DeepEqual(got, sb[:half]) {
+		t.Fatalf("current file holds %d of %d records (err=%v)", len(got), half, err)
+	}
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	for i := half; i < len(sb); i += 20 {
+		ss.OnSBatches(sb[i:min(i+20, len(sb))])
+	}
+	if err := ss.Close(); err != nil {
+		t.Fatalf("Close after the obstacle was removed: %v", err)
+	}
+	if _, err := os.Stat(segmentPath(sPath, 1)); err != nil {
+		t.Fatalf("no rotation after the obstacle was removed: %v", err)
+	}
+	var got []tfd.SBatch
+	for _, seg := range []string{segmentPath(sPath, 1), sPath} {
+		part, err := ReadAllSLog(seg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, part...)
+	}
+	// One backup is kept, so the oldest records may have rotated out; what remains
+	// must be the unbroken tail of what was written.
+	if len(got) == 0 || !reflect.DeepEqual(got, sb[len(sb)-len(got):]) {
+		t.Fatalf("retained %d records that are not the tail of the log", len(got))
+	}
+}
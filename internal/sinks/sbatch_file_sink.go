@@ -17,91 +17,159 @@
 package sinks
 
 import (
-	"bufio"
 	"encoding/json"
-	"os"
 	"sync"
-	"time"
 
 	tfd "vsa/plugin/tfd"
 )
 
-// SBatchFileSink is a buffered JSONL sink for S-batches. It is safe for
-// concurrent use and optimized for append-only workloads.
+// SBatchFileSink is a buffered JSONL (or binary, see FileSinkOptions) sink for
+// S-batches. It is safe for concurrent use and optimized for append-only workloads.
 type SBatchFileSink struct {
-	mu   sync.Mutex
-	f    *os.File
-	w    *bufio.Writer
-	path string
+	mu  sync.Mutex
+	lf  *logFile
+	buf []byte // scratch for binary records
+}
+
+// FileSinkOptions configures the S-batch and envelope file sinks.
+type FileSinkOptions struct {
+	// Format selects the record encoding (default FormatJSONL). Appending to an
+	// existing file requires the same format it was created with.
+	Format Format
+
+	// Compressed wraps the file in a gzip stream, flushed on the same cadence as the
+	// buffered writer. Readers detect gzip by its magic bytes. Appending to an
+	// existing file requires the same setting it was created with.
+	Compressed bool
+
+	// MaxBytes > 0 enables size-based rotation: once the file reaches MaxBytes it is
+	// renamed to path.1 (older segments shift to path.2, …) and a fresh file is started.
+	// Rotation happens between write calls, so segments may overshoot slightly.
+	MaxBytes int64
 
-	lastFlush time.Time
+	// MaxBackups is the number of rotated segments kept; older ones are deleted.
+	// MaxBackups 0 keeps no rotated segments, so the file is not rotated at all and
+	// grows past MaxBytes rather than dropping its data.
+	MaxBackups int
 }
 
 // NewSBatchFileSink opens (or creates) the file at path in append mode with
 // a buffered writer. Call Close() when done.
 func NewSBatchFileSink(path string) (*SBatchFileSink, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	return NewSBatchFileSinkWithOptions(path, FileSinkOptions{})
+}
+
+// NewSBatchFileSinkWithOptions is NewSBatchFileSink with explicit encoding options.
+func NewSBatchFileSinkWithOptions(path string, opts FileSinkOptions) (*SBatchFileSink, error) {
+	lf, err := openLogFile(path, opts, sLogMagic)
 	if err != nil {
 		return nil, err
 	}
-	s := &SBatchFileSink{f: f, w: bufio.NewWriterSize(f, 1<<20 /*1MiB*/), path: path, lastFlush: time.Now()}
-	return s, nil
+	return &SBatchFileSink{lf: lf}, nil
 }
 
-// OnSBatches writes the batches as JSON lines.
+// OnSBatches writes the batches as versioned JSON lines (or binary records).
 func (s *SBatchFileSink) OnSBatches(b []tfd.SBatch) {
 	if len(b) == 0 {
 		return
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	enc := json.NewEncoder(s.w)
+	if s.lf.format == FormatBinary {
+		s.buf = s.buf[:0]
+		for i := range b {
+			s.buf = appendSBatchRecord(s.buf, &b[i])
+		}
+		_, _ = s.lf.w.Write(s.buf)
+		s.lf.maybeFlush()
+		return
+	}
+	enc := json.NewEncoder(s.lf.w)
 	for _, sb := range b {
-		if err := enc.Encode(&sb); err != nil {
+		line := sBatchLine{Version: jsonlVersion, SBatch: sb}
+		if err := enc.Encode(&line); err != nil {
 			// best effort: on error, try to flush and retry once
-			_ = s.w.Flush()
-			_ = enc.Encode(&sb)
+			_ = s.lf.w.Flush()
+			_ = enc.Encode(&line)
 		}
 	}
 	// Flush periodically to bound data loss on crash and for visibility in /state.
-	if time.Since(s.lastFlush) > 100*time.Millisecond {
-		_ = s.w.Flush()
-		s.lastFlush = time.Now()
-	}
+	s.lf.maybeFlush()
 }
 
 // Flush forces buffered data to be written to disk.
 func (s *SBatchFileSink) Flush() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.lastFlush = time.Now()
-	return s.w.Flush()
+	return s.lf.flush()
 }
 
 // Close flushes and closes the underlying file.
 func (s *SBatchFileSink) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_ = s.w.Flush()
-	return s.f.Close()
+	return s.lf.close()
 }
 
 // ReadAllSLog reads the entire S-batch log file as a slice. Intended for demo/replay.
+// The format (JSONL or binary) and gzip compression are detected from the file header.
+// Rotated segments are not included; see ReadAllSLogRotated.
 func ReadAllSLog(path string) ([]tfd.SBatch, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
 	var out []tfd.SBatch
-	scanner := bufio.NewScanner(f)
-	buf := make([]byte, 0, 1<<20)
-	scanner.Buffer(buf, 1<<26)
-	for scanner.Scan() {
-		var sb tfd.SBatch
-		if err := json.Unmarshal(scanner.Bytes(), &sb); err == nil {
-			out = append(out, sb)
+	err := readSLogFile(path, func(b tfd.SBatch) { out = append(out, b) })
+	return out, err
+}
+
+// ReadAllSLogRotated reads the rotated segments of path (oldest first) followed by
+// path itself, for reconstruction across rotation. Each segment's format is detected
+// independently.
+func ReadAllSLogRotated(path string) ([]tfd.SBatch, error) {
+	var out []tfd.SBatch
+	err := eachSLogRotated(path, func(b tfd.SBatch) { out = append(out, b) })
+	return out, err
+}
+
+// StreamSLogRotated sends the batches of the rotated segments of path (oldest first)
+// followed by path itself to out, one at a time, so huge S logs can feed
+// State.ReconstructStream without being loaded at once. It does not close out.
+func StreamSLogRotated(path string, out chan<- tfd.SBatch) error {
+	return eachSLogRotated(path, func(b tfd.SBatch) { out <- b })
+}
+
+func eachSLogRotated(path string, fn func(tfd.SBatch)) error {
+	for _, seg := range logSegments(path) {
+		if err := readSLogFile(seg, fn); err != nil {
+			return err
 		}
 	}
-	return out, scanner.Err()
+	return nil
+}
+
+func readSLogFile(path string, fn func(tfd.SBatch)) error {
+	r, c, err := openLogReader(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	binaryLog, err := hasHeader(r, sLogMagic)
+	if err != nil {
+		return err
+	}
+	if !binaryLog {
+		return eachJSONLine(r, func(l sBatchLine) error {
+			if err := checkLineVersion(l.Version); err != nil {
+				return err
+			}
+			fn(l.SBatch)
+			return nil
+		})
+	}
+	return readBinaryRecords(r, func(p []byte) error {
+		sb, err := decodeSBatch(p)
+		if err != nil {
+			return err
+		}
+		fn(sb)
+		return nil
+	})
 }
@@ -17,42 +17,41 @@
 package sinks
 
 import (
-	"bufio"
 	"encoding/json"
-	"os"
 	"sync"
-	"time"
 
 	tfd "vsa/plugin/tfd"
 )
 
 // VEnvFileSink appends Vector envelopes to a JSONL log for audit/replay.
 type VEnvFileSink struct {
-	mu   sync.Mutex
-	f    *os.File
-	w    *bufio.Writer
-	path string
-
-	lastFlush time.Time
+	mu  sync.Mutex
+	lf  *logFile
+	buf []byte // scratch for binary records
 }
 
 func NewVEnvFileSink(path string) (*VEnvFileSink, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	return NewVEnvFileSinkWithOptions(path, FileSinkOptions{})
+}
+
+// NewVEnvFileSinkWithOptions is NewVEnvFileSink with explicit encoding options.
+func NewVEnvFileSinkWithOptions(path string, opts FileSinkOptions) (*VEnvFileSink, error) {
+	lf, err := openLogFile(path, opts, vLogMagic)
 	if err != nil {
 		return nil, err
 	}
-	return &VEnvFileSink{f: f, w: bufio.NewWriterSize(f, 1<<20), path: path, lastFlush: time.Now()}, nil
+	return &VEnvFileSink{lf: lf}, nil
 }
 
+// Append writes env after every envelope of previously returned Append/AppendAll
+// calls, so the log holds envelopes in call order. Concurrent producers of one key's
+// chain must serialize stamping and Append (tfd.VActor.EnqueuePersist does) for the
+// on-disk order to match the order the envelopes were accepted.
 func (s *VEnvFileSink) Append(env tfd.Envelope) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	enc := json.NewEncoder(s.w)
-	_ = enc.Encode(&env)
-	if time.Since(s.lastFlush) > 100*time.Millisecond {
-		_ = s.w.Flush()
-		s.lastFlush = time.Now()
-	}
+	s.writeLocked(&env)
+	s.lf.maybeFlush()
 }
 
 func (s *VEnvFileSink) AppendAll(envs []tfd.Envelope) {
@@ -61,46 +60,79 @@ func (s *VEnvFileSink) AppendAll(envs []tfd.Envelope) {
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	enc := json.NewEncoder(s.w)
 	for i := range envs {
-		_ = enc.Encode(&envs[i])
+		s.writeLocked(&envs[i])
 	}
-	if time.Since(s.lastFlush) > 100*time.Millisecond {
-		_ = s.w.Flush()
-		s.lastFlush = time.Now()
+	s.lf.maybeFlush()
+}
+
+func (s *VEnvFileSink) writeLocked(env *tfd.Envelope) {
+	if s.lf.format == FormatBinary {
+		s.buf = appendEnvelopeRecord(s.buf[:0], env)
+		_, _ = s.lf.w.Write(s.buf)
+		return
 	}
+	_ = json.NewEncoder(s.lf.w).Encode(&envelopeLine{Version: jsonlVersion, Envelope: *env})
 }
 
 func (s *VEnvFileSink) Flush() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.lastFlush = time.Now()
-	return s.w.Flush()
+	return s.lf.flush()
 }
 
 func (s *VEnvFileSink) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_ = s.w.Flush()
-	return s.f.Close()
+	return s.lf.close()
 }
 
-// ReadAllVLog reads the Vector envelope log for replay.
+// ReadAllVLog reads the Vector envelope log for replay. The format (JSONL or binary)
+// and gzip compression are detected from the file header. Rotated segments are not
+// included; see ReadAllVLogRotated.
 func ReadAllVLog(path string) ([]tfd.Envelope, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
 	var out []tfd.Envelope
-	scanner := bufio.NewScanner(f)
-	buf := make([]byte, 0, 1<<20)
-	scanner.Buffer(buf, 1<<26)
-	for scanner.Scan() {
-		var e tfd.Envelope
-		if err := json.Unmarshal(scanner.Bytes(), &e); err == nil {
-			out = append(out, e)
+	err := readVLogFile(path, &out)
+	return out, err
+}
+
+// ReadAllVLogRotated reads the rotated segments of path (oldest first) followed by
+// path itself.
+func ReadAllVLogRotated(path string) ([]tfd.Envelope, error) {
+	var out []tfd.Envelope
+	for _, seg := range logSegments(path) {
+		if err := readVLogFile(seg, &out); err != nil {
+			return out, err
 		}
 	}
-	return out, scanner.Err()
+	return out, nil
+}
+
+func readVLogFile(path string, out *[]tfd.Envelope) error {
+	r, c, err := openLogReader(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	binaryLog, err := hasHeader(r, vLogMagic)
+	if err != nil {
+		return err
+	}
+	if !binaryLog {
+		return eachJSONLine(r, func(l envelopeLine) error {
+			if err := checkLineVersion(l.Version); err != nil {
+				return err
+			}
+			*out = append(*out, l.Envelope)
+			return nil
+		})
+	}
+	return readBinaryRecords(r, func(p []byte) error {
+		e, err := decodeEnvelope(p)
+		if err != nil {
+			return err
+		}
+		*out = append(*out, e)
+		return nil
+	})
 }
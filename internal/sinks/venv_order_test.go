@@ -0,0 +1,88 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	tfd "vsa/plugin/tfd"
+)
+
+// TestVEnvFileSink_ConcurrentAppendKeepsPerKeyOrder has many goroutines push V-envelopes
+// for a few shared keys through the V router into one sink, and checks that the log
+// holds each key's envelopes in exactly the order they were chained: same sequence as
+// the actor queue, and every prev-hash links to the previous record of its key on disk.
+func TestVEnvFileSink_ConcurrentAppendKeepsPerKeyOrder(t *testing.T) {
+	for _, format := range []Format{FormatJSONL, FormatBinary} {
+		path := filepath.Join(t.TempDir(), "v.log")
+		sink, err := NewVEnvFileSinkWithOptions(path, FileSinkOptions{Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := []uint64{tfd.HashKey("a"), tfd.HashKey("b"), tfd.HashKey("c")}
+		router := tfd.NewVRouter()
+		var seq atomic.Uint64
+		var wg sync.WaitGroup
+		for g := 0; g < 16; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					k := keys[(g+i)%len(keys)]
+					env := tfd.Envelope{Channel: tfd.ChannelVector, Footprint: tfd.Footprint{KeyID: k, Scope: tfd.ChannelVector}, Delta: 1, SeqEnd: seq.Add(1)}
+					router.Route(k).EnqueuePersist(env, sink.Append)
+				}
+			}(g)
+		}
+		wg.Wait()
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ReadAllVLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 16*200 {
+			t.Fatalf("format %d: read %d envelopes want %d", format, len(got), 16*200)
+		}
+		perKey := make(map[uint64][]tfd.Envelope)
+		lastSeq := make(map[uint64]uint64)
+		for i, e := range got {
+			k := e.Footprint.KeyID
+			if e.HashPrev != tfd.VChainLink(k, lastSeq[k], e.SeqEnd) {
+				t.Fatalf("format %d: record %d (key %x seq %d) does not link to the previous on-disk seq %d", format, i, k, e.SeqEnd, lastSeq[k])
+			}
+			lastSeq[k] = e.SeqEnd
+			perKey[k] = append(perKey[k], e)
+		}
+		for _, k := range keys {
+			queued := router.Route(k).Drain()
+			if len(queued) != len(perKey[k]) {
+				t.Fatalf("format %d: key %x: %d on disk, %d accepted", format, k, len(perKey[k]), len(queued))
+			}
+			for i := range queued {
+				if queued[i] != perKey[k][i] {
+					t.Fatalf("format %d: key %x record %d: disk %+v accepted %+v", format, k, i, perKey[k][i], queued[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tfdharness builds the TFD components that the tfd-proxy and tfd-sim
+// harnesses select with flags, so both binaries accept the same values.
+package tfdharness
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"vsa/internal/ratelimiter/persistence"
+	"vsa/internal/sinks"
+	tfd "vsa/plugin/tfd"
+)
+
+// BuildTransformer returns the S-batch transformer for a -vsa mode:
+//   - "simple" (default): merge per flush
+//   - "compacting": merge across flushes for window
+func BuildTransformer(mode string, window time.Duration) (tfd.VSATransformer, error) {
+	switch mode {
+	case "", "simple":
+		return tfd.SimpleVSA{}, nil
+	case "compacting":
+		return tfd.NewCompactingVSA(window), nil
+	default:
+		return nil, fmt.Errorf("unknown -vsa %q (want simple|compacting)", mode)
+	}
+}
+
+// BuildKafkaSBatchSink returns the S-batch Kafka publisher for topic. The repo does
+// not bundle a Kafka client, so only the demo LoggingKafkaProducer is available: it
+// is used when brokers is empty, and a broker list is an error rather than being
+// silently ignored. To publish for real, pass a producer to sinks.NewKafkaSBatchSink.
+func BuildKafkaSBatchSink(brokers, topic string) (*sinks.KafkaSBatchSink, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("kafka s-batch sink: empty topic")
+	}
+	if brokers != "" {
+		return nil, fmt.Errorf("kafka s-batch sink: no Kafka client is bundled, cannot publish to brokers %s (leave them empty for the demo logging producer)", brokers)
+	}
+	log.Printf("publishing S-batches to kafka topic=%s (demo logging producer)", topic)
+	return sinks.NewKafkaSBatchSink(persistence.LoggingKafkaProducer{}, topic), nil
+}
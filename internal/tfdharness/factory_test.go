@@ -0,0 +1,52 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfdharness
+
+import (
+	"testing"
+	"time"
+
+	tfd "vsa/plugin/tfd"
+)
+
+func TestBuildTransformer(t *testing.T) {
+	if v, err := BuildTransformer("", time.Millisecond); err != nil {
+		t.Fatal(err)
+	} else if _, ok := v.(tfd.SimpleVSA); !ok {
+		t.Fatalf("default transformer = %T, want tfd.SimpleVSA", v)
+	}
+	if v, err := BuildTransformer("compacting", time.Millisecond); err != nil {
+		t.Fatal(err)
+	} else if _, ok := v.(*tfd.CompactingVSA); !ok {
+		t.Fatalf("compacting transformer = %T, want *tfd.CompactingVSA", v)
+	}
+	if _, err := BuildTransformer("bogus", time.Millisecond); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+}
+
+func TestBuildKafkaSBatchSink_FailsFastOnBrokers(t *testing.T) {
+	if s, err := BuildKafkaSBatchSink("", "sbatches"); err != nil || s == nil {
+		t.Fatalf("demo sink: %v, %v", s, err)
+	}
+	if _, err := BuildKafkaSBatchSink("localhost:9092", "sbatches"); err == nil {
+		t.Fatal("brokers accepted without a Kafka client")
+	}
+	if _, err := BuildKafkaSBatchSink("", ""); err == nil {
+		t.Fatal("empty topic accepted")
+	}
+}
@@ -32,26 +32,44 @@ type Op struct {
 	NeedsExternalDecision bool
 	IsGlobal              bool
 	IsSingleKey           bool // must be true for S
-	IsConservativeDelta   bool // must be true for S
+	// IsConservativeDelta must be true for S. Negative amounts qualify too: a pure
+	// decrement (e.g. handing back units in the same bucket) commutes with every other
+	// delta, so it can stay on S. A semantic reversal whose effect depends on an outside
+	// decision or on past state is not conservative: set NeedsExternalDecision (or
+	// IsBackdated for an earlier bucket), which force V regardless of this flag.
+	IsConservativeDelta bool
 
 	SeqEnd uint64 // idempotency marker for S; optional for V
 }
 
 var ErrNoKey = errors.New("op missing key")
 
+// ErrBucketsNotDisjoint is returned by ClassifyMulti for an empty, all-buckets or
+// repeated bucket list, whose footprints would not be disjoint.
+var ErrBucketsNotDisjoint = errors.New("buckets must be distinct and non-empty")
+
 // Classify projects an incoming Op into a Channel and Footprint with a Delta.
-// It defaults to Vector (V) if any uncertainty exists.
+// It defaults to Vector (V) if any uncertainty exists. Key and bucket ids come from
+// HashKey; see ClassifyWith for another Hasher.
 func Classify(op Op) (Channel, Footprint, int64, error) {
+	return ClassifyWith(HashKey, op)
+}
+
+// ClassifyWith is Classify with the key and bucket ids computed by h (nil: HashKey).
+func ClassifyWith(h Hasher, op Op) (Channel, Footprint, int64, error) {
 	if op.Key == "" {
 		return ChannelVector, Footprint{}, 0, ErrNoKey
 	}
-	keyID := HashKey(op.Key)
+	if h == nil {
+		h = HashKey
+	}
+	keyID := h(op.Key)
 	var bucketID uint64
 	all := false
 	if op.Bucket == "" {
 		all = true
 	} else {
-		bucketID = HashKey(op.Bucket)
+		bucketID = h(op.Bucket)
 	}
 
 	// Forced to V per rules §1 and §3
@@ -65,3 +83,37 @@ func Classify(op Op) (Channel, Footprint, int64, error) {
 	// OK → S
 	return ChannelScalar, Footprint{KeyID: keyID, Time: TimeFootprint{BucketID: bucketID, All: all}, Scope: ChannelScalar}, op.Amount, nil
 }
+
+// ClassifyMulti fans one single-key op out to several bucket footprints (e.g.
+// overlapping windows), returning one envelope per bucket that carries the full delta
+// on the channel Classify would pick. op.Bucket is ignored. Buckets must be distinct
+// and concrete (no "" = all), so the footprints are pairwise disjoint and each S
+// envelope stays independently batchable; reconstruction then credits every cell.
+func ClassifyMulti(op Op, buckets []string) ([]Envelope, error) {
+	return ClassifyMultiWith(HashKey, op, buckets)
+}
+
+// ClassifyMultiWith is ClassifyMulti with the ids computed by h (nil: HashKey).
+func ClassifyMultiWith(h Hasher, op Op, buckets []string) ([]Envelope, error) {
+	if op.Key == "" {
+		return nil, ErrNoKey
+	}
+	if len(buckets) == 0 {
+		return nil, ErrBucketsNotDisjoint
+	}
+	seen := make(map[string]struct{}, len(buckets))
+	out := make([]Envelope, 0, len(buckets))
+	for _, b := range buckets {
+		if _, dup := seen[b]; dup || b == "" {
+			return nil, ErrBucketsNotDisjoint
+		}
+		seen[b] = struct{}{}
+		op.Bucket = b
+		ch, fp, delta, err := ClassifyWith(h, op)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Envelope{Channel: ch, Footprint: fp, Delta: delta, SeqEnd: op.SeqEnd})
+	}
+	return out, nil
+}
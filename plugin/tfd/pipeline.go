@@ -16,7 +16,10 @@
 
 package tfd
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 // Pipeline is a small façade that wires together the S-lane (accumulator +
 // background service + optional VSA compression) and the V-lane (per-key
@@ -25,8 +28,8 @@ import "time"
 // persistence.
 //
 // Responsibilities:
-//   - Route Scalar envelopes to the S-lane service (with TryIngest fallback to
-//     blocking Ingest), which performs time-capped batching and optional VSA
+//   - Route Scalar envelopes to the S-lane service (blocking on a full buffer, or
+//     dropping under OverflowDrop), which performs time-capped batching and optional VSA
 //     compression before calling the configured SBatchesSink.
 //   - Route Vector envelopes to per-key V actors; callers can optionally persist
 //     them via the provided callback, or later drain them per key.
@@ -39,8 +42,24 @@ import "time"
 //   - Domain semantics remain outside; this only orchestrates lanes.
 //   - All options are explicit to avoid hidden global defaults.
 type Pipeline struct {
-	s *SService
-	v *VRouter
+	s      *SService
+	v      *VRouter
+	hasher Hasher
+
+	ops  atomic.Uint64
+	vOps atomic.Uint64
+}
+
+// PipelineStats is a point-in-time snapshot of pipeline counters, so embedders can
+// read coalescing gains (SBatchesIn vs SBatchesOut, Ops vs SBatchesOut) without
+// wiring Prometheus.
+type PipelineStats struct {
+	Ops         uint64    // envelopes passed to Handle
+	VOps        uint64    // Vector envelopes routed to V actors
+	SBatchesIn  uint64    // S-batches flushed by the accumulator, before the transformer
+	SBatchesOut uint64    // S-batches handed to the sink
+	LastFlush   time.Time // when S-batches were last handed to the sink; zero if never
+	SDropped    uint64    // Scalar envelopes dropped on a full buffer (OverflowDrop)
 }
 
 // PipelineOptions configures the S-lane and integrations. V-lane persistence is
@@ -53,6 +72,16 @@ type PipelineOptions struct {
 	TimeCap       time.Duration
 	FlushInterval time.Duration
 	Buffer        int
+	MaxLoadFactor float64        // see SServiceOptions.MaxLoadFactor
+	OnOverflow    OverflowPolicy // see SServiceOptions.OnOverflow
+	// Clock is the pipeline's time source for the shards' time caps, flush stats and
+	// (when VSA has a SetClock method, like CompactingVSA) the transformer. nil uses
+	// the package-level Now.
+	Clock Clock
+
+	// Hasher computes key and bucket ids in Pipeline.Classify and Pipeline.HashKey, e.g.
+	// XXHash64 to match an upstream partitioner. nil keeps HashKey (FNV-1a).
+	Hasher Hasher
 
 	// Integrations
 	VSA   VSATransformer
@@ -62,8 +91,38 @@ type PipelineOptions struct {
 // NewPipeline constructs and wires a Pipeline according to the provided options.
 func NewPipeline(opts PipelineOptions) *Pipeline {
 	acc := NewSAccumulator(opts.Shards, opts.OrderPow2, opts.CountThresh, opts.TimeCap)
-	svc := NewSService(acc, opts.VSA, opts.SSink, SServiceOptions{Buffer: opts.Buffer, FlushInterval: opts.FlushInterval})
-	return &Pipeline{s: svc, v: NewVRouter()}
+	if opts.Clock != nil {
+		acc.SetClock(opts.Clock)
+		if c, ok := opts.VSA.(interface{ SetClock(Clock) }); ok {
+			c.SetClock(opts.Clock)
+		}
+	}
+	svc := NewSService(acc, opts.VSA, opts.SSink, SServiceOptions{Buffer: opts.Buffer, FlushInterval: opts.FlushInterval, MaxLoadFactor: opts.MaxLoadFactor, OnOverflow: opts.OnOverflow})
+	h := opts.Hasher
+	if h == nil {
+		h = HashKey
+	}
+	return &Pipeline{s: svc, v: NewVRouter(), hasher: h}
+}
+
+// Classify is ClassifyWith using the pipeline's Hasher (PipelineOptions.Hasher).
+func (p *Pipeline) Classify(op Op) (Channel, Footprint, int64, error) {
+	return ClassifyWith(p.hasher, op)
+}
+
+// ClassifyMulti is ClassifyMultiWith using the pipeline's Hasher.
+func (p *Pipeline) ClassifyMulti(op Op, buckets []string) ([]Envelope, error) {
+	return ClassifyMultiWith(p.hasher, op, buckets)
+}
+
+// HashKey returns the id the pipeline's Hasher assigns to a key or bucket string, for
+// looking up cells of reconstructed state.
+func (p *Pipeline) HashKey(s string) uint64 { return p.hasher(s) }
+
+// BucketIDFor is BucketIDForWith using the pipeline's Hasher, i.e. the id Classify
+// assigns to BucketFor(ts, width).
+func (p *Pipeline) BucketIDFor(ts time.Time, width time.Duration) uint64 {
+	return BucketIDForWith(p.hasher, ts, width)
 }
 
 // Start launches the background S-lane service.
@@ -79,22 +138,41 @@ func (p *Pipeline) FlushS() { p.s.Flush() }
 
 // Handle routes an already classified envelope to the appropriate lane.
 // For Vector envelopes, an optional persistV callback can be provided to
-// synchronously persist the event (e.g., append to a log). For Scalar, the
-// envelope is ingested into the S-lane service (TryIngest first, then Ingest).
-func (p *Pipeline) Handle(env Envelope, persistV func(Envelope)) {
+// synchronously persist the event (e.g., append to a log); it receives the envelope
+// stamped with its V-chain link and runs under the key's actor lock, so concurrent
+// Handle calls persist each key's envelopes in chain order. For Scalar, the
+// envelope is submitted to the S-lane service (SService.Submit); the returned error
+// is ErrSDropped when it was discarded under OverflowDrop, and nil otherwise.
+func (p *Pipeline) Handle(env Envelope, persistV func(Envelope)) error {
+	p.ops.Add(1)
 	if env.Channel == ChannelScalar {
-		if !p.s.TryIngest(env) {
-			p.s.Ingest(env)
-		}
-		return
+		return p.s.Submit(env)
 	}
-	act := p.v.Route(env.Footprint.KeyID)
-	act.Enqueue(env)
-	if persistV != nil {
-		persistV(env)
+	p.vOps.Add(1)
+	p.v.Route(env.Footprint.KeyID).EnqueuePersist(env, persistV)
+	return nil
+}
+
+// Stats returns a snapshot of the pipeline counters. It is safe to call concurrently
+// with Handle; S-lane counts advance when the service flushes.
+func (p *Pipeline) Stats() PipelineStats {
+	st := PipelineStats{
+		Ops:         p.ops.Load(),
+		VOps:        p.vOps.Load(),
+		SBatchesIn:  p.s.batchesIn.Load(),
+		SBatchesOut: p.s.batchesOut.Load(),
+		SDropped:    p.s.dropped.Load(),
 	}
+	if ns := p.s.lastFlushNs.Load(); ns != 0 {
+		st.LastFlush = time.Unix(0, ns)
+	}
+	return st
 }
 
 // DrainV returns (and clears) all queued Vector envelopes for a given key in
 // FIFO order, suitable for persistence or replay.
 func (p *Pipeline) DrainV(keyID uint64) []Envelope { return p.v.Route(keyID).Drain() }
+
+// ResumeV continues the V chains from an existing V log (see VRouter.Resume). Call it
+// before the first Handle when appending to a log written by an earlier process.
+func (p *Pipeline) ResumeV(vEnvs []Envelope) { p.v.Resume(vEnvs) }
@@ -17,6 +17,7 @@
 package tfd
 
 import (
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -90,3 +91,205 @@ func TestPipeline_RoutesAndFlushes(t *testing.T) {
 		t.Fatalf("unexpected V drain: %+v", vout)
 	}
 }
+
+// TestPipeline_ClassifyMultiCreditsEveryBucket ingests a multi-bucket op through the
+// S-lane and verifies each bucket cell receives the delta on reconstruction.
+func TestPipeline_ClassifyMultiCreditsEveryBucket(t *testing.T) {
+	buckets := []string{"w-1m", "w-5m", "w-1h"}
+	envs, err := ClassifyMulti(Op{Key: "k-multi", Amount: 3, IsSingleKey: true, IsConservativeDelta: true, SeqEnd: 9}, buckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != len(buckets) {
+		t.Fatalf("got %d envelopes, want %d", len(envs), len(buckets))
+	}
+	for i := range envs {
+		if envs[i].Channel != ChannelScalar {
+			t.Fatalf("envelope %d not S-eligible: %+v", i, envs[i])
+		}
+		for j := i + 1; j < len(envs); j++ {
+			if !envs[i].Footprint.Disjoint(envs[j].Footprint) {
+				t.Fatalf("footprints %d and %d overlap", i, j)
+			}
+		}
+	}
+	for _, bad := range [][]string{nil, {"w-1m", "w-1m"}, {"w-1m", ""}} {
+		if _, err := ClassifyMulti(Op{Key: "k-multi", Amount: 1}, bad); err != ErrBucketsNotDisjoint {
+			t.Fatalf("ClassifyMulti(%q) err=%v, want ErrBucketsNotDisjoint", bad, err)
+		}
+	}
+
+	sink := &sinkMock2{}
+	p := NewPipeline(PipelineOptions{Shards: 2, OrderPow2: 4, CountThresh: 1024, TimeCap: time.Hour, FlushInterval: time.Hour, Buffer: 16, VSA: SimpleVSA{}, SSink: sink})
+	p.Start()
+	for i := 0; i < 2; i++ {
+		for _, e := range envs {
+			p.Handle(e, nil)
+		}
+	}
+	p.Stop()
+
+	st := NewState()
+	sink.mu.Lock()
+	if err := st.Reconstruct(sink.seen, nil); err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Unlock()
+	key := HashKey("k-multi")
+	for _, b := range buckets {
+		if got := st.Cells()[[2]uint64{key, HashKey(b)}]; got != 6 {
+			t.Fatalf("bucket %s: cell=%d want 6", b, got)
+		}
+	}
+	if len(st.Cells()) != len(buckets) {
+		t.Fatalf("unexpected cells: %v", st.Cells())
+	}
+}
+
+// TestPipeline_Stats drives a known S/V mix and checks the pipeline's own counters.
+func TestPipeline_Stats(t *testing.T) {
+	sink := &sinkMock2{}
+	p := NewPipeline(PipelineOptions{Shards: 2, OrderPow2: 6, CountThresh: 1024, TimeCap: time.Hour, FlushInterval: time.Hour, Buffer: 64, VSA: SimpleVSA{}, SSink: sink})
+	p.Start()
+	defer p.Stop()
+	if st := p.Stats(); st != (PipelineStats{}) {
+		t.Fatalf("fresh pipeline stats=%+v, want zero", st)
+	}
+
+	// 30 S ops over 3 cells (one of which nets to zero), 4 V ops.
+	for i := 0; i < 30; i++ {
+		delta := int64(1)
+		if i%3 == 2 {
+			delta = int64(1 - 2*(i/3%2)) // alternates +1/-1 over 10 ops → nets to 0
+		}
+		fp := Footprint{KeyID: HashKey("k-stats"), Time: TimeFootprint{BucketID: uint64(i % 3)}, Scope: ChannelScalar}
+		p.Handle(Envelope{Channel: ChannelScalar, Footprint: fp, Delta: delta, SeqEnd: uint64(i)}, nil)
+	}
+	for i := 0; i < 4; i++ {
+		fp := Footprint{KeyID: HashKey("k-stats"), Time: TimeFootprint{BucketID: 0}, Scope: ChannelVector}
+		p.Handle(Envelope{Channel: ChannelVector, Footprint: fp, Delta: -1, SeqEnd: uint64(100 + i)}, nil)
+	}
+	before := time.Now()
+	p.FlushS()
+
+	st := p.Stats()
+	if st.Ops != 34 || st.VOps != 4 {
+		t.Fatalf("Ops=%d VOps=%d, want 34 and 4", st.Ops, st.VOps)
+	}
+	// The accumulator coalesces 30 ops into 3 cells; SimpleVSA drops the net-zero one.
+	if st.SBatchesIn != 3 || st.SBatchesOut != 2 {
+		t.Fatalf("SBatchesIn=%d SBatchesOut=%d, want 3 and 2", st.SBatchesIn, st.SBatchesOut)
+	}
+	if st.LastFlush.Before(before.Add(-time.Second)) || st.LastFlush.After(time.Now()) {
+		t.Fatalf("LastFlush=%v not set by the flush", st.LastFlush)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if uint64(len(sink.seen)) != st.SBatchesOut {
+		t.Fatalf("sink saw %d batches, stats report %d", len(sink.seen), st.SBatchesOut)
+	}
+}
+
+// TestPipeline_HandleReportsSaturation fills the S-lane buffer of a pipeline whose
+// service is not draining and checks that Handle reports saturation for further Scalar
+// envelopes while Vector envelopes are still routed.
+func TestPipeline_HandleReportsSaturation(t *testing.T) {
+	p := NewPipeline(PipelineOptions{Shards: 1, OrderPow2: 4, CountThresh: 1024, TimeCap: time.Hour, FlushInterval: time.Hour, Buffer: 4, OnOverflow: OverflowDrop, VSA: SimpleVSA{}})
+	s := Envelope{Channel: ChannelScalar, Footprint: Footprint{KeyID: HashKey("k-sat"), Time: TimeFootprint{BucketID: 1}, Scope: ChannelScalar}, Delta: 1}
+	for i := 0; i < 4; i++ {
+		if err := p.Handle(s, nil); err != nil {
+			t.Fatalf("Handle #%d with room in the buffer: %v", i, err)
+		}
+	}
+	if err := p.Handle(s, nil); !errors.Is(err, ErrSDropped) {
+		t.Fatalf("Handle on a full S-lane = %v, want ErrSDropped", err)
+	}
+
+	var persisted int
+	v := Envelope{Channel: ChannelVector, Footprint: Footprint{KeyID: HashKey("k-sat"), Time: TimeFootprint{BucketID: 1}, Scope: ChannelVector}, Delta: -1, SeqEnd: 1}
+	if err := p.Handle(v, func(Envelope) { persisted++ }); err != nil || persisted != 1 {
+		t.Fatalf("V Handle while S is saturated: err=%v persisted=%d, want nil and 1", err, persisted)
+	}
+	if st := p.Stats(); st.SDropped != 1 || st.VOps != 1 {
+		t.Fatalf("stats %+v, want SDropped=1 VOps=1", st)
+	}
+
+	// Once the service drains the buffer, Scalar envelopes are accepted again.
+	p.Start()
+	defer p.Stop()
+	p.FlushS()
+	if err := p.Handle(s, nil); err != nil {
+		t.Fatalf("Handle after draining: %v", err)
+	}
+}
+
+// A Pipeline's Hasher decides footprint ids deterministically; switching to XXHash64
+// yields the well-known xxHash64 ids, and shard routing follows the ids it produces.
+func TestPipeline_Hasher(t *testing.T) {
+	// Reference xxHash64 (seed 0) vectors.
+	if got := XXHash64(""); got != 0xef46db3751d8e999 {
+		t.Fatalf("XXHash64(\"\")=%#x", got)
+	}
+	if got := XXHash64("a"); got != 0xd24ec4f1a98c6e5b {
+		t.Fatalf("XXHash64(\"a\")=%#x", got)
+	}
+	if h, err := HasherByName("nope"); h != nil || err == nil {
+		t.Fatalf("HasherByName(nope) must fail")
+	}
+
+	op := Op{Key: "tenant-42", Bucket: "t1s/7", Amount: 1, IsSingleKey: true, IsConservativeDelta: true}
+	def := NewPipeline(PipelineOptions{Shards: 1})
+	xx := NewPipeline(PipelineOptions{Shards: 1, Hasher: XXHash64})
+	_, fpDef, _, _ := def.Classify(op)
+	_, fpXX, _, _ := xx.Classify(op)
+	if _, want, _, _ := Classify(op); fpDef != want {
+		t.Fatalf("default pipeline footprint %+v != Classify %+v", fpDef, want)
+	}
+	if fpXX.KeyID != XXHash64(op.Key) || fpXX.Time.BucketID != XXHash64(op.Bucket) {
+		t.Fatalf("xxhash footprint %+v", fpXX)
+	}
+	if _, again, _, _ := xx.Classify(op); again != fpXX {
+		t.Fatalf("classification not deterministic: %+v vs %+v", again, fpXX)
+	}
+	if fpXX.KeyID == fpDef.KeyID || xx.HashKey(op.Key) != fpXX.KeyID {
+		t.Fatalf("switching hashers must change ids: default=%#x xx=%#x", fpDef.KeyID, fpXX.KeyID)
+	}
+
+	// Bucket ids derived from a timestamp follow the hasher too, matching what Classify
+	// assigns to the BucketFor label.
+	ts := time.Unix(42, 0)
+	bop := op
+	bop.Bucket = BucketFor(ts, time.Second)
+	_, fpB, _, _ := xx.Classify(bop)
+	if got := xx.BucketIDFor(ts, time.Second); got != fpB.Time.BucketID || BucketIDForWith(XXHash64, ts, time.Second) != got {
+		t.Fatalf("xxhash BucketIDFor=%#x want Classify's %#x", got, fpB.Time.BucketID)
+	}
+	if def.BucketIDFor(ts, time.Second) != BucketIDFor(ts, time.Second) || BucketIDFor(ts, time.Second) == fpB.Time.BucketID {
+		t.Fatalf("default BucketIDFor must use HashKey")
+	}
+
+	// Routing is a pure function of the ids: the shard for a key under each hasher is
+	// exactly what its ids select, so switching hashers moves keys predictably.
+	acc := NewSAccumulator(8, 4, 1<<20, time.Hour)
+	moved := 0
+	for i := 0; i < 64; i++ {
+		op.Key = "k" + string(rune('A'+i%26)) + string(rune('a'+i/26))
+		for _, p := range []*Pipeline{def, xx} {
+			ch, fp, d, err := p.Classify(op)
+			if err != nil || ch != ChannelScalar {
+				t.Fatalf("Classify(%q): ch=%v err=%v", op.Key, ch, err)
+			}
+			want := int(packKeyBucket(p.HashKey(op.Key), p.HashKey(op.Bucket)) % 8)
+			if got := acc.shardIndex(fp.KeyID, fp.Time.BucketID); got != want {
+				t.Fatalf("%q routed to shard %d, want %d", op.Key, got, want)
+			}
+			acc.Ingest(Envelope{Channel: ch, Footprint: fp, Delta: d})
+		}
+		if acc.shardIndex(def.HashKey(op.Key), def.HashKey(op.Bucket)) != acc.shardIndex(xx.HashKey(op.Key), xx.HashKey(op.Bucket)) {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("switching hashers moved no key to another shard")
+	}
+}
@@ -16,11 +16,26 @@
 
 package tfd
 
-import "sort"
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrVChainBroken reports a V log whose per-key chain has a gap, a duplicate or a
+// reordered envelope (see StrictVChain).
+var ErrVChainBroken = errors.New("tfd: broken V chain")
 
 // State is a minimal in-memory model for tests: value per (key,bucket).
 type State struct {
 	cells map[[2]uint64]int64
+
+	// StrictVChain makes Reconstruct verify that the V-envelopes of each key, in the
+	// order given (log order), form the prev-hash chain stamped by VActor.Enqueue.
+	// The first envelope of a key is trusted (its predecessor may have been compacted
+	// away); later ones must link to their predecessor, so writers appending to an
+	// existing log resume the chain (VRouter.Resume) rather than restart it.
+	StrictVChain bool
 }
 
 func NewState() *State { return &State{cells: make(map[[2]uint64]int64)} }
@@ -37,10 +52,44 @@ func (s *State) applyV(env Envelope) {
 }
 
 // Reconstruct applies S-batches in any order and then V-envelopes in per-key order.
-func (s *State) Reconstruct(sBatches []SBatch, vEnvs []Envelope) {
+// With StrictVChain set, a broken chain returns an error wrapping ErrVChainBroken and
+// nothing is applied; otherwise it always returns nil.
+func (s *State) Reconstruct(sBatches []SBatch, vEnvs []Envelope) error {
+	if s.StrictVChain {
+		if err := VerifyVChain(vEnvs); err != nil {
+			return err
+		}
+	}
 	for _, b := range sBatches {
 		s.applyS(b)
 	}
+	s.applyVOrdered(vEnvs)
+	return nil
+}
+
+// ReconstructStream is Reconstruct for S logs too large to hold in memory: S-batches
+// are applied as they arrive on sBatches until it is closed, then V-envelopes in
+// per-key order (V still needs its per-key sort, so it stays a slice). The result
+// equals Reconstruct on the same input. With StrictVChain set, a broken chain is
+// detected before any S-batch is applied; sBatches is then drained without applying
+// anything, so the producer never blocks.
+func (s *State) ReconstructStream(sBatches <-chan SBatch, vEnvs []Envelope) error {
+	if s.StrictVChain {
+		if err := VerifyVChain(vEnvs); err != nil {
+			for range sBatches {
+			}
+			return err
+		}
+	}
+	for b := range sBatches {
+		s.applyS(b)
+	}
+	s.applyVOrdered(vEnvs)
+	return nil
+}
+
+// applyVOrdered sorts vEnvs by key and SeqEnd and applies them in that order.
+func (s *State) applyVOrdered(vEnvs []Envelope) {
 	// Apply V in order per key by SeqEnd for determinism in tests
 	sort.Slice(vEnvs, func(i, j int) bool {
 		if vEnvs[i].Footprint.KeyID == vEnvs[j].Footprint.KeyID {
@@ -53,6 +102,31 @@ func (s *State) Reconstruct(sBatches []SBatch, vEnvs []Envelope) {
 	}
 }
 
+// VerifyVChain checks that vEnvs, in log order, form a consistent prev-hash chain per
+// key: sequences strictly increase (no duplicate or reordering) and each link names
+// its predecessor (no gap). The first envelope of each key is trusted; a link that
+// restarts at 0 anywhere else is a break, since it hides whatever preceded it.
+func VerifyVChain(vEnvs []Envelope) error {
+	last := make(map[uint64]uint64)
+	for i, e := range vEnvs {
+		k := e.Footprint.KeyID
+		prev, seen := last[k]
+		last[k] = e.SeqEnd
+		if !seen {
+			continue
+		}
+		switch {
+		case e.SeqEnd == prev:
+			return fmt.Errorf("%w: key %x: duplicate seq %d at record %d", ErrVChainBroken, k, e.SeqEnd, i)
+		case e.SeqEnd < prev:
+			return fmt.Errorf("%w: key %x: seq %d after %d at record %d", ErrVChainBroken, k, e.SeqEnd, prev, i)
+		case e.HashPrev != VChainLink(k, prev, e.SeqEnd):
+			return fmt.Errorf("%w: key %x: seq %d does not link to %d at record %d (gap or corruption)", ErrVChainBroken, k, e.SeqEnd, prev, i)
+		}
+	}
+	return nil
+}
+
 // BaselineApply applies mixed envelopes naively in arrival order, simulating
 // a fully ordered single-log execution for comparison in tests.
 func (s *State) BaselineApply(envs []Envelope) {
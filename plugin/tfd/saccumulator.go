@@ -17,6 +17,7 @@
 package tfd
 
 import (
+	"sync/atomic"
 	"time"
 )
 
@@ -40,11 +41,35 @@ type SShard struct {
 	timeCap        time.Duration
 	lastFlushAt    time.Time
 	pending        bool
+	clock          Clock // nil falls back to the package-level Now
+
+	// maxUsed is the occupancy (from MaxLoadFactor) at which a new cell first moves
+	// the table contents to spill; spill is emitted ahead of the table by Flush.
+	maxUsed int
+	spill   []SBatch
+	spills  int // load-factor flushes, for tests/diagnostics
+
+	// allCells aggregates All=true (every-bucket) deltas per key, indexed by allIdx,
+	// apart from the bucket cells: an All footprint is never Disjoint from a bucket
+	// footprint of the same key, so it must not share a probe slot with one. At flush
+	// time each cell is merged into its key's bucket-0 cell (the BucketID Classify
+	// reports for All), so a flush still emits one batch per (key, bucket).
+	allIdx   map[uint64]int
+	allCells []SBatch
+
+	// Occupancy and flush-trigger counts, published for readers outside the writer
+	// goroutine (SAccumulator.ShardStats).
+	usedPub      atomic.Int64
+	countFlushes atomic.Uint64
+	timeFlushes  atomic.Uint64
 }
 
+// defaultMaxLoadFactor keeps linear probing chains short.
+const defaultMaxLoadFactor = 0.75
+
 func newSShard(orderPow2 uint, countThreshold int, timeCap time.Duration) *SShard {
 	n := 1 << orderPow2
-	return &SShard{
+	s := &SShard{
 		keys:           make([]uint64, n),
 		keyIDs:         make([]uint64, n),
 		bucketIDs:      make([]uint64, n),
@@ -55,6 +80,32 @@ func newSShard(orderPow2 uint, countThreshold int, timeCap time.Duration) *SShar
 		timeCap:        timeCap,
 		lastFlushAt:    Now(),
 	}
+	s.setMaxLoadFactor(defaultMaxLoadFactor)
+	return s
+}
+
+// now reads the shard's clock.
+func (s *SShard) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return Now()
+}
+
+// setClock switches the shard to c and restarts its time cap from c's current time.
+func (s *SShard) setClock(c Clock) {
+	s.clock = c
+	s.lastFlushAt = s.now()
+}
+
+// setMaxLoadFactor sets the occupancy fraction that triggers a flush-and-clear.
+// f <= 0 selects the default; the limit always leaves one slot free so probing ends.
+func (s *SShard) setMaxLoadFactor(f float64) {
+	if f <= 0 {
+		f = defaultMaxLoadFactor
+	}
+	n := len(s.keys)
+	s.maxUsed = max(1, min(n-1, int(f*float64(n))))
 }
 
 func (s *SShard) probe(k uint64) int {
@@ -71,8 +122,20 @@ func (s *SShard) probe(k uint64) int {
 
 // Ingest merges an S-envelope's delta into the shard accumulator.
 func (s *SShard) Ingest(env Envelope) {
+	if env.Footprint.Time.All {
+		s.ingestAll(env)
+		s.maybeFlush()
+		return
+	}
 	k := packKeyBucket(env.Footprint.KeyID, env.Footprint.Time.BucketID)
 	i := s.probe(k)
+	if s.keys[i] == 0 && s.used >= s.maxUsed {
+		// Table at its load factor: move the contents aside instead of letting probe
+		// chains grow (or the table fill up); nothing is lost, Flush emits the spill.
+		s.spills++
+		s.flushTable(&s.spill)
+		i = s.probe(k)
+	}
 	if s.keys[i] == 0 {
 		s.keys[i] = k
 		s.keyIDs[i] = env.Footprint.KeyID
@@ -87,17 +150,90 @@ func (s *SShard) Ingest(env Envelope) {
 	s.maybeFlush()
 }
 
+// ingestAll merges an All=true delta into its key's every-bucket cell.
+func (s *SShard) ingestAll(env Envelope) {
+	key := env.Footprint.KeyID
+	i, ok := s.allIdx[key]
+	if !ok {
+		if s.allIdx == nil {
+			s.allIdx = make(map[uint64]int)
+		}
+		i = len(s.allCells)
+		s.allIdx[key] = i
+		s.allCells = append(s.allCells, SBatch{KeyID: key, BucketID: env.Footprint.Time.BucketID})
+	}
+	c := &s.allCells[i]
+	c.NetDelta += env.Delta
+	if env.SeqEnd > c.SeqEnd {
+		c.SeqEnd = env.SeqEnd
+	}
+}
+
+// maybeFlush reports whether the count threshold or the time cap since the last
+// trigger has been reached. It is a readiness check only: cells stay in the table
+// until the next Flush. The first trigger after a Flush is counted by kind.
 func (s *SShard) maybeFlush() bool {
-	now := Now()
-	if s.used >= s.countThreshold || now.Sub(s.lastFlushAt) >= s.timeCap {
-		s.lastFlushAt = now
-		return true
+	now := s.now()
+	s.usedPub.Store(int64(s.used))
+	byCount := s.used+len(s.allCells) >= s.countThreshold
+	if !byCount && now.Sub(s.lastFlushAt) < s.timeCap {
+		return false
+	}
+	if !s.pending {
+		s.pending = true
+		if byCount {
+			s.countFlushes.Add(1)
+		} else {
+			s.timeFlushes.Add(1)
+		}
 	}
-	return false
+	s.lastFlushAt = now
+	return true
 }
 
-// Flush emits compact S-batches and clears the table (lazy clear by zeroing used slots).
+// Flush emits compact S-batches, including any load-factor spill and the every-bucket
+// cells, and clears the table (lazy clear by zeroing used slots).
 func (s *SShard) Flush(out *[]SBatch) {
+	if len(s.spill) > 0 {
+		*out = append(*out, s.spill...)
+		s.spill = s.spill[:0]
+	}
+	from := len(*out)
+	s.flushTable(out)
+	if len(s.allCells) > 0 {
+		mergeAllCells(out, from, s.allCells)
+		s.allCells = s.allCells[:0]
+		clear(s.allIdx)
+	}
+	s.pending = false
+	s.usedPub.Store(0)
+}
+
+// mergeAllCells folds every-bucket cells into their key's bucket-0 batch among
+// (*out)[from:], appending the cells whose key has none.
+func mergeAllCells(out *[]SBatch, from int, cells []SBatch) {
+	var zero map[uint64]int
+	for j := from; j < len(*out); j++ {
+		if (*out)[j].BucketID == 0 {
+			if zero == nil {
+				zero = make(map[uint64]int)
+			}
+			zero[(*out)[j].KeyID] = j
+		}
+	}
+	for _, c := range cells {
+		j, ok := zero[c.KeyID]
+		if !ok {
+			*out = append(*out, c)
+			continue
+		}
+		b := &(*out)[j]
+		b.NetDelta += c.NetDelta
+		b.SeqEnd = max(b.SeqEnd, c.SeqEnd)
+	}
+}
+
+func (s *SShard) flushTable(out *[]SBatch) {
 	if s.used == 0 {
 		return
 	}
@@ -124,10 +260,22 @@ func (s *SShard) Flush(out *[]SBatch) {
 
 // FlushKey emits S-batches for a specific key and clears only those entries.
 func (s *SShard) FlushKey(keyID uint64, out *[]SBatch) {
-	if s.used == 0 {
-		return
+	if len(s.spill) > 0 {
+		kept := s.spill[:0]
+		for _, b := range s.spill {
+			if b.KeyID == keyID {
+				*out = append(*out, b)
+			} else {
+				kept = append(kept, b)
+			}
+		}
+		s.spill = kept
 	}
+	from := len(*out)
 	for i := range s.keys {
+		if s.used == 0 {
+			break
+		}
 		if s.keys[i] == 0 || s.keyIDs[i] != keyID {
 			continue
 		}
@@ -146,4 +294,23 @@ func (s *SShard) FlushKey(keyID uint64, out *[]SBatch) {
 		s.seqEnds[i] = 0
 		s.used--
 	}
+	s.usedPub.Store(int64(s.used))
+	s.flushKeyAll(keyID, out, from)
+}
+
+// flushKeyAll merges keyID's every-bucket cell, if any, into the batches FlushKey
+// emitted from (*out)[from:] and removes it.
+func (s *SShard) flushKeyAll(keyID uint64, out *[]SBatch, from int) {
+	i, ok := s.allIdx[keyID]
+	if !ok {
+		return
+	}
+	mergeAllCells(out, from, s.allCells[i:i+1])
+	last := len(s.allCells) - 1
+	if i != last {
+		s.allCells[i] = s.allCells[last]
+		s.allIdx[s.allCells[i].KeyID] = i
+	}
+	s.allCells = s.allCells[:last]
+	delete(s.allIdx, keyID)
 }
@@ -20,7 +20,9 @@ import "time"
 
 // SAccumulator holds N independent single-writer shards and exposes a simple API.
 type SAccumulator struct {
-	shards []*SShard
+	shards  []*SShard
+	clock   Clock // nil falls back to the package-level Now
+	spilled bool  // a shard spilled since the last FlushAll
 }
 
 // NewSAccumulator creates an SAccumulator with p shards, each having an
@@ -40,6 +42,35 @@ func NewSAccumulator(p, orderPow2, countThreshold int, timeCap time.Duration) *S
 	return acc
 }
 
+// SetMaxLoadFactor sets the occupancy fraction of each shard table at which the shard
+// flushes its contents aside (emitted with the next FlushAll) before adding a new cell.
+// The spill grows until that FlushAll, so callers bounding memory should FlushAll as
+// soon as SpillPending reports true, as SService does. f <= 0 selects the default
+// (0.75). Must not be called concurrently with Ingest.
+func (a *SAccumulator) SetMaxLoadFactor(f float64) {
+	for _, s := range a.shards {
+		s.setMaxLoadFactor(f)
+	}
+}
+
+// SetClock gives the accumulator its own time source for the shards' time caps,
+// independent of the package-level Now (and of other accumulators). nil reverts to
+// Now. Must not be called concurrently with Ingest.
+func (a *SAccumulator) SetClock(c Clock) {
+	a.clock = c
+	for _, s := range a.shards {
+		s.setClock(c)
+	}
+}
+
+// now reads the accumulator's clock.
+func (a *SAccumulator) now() time.Time {
+	if a.clock != nil {
+		return a.clock()
+	}
+	return Now()
+}
+
 func (a *SAccumulator) shardIndex(keyID, bucketID uint64) int {
 	// shard on combined ids for better distribution
 	k := packKeyBucket(keyID, bucketID)
@@ -51,8 +82,41 @@ func (a *SAccumulator) Ingest(env Envelope) {
 	if env.Channel != ChannelScalar {
 		return
 	}
-	i := a.shardIndex(env.Footprint.KeyID, env.Footprint.Time.BucketID)
-	a.shards[i].Ingest(env)
+	s := a.shards[a.shardIndex(env.Footprint.KeyID, env.Footprint.Time.BucketID)]
+	s.Ingest(env)
+	if len(s.spill) > 0 {
+		a.spilled = true
+	}
+}
+
+// SpillPending reports whether a shard has reached its load factor and moved its table
+// aside since the last FlushAll. Must be called from the writer goroutine.
+func (a *SAccumulator) SpillPending() bool {
+	return a.spilled
+}
+
+// ShardStats is a point-in-time view of one accumulator shard, for tuning the table
+// size, count threshold and time cap.
+type ShardStats struct {
+	Used         int    // occupied table slots
+	Slots        int    // table size (2^orderPow2)
+	CountFlushes uint64 // flushes made ready by the count threshold
+	TimeFlushes  uint64 // flushes made ready by the time cap
+}
+
+// ShardStats returns the per-shard occupancy and flush-trigger counts, indexed by
+// shard. It is safe to call concurrently with Ingest and FlushAll.
+func (a *SAccumulator) ShardStats() []ShardStats {
+	out := make([]ShardStats, len(a.shards))
+	for i, s := range a.shards {
+		out[i] = ShardStats{
+			Used:         int(s.usedPub.Load()),
+			Slots:        len(s.keys),
+			CountFlushes: s.countFlushes.Load(),
+			TimeFlushes:  s.timeFlushes.Load(),
+		}
+	}
+	return out
 }
 
 // FlushAll drains all shards into a contiguous slice and clears them.
@@ -61,5 +125,6 @@ func (a *SAccumulator) FlushAll() []SBatch {
 	for _, s := range a.shards {
 		s.Flush(&out)
 	}
+	a.spilled = false
 	return out
 }
@@ -17,7 +17,9 @@
 package tfd
 
 import (
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,8 +37,36 @@ type SServiceOptions struct {
 	// FlushInterval is the periodic flush cadence, enforcing tail latency bound.
 	// Default 2ms.
 	FlushInterval time.Duration
+	// MaxLoadFactor is the occupancy fraction of a shard's open-addressed table at
+	// which a new (key,bucket) cell first flushes the shard's contents aside and clears
+	// the table, so many distinct cells never degrade probing or fill the table. The
+	// service then flushes immediately instead of waiting for the next FlushInterval,
+	// so no delta is lost and each shard holds at most one table's worth of cells plus
+	// one spill. The shard's CountThresh and TimeCap checks are advisory (the service
+	// emits on FlushInterval); this is the only occupancy bound enforced between
+	// ticks. 0 selects the default 0.75.
+	MaxLoadFactor float64
+	// OnOverflow decides what Submit does when the buffer is full. The default,
+	// OverflowBlock, waits for room like Ingest.
+	OnOverflow OverflowPolicy
 }
 
+// OverflowPolicy is the behavior of SService.Submit when the ingress buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the service has room, propagating backpressure.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop discards the envelope, counts it (SService.Dropped) and returns
+	// ErrSDropped, so callers shed load deterministically under extreme overload.
+	OverflowDrop
+)
+
+// ErrSDropped is returned by SService.Submit (and Pipeline.Handle) when a Scalar
+// envelope was discarded because the buffer was full under OverflowDrop. The
+// envelope's delta is lost; callers that need it must retry or record it elsewhere.
+var ErrSDropped = errors.New("tfd: S-service buffer full, envelope dropped")
+
 // SService is a single-worker service that ingests Scalar envelopes, accumulates
 // them in-memory via SAccumulator, and periodically flushes through VSATransformer
 // into a sink. It enforces a time-capped batching policy regardless of write load.
@@ -51,6 +81,12 @@ type SService struct {
 	once   sync.Once
 	// flushReqCh allows external callers to request an immediate flush on the service goroutine and wait for completion
 	flushReqCh chan chan struct{}
+
+	// flush statistics, read by Pipeline.Stats
+	batchesIn   atomic.Uint64 // accumulator output, before the transformer
+	batchesOut  atomic.Uint64 // handed to the sink
+	lastFlushNs atomic.Int64  // when batches were last handed to the sink
+	dropped     atomic.Uint64 // envelopes discarded by Submit under OverflowDrop
 }
 
 // NewSService constructs a new service. acc must be exclusive to this service
@@ -62,6 +98,9 @@ func NewSService(acc *SAccumulator, vsa VSATransformer, sink SBatchesSink, opts
 	if opts.FlushInterval <= 0 {
 		opts.FlushInterval = 2 * time.Millisecond
 	}
+	if opts.MaxLoadFactor > 0 {
+		acc.SetMaxLoadFactor(opts.MaxLoadFactor)
+	}
 	return &SService{
 		acc:        acc,
 		vsa:        vsa,
@@ -119,20 +158,46 @@ func (s *SService) TryIngest(env Envelope) bool {
 	}
 }
 
+// Submit enqueues a Scalar envelope according to the OnOverflow policy: it blocks
+// while the buffer is full under OverflowBlock, and under OverflowDrop discards the
+// envelope and returns ErrSDropped instead. Vector envelopes are ignored.
+func (s *SService) Submit(env Envelope) error {
+	if s.TryIngest(env) {
+		return nil
+	}
+	if s.opts.OnOverflow == OverflowDrop {
+		s.dropped.Add(1)
+		return ErrSDropped
+	}
+	s.Ingest(env)
+	return nil
+}
+
+// Dropped returns the number of envelopes Submit discarded under OverflowDrop.
+func (s *SService) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
 func (s *SService) run() {
 	defer close(s.doneCh)
 	ticker := time.NewTicker(s.opts.FlushInterval)
 	defer ticker.Stop()
-	flush := func() {
+	// flush emits accumulated batches; force also drains transformers that hold
+	// batches across flushes (VSADrainer).
+	flush := func(force bool) {
 		b := s.acc.FlushAll()
-		if len(b) == 0 {
-			return
-		}
+		s.batchesIn.Add(uint64(len(b)))
 		if s.vsa != nil {
+			// Called even when empty so windowed transformers can emit held batches.
 			b = s.vsa.Compress(b)
+			if d, ok := s.vsa.(VSADrainer); ok && force {
+				b = append(b, d.Drain()...)
+			}
 		}
 		if len(b) > 0 && s.sink != nil {
 			s.sink.OnSBatches(b)
+			s.batchesOut.Add(uint64(len(b)))
+			s.lastFlushNs.Store(s.acc.now().UnixNano())
 		}
 	}
 	for {
@@ -142,10 +207,13 @@ func (s *SService) run() {
 			if env.Channel == ChannelScalar {
 				s.acc.Ingest(env)
 			}
-			// Opportunistic micro-flush on count threshold is inside the shard;
-			// we still rely on the periodic ticker for tail bound.
+			// A load-factor spill is emitted at once so it cannot grow between ticks;
+			// otherwise we rely on the periodic ticker for tail bound.
+			if s.acc.SpillPending() {
+				flush(false)
+			}
 		case <-ticker.C:
-			flush()
+			flush(false)
 		case done := <-s.flushReqCh:
 			// Synchronous flush requested by caller: drain pending ingress, then flush
 			drain := func() {
@@ -161,7 +229,7 @@ func (s *SService) run() {
 				}
 			}
 			drain()
-			flush()
+			flush(true)
 			close(done)
 		case <-s.stopCh:
 			// Drain remaining queued items without blocking
@@ -172,7 +240,7 @@ func (s *SService) run() {
 						s.acc.Ingest(env)
 					}
 				default:
-					flush()
+					flush(true)
 					return
 				}
 			}
@@ -86,3 +86,84 @@ func TestSService_TryIngestBackpressure(t *testing.T) {
 		t.Fatalf("expected first TryIngest to succeed and second to fail due to full buffer; got %v and %v", ok1, ok2)
 	}
 }
+
+func TestSService_OverflowDropCountsAndDoesNotBlock(t *testing.T) {
+	acc := NewSAccumulator(1, 4, 1000, time.Hour)
+	sink := &sinkMock{}
+	// Not started yet, so nothing drains the buffer of 2.
+	svc := NewSService(acc, SimpleVSA{}, sink, SServiceOptions{Buffer: 2, FlushInterval: time.Hour, OnOverflow: OverflowDrop})
+
+	k := HashKey("k3")
+	b := HashKey("b3")
+	errs := make(chan []error, 1)
+	go func() {
+		var out []error
+		for i := 0; i < 5; i++ {
+			out = append(out, svc.Submit(Envelope{Channel: ChannelScalar, Footprint: Footprint{KeyID: k, Time: TimeFootprint{BucketID: b}}, Delta: 1}))
+		}
+		errs <- out
+	}()
+	var got []error
+	select {
+	case got = <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("Submit blocked on a full buffer under OverflowDrop")
+	}
+	want := []error{nil, nil, ErrSDropped, ErrSDropped, ErrSDropped}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Submit %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+	if d := svc.Dropped(); d != 3 {
+		t.Fatalf("Dropped()=%d, want 3", d)
+	}
+
+	// The accepted envelopes still reach the sink.
+	svc.Start()
+	svc.Stop()
+	var net int64
+	for _, sb := range sink.seen {
+		net += sb.NetDelta
+	}
+	if net != 2 {
+		t.Fatalf("sink net delta %d, want the 2 accepted units", net)
+	}
+}
+
+// TestSService_LoadFactorSpillFlushesImmediately checks that a load-factor spill is
+// handed to the sink without waiting for the next tick, so it cannot grow unbounded.
+func TestSService_LoadFactorSpillFlushesImmediately(t *testing.T) {
+	acc := NewSAccumulator(1, 3, 1<<20, time.Hour) // 8 slots
+	sink := &sinkMock{}
+	svc := NewSService(acc, nil, sink, SServiceOptions{Buffer: 64, FlushInterval: time.Hour, MaxLoadFactor: 0.5})
+	svc.Start()
+
+	k := HashKey("k")
+	for b := uint64(1); b <= 20; b++ {
+		svc.Ingest(Envelope{Channel: ChannelScalar, Footprint: Footprint{KeyID: k, Time: TimeFootprint{BucketID: b}}, Delta: int64(b), SeqEnd: b})
+	}
+	// Cells 5, 10, 15 and 20 each spill the 4 cells before them, and the service
+	// flushes the spill together with the new cell at once.
+	deadline := time.Now().Add(2 * time.Second)
+	n := 0
+	for n < 20 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		sink.mu.Lock()
+		n = len(sink.seen)
+		sink.mu.Unlock()
+	}
+	svc.Stop()
+	if n != 20 {
+		t.Fatalf("sink saw %d batches before any tick, want all 20 cells", n)
+	}
+	got := map[uint64]int64{}
+	for _, sb := range sink.seen {
+		got[sb.BucketID] += sb.NetDelta
+	}
+	for b := uint64(1); b <= 20; b++ {
+		if got[b] != int64(b) {
+			t.Fatalf("bucket %d: got %d want %d (delta lost)", b, got[b], b)
+		}
+	}
+}
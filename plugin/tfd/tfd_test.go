@@ -17,6 +17,10 @@
 package tfd
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -126,7 +130,9 @@ func TestReconstructionEqualsBaseline(t *testing.T) {
 		}
 	}
 	rec := NewState()
-	rec.Reconstruct(sb, vlist)
+	if err := rec.Reconstruct(sb, vlist); err != nil {
+		t.Fatal(err)
+	}
 	if len(base.cells) != len(rec.cells) {
 		t.Fatalf("cell count mismatch base=%d rec=%d", len(base.cells), len(rec.cells))
 	}
@@ -137,6 +143,66 @@ func TestReconstructionEqualsBaseline(t *testing.T) {
 	}
 }
 
+// All=true deltas for a key aggregate in their own slot, apart from the key's bucket
+// cells (even one whose BucketID is 0), are merged into the key's bucket-0 cell at
+// flush, and reconstruction matches the baseline; FlushKey drains the slot too.
+func TestSAccumulator_AllBucketSlot(t *testing.T) {
+	key, other := HashKey("k"), HashKey("other")
+	b1 := HashKey("b1")
+	all := TimeFootprint{All: true}
+	envs := []Envelope{
+		{Channel: ChannelScalar, Footprint: Footprint{KeyID: key, Time: TimeFootprint{BucketID: b1}}, Delta: 5, SeqEnd: 1},
+		{Channel: ChannelScalar, Footprint: Footprint{KeyID: key, Time: all}, Delta: 4, SeqEnd: 2},
+		{Channel: ChannelScalar, Footprint: Footprint{KeyID: key, Time: TimeFootprint{BucketID: 0}}, Delta: 7, SeqEnd: 3},
+		{Channel: ChannelScalar, Footprint: Footprint{KeyID: key, Time: all}, Delta: -1, SeqEnd: 4},
+		{Channel: ChannelScalar, Footprint: Footprint{KeyID: key, Time: TimeFootprint{BucketID: b1}}, Delta: 2, SeqEnd: 5},
+		{Channel: ChannelScalar, Footprint: Footprint{KeyID: other, Time: all}, Delta: 9, SeqEnd: 6},
+	}
+	acc := NewSAccumulator(1, 4, 100, time.Hour)
+	for _, e := range envs {
+		acc.Ingest(e)
+	}
+	sb := acc.FlushAll()
+	if len(sb) != 3 {
+		t.Fatalf("want 3 batches (k/b1, k/0 with k's All slot merged in, other's All slot), got %+v", sb)
+	}
+	cells := make(map[[2]uint64]SBatch)
+	for _, b := range sb {
+		if _, dup := cells[[2]uint64{b.KeyID, b.BucketID}]; dup {
+			t.Fatalf("cell %x/%x emitted twice: %+v", b.KeyID, b.BucketID, sb)
+		}
+		cells[[2]uint64{b.KeyID, b.BucketID}] = b
+	}
+	if z := cells[[2]uint64{key, 0}]; z.NetDelta != 10 || z.SeqEnd != 4 {
+		t.Fatalf("bucket-0 cell %+v, want 7 plus the All slot's 3 at seq 4", z)
+	}
+	base, rec := NewState(), NewState()
+	base.BaselineApply(envs)
+	if err := rec.Reconstruct(sb, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(base.cells, rec.cells) {
+		t.Fatalf("reconstruction %v != baseline %v", rec.cells, base.cells)
+	}
+
+	for _, e := range envs {
+		acc.Ingest(e)
+	}
+	var out []SBatch
+	acc.shards[0].FlushKey(other, &out)
+	if len(out) != 1 || out[0].NetDelta != 9 {
+		t.Fatalf("FlushKey(other)=%+v want the All slot with 9", out)
+	}
+	out = out[:0]
+	acc.shards[0].FlushKey(key, &out)
+	if len(out) != 2 {
+		t.Fatalf("FlushKey(k)=%+v, want b1 and bucket 0 with the All slot merged", out)
+	}
+	if rest := acc.FlushAll(); len(rest) != 0 {
+		t.Fatalf("after FlushKey: %+v, want nothing left", rest)
+	}
+}
+
 func TestClassify_AllAndErrors(t *testing.T) {
 	// Missing key -> error, Vector
 	ch, fp, d, err := Classify(Op{})
@@ -158,6 +224,26 @@ func TestClassify_AllAndErrors(t *testing.T) {
 	}
 }
 
+// A negative conservative delta is an order-insensitive decrement and stays on S; the
+// same amount as a reversal (external decision) or backdated op is forced to V.
+func TestClassify_NegativeConservativeDelta(t *testing.T) {
+	dec := Op{Key: "k1", Bucket: "t1s/5", Amount: -3, IsSingleKey: true, IsConservativeDelta: true}
+	ch, fp, d, err := Classify(dec)
+	if err != nil || ch != ChannelScalar || fp.Scope != ChannelScalar || d != -3 {
+		t.Fatalf("decrement: ch=%v fp=%+v d=%d err=%v; want S with delta -3", ch, fp, d, err)
+	}
+	reversal := dec
+	reversal.NeedsExternalDecision = true
+	if ch, _, d, _ := Classify(reversal); ch != ChannelVector || d != -3 {
+		t.Fatalf("reversal: ch=%v d=%d; want V with delta -3", ch, d)
+	}
+	backdated := dec
+	backdated.IsBackdated = true
+	if ch, _, _, _ := Classify(backdated); ch != ChannelVector {
+		t.Fatalf("backdated decrement: ch=%v; want V", ch)
+	}
+}
+
 func TestHashKeyAndHash128Deterministic(t *testing.T) {
 	a := HashKey("alpha")
 	b := HashKey("alpha")
@@ -291,9 +377,9 @@ func TestVActorAndRouter(t *testing.T) {
 		t.Fatalf("unexpected order: %+v", out)
 	}
 
-	// HashPrev should match computation per enqueue
-	expectedPrev1 := Hash128(k, uint64(5))
-	expectedPrev2 := Hash128(k, uint64(7))
+	// HashPrev links each envelope to its predecessor's SeqEnd (0 for the first)
+	expectedPrev1 := VChainLink(k, 0, 5)
+	expectedPrev2 := VChainLink(k, 5, 7)
 	if out[0].HashPrev != expectedPrev1 || out[1].HashPrev != expectedPrev2 {
 		t.Fatalf("unexpected HashPrev values: %x %x", out[0].HashPrev, out[1].HashPrev)
 	}
@@ -317,7 +403,9 @@ func TestReconstruct_VPerKeyOrderingAndMultiKeySort(t *testing.T) {
 		{Channel: ChannelVector, Footprint: Footprint{KeyID: k1, Time: TimeFootprint{BucketID: b}}, Delta: 2, SeqEnd: 1},
 	}
 
-	s.Reconstruct(nil, v)
+	if err := s.Reconstruct(nil, v); err != nil {
+		t.Fatal(err)
+	}
 
 	if got := s.cells[[2]uint64{k1, b}]; got != 3 {
 		t.Fatalf("expected k1 total 3, got %d", got)
@@ -326,3 +414,245 @@ func TestReconstruct_VPerKeyOrderingAndMultiKeySort(t *testing.T) {
 		t.Fatalf("expected k2 total 3, got %d", got)
 	}
 }
+
+func TestReconstruct_StrictVChainDetectsBrokenChain(t *testing.T) {
+	r := NewVRouter()
+	k1, k2, b := HashKey("k1"), HashKey("k2"), HashKey("bucket")
+	var log []Envelope
+	for seq := uint64(1); seq <= 8; seq++ {
+		k := k1
+		if seq%3 == 0 {
+			k = k2
+		}
+		env := Envelope{Channel: ChannelVector, Footprint: Footprint{KeyID: k, Time: TimeFootprint{BucketID: b}}, Delta: 1, SeqEnd: seq * 10}
+		log = append(log, r.Route(k).Enqueue(env))
+	}
+	strict := NewState()
+	strict.StrictVChain = true
+	if err := strict.Reconstruct(nil, append([]Envelope(nil), log...)); err != nil {
+		t.Fatalf("intact chain rejected: %v", err)
+	}
+	// A restarted router that resumes from the log continues the chain; one that
+	// does not restarts it at 0, which is only accepted for a key's first envelope.
+	resumed := NewVRouter()
+	resumed.Resume(log)
+	next := resumed.Route(k1).Enqueue(Envelope{Channel: ChannelVector, Footprint: Footprint{KeyID: k1}, SeqEnd: 1000})
+	if err := VerifyVChain(append(append([]Envelope(nil), log...), next)); err != nil {
+		t.Fatalf("resumed chain rejected: %v", err)
+	}
+	restarted := NewVRouter().Route(k1).Enqueue(Envelope{Channel: ChannelVector, Footprint: Footprint{KeyID: k1}, SeqEnd: 1000})
+	if err := VerifyVChain(append(append([]Envelope(nil), log...), restarted)); !errors.Is(err, ErrVChainBroken) {
+		t.Fatalf("restart link mid-chain: err=%v, want ErrVChainBroken", err)
+	}
+	if err := VerifyVChain([]Envelope{restarted}); err != nil {
+		t.Fatalf("restart link as a key's first envelope rejected: %v", err)
+	}
+
+	broken := map[string][]Envelope{
+		// log[2] is k2's first envelope, log[1] and log[3] are consecutive k1 links.
+		"gap":       append(append([]Envelope(nil), log[:3]...), log[4:]...),
+		"duplicate": append(append([]Envelope(nil), log[:4]...), log[3:]...),
+		"reordered": append(append([]Envelope(nil), log[0], log[3], log[2], log[1]), log[4:]...),
+	}
+	for name, vs := range broken {
+		t.Run(name, func(t *testing.T) {
+			st := NewState()
+			st.StrictVChain = true
+			err := st.Reconstruct(nil, vs)
+			if !errors.Is(err, ErrVChainBroken) {
+				t.Fatalf("Reconstruct err=%v, want ErrVChainBroken", err)
+			}
+			if len(st.Cells()) != 0 {
+				t.Fatalf("nothing should be applied on a broken chain, got %v", st.Cells())
+			}
+			if err := NewState().Reconstruct(nil, vs); err != nil {
+				t.Fatalf("non-strict Reconstruct must not verify, got %v", err)
+			}
+		})
+	}
+}
+
+// Streaming the S-batches through a channel reconstructs the same cells as passing
+// them as a slice, for identical S and V input.
+func TestReconstructStream_MatchesSlice(t *testing.T) {
+	var sb []SBatch
+	for i := 0; i < 500; i++ {
+		sb = append(sb, SBatch{KeyID: HashKey(fmt.Sprintf("k%d", i%7)), BucketID: HashKey(fmt.Sprintf("b%d", i%3)), NetDelta: int64(i%11 - 5), SeqEnd: uint64(i + 1)})
+	}
+	r := NewVRouter()
+	var ve []Envelope
+	for seq := uint64(1); seq <= 40; seq++ {
+		k := HashKey(fmt.Sprintf("k%d", seq%4))
+		ve = append(ve, r.Route(k).Enqueue(Envelope{Channel: ChannelVector, Footprint: Footprint{KeyID: k, Time: TimeFootprint{BucketID: HashKey("b0")}}, Delta: int64(seq), SeqEnd: seq}))
+	}
+
+	want := NewState()
+	if err := want.Reconstruct(append([]SBatch(nil), sb...), append([]Envelope(nil), ve...)); err != nil {
+		t.Fatal(err)
+	}
+	got := NewState()
+	got.StrictVChain = true
+	ch := make(chan SBatch, 8)
+	go func() {
+		for _, b := range sb {
+			ch <- b
+		}
+		close(ch)
+	}()
+	if err := got.ReconstructStream(ch, append([]Envelope(nil), ve...)); err != nil {
+		t.Fatalf("ReconstructStream: %v", err)
+	}
+	if !reflect.DeepEqual(want.Cells(), got.Cells()) {
+		t.Fatalf("streamed %v != slice %v", got.Cells(), want.Cells())
+	}
+
+	// A broken chain drains the stream and applies nothing.
+	broken := NewState()
+	broken.StrictVChain = true
+	ch = make(chan SBatch)
+	go func() {
+		for _, b := range sb {
+			ch <- b
+		}
+		close(ch)
+	}()
+	if err := broken.ReconstructStream(ch, append(append([]Envelope(nil), ve[:5]...), ve[6:]...)); !errors.Is(err, ErrVChainBroken) {
+		t.Fatalf("err=%v, want ErrVChainBroken", err)
+	}
+	if len(broken.Cells()) != 0 {
+		t.Fatalf("nothing should be applied on a broken chain, got %v", broken.Cells())
+	}
+}
+
+func TestSShard_LoadFactorFlushKeepsDeltas(t *testing.T) {
+	acc := NewSAccumulator(1, 3, 1<<20, time.Hour) // 8 slots, thresholds out of the way
+	acc.SetMaxLoadFactor(0.5)                      // at most 4 cells before a flush-and-clear
+	shard := acc.shards[0]
+	want := map[[2]uint64]int64{}
+	key := HashKey("k-load")
+	for round := 0; round < 3; round++ {
+		for b := uint64(1); b <= 20; b++ {
+			acc.Ingest(Envelope{Channel: ChannelScalar, Footprint: Footprint{KeyID: key, Time: TimeFootprint{BucketID: b}}, Delta: int64(b), SeqEnd: b})
+			want[[2]uint64{key, b}] += int64(b)
+			if shard.used > 4 {
+				t.Fatalf("occupancy %d exceeded the load factor", shard.used)
+			}
+		}
+	}
+	if shard.spills == 0 {
+		t.Fatalf("expected load-factor flushes with 20 distinct cells in 8 slots")
+	}
+	got := map[[2]uint64]int64{}
+	for _, b := range acc.FlushAll() {
+		got[[2]uint64{b.KeyID, b.BucketID}] += b.NetDelta
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d cells, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("cell %v: got %d want %d (delta lost)", k, got[k], v)
+		}
+	}
+	if shard.used != 0 || len(shard.spill) != 0 {
+		t.Fatalf("FlushAll should clear table and spill: used=%d spill=%d", shard.used, len(shard.spill))
+	}
+}
+
+func TestBucketFor_SameWindowSameBucket(t *testing.T) {
+	base := time.Unix(42, 0)
+	a, b := base.Add(100*time.Millisecond), base.Add(999*time.Millisecond)
+	if got := BucketFor(a, time.Second); got != "t1s/42" || BucketFor(b, time.Second) != got {
+		t.Fatalf("BucketFor = %q, %q; want both t1s/42", got, BucketFor(b, time.Second))
+	}
+	if BucketFor(base.Add(time.Second), time.Second) == BucketFor(a, time.Second) {
+		t.Fatalf("the next window must map to a different bucket")
+	}
+	// Windows are floored before the epoch as well: -0.5s lies in window -1.
+	if got := BucketFor(time.Unix(0, -int64(500*time.Millisecond)), time.Second); got != "t1s/-1" {
+		t.Fatalf("pre-epoch bucket = %q want t1s/-1", got)
+	}
+	if BucketIDFor(a, time.Minute) != BucketIDFor(b, time.Minute) {
+		t.Fatalf("BucketIDFor differs within one window")
+	}
+
+	// Classify accepts the label as an ordinary bucket and assigns the matching id.
+	_, fp, _, err := Classify(Op{Key: "k", Bucket: BucketFor(a, time.Second), Amount: 1, IsSingleKey: true, IsConservativeDelta: true})
+	if err != nil || fp.Time.BucketID != BucketIDFor(b, time.Second) || fp.Time.All {
+		t.Fatalf("Classify footprint %+v err=%v, want BucketID %d", fp.Time, err, BucketIDFor(b, time.Second))
+	}
+}
+
+func TestSAccumulator_IndependentClocks(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	for _, tc := range []struct {
+		name    string
+		advance time.Duration
+		want    bool
+	}{
+		{"before_cap", 999 * time.Millisecond, false},
+		{"at_cap", time.Second, true},
+		{"far_past_cap", time.Hour, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			now := t0
+			acc := NewSAccumulator(1, 4, 1000, time.Second)
+			acc.SetClock(func() time.Time { mu.Lock(); defer mu.Unlock(); return now })
+			acc.Ingest(Envelope{Channel: ChannelScalar, Footprint: Footprint{KeyID: HashKey("k"), Time: TimeFootprint{BucketID: HashKey("b")}}, Delta: 1})
+			mu.Lock()
+			now = now.Add(tc.advance)
+			mu.Unlock()
+			if got := acc.shards[0].maybeFlush(); got != tc.want {
+				t.Fatalf("time cap due after %v: got %v, want %v", tc.advance, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSAccumulator_ShardStatsFlushTriggers(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(1000, 0)
+	acc := NewSAccumulator(1, 4, 3, time.Second) // 16 slots, count threshold 3
+	acc.SetClock(func() time.Time { mu.Lock(); defer mu.Unlock(); return now })
+	ingest := func(b uint64) {
+		acc.Ingest(Envelope{Channel: ChannelScalar, Footprint: Footprint{KeyID: HashKey("k"), Time: TimeFootprint{BucketID: b}}, Delta: 1})
+	}
+
+	flushed := func() (net int64) {
+		for _, b := range acc.FlushAll() {
+			net += b.NetDelta
+		}
+		return net
+	}
+
+	ingest(1)
+	ingest(2)
+	if st := acc.ShardStats()[0]; st.Used != 2 || st.Slots != 16 || st.CountFlushes != 0 || st.TimeFlushes != 0 {
+		t.Fatalf("below both thresholds: %+v", st)
+	}
+	ingest(3) // third distinct cell reaches the count threshold
+	ingest(4) // still ready; counted once until the next flush
+	if st := acc.ShardStats()[0]; st.Used != 4 || st.CountFlushes != 1 || st.TimeFlushes != 0 {
+		t.Fatalf("after count threshold: %+v, want one count flush and the cells kept in the table", st)
+	}
+	if net := flushed(); net != 4 {
+		t.Fatalf("flushed net = %d, want 4", net)
+	}
+
+	ingest(5)
+	mu.Lock()
+	now = now.Add(time.Second)
+	mu.Unlock()
+	ingest(6) // two cells, but the time cap has elapsed
+	if st := acc.ShardStats()[0]; st.Used != 2 || st.CountFlushes != 1 || st.TimeFlushes != 1 {
+		t.Fatalf("after time cap: %+v, want one flush of each kind", st)
+	}
+	if net := flushed(); net != 2 {
+		t.Fatalf("flushed net = %d, want 2", net)
+	}
+	if st := acc.ShardStats()[0]; st.Used != 0 {
+		t.Fatalf("after flush: %+v, want an empty table", st)
+	}
+}
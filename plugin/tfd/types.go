@@ -18,8 +18,12 @@ package tfd
 
 import (
 	"encoding/binary"
+	"fmt"
 	"hash/fnv"
+	"strconv"
 	"time"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 // Channel identifies the processing lane for an operation.
@@ -82,6 +86,59 @@ func HashKey(s string) uint64 {
 	return h.Sum64()
 }
 
+// Hasher maps key and bucket strings to the 64-bit ids of footprints. The ids decide
+// shard and actor routing and are what the logs record, so every process writing or
+// reading the same logs must use the same Hasher.
+type Hasher func(s string) uint64
+
+// XXHash64 is a Hasher producing xxHash64 (seed 0) ids, for interop with upstream
+// partitioners and external systems that use xxhash. HashKey (FNV-1a) stays the default.
+func XXHash64(s string) uint64 { return xxhash.Sum64String(s) }
+
+// HasherByName returns the Hasher for a flag value: "fnv" (or "", the default HashKey)
+// or "xxhash64".
+func HasherByName(name string) (Hasher, error) {
+	switch name {
+	case "", "fnv":
+		return HashKey, nil
+	case "xxhash64":
+		return XXHash64, nil
+	}
+	return nil, fmt.Errorf("tfd: unknown hasher %q (want fnv|xxhash64)", name)
+}
+
+// BucketFor returns the canonical label of the time bucket of width that contains ts:
+// "t<width>/<n>", where n counts whole widths since the Unix epoch (floored, so times
+// before 1970 get negative indexes), e.g. "t1s/42". Every timestamp in the same window
+// maps to the same label, on any host, so the label can be passed as Op.Bucket (or a
+// /state bucket) instead of hand-formatted strings. width must be positive.
+func BucketFor(ts time.Time, width time.Duration) string {
+	if width <= 0 {
+		panic("tfd: BucketFor width must be positive")
+	}
+	ns, w := ts.UnixNano(), int64(width)
+	n := ns / w
+	if ns%w < 0 {
+		n--
+	}
+	return "t" + width.String() + "/" + strconv.FormatInt(n, 10)
+}
+
+// BucketIDFor returns the BucketID of BucketFor(ts, width), i.e. the id Classify
+// assigns to that label. See BucketIDForWith for another Hasher.
+func BucketIDFor(ts time.Time, width time.Duration) uint64 {
+	return BucketIDForWith(HashKey, ts, width)
+}
+
+// BucketIDForWith is BucketIDFor with the id computed by h (nil: HashKey), matching
+// ClassifyWith(h, ...).
+func BucketIDForWith(h Hasher, ts time.Time, width time.Duration) uint64 {
+	if h == nil {
+		h = HashKey
+	}
+	return h(BucketFor(ts, width))
+}
+
 // Hash128 computes a simple 128-bit digest from inputs (non-cryptographic).
 func Hash128(parts ...uint64) (out [16]byte) {
 	// Mix via FNV-1a 64 then expand across 128 bits
@@ -101,5 +158,13 @@ func Hash128(parts ...uint64) (out [16]byte) {
 	return
 }
 
-// Now is abstracted for testability.
+// Clock is a time source. Components that take one (SAccumulator.SetClock,
+// PipelineOptions.Clock, CompactingVSA.SetClock) read time only from it, so instances
+// with different clocks can run side by side, e.g. in parallel tests.
+type Clock func() time.Time
+
+// Now is the fallback time source for components without their own Clock.
+//
+// Deprecated: Now is shared by every instance in the process, so tests that swap it
+// cannot run in parallel. Give each instance a Clock instead.
 var Now = func() time.Time { return time.Now() }
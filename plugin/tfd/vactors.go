@@ -18,32 +18,63 @@ package tfd
 
 import (
 	"container/list"
+	"sync"
 )
 
-// VActor represents a per-key ordered queue with an audit chain.
+// VActor represents a per-key ordered queue with an audit chain. It is safe for
+// concurrent use.
 type VActor struct {
-	keyID uint64
-	prev  [16]byte
-	queue *list.List // of Envelope
+	mu      sync.Mutex
+	keyID   uint64
+	lastSeq uint64     // SeqEnd of the previous envelope (0 before the first)
+	queue   *list.List // of Envelope
 }
 
 func newVActor(keyID uint64) *VActor {
 	return &VActor{keyID: keyID, queue: list.New()}
 }
 
-// Enqueue appends a V-envelope and updates the prev-hash link.
-func (a *VActor) Enqueue(env Envelope) {
+// Enqueue appends a V-envelope, stamping it with the prev-hash link
+// Hash128(key, previous SeqEnd, SeqEnd), and returns the stamped envelope so callers
+// persist the chain. Scalar envelopes are ignored and returned unchanged.
+func (a *VActor) Enqueue(env Envelope) Envelope {
+	return a.EnqueuePersist(env, nil)
+}
+
+// EnqueuePersist is Enqueue followed by persist(stamped envelope), both under the
+// actor's lock. Concurrent callers for the same key therefore persist in exactly the
+// order their envelopes were chained, so an append-only log (e.g. a V-envelope file
+// sink) holds each key's chain in acceptance order. persist may be nil.
+func (a *VActor) EnqueuePersist(env Envelope, persist func(Envelope)) Envelope {
 	if env.Channel != ChannelVector {
-		return
+		return env
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	env = a.enqueueLocked(env)
+	if persist != nil {
+		persist(env)
 	}
-	// compute prev-hash as a function of key and last seqEnd
-	a.prev = Hash128(a.keyID, env.SeqEnd)
-	env.HashPrev = a.prev
+	return env
+}
+
+func (a *VActor) enqueueLocked(env Envelope) Envelope {
+	env.HashPrev = VChainLink(a.keyID, a.lastSeq, env.SeqEnd)
+	a.lastSeq = env.SeqEnd
 	a.queue.PushBack(env)
+	return env
+}
+
+// VChainLink is the prev-hash stamped on a V-envelope for key with sequence seq whose
+// predecessor in the key's chain had sequence prevSeq (0 at the start of a chain).
+func VChainLink(keyID, prevSeq, seq uint64) [16]byte {
+	return Hash128(keyID, prevSeq, seq)
 }
 
 // Drain returns all queued envelopes in order and clears the queue.
 func (a *VActor) Drain() []Envelope {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	var out []Envelope
 	for e := a.queue.Front(); e != nil; e = e.Next() {
 		out = append(out, e.Value.(Envelope))
@@ -52,8 +83,9 @@ func (a *VActor) Drain() []Envelope {
 	return out
 }
 
-// VRouter sharded map from keyID to actor.
+// VRouter sharded map from keyID to actor. It is safe for concurrent use.
 type VRouter struct {
+	mu     sync.Mutex
 	actors map[uint64]*VActor
 }
 
@@ -62,6 +94,8 @@ func NewVRouter() *VRouter {
 }
 
 func (r *VRouter) Route(keyID uint64) *VActor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	act := r.actors[keyID]
 	if act == nil {
 		act = newVActor(keyID)
@@ -69,3 +103,16 @@ func (r *VRouter) Route(keyID uint64) *VActor {
 	}
 	return act
 }
+
+// Resume continues each key's chain from vEnvs, the V log in log order, so that after
+// a process restart the next envelope of a key links to the last logged one instead
+// of starting a new chain (which VerifyVChain only accepts as a key's first
+// envelope). Call it before the first Enqueue.
+func (r *VRouter) Resume(vEnvs []Envelope) {
+	for _, e := range vEnvs {
+		act := r.Route(e.Footprint.KeyID)
+		act.mu.Lock()
+		act.lastSeq = e.SeqEnd
+		act.mu.Unlock()
+	}
+}
@@ -16,6 +16,8 @@
 
 package tfd
 
+import "time"
+
 // VSATransformer is an integration point that can further compress S-batches
 // after shard-level coalescing, before durable I/O.
 // Implementations should be allocation-conscious and avoid per-item heap churn.
@@ -25,6 +27,13 @@ type VSATransformer interface {
 	Compress(in []SBatch) (out []SBatch)
 }
 
+// VSADrainer is optionally implemented by transformers that hold batches across
+// Compress calls. SService drains them on synchronous flushes and on Stop, so nothing
+// held is left behind.
+type VSADrainer interface {
+	Drain() []SBatch
+}
+
 // SimpleVSA is a production-safe baseline transformer:
 // - merges duplicate entries within the same input slice by (KeyID,BucketID)
 // - drops entries with NetDelta==0 after merge
@@ -105,3 +114,75 @@ func (SimpleVSA) Compress(in []SBatch) []SBatch {
 	}
 	return out
 }
+
+// CompactingVSA merges S-batches for the same (KeyID,BucketID) across flush cycles:
+// batches are held for up to Window and emitted as one net SBatch per cell (NetDelta
+// summed, max SeqEnd), trading up to Window of extra durability latency for fewer
+// sink writes. Cells netting to zero are dropped. Held batches are emitted by Drain,
+// which SService calls on FlushS and Stop.
+//
+// It is stateful and must only be used by a single SService (Compress and Drain are
+// called from its goroutine).
+type CompactingVSA struct {
+	window  time.Duration
+	pending map[[2]uint64]SBatch
+	since   time.Time // first hold since the last emit; zero when nothing is held
+	clock   Clock     // nil falls back to the package-level Now
+}
+
+// NewCompactingVSA returns a CompactingVSA holding batches for up to window
+// (default 10ms when window <= 0).
+func NewCompactingVSA(window time.Duration) *CompactingVSA {
+	if window <= 0 {
+		window = 10 * time.Millisecond
+	}
+	return &CompactingVSA{window: window, pending: make(map[[2]uint64]SBatch)}
+}
+
+// SetClock gives the transformer its own time source for the window. nil reverts to
+// the package-level Now. Pipeline sets it from PipelineOptions.Clock.
+func (c *CompactingVSA) SetClock(clock Clock) { c.clock = clock }
+
+// Compress implements VSATransformer. It returns nothing until the window since the
+// first held batch has elapsed, then every held cell.
+func (c *CompactingVSA) Compress(in []SBatch) []SBatch {
+	for _, b := range in {
+		k := [2]uint64{b.KeyID, b.BucketID}
+		if prev, ok := c.pending[k]; ok {
+			prev.NetDelta += b.NetDelta
+			if b.SeqEnd > prev.SeqEnd {
+				prev.SeqEnd = b.SeqEnd
+			}
+			b = prev
+		}
+		c.pending[k] = b
+	}
+	if len(c.pending) == 0 {
+		return in[:0]
+	}
+	now := Now()
+	if c.clock != nil {
+		now = c.clock()
+	}
+	if c.since.IsZero() {
+		c.since = now
+	}
+	if now.Sub(c.since) < c.window {
+		return in[:0]
+	}
+	return c.emit(in[:0])
+}
+
+// Drain implements VSADrainer: it emits every held cell regardless of the window.
+func (c *CompactingVSA) Drain() []SBatch { return c.emit(nil) }
+
+func (c *CompactingVSA) emit(out []SBatch) []SBatch {
+	for k, v := range c.pending {
+		if v.NetDelta != 0 {
+			out = append(out, v)
+		}
+		delete(c.pending, k)
+	}
+	c.since = time.Time{}
+	return out
+}
@@ -16,7 +16,11 @@
 
 package tfd
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestSimpleVSA_Compress_MergeAndDropZero(t *testing.T) {
 	key := uint64(42)
@@ -67,3 +71,79 @@ func TestSimpleVSA_Compress_MapPath(t *testing.T) {
 		m[k] = sb.SeqEnd
 	}
 }
+
+// runSService ingests rounds of S-envelopes over several flush cycles through an
+// SService using vsa and returns everything the sink received.
+func runSService(t *testing.T, vsa VSATransformer) []SBatch {
+	t.Helper()
+	acc := NewSAccumulator(4, 6, 1<<20, time.Hour)
+	sink := &sinkMock{}
+	svc := NewSService(acc, vsa, sink, SServiceOptions{Buffer: 256, FlushInterval: time.Millisecond})
+	svc.Start()
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 40; i++ {
+			fp := Footprint{KeyID: HashKey("k") + uint64(i%8), Time: TimeFootprint{BucketID: uint64(i % 3)}}
+			svc.Ingest(Envelope{Channel: ChannelScalar, Footprint: fp, Delta: int64(i%5) + 1, SeqEnd: uint64(round*100 + i)})
+		}
+		time.Sleep(5 * time.Millisecond) // let ticker flushes happen between rounds
+	}
+	svc.Stop()
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return append([]SBatch(nil), sink.seen...)
+}
+
+func TestCompactingVSA_FewerBatchesSameState(t *testing.T) {
+	simple := runSService(t, SimpleVSA{})
+	compacting := runSService(t, NewCompactingVSA(time.Hour))
+	t.Logf("batches out: simple=%d compacting=%d", len(simple), len(compacting))
+	if len(compacting) >= len(simple) {
+		t.Fatalf("compacting should emit fewer batches: compacting=%d simple=%d", len(compacting), len(simple))
+	}
+	seen := map[[2]uint64]bool{}
+	for _, b := range compacting {
+		k := [2]uint64{b.KeyID, b.BucketID}
+		if seen[k] {
+			t.Fatalf("cell %v emitted twice within one window", k)
+		}
+		seen[k] = true
+	}
+	want, got := NewState(), NewState()
+	if err := want.Reconstruct(simple, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.Reconstruct(compacting, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want.Cells(), got.Cells()) {
+		t.Fatalf("reconstructed state differs: simple=%v compacting=%v", want.Cells(), got.Cells())
+	}
+}
+
+func TestCompactingVSA_WindowMergesAcrossCalls(t *testing.T) {
+	oldNow := Now
+	defer func() { Now = oldNow }()
+	t0 := time.Unix(0, 0)
+	Now = func() time.Time { return t0 }
+
+	c := NewCompactingVSA(10 * time.Millisecond)
+	if out := c.Compress([]SBatch{{KeyID: 1, BucketID: 2, NetDelta: 4, SeqEnd: 7}, {KeyID: 3, BucketID: 2, NetDelta: 1, SeqEnd: 1}}); len(out) != 0 {
+		t.Fatalf("batches must be held within the window, got %v", out)
+	}
+	t0 = t0.Add(5 * time.Millisecond)
+	if out := c.Compress([]SBatch{{KeyID: 1, BucketID: 2, NetDelta: 6, SeqEnd: 5}, {KeyID: 3, BucketID: 2, NetDelta: -1, SeqEnd: 9}}); len(out) != 0 {
+		t.Fatalf("batches must be held within the window, got %v", out)
+	}
+	t0 = t0.Add(5 * time.Millisecond)
+	out := c.Compress(nil)
+	if want := []SBatch{{KeyID: 1, BucketID: 2, NetDelta: 10, SeqEnd: 7}}; !reflect.DeepEqual(out, want) {
+		t.Fatalf("window expiry emitted %v, want %v (sum deltas, max SeqEnd, drop zero)", out, want)
+	}
+	c.Compress([]SBatch{{KeyID: 1, BucketID: 2, NetDelta: 2, SeqEnd: 11}})
+	if out := c.Drain(); len(out) != 1 || out[0].NetDelta != 2 {
+		t.Fatalf("Drain should emit held batches regardless of the window, got %v", out)
+	}
+	if out := c.Drain(); len(out) != 0 {
+		t.Fatalf("second Drain should be empty, got %v", out)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -16,8 +17,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -286,6 +289,136 @@ func TestE2E_RefundFlow(t *testing.T) {
 	_ = resp.Body.Close()
 }
 
+// reserveE2E issues POST /reserve for key and n against the running server and returns the token.
+func reserveE2E(t *testing.T, client *http.Client, baseURL, key string, n int) string {
+	t.Helper()
+	resp, err := client.Post(fmt.Sprintf("%s/reserve?api_key=%s&n=%d", baseURL, key, n), "", nil)
+	if err != nil {
+		t.Fatalf("reserve err: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 on reserve, got %d", resp.StatusCode)
+	}
+	token := resp.Header.Get("X-Reservation-Token")
+	if token == "" {
+		t.Fatalf("missing X-Reservation-Token")
+	}
+	return token
+}
+
+// remainingE2E returns X-RateLimit-Remaining from a 200 /check (which itself consumes one unit).
+func remainingE2E(t *testing.T, client *http.Client, baseURL, key string) string {
+	t.Helper()
+	resp, err := client.Get(baseURL + "/check?api_key=" + key)
+	if err != nil {
+		t.Fatalf("check err: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 on check, got %d", resp.StatusCode)
+	}
+	return resp.Header.Get("X-RateLimit-Remaining")
+}
+
+// TestE2E_ReserveCancelRestoresAvailability proves that cancelling a reservation
+// returns its units, while committing one keeps them consumed.
+func TestE2E_ReserveCancelRestoresAvailability(t *testing.T) {
+	rs := buildAndStartServer(t,
+		"--rate_limit=10",
+		"--commit_threshold=1000000",
+		"--reservation_ttl=0",
+	)
+	client := &http.Client{Timeout: 2 * time.Second}
+	key := "reserve-e2e"
+
+	kept := reserveE2E(t, client, rs.baseURL, key, 3)
+	dropped := reserveE2E(t, client, rs.baseURL, key, 5)
+	for path, want := range map[string]int{"/commit?token=" + kept: http.StatusNoContent, "/cancel?token=" + dropped: http.StatusNoContent} {
+		resp, err := client.Post(rs.baseURL+path, "", nil)
+		if err != nil {
+			t.Fatalf("%s err: %v", path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("%s: got %d want %d", path, resp.StatusCode, want)
+		}
+	}
+	// 10 - 3 (committed) - 1 (this check) = 6
+	if got := remainingE2E(t, client, rs.baseURL, key); got != "6" {
+		t.Fatalf("X-RateLimit-Remaining=%s want 6 after cancel", got)
+	}
+}
+
+// TestE2E_ReserveExpiryAutoRefunds proves that a reservation abandoned past the TTL
+// is refunded without any client action.
+func TestE2E_ReserveExpiryAutoRefunds(t *testing.T) {
+	rs := buildAndStartServer(t,
+		"--rate_limit=10",
+		"--commit_threshold=1000000",
+		"--reservation_ttl=100ms",
+	)
+	client := &http.Client{Timeout: 2 * time.Second}
+	key := "expiry-e2e"
+
+	_ = reserveE2E(t, client, rs.baseURL, key, 10)
+	resp, err := client.Get(rs.baseURL + "/check?api_key=" + key)
+	if err != nil {
+		t.Fatalf("check err: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while the reservation holds the budget, got %d", resp.StatusCode)
+	}
+	time.Sleep(300 * time.Millisecond)
+	// 10 - 1 (this check) = 9
+	if got := remainingE2E(t, client, rs.baseURL, key); got != "9" {
+		t.Fatalf("X-RateLimit-Remaining=%s want 9 after expiry", got)
+	}
+}
+
+// TestE2E_WeightedCost mixes cost=1 and cost=10 requests against a small budget and
+// verifies that a weighted request is admitted only when its full cost is available and
+// that headers report the remaining budget after the weighted consume.
+func TestE2E_WeightedCost(t *testing.T) {
+	rs := buildAndStartServer(t,
+		"--rate_limit=25",
+		"--commit_threshold=1000000",
+	)
+	client := &http.Client{Timeout: 2 * time.Second}
+	key := "cost-e2e"
+
+	steps := []struct {
+		cost      int
+		status    int
+		remaining string
+	}{
+		{10, http.StatusOK, "15"},
+		{1, http.StatusOK, "14"},
+		{10, http.StatusOK, "4"},
+		{10, http.StatusTooManyRequests, "4"}, // full cost not available: nothing consumed
+		{1, http.StatusOK, "3"},
+		{1, http.StatusOK, "2"},
+		{10, http.StatusTooManyRequests, "2"},
+		{1, http.StatusOK, "1"},
+		{1, http.StatusOK, "0"},
+		{1, http.StatusTooManyRequests, "0"},
+	}
+	for i, st := range steps {
+		resp, err := client.Get(fmt.Sprintf("%s/check?api_key=%s&cost=%d", rs.baseURL, key, st.cost))
+		if err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != st.status {
+			t.Fatalf("step %d (cost=%d): got %d want %d", i+1, st.cost, resp.StatusCode, st.status)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != st.remaining {
+			t.Fatalf("step %d (cost=%d): X-RateLimit-Remaining=%s want %s", i+1, st.cost, got, st.remaining)
+		}
+	}
+}
+
 // TestE2E_MultiKeyIsolation verifies rate limit isolation between API keys in an end-to-end scenario.
 // Purpose: demonstrate that rate limits are per-key and not shared across keys.
 // Scenario: 3 requests with 200 status, 1 request with 429 status, 1 request with 200 status; 429 expected.
@@ -416,6 +549,377 @@ func TestE2E_LimitHeadersAnd429(t *testing.T) {
 	_ = resp.Body.Close()
 }
 
+// TestE2E_RetryAfterAndJSONDenyBody checks that, under a window, Retry-After on a 429
+// is the time until the refills cover the request (a positive whole number of seconds
+// within the window), that --deny_body=json yields the JSON denial shape, and that
+// --retry_after overrides the computed value.
+func TestE2E_RetryAfterAndJSONDenyBody(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=10", "--window=20s", "--deny_body=json")
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(rs.baseURL + "/check?api_key=ra&cost=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("drain: want 200, got %d", resp.StatusCode)
+	}
+
+	resp, err = client.Get(rs.baseURL + "/check?api_key=ra&cost=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("want 429, got %d", resp.StatusCode)
+	}
+	retry, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || retry < 1 || retry > 20 {
+		t.Fatalf("Retry-After=%q, want an integer in [1,20]", resp.Header.Get("Retry-After"))
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type=%q, want application/json", ct)
+	}
+	var body struct {
+		Allowed    *bool  `json:"allowed"`
+		Reason     string `json:"reason"`
+		Remaining  *int64 `json:"remaining"`
+		Limit      int64  `json:"limit"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode 429 body: %v", err)
+	}
+	if body.Allowed == nil || *body.Allowed || body.Reason != "key_limit" || body.Remaining == nil || body.Limit != 10 || body.RetryAfter != retry {
+		t.Fatalf("unexpected 429 body %+v (Retry-After %d)", body, retry)
+	}
+
+	rs2 := buildAndStartServer(t, "--rate_limit=1", "--retry_after=7s")
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := client.Get(rs2.baseURL + "/check?api_key=ra")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: want %d, got %d", i, want, resp.StatusCode)
+		}
+		if want == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "7" {
+			t.Fatalf("Retry-After=%q, want the 7s override", resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+// TestE2E_KeyLimits checks that --key_limits gives listed keys their own budget and
+// X-RateLimit-Limit while other keys keep --rate_limit.
+func TestE2E_KeyLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	if err := os.WriteFile(path, []byte(`{"gold": 5, "bronze": 2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rs := buildAndStartServer(t, "--rate_limit=3", "--key_limits="+path)
+	client := &http.Client{Timeout: 2 * time.Second}
+	for key, limit := range map[string]int{"gold": 5, "bronze": 2, "other": 3} {
+		for i := 0; i <= limit; i++ {
+			resp, err := client.Get(rs.baseURL + "/check?api_key=" + key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			want := http.StatusOK
+			if i == limit {
+				want = http.StatusTooManyRequests
+			}
+			if resp.StatusCode != want {
+				t.Fatalf("%s request %d: want %d, got %d", key, i+1, want, resp.StatusCode)
+			}
+			if got := resp.Header.Get("X-RateLimit-Limit"); got != strconv.Itoa(limit) {
+				t.Fatalf("%s: X-RateLimit-Limit=%q, want %d", key, got, limit)
+			}
+		}
+	}
+}
+
+// TestE2E_AuthAndRequestID checks that with --auth_keys an unlisted key is rejected
+// with 401 before anything is consumed, that a listed key's credentials are rejected
+// with 403 for any other key, that listed keys are rate limited as usual, and that every response carries an X-Request-ID,
+// echoing the client's when it sends one.
+func TestE2E_AuthAndRequestID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(path, []byte("# accepted keys\ngood\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rs := buildAndStartServer(t, "--rate_limit=1", "--auth_keys="+path)
+	client := &http.Client{Timeout: 2 * time.Second}
+	do := func(method, url string, header map[string]string, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, rs.baseURL+url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.Header.Get("X-Request-ID") == "" {
+			t.Fatalf("%s %s: missing X-Request-ID", method, url)
+		}
+		return resp
+	}
+
+	for i := 0; i < 3; i++ {
+		if resp := do(http.MethodGet, "/check?api_key=intruder", nil, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("unlisted key: want 401, got %d", resp.StatusCode)
+		}
+	}
+	if resp := do(http.MethodPost, "/v1/check", nil, `{"key":"intruder"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("JSON check without credentials: want 401, got %d", resp.StatusCode)
+	}
+	// Credentials for "good" do not cover other keys, in the query or in a JSON body.
+	good := map[string]string{"X-API-Key": "good"}
+	if resp := do(http.MethodGet, "/status?api_key=intruder", good, ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("status of another key: want 403, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/v1/check", good, `{"key":"intruder"}`); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("JSON check of another key: want 403, got %d", resp.StatusCode)
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		if resp := do(http.MethodGet, "/check?api_key=good", nil, ""); resp.StatusCode != want {
+			t.Fatalf("listed key request %d: want %d, got %d", i+1, want, resp.StatusCode)
+		}
+	}
+	resp := do(http.MethodGet, "/check?api_key=good", map[string]string{"X-Request-ID": "trace-123"}, "")
+	if got := resp.Header.Get("X-Request-ID"); got != "trace-123" {
+		t.Fatalf("X-Request-ID=%q, want the client's trace-123", got)
+	}
+}
+
+// TestE2E_JSONCheck drives POST /v1/check with JSON bodies against the real binary:
+// admits report remaining/limit, the 429 carries a JSON body with the denial reason,
+// and the legacy GET /check shares the same budget.
+func TestE2E_JSONCheck(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=3")
+	client := &http.Client{Timeout: 2 * time.Second}
+	type checkResp struct {
+		Allowed   bool   `json:"allowed"`
+		Remaining int64  `json:"remaining"`
+		Limit     int64  `json:"limit"`
+		Reason    string `json:"reason"`
+	}
+	post := func(body string) (int, checkResp) {
+		t.Helper()
+		resp, err := client.Post(rs.baseURL+"/v1/check", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var cr checkResp
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusTooManyRequests {
+			if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+		}
+		return resp.StatusCode, cr
+	}
+
+	if code, cr := post(`{"key":"json e2e/1","cost":2}`); code != http.StatusOK || cr != (checkResp{Allowed: true, Remaining: 1, Limit: 3}) {
+		t.Fatalf("first check: %d %+v", code, cr)
+	}
+	// The legacy endpoint sees the same key (URL-encoded there).
+	resp, err := client.Get(rs.baseURL + "/check?api_key=json+e2e%2F1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("GET /check: %d remaining=%q", resp.StatusCode, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+	code, cr := post(`{"key":"json e2e/1"}`)
+	if code != http.StatusTooManyRequests || cr != (checkResp{Allowed: false, Remaining: 0, Limit: 3, Reason: "key_limit"}) {
+		t.Fatalf("429 body: %d %+v", code, cr)
+	}
+	if code, _ := post(`{"cost":1}`); code != http.StatusBadRequest {
+		t.Fatalf("missing key: got %d want 400", code)
+	}
+}
+
+type bulkResp struct {
+	Key       string `json:"key"`
+	Allowed   bool   `json:"allowed"`
+	Remaining int64  `json:"remaining"`
+	Reason    string `json:"reason"`
+}
+
+func postBulk(t *testing.T, client *http.Client, url, body string) (int, []bulkResp) {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out []bulkResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return resp.StatusCode, out
+}
+
+// TestE2E_BulkCheckBestEffort verifies that POST /v1/bulk-check checks each item on
+// its own: denied items do not prevent the others from being admitted.
+func TestE2E_BulkCheckBestEffort(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=3")
+	client := &http.Client{Timeout: 2 * time.Second}
+	url := rs.baseURL + "/v1/bulk-check"
+
+	code, got := postBulk(t, client, url, `[{"key":"bulk-a","cost":3},{"key":"bulk-b","cost":5},{"key":"bulk-b","cost":1}]`)
+	want := []bulkResp{
+		{Key: "bulk-a", Allowed: true, Remaining: 0},
+		{Key: "bulk-b", Allowed: false, Remaining: 3, Reason: "overage_disabled"}, // 5 exceeds the limit of 3
+		{Key: "bulk-b", Allowed: true, Remaining: 2},
+	}
+	if code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %d %+v want %+v", code, got, want)
+	}
+}
+
+// TestE2E_BulkCheckAtomic verifies the all-or-nothing mode: when one key cannot be
+// admitted nothing is consumed, and once every key fits all are admitted together.
+func TestE2E_BulkCheckAtomic(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=3")
+	client := &http.Client{Timeout: 2 * time.Second}
+	url := rs.baseURL + "/v1/bulk-check?atomic=1"
+
+	code, got := postBulk(t, client, url, `[{"key":"atom-a","cost":2},{"key":"atom-b","cost":4}]`)
+	want := []bulkResp{
+		{Key: "atom-a", Allowed: false, Remaining: 3},
+		{Key: "atom-b", Allowed: false, Remaining: 3, Reason: "overage_disabled"}, // 4 exceeds the limit of 3
+	}
+	if code != http.StatusTooManyRequests || !reflect.DeepEqual(got, want) {
+		t.Fatalf("denial: got %d %+v want %+v", code, got, want)
+	}
+	code, got = postBulk(t, client, url, `[{"key":"atom-a","cost":2},{"key":"atom-b","cost":3}]`)
+	want = []bulkResp{
+		{Key: "atom-a", Allowed: true, Remaining: 1},
+		{Key: "atom-b", Allowed: true, Remaining: 0},
+	}
+	if code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("admit: got %d %+v want %+v", code, got, want)
+	}
+}
+
+// TestE2E_RemainingHeaderDecrements verifies that successful /check responses expose
+// X-RateLimit-Limit and an X-RateLimit-Remaining that decrements by one per admit, so
+// clients can self-throttle before hitting 429.
+func TestE2E_RemainingHeaderDecrements(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=5", "--commit_threshold=2", "--commit_interval=5ms")
+	client := &http.Client{Timeout: 2 * time.Second}
+	key := "remaining-e2e"
+	for want := 4; want >= 0; want-- {
+		resp, err := client.Get(rs.baseURL + "/check?api_key=" + key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want 200, got %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-RateLimit-Limit"); got != "5" {
+			t.Fatalf("X-RateLimit-Limit=%q want 5", got)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != fmt.Sprint(want) {
+			t.Fatalf("X-RateLimit-Remaining=%q want %d", got, want)
+		}
+		// Let background commits fold the vector; remaining must be unaffected by commits.
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestE2E_StatusEndpoint checks /status fields after a known sequence of admits and
+// that inspecting a key neither consumes budget nor creates unknown keys.
+func TestE2E_StatusEndpoint(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=20", "--commit_threshold=1", "--commit_interval=5ms")
+	client := &http.Client{Timeout: 2 * time.Second}
+	key := "status-e2e"
+
+	resp, err := client.Get(rs.baseURL + "/status?api_key=" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("want 404 before first use, got %d", resp.StatusCode)
+	}
+
+	for i := 0; i < 7; i++ {
+		resp, err := client.Get(rs.baseURL + "/check?api_key=" + key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+	// Wait for the background worker to commit all 7 admits (threshold 1).
+	var st struct{ Scalar, Vector, Available int64 }
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := client.Get(rs.baseURL + "/status?api_key=" + key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want 200, got %d", resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		_ = resp.Body.Close()
+		if st.Vector == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.Scalar != 13 || st.Vector != 0 || st.Available != 13 {
+		t.Fatalf("status=%+v want scalar=13 vector=0 available=13", st)
+	}
+}
+
+// TestE2E_WindowReplenishes verifies that with --window the budget of an exhausted key
+// is available again once the window has elapsed.
+func TestE2E_WindowReplenishes(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=3", "--window=1s")
+	client := &http.Client{Timeout: 2 * time.Second}
+	key := "window-e2e"
+	check := func() int {
+		resp, err := client.Get(rs.baseURL + "/check?api_key=" + key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	admitted := 0
+	for check() == http.StatusOK {
+		admitted++
+		if admitted > 10 {
+			t.Fatalf("budget never exhausted")
+		}
+	}
+	if admitted < 3 {
+		t.Fatalf("admitted %d before 429, want at least 3", admitted)
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if code := check(); code != http.StatusOK {
+			t.Fatalf("request %d after window: want 200, got %d", i+1, code)
+		}
+	}
+}
+
 // TestE2E_MetricsEndpoint validates the /metrics endpoint for proper status, content-type, and presence of expected metrics.
 func TestE2E_MetricsEndpoint(t *testing.T) {
 	rs := buildAndStartServer(t)
@@ -437,6 +941,36 @@ func TestE2E_MetricsEndpoint(t *testing.T) {
 	}
 }
 
+// TestE2E_RequestMetrics verifies that with --metrics_addr set, /metrics exposes
+// ratelimiter_requests_total by result and the /check latency histogram.
+func TestE2E_RequestMetrics(t *testing.T) {
+	rs := buildAndStartServer(t, "--rate_limit=2", "--metrics_addr=127.0.0.1:0")
+	client := &http.Client{Timeout: 2 * time.Second}
+	for i := 0; i < 3; i++ { // 2 admitted, 1 rejected
+		resp, err := client.Get(rs.baseURL + "/check?api_key=metrics-e2e")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+	resp, err := client.Get(rs.baseURL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	// The readiness probe in buildAndStartServer adds one admitted /check.
+	for _, series := range []string{
+		`ratelimiter_requests_total{result="ok"} 3`,
+		`ratelimiter_requests_total{result="rejected"} 1`,
+		`ratelimiter_check_duration_seconds_count 4`,
+	} {
+		if !bytes.Contains(b, []byte(series)) {
+			t.Fatalf("expected %q in /metrics output", series)
+		}
+	}
+}
+
 // TestE2E_ManyKeysConcurrent tests the rate limiter's behavior with concurrent requests using multiple keys.
 // Purpose: demonstrate that the rate limiter is not affected by the number of keys.
 // Scenario: 50 keys, 500 requests per key; 500 requests total; 429s expected.
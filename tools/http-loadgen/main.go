@@ -10,10 +10,18 @@
 //
 //	http-loadgen -base=http://127.0.0.1:8080 -mode=single -key=alice -n=5000 -c=16
 //	http-loadgen -base=http://127.0.0.1:8080 -mode=zipf -hot_key=hot-1 -cold_keys=50 -n=8000 -c=16
+//	http-loadgen -base=http://127.0.0.1:8080 -mode=single -key=alice -n=5000 -c=16 -rate=500
+//	http-loadgen -base=http://127.0.0.1:8080 -mode=zipf -n=8000 -c=16 -release_ratio=0.2
 //
 // Notes:
 //   - Uses GET with one query parameter (default api_key). Keys are URL-encoded.
-//   - Prints a one-line summary with duration and approximate throughput.
+//   - Prints a one-line summary with duration, approximate throughput, client-side latency
+//     percentiles (from a bounded reservoir sample) and the count of non-2xx responses.
+//   - -rate=R paces requests at ~R req/s across all workers (token bucket, burst = -c);
+//     the summary then also reports target vs achieved rate.
+//   - -release_ratio=F turns a fraction F of each worker's requests into POST -release_path
+//     for the same key (refunds), interleaved deterministically with the checks. The summary
+//     reports admits (2xx checks), releases (2xx releases) and 429s separately.
 package main
 
 import (
@@ -21,10 +29,12 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -57,6 +67,13 @@ func main() {
 		connIdle   = flag.Duration("idle_timeout", 30*time.Second, "HTTP idle connection timeout")
 		maxIdle    = flag.Int("max_idle", 256, "Max idle connections total")
 		maxIdlePer = flag.Int("max_idle_per_host", 256, "Max idle connections per host")
+		// Mixed workload
+		releaseRatio = flag.Float64("release_ratio", 0, "Fraction [0,1] of requests sent as POST -release_path (refunds) instead of checks")
+		releasePath  = flag.String("release_path", "/release", "Release path used by -release_ratio")
+		// Pacing
+		rate = flag.Float64("rate", 0, "Target request rate in req/s across all workers (0 = as fast as possible)")
+		// Latency sampling
+		maxLatSamples = flag.Int("max_latency_samples", 100000, "Cap on stored latency samples across workers (reservoir sampled)")
 	)
 	flag.Parse()
 
@@ -69,6 +86,18 @@ func main() {
 		fmt.Fprintln(os.Stderr, "-n and -c must be > 0")
 		os.Exit(2)
 	}
+	if *maxLatSamples <= 0 {
+		fmt.Fprintln(os.Stderr, "-max_latency_samples must be > 0")
+		os.Exit(2)
+	}
+	if *releaseRatio < 0 || *releaseRatio > 1 {
+		fmt.Fprintln(os.Stderr, "-release_ratio must be in [0,1]")
+		os.Exit(2)
+	}
+	if *rate < 0 {
+		fmt.Fprintln(os.Stderr, "-rate must be >= 0")
+		os.Exit(2)
+	}
 	if m == modeZipf {
 		if *coldN <= 0 {
 			fmt.Fprintln(os.Stderr, "-cold_keys must be > 0 in zipf mode")
@@ -86,6 +115,11 @@ func main() {
 		p = "/" + p
 	}
 	fullPath := baseURL + p
+	rp := *releasePath
+	if !strings.HasPrefix(rp, "/") {
+		rp = "/" + rp
+	}
+	releaseURL := baseURL + rp
 
 	// Configure HTTP client with connection reuse
 	tr := &http.Transport{
@@ -101,15 +135,37 @@ func main() {
 
 	start := time.Now()
 	var done int64
+	var sent atomic.Int64
+
+	// With -rate, workers take a token before each request.
+	var tokens <-chan struct{}
+	if *rate > 0 {
+		tokens = pace(ctx, *rate, *conc)
+	}
+
+	var non2xx, admits, releases, rejected atomic.Int64
+	capPerWorker := max(1, *maxLatSamples / *conc)
+	samples := make([]*reservoir, *conc)
 
 	worker := func(id, count int) {
 		defer atomic.AddInt64(&done, int64(count))
+		lat := newReservoir(capPerWorker, uint64(id))
+		samples[id] = lat
+		var releaseAcc float64 // spreads releases evenly: one whenever the accumulator crosses 1
 		for i := 0; i < count; i++ {
+			if tokens != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-tokens:
+				}
+			}
 			select {
 			case <-ctx.Done():
 				return
 			default:
 			}
+			sent.Add(1)
 			var k string
 			if m == modeSingle || m == modeRelease {
 				k = *key
@@ -122,17 +178,39 @@ func main() {
 					k = fmt.Sprintf("cold-%d", idx)
 				}
 			}
-			u := fullPath + "?" + url.Values{*param: {k}}.Encode()
-			method := http.MethodGet
+			target, method := fullPath, http.MethodGet
 			if m == modeRelease {
 				method = http.MethodPost
 			}
+			isRelease := m == modeRelease
+			if *releaseRatio > 0 {
+				if releaseAcc += *releaseRatio; releaseAcc >= 1 {
+					releaseAcc--
+					target, method, isRelease = releaseURL, http.MethodPost, true
+				}
+			}
+			u := target + "?" + url.Values{*param: {k}}.Encode()
 			req, _ := http.NewRequestWithContext(ctx, method, u, nil)
+			t0 := time.Now()
 			resp, err := client.Do(req)
 			if err == nil {
 				// Drain and close body to enable connection reuse
 				_, _ = io.Copy(io.Discard, resp.Body)
 				_ = resp.Body.Close()
+				lat.add(time.Since(t0))
+				switch {
+				case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+					if isRelease {
+						releases.Add(1)
+					} else {
+						admits.Add(1)
+					}
+				case resp.StatusCode == http.StatusTooManyRequests:
+					rejected.Add(1)
+					non2xx.Add(1)
+				default:
+					non2xx.Add(1)
+				}
 			} else {
 				// Brief backoff on errors to avoid hot spinning
 				time.Sleep(200 * time.Microsecond)
@@ -161,5 +239,86 @@ func main() {
 		elapsed = time.Millisecond
 	}
 	ops := float64(*N) / elapsed.Seconds()
-	fmt.Printf("LoadGen: mode=%s N=%d c=%d go=%d Duration=%s Throughput=%.0f req/s\n", m, *N, *conc, runtime.GOMAXPROCS(0), elapsed.Truncate(time.Millisecond), ops)
+	var lats []time.Duration
+	for _, r := range samples {
+		if r != nil {
+			lats = append(lats, r.buf...)
+		}
+	}
+	sort.Slice(lats, func(i, j int) bool { return lats[i] < lats[j] })
+	summary := fmt.Sprintf("LoadGen: mode=%s N=%d c=%d go=%d Duration=%s Throughput=%.0f req/s", m, *N, *conc, runtime.GOMAXPROCS(0), elapsed.Truncate(time.Millisecond), ops)
+	if *rate > 0 {
+		achieved := float64(sent.Load()) / elapsed.Seconds()
+		summary += fmt.Sprintf(" Target=%.0f req/s Achieved=%.0f req/s (%.0f%%)", *rate, achieved, 100*achieved / *rate)
+	}
+	summary += fmt.Sprintf(" p50=%s p95=%s p99=%s non2xx=%d admits=%d releases=%d 429s=%d",
+		percentile(lats, 50), percentile(lats, 95), percentile(lats, 99), non2xx.Load(), admits.Load(), releases.Load(), rejected.Load())
+	fmt.Println(summary)
+}
+
+// reservoir keeps a uniform random sample of at most cap latencies (Algorithm R), so
+// memory stays bounded no matter how many requests a worker sends.
+type reservoir struct {
+	buf  []time.Duration
+	cap  int
+	seen int
+	rnd  *rand.Rand
+}
+
+func newReservoir(capacity int, seed uint64) *reservoir {
+	return &reservoir{buf: make([]time.Duration, 0, min(capacity, 4096)), cap: capacity, rnd: rand.New(rand.NewPCG(seed, 0x9e3779b9))}
+}
+
+func (r *reservoir) add(d time.Duration) {
+	r.seen++
+	if len(r.buf) < r.cap {
+		r.buf = append(r.buf, d)
+		return
+	}
+	if j := r.rnd.IntN(r.seen); j < r.cap {
+		r.buf[j] = d
+	}
+}
+
+// percentile returns the p-th percentile of sorted (0 when empty), rounded for display.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	d := sorted[(len(sorted)-1)*p/100]
+	return d.Round(time.Microsecond)
+}
+
+// pace returns a token channel refilled at rate tokens/s with room for burst
+// tokens. Tokens are credited from elapsed time rather than one per tick, so rates
+// above the timer resolution are still met; tokens that find the bucket full are
+// dropped, so a slow server lowers the achieved rate instead of causing a catch-up
+// burst.
+func pace(ctx context.Context, rate float64, burst int) <-chan struct{} {
+	ch := make(chan struct{}, burst)
+	interval := time.Duration(float64(time.Second) / rate)
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		start := time.Now()
+		var credited int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				due := int64(now.Sub(start).Seconds() * rate)
+				for ; credited < due; credited++ {
+					select {
+					case ch <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return ch
 }
@@ -20,11 +20,16 @@
 package vsa
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/bits"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
-	_ "unsafe"
+	"unsafe"
 )
 
 //go:linkname runtime_procPin runtime.procPin
@@ -33,12 +38,35 @@ func runtime_procPin() int
 //go:linkname runtime_procUnpin runtime.procUnpin
 func runtime_procUnpin()
 
-// cache line size varies; we over-pad to 128 bytes to avoid false sharing
-const padSize = 128 - 8 // atomic.Int64 is 8 bytes; remainder to reach >=128
+// defaultStripePadding is the default distance in bytes between stripe counters.
+// Cache line size varies (64 bytes on most x86/ARM servers, 128 on Apple silicon and
+// with adjacent-line prefetching), so we over-pad to 128 to avoid false sharing.
+const defaultStripePadding = 128
 
-type stripe struct {
-	val atomic.Int64
-	_   [padSize]byte
+// stripeSet holds the striped counters, each in its own slot of 1<<shift int64s so that
+// concurrent updates to neighbouring stripes do not share a cache line.
+type stripeSet struct {
+	vals  []atomic.Int64
+	n     int
+	shift uint
+}
+
+// newStripeSet allocates n counters spaced padding bytes apart (a power of two >= 8).
+func newStripeSet(n, padding int) stripeSet {
+	shift := uint(bits.TrailingZeros(uint(padding / 8)))
+	return stripeSet{vals: make([]atomic.Int64, n<<shift), n: n, shift: shift}
+}
+
+// at returns the i-th counter.
+func (s *stripeSet) at(i int) *atomic.Int64 { return &s.vals[i<<s.shift] }
+
+// stripePadding resolves Options.StripePadding: 0 uses the default; other values are
+// rounded up to a power of two and clamped to [8,256].
+func stripePadding(p int) int {
+	if p <= 0 {
+		return defaultStripePadding
+	}
+	return nextPow2(max(8, min(256, p)))
 }
 
 // VSA is a thread-safe, in-memory data structure for Vector-Scalar Accumulation.
@@ -52,8 +80,14 @@ type VSA struct {
 	committedOffset atomic.Int64
 
 	// per-CPU-like stripes to reduce contention on hot keys
-	stripes []stripe
+	stripes stripeSet
 	mask    int // stripes-1 (power-of-two mask)
+	padding int // bytes between stripe counters, also used for an upgraded set
+
+	// upgraded is the wider stripe set installed by Upgrade on a single-stripe VSA.
+	// Once set, all new updates land here; the original stripe is kept and still
+	// summed so updates racing with the upgrade are never lost.
+	upgraded atomic.Pointer[stripeSet]
 
 	// chooser is a simple counter to spread updates across stripes for Update path
 	chooser atomic.Uint64
@@ -66,13 +100,23 @@ type VSA struct {
 	cachedNet atomic.Int64
 	cachedAt  atomic.Int64
 
+	// opts are the options the VSA was built with, kept for Clone.
+	opts Options
+
 	// options-derived behavior flags/params
 	cheapUpdateChooser bool
 	perPUpdateChooser  bool
+	deterministic      bool
 	useCachedGate      bool
 	cacheInterval      time.Duration
 	cacheSlack         int64
 	fastPathGuard      int64
+	maxPending         int64
+	capRejects         atomic.Uint64
+	fastHits           atomic.Int64 // TryConsume calls served by the FastPathGuard path
+	lockedHits         atomic.Int64 // TryConsume calls that took the serialized gate
+	reporter           func(available int64)
+	reportInterval     time.Duration
 
 	// grouped scan settings (optional approximate gating)
 	groupCount  int
@@ -89,16 +133,48 @@ type VSA struct {
 
 	// background cache refresher control
 	stopCh    chan struct{}
+	ctxDone   <-chan struct{} // NewWithContext: also stops the aggregator; nil otherwise
 	closeOnce sync.Once
 
 	// Small critical section for TryConsume to preserve gating semantics
 	tryMu sync.Mutex
+
+	// commit interval stats (Options.RecordCommitIntervals), guarded by tryMu
+	recordCommits bool
+	lastCommitAt  int64 // UnixNano of the last effective commit; 0 before the first
+	commitIv      commitIntervals
+}
+
+// commitIntervals aggregates the gaps between successive commits, in nanoseconds.
+type commitIntervals struct {
+	min, max, sum int64
+	n             int
+}
+
+// Reader is the read-only view of a VSA, for code that only inspects availability.
+type Reader interface {
+	Available() int64
+	State() (scalar, vector int64)
+}
+
+// Consumer is the gated write view of a VSA, for code that admits and refunds units.
+type Consumer interface {
+	TryConsume(n int64) bool
+	TryRefund(n int64) bool
 }
 
+var (
+	_ Reader   = (*VSA)(nil)
+	_ Consumer = (*VSA)(nil)
+)
+
 // Options configures VSA construction.
 type Options struct {
 	// Stripes sets the number of striped counters to reduce contention.
 	// 0 uses the default: nextPow2(clamp(GOMAXPROCS, [8,64])).
+	// 1 selects fixed single-stripe mode (essentially one padded atomic): the lowest
+	// per-key footprint, for long tails of cold keys, at the cost of hot-key scalability.
+	// Other values are rounded to the next power of two and clamped to [8,64].
 	Stripes int
 
 	// CheapUpdateChooser chooses stripes in Update without an atomic.Add, using
@@ -136,24 +212,99 @@ type Options struct {
 	// sums of stripes to reduce cross-core reads for currentVector() and cached gate.
 	// Set to a small multiple of GOMAXPROCS (e.g., 2–4) to approximate per-NUMA groups.
 	HierarchicalGroups int
+
+	// StripePadding is the distance in bytes between stripe counters. 0 uses the
+	// default of 128; other values are rounded up to a power of two and clamped to
+	// [8,256]. Padding keeps stripes that different cores update on separate cache
+	// lines (false sharing makes every update bounce the line between cores), but each
+	// VSA pays stripes×padding bytes. With many keys, 64 matches the cache line of most
+	// x86/ARM servers and halves that cost; 8 packs the counters with no padding at all,
+	// which is only sensible for keys that are rarely updated concurrently.
+	StripePadding int
+
+	// SingleStripe allocates exactly one unpadded counter: the smallest footprint, for
+	// Stores holding millions of rarely touched keys. All operations stay exact, but
+	// every update of the key contends on that one counter (and may share its cache
+	// line with neighbouring data), so hot keys scale poorly. It implies Stripes=1 and
+	// ignores StripePadding for the counter; Upgrade still installs a padded set.
+	SingleStripe bool
+
+	// DeterministicChooser places every update on stripe 0 (Update, TryConsume,
+	// TryRefund, including an upgraded stripe set), so white-box tests can assert exact
+	// stripe contents. It overrides the other choosers and removes all striping benefit;
+	// do not use it outside tests.
+	DeterministicChooser bool
+
+	// AvailabilityReporter, when non-nil, is called with Available() every
+	// ReportInterval (default 1s) from the VSA's background goroutine, e.g. to feed a
+	// dashboard gauge without polling. It must return quickly: a slow reporter delays
+	// cached-gate refreshes sharing the goroutine. Close stops the reports.
+	AvailabilityReporter func(available int64)
+	ReportInterval       time.Duration
+
+	// RecordCommitIntervals tracks the time between successive effective Commit calls
+	// (those that move the committed offset), reported by CommitIntervalStats. It adds
+	// a clock read to Commit only; the hot paths are unaffected.
+	RecordCommitIntervals bool
+
+	// MaxPendingVector, when > 0, caps the uncommitted vector: an Update, TryConsume,
+	// ConsumeUpTo or TryConsumeAll that would push |vector| beyond it is rejected
+	// (changes toward zero always pass), so a worker that stops committing surfaces as
+	// back-pressure instead of unbounded pending debt. Gated paths check the exact
+	// vector; Update checks the running approximation (see ApproxVector), so
+	// concurrent updates may overshoot the cap by their in-flight amounts. Rejections
+	// are counted by CapRejections. 0 disables the cap.
+	MaxPendingVector int64
+
+	// StrictGate forces every gated operation through the exact scan of all stripes
+	// under the lock, ignoring UseCachedGate, CacheSlack, GroupCount/GroupSlack and
+	// FastPathGuard. TryConsume then never denies a request the exact availability
+	// covers (no slack- or staleness-induced false denials) and never admits one it
+	// does not (no guard-window oversubscription). The price is throughput on hot
+	// keys: each TryConsume takes tryMu and reads every stripe, which is what the
+	// approximations exist to avoid. HierarchicalGroups stays in effect; its sums are
+	// exact.
+	StrictGate bool
 }
 
 // NewWithOptions creates and initializes a VSA with explicit options.
 func NewWithOptions(initialScalar int64, opts Options) *VSA {
-	var s int
-	if opts.Stripes > 0 {
-		s = nextPow2(max(8, min(64, opts.Stripes)))
+	return newVSA(initialScalar, opts, nil)
+}
+
+// NewWithContext is NewWithOptions with the background aggregator (cached gate and
+// availability reports) tied to ctx: it stops when ctx is canceled, as if Close had
+// been called. Close still works and remains safe to call afterwards.
+func NewWithContext(ctx context.Context, initialScalar int64, opts Options) *VSA {
+	return newVSA(initialScalar, opts, ctx.Done())
+}
+
+func newVSA(initialScalar int64, opts Options, done <-chan struct{}) *VSA {
+	s := 1
+	if opts.Stripes != 1 {
+		s = stripeCount(opts.Stripes)
+	}
+	pad := stripePadding(opts.StripePadding)
+	v := &VSA{mask: s - 1, padding: pad, opts: opts, ctxDone: done}
+	if opts.SingleStripe {
+		s, v.mask = 1, 0
+		v.stripes = newStripeSet(1, 8)
 	} else {
-		p := runtime.GOMAXPROCS(0)
-		// Default closer to P than 2×P to reduce currentVector scanning cost.
-		s = nextPow2(max(8, min(64, p)))
+		v.stripes = newStripeSet(s, pad)
 	}
-	v := &VSA{stripes: make([]stripe, s), mask: s - 1}
 	v.scalar.Store(initialScalar)
 
+	if opts.StrictGate {
+		opts.UseCachedGate, opts.CacheSlack = false, 0
+		opts.GroupCount, opts.GroupSlack = 0, 0
+		opts.FastPathGuard = 0
+	}
+
 	// options
 	v.cheapUpdateChooser = opts.CheapUpdateChooser
 	v.perPUpdateChooser = opts.PerPUpdateChooser
+	v.deterministic = opts.DeterministicChooser
+	v.recordCommits = opts.RecordCommitIntervals
 	v.useCachedGate = opts.UseCachedGate
 	if v.useCachedGate {
 		if opts.CacheInterval <= 0 {
@@ -163,10 +314,12 @@ func NewWithOptions(initialScalar int64, opts Options) *VSA {
 		}
 		v.cacheSlack = opts.CacheSlack
 	}
+	// Grouped scans and hierarchical sums need at least two stripes to be useful;
+	// with a single stripe both degrade to the exact path.
+	if opts.GroupCount > s {
+		opts.GroupCount = s
+	}
 	if opts.GroupCount > 1 {
-		if opts.GroupCount > s {
-			opts.GroupCount = s
-		}
 		v.groupCount = opts.GroupCount
 		// compute stride: number of stripes per group (ceil)
 		g := v.groupCount
@@ -178,19 +331,26 @@ func NewWithOptions(initialScalar int64, opts Options) *VSA {
 	if opts.FastPathGuard > 0 {
 		v.fastPathGuard = opts.FastPathGuard
 	}
+	if opts.MaxPendingVector > 0 {
+		v.maxPending = opts.MaxPendingVector
+	}
 	// hierarchical aggregation setup
-	if opts.HierarchicalGroups > 1 {
-		h := opts.HierarchicalGroups
-		if h > s {
-			h = s
-		}
+	if h := min(opts.HierarchicalGroups, s); h > 1 {
 		v.hGroups = h
 		v.hStride = (s + h - 1) / h
 		v.hStride = max(1, v.hStride)
 		v.hGroupSum = make([]atomic.Int64, v.hGroups)
 	}
 
-	if v.useCachedGate {
+	if opts.AvailabilityReporter != nil {
+		v.reporter = opts.AvailabilityReporter
+		v.reportInterval = opts.ReportInterval
+		if v.reportInterval <= 0 {
+			v.reportInterval = time.Second
+		}
+	}
+
+	if v.useCachedGate || v.reporter != nil {
 		v.stopCh = make(chan struct{})
 		go v.runAggregator()
 	}
@@ -203,25 +363,239 @@ func New(initialScalar int64) *VSA {
 	return NewWithOptions(initialScalar, Options{})
 }
 
+// NewFromState creates a VSA whose State is (scalar, vector) from the start, e.g. when
+// restoring a key whose uncommitted net was stored alongside its scalar. The vector is
+// placed in a single stripe with no committed offset, so nothing has to be replayed.
+func NewFromState(scalar, vector int64, opts Options) *VSA {
+	v := NewWithOptions(scalar, opts)
+	if vector != 0 {
+		v.addLocked(vector)
+		v.cachedNet.Store(vector)
+	}
+	return v
+}
+
+// stripeCount resolves a requested multi-stripe count: 0 uses the default
+// nextPow2(clamp(GOMAXPROCS, [8,64])); other values are rounded and clamped the same way.
+func stripeCount(n int) int {
+	if n <= 0 {
+		// Default closer to P than 2×P to reduce currentVector scanning cost.
+		n = runtime.GOMAXPROCS(0)
+	}
+	return nextPow2(max(8, min(64, n)))
+}
+
+// Upgrade widens a single-stripe VSA (Options.Stripes=1) to a striped one in place,
+// so a key that turns hot regains update scalability. stripes follows the same rules
+// as Options.Stripes (0 = default). It is safe to call concurrently with all other
+// operations and returns false if the VSA is not single-stripe or already upgraded.
+func (v *VSA) Upgrade(stripes int) bool {
+	if v.stripes.n != 1 {
+		return false
+	}
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	if v.upgraded.Load() != nil {
+		return false
+	}
+	set := newStripeSet(stripeCount(stripes), v.padding)
+	v.upgraded.Store(&set)
+	return true
+}
+
+// Clone returns an independent VSA with the same scalar, options and net vector as v.
+// The net vector is collapsed into a single stripe of the copy, and an upgraded VSA
+// yields an upgraded copy with the same stripe count. The copy is taken under tryMu, so
+// it is consistent with gated operations (TryConsume, TryRefund, commits); plain Update
+// calls racing with Clone may or may not be included. A clone using the cached gate
+// runs its own aggregator and must be closed independently.
+func (v *VSA) Clone() *VSA {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	c := NewWithOptions(v.scalar.Load(), v.opts)
+	if up := v.upgraded.Load(); up != nil {
+		c.Upgrade(up.n)
+	}
+	net := v.currentVector()
+	c.addLocked(net)
+	c.cachedNet.Store(net)
+	return c
+}
+
+// Snapshot is the durable state of a VSA: its scalar and net vector, with the stripes
+// and committed offset collapsed away. It round-trips through MarshalBinary and
+// UnmarshalBinary, e.g. to hand a key's state over to another process.
+type Snapshot struct {
+	Scalar int64
+	Vector int64
+}
+
+// snapshotVersion prefixes the binary encoding of a Snapshot.
+const snapshotVersion = 1
+
+// errSnapshotEncoding reports a Snapshot encoding that UnmarshalBinary cannot decode.
+var errSnapshotEncoding = errors.New("vsa: invalid snapshot encoding")
+
+// MarshalBinary encodes s as a version byte followed by Scalar and Vector as 64-bit
+// big-endian integers.
+func (s Snapshot) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 17)
+	b[0] = snapshotVersion
+	binary.BigEndian.PutUint64(b[1:9], uint64(s.Scalar))
+	binary.BigEndian.PutUint64(b[9:17], uint64(s.Vector))
+	return b, nil
+}
+
+// UnmarshalBinary decodes an encoding produced by MarshalBinary.
+func (s *Snapshot) UnmarshalBinary(b []byte) error {
+	if len(b) != 17 || b[0] != snapshotVersion {
+		return errSnapshotEncoding
+	}
+	s.Scalar = int64(binary.BigEndian.Uint64(b[1:9]))
+	s.Vector = int64(binary.BigEndian.Uint64(b[9:17]))
+	return nil
+}
+
+// Snapshot returns v's scalar and net vector, read together under tryMu so the pair is
+// consistent with gated operations; like Clone, plain Update calls racing with it may
+// or may not be included.
+func (v *VSA) Snapshot() Snapshot {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	return Snapshot{Scalar: v.scalar.Load(), Vector: v.currentVector()}
+}
+
+// Restore replaces v's scalar and net vector with those of s, so State and Available
+// match the VSA the snapshot was taken from. It is meant for a freshly built VSA
+// (any options) before it is shared; updates racing with Restore are kept on top of
+// the restored vector.
+func (v *VSA) Restore(s Snapshot) {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	v.scalar.Store(s.Scalar)
+	if d := s.Vector - v.currentVector(); d != 0 {
+		v.addLocked(d)
+	}
+	v.cachedNet.Store(s.Vector)
+}
+
+// StripeCount returns the number of stripes updates are currently spread over.
+func (v *VSA) StripeCount() int {
+	if up := v.upgraded.Load(); up != nil {
+		return up.n
+	}
+	return v.stripes.n
+}
+
+// DebugStripes returns a copy of each stripe's raw value, followed by the stripes of
+// an upgraded set if any. The values include amounts already committed, so their sum
+// minus the committed offset is the net vector. Each stripe is loaded atomically but
+// the copy as a whole is not a consistent snapshot under concurrent updates.
+//
+// DebugStripes is a diagnostic aid for inspecting contention and stripe imbalance; its
+// layout follows the internal stripe set and is not part of the stable API.
+func (v *VSA) DebugStripes() []int64 {
+	up := v.upgraded.Load()
+	n := v.stripes.n
+	if up != nil {
+		n += up.n
+	}
+	out := make([]int64, 0, n)
+	for i := 0; i < v.stripes.n; i++ {
+		out = append(out, v.stripes.at(i).Load())
+	}
+	if up != nil {
+		for i := 0; i < up.n; i++ {
+			out = append(out, up.at(i).Load())
+		}
+	}
+	return out
+}
+
 // Update applies a change to the VSA's volatile vector.
 // Hot path: lock-free atomic add on a chosen stripe.
+// With Options.MaxPendingVector, a change that would push |vector| past the cap is
+// dropped and counted (CapRejections); use TryUpdate to learn about it.
 func (v *VSA) Update(value int64) {
-	idx := v.chooseIdxForUpdate()
-	v.stripes[idx].val.Add(value)
+	v.update(value)
+}
+
+// TryUpdate is Update that reports whether the change was applied: it returns false
+// when Options.MaxPendingVector rejected it.
+func (v *VSA) TryUpdate(value int64) bool {
+	return v.update(value)
+}
+
+// update is the single check-and-apply behind Update and TryUpdate. With a cap, the
+// change is claimed on approxNet by CAS before it reaches a stripe, so the cap is
+// checked exactly once per change and concurrent updaters cannot jointly overshoot it.
+func (v *VSA) update(value int64) bool {
+	if v.maxPending > 0 {
+		for {
+			net := v.approxNet.Load()
+			if v.capBlocks(net, value) {
+				v.capRejects.Add(1)
+				return false
+			}
+			if v.approxNet.CompareAndSwap(net, net+value) {
+				break
+			}
+		}
+		v.addToStripe(value)
+		return true
+	}
+	v.addToStripe(value)
+	// keep approximate net up to date for fast-path gating
+	v.approxNet.Add(value)
+	return true
+}
+
+// addToStripe adds value to a chosen stripe (and its hierarchical group), leaving
+// approxNet to the caller.
+func (v *VSA) addToStripe(value int64) {
+	if up := v.upgraded.Load(); up != nil {
+		up.at(v.chooseIdxForUpdate(up.n - 1)).Add(value)
+		return
+	}
+	idx := v.chooseIdxForUpdate(v.mask)
+	v.stripes.at(idx).Add(value)
 	if v.hGroups > 0 {
 		g := idx / v.hStride
 		v.hGroupSum[g].Add(value)
 	}
-	// keep approximate net up to date for fast-path gating
-	v.approxNet.Add(value)
 }
 
-// Available returns the real-time available resource count: S - |A_net|.
+// capBlocks reports whether adding delta to net would take |net| beyond the
+// MaxPendingVector cap. Changes that do not grow |net| are never blocked.
+func (v *VSA) capBlocks(net, delta int64) bool {
+	next := abs(net + delta)
+	return next > v.maxPending && next > abs(net)
+}
+
+// CapRejections returns how many changes Options.MaxPendingVector has rejected.
+func (v *VSA) CapRejections() uint64 {
+	return v.capRejects.Load()
+}
+
+// Available returns the real-time available resource count: S - |A_net|, clamped at 0.
 // We compute A_net by summing stripes and subtracting committedOffset.
+//
+// Invariant: the scalar never goes negative. Gated operations cannot break it, but
+// ungated Updates beyond the budget that are then committed, or an external
+// reconciliation that commits twice, can; Available then reports 0 rather than a
+// negative budget and Healthy reports false.
 func (v *VSA) Available() int64 {
 	s := v.scalar.Load()
 	net := v.currentVector()
-	return s - abs(net)
+	return nonNegative(s - abs(net))
+}
+
+// Healthy reports whether the scalar invariant holds (scalar >= 0). A false result
+// means more was committed than the budget allowed; the VSA keeps working (and denies
+// every consume) but its durable state needs reconciliation, so monitoring should
+// alert on it.
+func (v *VSA) Healthy() bool {
+	return v.scalar.Load() >= 0
 }
 
 // helper RNG for cheap chooser
@@ -240,7 +614,10 @@ func (r *rng64) next() uint64 {
 	return x * 2685821657736338717
 }
 
-func (v *VSA) chooseIdxForUpdate() int {
+func (v *VSA) chooseIdxForUpdate(mask int) int {
+	if v.deterministic {
+		return 0
+	}
 	if v.cheapUpdateChooser {
 		p := v.prngPool.Get()
 		var r *rng64
@@ -251,15 +628,15 @@ func (v *VSA) chooseIdxForUpdate() int {
 		}
 		x := r.next()
 		v.prngPool.Put(r)
-		return int(x) & v.mask
+		return int(x) & mask
 	}
 	if v.perPUpdateChooser {
 		pid := runtime_procPin()
-		i := pid & v.mask
+		i := pid & mask
 		runtime_procUnpin()
 		return i
 	}
-	return int(v.chooser.Add(1)) & v.mask
+	return int(v.chooser.Add(1)) & mask
 }
 
 // State returns the current scalar and effective vector values.
@@ -267,6 +644,16 @@ func (v *VSA) State() (scalar, vector int64) {
 	return v.scalar.Load(), v.currentVector()
 }
 
+// ApproxVector returns the effective vector without scanning the stripes, from the
+// running net every operation maintains alongside its stripe update (it already
+// excludes committed amounts). It is cheap enough for dashboards and monitoring loops
+// that would otherwise pay State's full scan, but it is not linearizable: while
+// operations are in flight it can momentarily differ from the exact vector (State).
+// Once activity quiesces the two agree.
+func (v *VSA) ApproxVector() int64 {
+	return v.approxNet.Load()
+}
+
 // CheckCommit determines if a commit is required for the given threshold.
 // It returns (true, vector) when |vector| ≥ threshold.
 func (v *VSA) CheckCommit(threshold int64) (bool, int64) {
@@ -309,12 +696,120 @@ func (v *VSA) Commit(committedVector int64) {
 	} else {
 		delta = -mag // commit negative towards reducing a negative net
 	}
-	// Apply: decrease scalar by |delta| and increase committedOffset by delta.
+	v.commitLocked(delta)
+	v.tryMu.Unlock()
+}
+
+// CommitAll folds the entire current net vector into the scalar and returns the amount
+// folded (the prior net; 0 if there was none), leaving the vector at zero. The net is
+// read and folded in one tryMu critical section, so no gated operation lands in
+// between. Unlike the worker's persist-then-Commit flow, the fold happens before the
+// caller can persist the returned amount: use it where that amount is persisted
+// afterwards with retries, or where the state is in-memory only.
+func (v *VSA) CommitAll() int64 {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	net := v.currentVector()
+	if net != 0 {
+		v.commitLocked(net)
+	}
+	return net
+}
+
+// commitLocked moves delta from the vector into the scalar: the scalar drops by |delta|
+// and the committed offset grows by delta. Callers hold tryMu and pass a delta with the
+// sign of the current net and no larger magnitude.
+func (v *VSA) commitLocked(delta int64) {
 	v.scalar.Add(-abs(delta))
 	v.committedOffset.Add(delta)
 	// Keep the approximate net consistent with the new committed offset
 	v.approxNet.Add(-delta)
-	v.tryMu.Unlock()
+	if v.recordCommits {
+		v.recordCommitLocked(time.Now().UnixNano())
+	}
+}
+
+// recordCommitLocked adds the interval since the previous commit. Callers hold tryMu.
+func (v *VSA) recordCommitLocked(now int64) {
+	if prev := v.lastCommitAt; prev != 0 {
+		iv := &v.commitIv
+		d := now - prev
+		if iv.n == 0 || d < iv.min {
+			iv.min = d
+		}
+		if d > iv.max {
+			iv.max = d
+		}
+		iv.sum += d
+		iv.n++
+	}
+	v.lastCommitAt = now
+}
+
+// CommitIntervalStats returns the minimum, average and maximum time between successive
+// effective commits and the number of intervals measured (commits - 1). It requires
+// Options.RecordCommitIntervals; otherwise, or before two commits, it returns zeros.
+func (v *VSA) CommitIntervalStats() (min, avg, max time.Duration, n int) {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	iv := v.commitIv
+	if iv.n == 0 {
+		return 0, 0, 0, 0
+	}
+	return time.Duration(iv.min), time.Duration(iv.sum / int64(iv.n)), time.Duration(iv.max), iv.n
+}
+
+// RaiseScalar increases the scalar by up to by units, for replenishing a budget (e.g.
+// sliding-window refills). The increase stops once Available() reaches maxAvailable, so
+// units already admitted keep counting against the refilled budget. The scalar is never
+// lowered. It returns the resulting scalar.
+//
+// The adjustment is in-memory only; persisting the new budget is the caller's concern.
+func (v *VSA) RaiseScalar(by, maxAvailable int64) int64 {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	s := v.scalar.Load()
+	if by <= 0 {
+		return s
+	}
+	ceiling := maxAvailable + abs(v.currentVector())
+	next := s + by
+	if next > ceiling {
+		next = ceiling
+	}
+	if next > s {
+		v.scalar.Store(next)
+		return next
+	}
+	return s
+}
+
+// LowerScalar decreases the scalar by up to by units, for gradual budget reductions
+// (e.g. downgrading a tenant). The new scalar never drops below floor, nor below the
+// current |net| so Available() never goes negative: units already admitted are never
+// oversubscribed, the reduction simply waits for them to be committed or refunded.
+// The scalar is never raised. It returns the resulting scalar.
+//
+// The adjustment is in-memory only; persisting the new budget is the caller's concern.
+func (v *VSA) LowerScalar(by, floor int64) int64 {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	s := v.scalar.Load()
+	if by <= 0 {
+		return s
+	}
+	next := s - by
+	if next < floor {
+		next = floor
+	}
+	if m := abs(v.currentVector()); next < m {
+		next = m
+	}
+	if next < s {
+		v.scalar.Store(next)
+		return next
+	}
+	return s
 }
 
 // TryConsume atomically checks whether at least n units are available and, if so,
@@ -328,10 +823,16 @@ func (v *VSA) TryConsume(n int64) bool {
 	if v.fastPathGuard > 0 {
 		s := v.scalar.Load()
 		approx := v.approxNet.Load()
-		if s-abs(approx) >= n+v.fastPathGuard {
+		if s-abs(approx) >= n+v.fastPathGuard && (v.maxPending == 0 || abs(approx+n)+v.fastPathGuard <= v.maxPending) {
 			// Reserve without taking the lock; bounded risk thanks to guard.
-			idx := int(v.chooser.Add(1)) & v.mask
-			v.stripes[idx].val.Add(n)
+			v.fastHits.Add(1)
+			if up := v.upgraded.Load(); up != nil {
+				up.at(v.nextIdx(up.n - 1)).Add(n)
+				v.approxNet.Add(n)
+				return true
+			}
+			idx := v.nextIdx(v.mask)
+			v.stripes.at(idx).Add(n)
 			if v.hGroups > 0 {
 				g := idx / v.hStride
 				v.hGroupSum[g].Add(n)
@@ -341,8 +842,69 @@ func (v *VSA) TryConsume(n int64) bool {
 		}
 	}
 	// 2) Serialized path with optional cached/grouped gating and exact fallback.
+	v.lockedHits.Add(1)
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	return v.tryConsumeLocked(n)
+}
+
+// PathStats returns how many TryConsume calls (with n > 0) took the lock-free
+// FastPathGuard path and how many fell through to the serialized gate, whether or not
+// they were admitted, to help tune the guard distance. Without FastPathGuard every call
+// counts as locked. Other gated methods (TryConsumeReport, ConsumeUpTo, ...) always
+// serialize and are not counted.
+func (v *VSA) PathStats() (fast, locked int64) {
+	return v.fastHits.Load(), v.lockedHits.Load()
+}
+
+// TryConsumeReport is TryConsume that also returns the availability right after the
+// operation (after consuming on success, as seen by the check on failure), read inside
+// the same critical section, so no other gated operation can slip in between. It
+// always takes the serialized path (the lock-free FastPathGuard path has no critical
+// section); the reported value is exact. n <= 0 returns (false, Available()).
+func (v *VSA) TryConsumeReport(n int64) (ok bool, remaining int64) {
+	if n <= 0 {
+		return false, v.Available()
+	}
 	v.tryMu.Lock()
 	defer v.tryMu.Unlock()
+	ok = v.tryConsumeLocked(n)
+	return ok, nonNegative(v.scalar.Load() - abs(v.currentVector()))
+}
+
+// ConsumeUpTo consumes min(n, available) units and returns the amount granted (0 when
+// nothing is available or n <= 0), for "give me up to n" callers that prefer a partial
+// grant to a denial. The availability is read exactly under tryMu, regardless of gating
+// options, so grants never oversubscribe.
+func (v *VSA) ConsumeUpTo(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	net := v.currentVector()
+	grant := v.scalar.Load() - abs(net)
+	if n < grant {
+		grant = n
+	}
+	if v.maxPending > 0 && v.capBlocks(net, grant) {
+		// Grant only what fits under the cap.
+		if room := v.maxPending - net; room < grant {
+			grant = room
+		}
+		if grant <= 0 {
+			v.capRejects.Add(1)
+		}
+	}
+	if grant <= 0 {
+		return 0
+	}
+	v.addLocked(grant)
+	return grant
+}
+
+// tryConsumeLocked is the serialized part of TryConsume. Callers must hold tryMu.
+func (v *VSA) tryConsumeLocked(n int64) bool {
 	// Try cached gate first when enabled.
 	if v.useCachedGate {
 		avail := v.scalar.Load() - abs(v.cachedNet.Load()) - v.cacheSlack
@@ -351,17 +913,17 @@ func (v *VSA) TryConsume(n int64) bool {
 		}
 	} else if v.groupCount > 1 {
 		// Grouped scan estimate; if estimate denies, fall back to exact.
-		start := (int(v.groupRR) * v.groupStride) % len(v.stripes)
+		start := (int(v.groupRR) * v.groupStride) % v.stripes.n
 		v.groupRR++
 		var partial int64
 		end := start + v.groupStride
-		if end > len(v.stripes) {
-			end = len(v.stripes)
+		if end > v.stripes.n {
+			end = v.stripes.n
 		}
 		for i := start; i < end; i++ {
-			partial += v.stripes[i].val.Load()
+			partial += v.stripes.at(i).Load()
 		}
-		est := partial * int64(len(v.stripes)) / int64(end-start)
+		est := partial * int64(v.stripes.n) / int64(end-start)
 		netEst := est - v.committedOffset.Load()
 		avail := v.scalar.Load() - abs(netEst) - v.cacheSlack
 		if avail < n {
@@ -377,15 +939,60 @@ func (v *VSA) TryConsume(n int64) bool {
 			return false
 		}
 	}
+	if v.maxPending > 0 && v.capBlocks(v.currentVector(), n) {
+		v.capRejects.Add(1)
+		return false
+	}
 	// Reserve by updating a stripe (use round-robin under lock to avoid an atomic)
-	idx := int(v.rr) & v.mask
-	v.rr++
-	v.stripes[idx].val.Add(n)
-	if v.hGroups > 0 {
-		g := idx / v.hStride
-		v.hGroupSum[g].Add(n)
+	v.addLocked(n)
+	return true
+}
+
+// TryConsumeAll atomically consumes n[i] units from vs[i] for every i, or nothing at all:
+// it returns true only if every VSA had enough available. Entries naming the same VSA
+// are summed and checked together. All involved VSAs are locked (in address order, so
+// concurrent calls cannot deadlock) for the check and the update, so no other gated
+// operation can slip in between. The check is always exact, regardless of gating options.
+// It returns false if the slices differ in length, are empty, or any n[i] <= 0.
+func TryConsumeAll(vs []*VSA, n []int64) bool {
+	if len(vs) == 0 || len(vs) != len(n) {
+		return false
+	}
+	total := make(map[*VSA]int64, len(vs))
+	for i, v := range vs {
+		if n[i] <= 0 {
+			return false
+		}
+		total[v] += n[i]
+	}
+	order := make([]*VSA, 0, len(total))
+	for v := range total {
+		order = append(order, v)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return uintptr(unsafe.Pointer(order[i])) < uintptr(unsafe.Pointer(order[j]))
+	})
+	for _, v := range order {
+		v.tryMu.Lock()
+	}
+	defer func() {
+		for _, v := range order {
+			v.tryMu.Unlock()
+		}
+	}()
+	for _, v := range order {
+		net := v.currentVector()
+		if v.scalar.Load()-abs(net) < total[v] {
+			return false
+		}
+		if v.maxPending > 0 && v.capBlocks(net, total[v]) {
+			v.capRejects.Add(1)
+			return false
+		}
+	}
+	for _, v := range order {
+		v.addLocked(total[v])
 	}
-	v.approxNet.Add(n)
 	return true
 }
 
@@ -399,26 +1006,90 @@ func (v *VSA) TryRefund(n int64) bool {
 	}
 	v.tryMu.Lock()
 	defer v.tryMu.Unlock()
+	return v.refundLocked(n) > 0
+}
+
+// TryRefundReport is TryRefund that also reports the amount actually refunded (n
+// clamped to the positive net vector, 0 when there was nothing to refund) and the
+// availability right after, read in the same critical section. n <= 0 returns
+// (false, 0, Available()).
+func (v *VSA) TryRefundReport(n int64) (ok bool, refunded int64, remaining int64) {
+	if n <= 0 {
+		return false, 0, v.Available()
+	}
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	refunded = v.refundLocked(n)
+	return refunded > 0, refunded, nonNegative(v.scalar.Load() - abs(v.currentVector()))
+}
+
+// refundLocked is the serialized part of TryRefund: it refunds up to n units of the
+// positive net vector and returns the amount refunded. Callers must hold tryMu.
+func (v *VSA) refundLocked(n int64) int64 {
 	net := v.currentVector()
 	if net <= 0 {
-		return false
+		return 0
 	}
 	if n > net {
 		n = net // clamp: never overshoot below zero net
 	}
-	idx := int(v.rr) & v.mask
-	v.rr++
-	v.stripes[idx].val.Add(-n)
-	if v.hGroups > 0 {
-		g := idx / v.hStride
-		v.hGroupSum[g].Add(-n)
+	v.addLocked(-n)
+	return n
+}
+
+// TrySetVector forces the effective in-memory vector to target, e.g. to reconcile with
+// authoritative state read from storage or a remote replica. It applies the difference
+// from the current net to a single stripe under the gate lock, so State() then reports
+// target (plus any concurrent Updates). It returns false and changes nothing if the
+// result would make Available() negative (|target| > scalar).
+func (v *VSA) TrySetVector(target int64) bool {
+	v.tryMu.Lock()
+	defer v.tryMu.Unlock()
+	if abs(target) > v.scalar.Load() {
+		return false
+	}
+	if delta := target - v.currentVector(); delta != 0 {
+		v.addLocked(delta)
 	}
-	v.approxNet.Add(-n)
 	return true
 }
 
+// nextIdx picks the stripe for a lock-free TryConsume reservation.
+func (v *VSA) nextIdx(mask int) int {
+	if v.deterministic {
+		return 0
+	}
+	return int(v.chooser.Add(1)) & mask
+}
+
+// addLocked applies n to the next round-robin stripe of the active stripe set.
+// Callers must hold tryMu (rr is not atomic).
+func (v *VSA) addLocked(n int64) {
+	var idx int
+	if !v.deterministic {
+		idx = int(v.rr)
+		v.rr++
+	}
+	if up := v.upgraded.Load(); up != nil {
+		up.at(idx & (up.n - 1)).Add(n)
+	} else {
+		idx &= v.mask
+		v.stripes.at(idx).Add(n)
+		if v.hGroups > 0 {
+			g := idx / v.hStride
+			v.hGroupSum[g].Add(n)
+		}
+	}
+	v.approxNet.Add(n)
+}
+
 // currentVector computes the effective in-memory vector: sum(stripes) - committedOffset.
 func (v *VSA) currentVector() int64 {
+	return v.sumStripes() - v.committedOffset.Load()
+}
+
+// sumStripes returns the raw sum of all stripes, including an upgraded stripe set.
+func (v *VSA) sumStripes() int64 {
 	var sum int64
 	if v.hGroups > 0 {
 		// Use hierarchical group sums to reduce cross-core reads
@@ -426,36 +1097,46 @@ func (v *VSA) currentVector() int64 {
 			sum += v.hGroupSum[i].Load()
 		}
 	} else {
-		for i := range v.stripes {
-			sum += v.stripes[i].val.Load()
+		for i := 0; i < v.stripes.n; i++ {
+			sum += v.stripes.at(i).Load()
+		}
+	}
+	if up := v.upgraded.Load(); up != nil {
+		for i := 0; i < up.n; i++ {
+			sum += up.at(i).Load()
 		}
 	}
-	return sum - v.committedOffset.Load()
+	return sum
 }
 
 // runAggregator periodically refreshes cachedNet using the exact sum of stripes (or
 // hierarchical group sums when enabled) to minimize cross-core reads.
+//
+// It also drives the AvailabilityReporter; either ticker is off when its option is unset.
 func (v *VSA) runAggregator() {
-	t := time.NewTicker(v.cacheInterval)
-	defer t.Stop()
+	var cacheC, reportC <-chan time.Time
+	if v.useCachedGate {
+		t := time.NewTicker(v.cacheInterval)
+		defer t.Stop()
+		cacheC = t.C
+	}
+	if v.reporter != nil {
+		t := time.NewTicker(v.reportInterval)
+		defer t.Stop()
+		reportC = t.C
+	}
 	for {
 		select {
-		case now := <-t.C:
-			var sum int64
-			if v.hGroups > 0 {
-				for i := 0; i < v.hGroups; i++ {
-					sum += v.hGroupSum[i].Load()
-				}
-			} else {
-				for i := range v.stripes {
-					sum += v.stripes[i].val.Load()
-				}
-			}
-			net := sum - v.committedOffset.Load()
+		case now := <-cacheC:
+			net := v.sumStripes() - v.committedOffset.Load()
 			v.cachedNet.Store(net)
 			v.cachedAt.Store(now.UnixNano())
+		case <-reportC:
+			v.reporter(v.Available())
 		case <-v.stopCh:
 			return
+		case <-v.ctxDone:
+			return
 		}
 	}
 }
@@ -469,6 +1150,14 @@ func abs(n int64) int64 {
 	return n
 }
 
+// nonNegative clamps n at 0, for availability reports.
+func nonNegative(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
 func nextPow2(x int) int {
 	if x <= 1 {
 		return 1
@@ -500,7 +1189,8 @@ func max(a, b int) int {
 	return b
 }
 
-// Close stops the background aggregator (if running). It is safe to call multiple times.
+// Close stops the background aggregator and availability reports (if running). It is
+// safe to call multiple times.
 func (v *VSA) Close() {
 	v.closeOnce.Do(func() {
 		if v.stopCh != nil {
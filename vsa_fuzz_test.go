@@ -0,0 +1,103 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsa
+
+import (
+	"bytes"
+	"testing"
+)
+
+// snapshotFuzzOptions are the configurations a fuzzed VSA (and the VSA it is restored
+// into) is built with, so snapshots are exercised across stripe layouts.
+var snapshotFuzzOptions = []Options{
+	{},
+	{Stripes: 1},
+	{SingleStripe: true},
+	{Stripes: 16, HierarchicalGroups: 4},
+	{Stripes: 8, GroupCount: 4},
+	{DeterministicChooser: true},
+	{FastPathGuard: 8},
+}
+
+// FuzzSnapshotRoundTrip applies a random sequence of operations to a VSA, snapshots it,
+// round-trips the snapshot through its binary encoding, restores it into a fresh VSA
+// with possibly different options and checks that State and Available match.
+//
+//	go test -run '^$' -fuzz FuzzSnapshotRoundTrip .
+func FuzzSnapshotRoundTrip(f *testing.F) {
+	f.Add([]byte{}, int64(0), uint8(0), uint8(0))
+	f.Add([]byte{0, 5, 1, 3, 2, 1, 3, 2}, int64(100), uint8(1), uint8(3))
+	f.Add([]byte{0, 200, 4, 3, 3, 0, 1, 50, 2, 9}, int64(-20), uint8(2), uint8(5))
+	f.Add([]byte{1, 255, 1, 255, 4, 0, 3, 1, 0, 128}, int64(1<<40), uint8(4), uint8(6))
+	f.Fuzz(func(t *testing.T, ops []byte, scalar int64, srcOpt, dstOpt uint8) {
+		scalar %= 1 << 40 // keep sums far from overflow
+		src := NewWithOptions(scalar, snapshotFuzzOptions[int(srcOpt)%len(snapshotFuzzOptions)])
+		for i := 0; i+1 < len(ops); i += 2 {
+			n := int64(int8(ops[i+1]))
+			switch ops[i] % 6 {
+			case 0:
+				src.Update(n)
+			case 1:
+				src.TryConsume(abs(n))
+			case 2:
+				src.TryRefund(abs(n))
+			case 3:
+				_, vec := src.State()
+				src.Commit(vec * abs(n) / 128)
+			case 4:
+				src.CommitAll()
+			case 5:
+				src.Upgrade(int(abs(n)))
+			}
+		}
+
+		snap := src.Snapshot()
+		if s, vec := src.State(); snap != (Snapshot{s, vec}) {
+			t.Fatalf("Snapshot()=%+v, State()=(%d,%d)", snap, s, vec)
+		}
+		b, err := snap.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		var decoded Snapshot
+		if err := decoded.UnmarshalBinary(b); err != nil || decoded != snap {
+			t.Fatalf("round trip: got %+v (err %v), want %+v", decoded, err, snap)
+		}
+
+		dst := NewWithOptions(0, snapshotFuzzOptions[int(dstOpt)%len(snapshotFuzzOptions)])
+		dst.Restore(decoded)
+		ss, sv := src.State()
+		ds, dv := dst.State()
+		if ss != ds || sv != dv {
+			t.Fatalf("restored State()=(%d,%d), want (%d,%d)", ds, dv, ss, sv)
+		}
+		if src.Available() != dst.Available() || dst.Available() != nonNegative(ds-abs(dv)) {
+			t.Fatalf("restored Available()=%d, source %d, want max(scalar-|vector|, 0)=%d", dst.Available(), src.Available(), nonNegative(ds-abs(dv)))
+		}
+		if dst.Snapshot() != snap {
+			t.Fatalf("restored Snapshot()=%+v, want %+v", dst.Snapshot(), snap)
+		}
+
+		// Arbitrary bytes either decode to a snapshot that re-encodes identically or are rejected.
+		var any Snapshot
+		if any.UnmarshalBinary(ops) == nil {
+			if again, _ := any.MarshalBinary(); !bytes.Equal(again, ops) {
+				t.Fatalf("decoded %x to %+v, which re-encodes as %x", ops, any, again)
+			}
+		}
+	})
+}
@@ -17,6 +17,10 @@
 package vsa
 
 import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -136,3 +140,733 @@ func TestVSA_CheckCommit_NegativeVector(t *testing.T) {
 		t.Fatalf("CheckCommit(3) with vec=-5 => ok=%v vec=%d; want ok=true vec=-5", ok, vec)
 	}
 }
+
+// Single-stripe mode must behave exactly like the default for every operation, including
+// when grouped-scan or hierarchical options are requested alongside it.
+func TestVSA_SingleStripe_AllOperations(t *testing.T) {
+	variants := map[string]Options{
+		"plain":        {Stripes: 1},
+		"grouped":      {Stripes: 1, GroupCount: 4},
+		"hierarchical": {Stripes: 1, HierarchicalGroups: 4},
+		"fast-path":    {Stripes: 1, FastPathGuard: 2},
+		"cheap":        {Stripes: 1, CheapUpdateChooser: true, PerPUpdateChooser: true},
+		"lean":         {SingleStripe: true, Stripes: 32, GroupCount: 4},
+	}
+	for name, opts := range variants {
+		t.Run(name, func(t *testing.T) {
+			v := NewWithOptions(10, opts)
+			defer v.Close()
+			if v.stripes.n != 1 || v.groupCount > 1 || v.hGroups != 0 || (opts.SingleStripe && len(v.stripes.vals) != 1) {
+				t.Fatalf("stripes=%d groupCount=%d hGroups=%d; want single stripe, no groups", v.stripes.n, v.groupCount, v.hGroups)
+			}
+			v.Update(3)
+			v.Update(-1)
+			if s, vec := v.State(); s != 10 || vec != 2 {
+				t.Fatalf("State()=(%d,%d) want (10,2)", s, vec)
+			}
+			for i := 0; i < 8; i++ {
+				if !v.TryConsume(1) {
+					t.Fatalf("TryConsume(1) #%d denied", i+1)
+				}
+			}
+			if v.TryConsume(1) {
+				t.Fatalf("TryConsume beyond budget must be denied")
+			}
+			if got := v.Available(); got != 0 {
+				t.Fatalf("Available()=%d want 0", got)
+			}
+			if !v.TryRefund(3) {
+				t.Fatalf("TryRefund(3) should apply")
+			}
+			ok, vec := v.CheckCommit(5)
+			if !ok || vec != 7 {
+				t.Fatalf("CheckCommit(5)=(%v,%d) want (true,7)", ok, vec)
+			}
+			v.Commit(vec)
+			if s, vec := v.State(); s != 3 || vec != 0 {
+				t.Fatalf("after commit State()=(%d,%d) want (3,0)", s, vec)
+			}
+			if got := v.Available(); got != 3 {
+				t.Fatalf("Available() after commit=%d want 3", got)
+			}
+		})
+	}
+}
+
+// Compare heap usage of single-stripe VSAs against the default striping.
+func TestVSA_SingleStripe_MemoryVsDefault(t *testing.T) {
+	const n = 2000
+	measure := func(opts Options) uint64 {
+		keep := make([]*VSA, n)
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for i := range keep {
+			keep[i] = NewWithOptions(100, opts)
+		}
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(keep)
+		return (after.TotalAlloc - before.TotalAlloc) / n
+	}
+	single := measure(Options{Stripes: 1})
+	wide := measure(Options{Stripes: 64})
+	t.Logf("bytes/VSA: single-stripe=%d stripes=64=%d", single, wide)
+	if single*4 > wide {
+		t.Fatalf("single-stripe VSA should be far smaller: single=%dB wide=%dB", single, wide)
+	}
+}
+
+// StripePadding only changes the spacing of the counters: the layout follows the
+// resolved padding and the accounting is unaffected, including after Upgrade.
+func TestVSA_StripePadding(t *testing.T) {
+	for _, tc := range []struct{ in, want int }{{0, 128}, {64, 64}, {1, 8}, {48, 64}, {1000, 256}} {
+		if got := stripePadding(tc.in); got != tc.want {
+			t.Fatalf("stripePadding(%d)=%d want %d", tc.in, got, tc.want)
+		}
+		v := NewWithOptions(100, Options{Stripes: 8, StripePadding: tc.in})
+		if got := len(v.stripes.vals) * 8; got != 8*tc.want {
+			t.Fatalf("padding %d: %d bytes of counters want %d", tc.in, got, 8*tc.want)
+		}
+		for i := 0; i < 40; i++ {
+			v.Update(1)
+		}
+		if !v.TryConsume(50) || v.TryConsume(11) || !v.TryRefund(5) {
+			t.Fatalf("padding %d: gated ops disagree with the default", tc.in)
+		}
+		if got := v.Available(); got != 15 {
+			t.Fatalf("padding %d: Available()=%d want 15", tc.in, got)
+		}
+	}
+	v := NewWithOptions(100, Options{Stripes: 1, StripePadding: 8})
+	v.Update(3)
+	if !v.Upgrade(16) {
+		t.Fatal("Upgrade refused a single-stripe VSA")
+	}
+	v.Update(4)
+	if up := v.upgraded.Load(); len(up.vals) != 16 || v.Available() != 93 {
+		t.Fatalf("upgraded set has %d slots, Available()=%d; want 16 and 93", len(up.vals), v.Available())
+	}
+}
+
+// With DeterministicChooser every path (Update, fast and locked TryConsume, TryRefund,
+// TrySetVector, and an upgraded set) writes stripe 0 only.
+func TestVSA_DeterministicChooser_Stripe0(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"default":   {Stripes: 8, DeterministicChooser: true},
+		"fast-path": {Stripes: 8, DeterministicChooser: true, FastPathGuard: 10},
+		"cheap":     {Stripes: 8, DeterministicChooser: true, CheapUpdateChooser: true, HierarchicalGroups: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := NewWithOptions(1000, opts)
+			onlyStripe0 := func(set *stripeSet, want int64) {
+				t.Helper()
+				for i := 0; i < set.n; i++ {
+					got, exp := set.at(i).Load(), int64(0)
+					if i == 0 {
+						exp = want
+					}
+					if got != exp {
+						t.Fatalf("stripe %d = %d want %d", i, got, exp)
+					}
+				}
+			}
+			for i := 0; i < 10; i++ {
+				v.Update(2)
+				if !v.TryConsume(3) {
+					t.Fatalf("TryConsume denied at %d", i)
+				}
+			}
+			v.TryRefund(4)
+			v.TrySetVector(40)
+			onlyStripe0(&v.stripes, 40)
+		})
+	}
+	v := NewWithOptions(100, Options{Stripes: 1, DeterministicChooser: true})
+	v.Update(1)
+	v.Upgrade(8)
+	for i := 0; i < 5; i++ {
+		v.Update(1)
+		v.TryConsume(1)
+	}
+	up := v.upgraded.Load()
+	for i := 0; i < up.n; i++ {
+		if got := up.at(i).Load(); (i == 0 && got != 10) || (i > 0 && got != 0) {
+			t.Fatalf("upgraded stripe %d = %d", i, got)
+		}
+	}
+}
+
+// Upgrade widens a single-stripe VSA in place without losing updates that race with it.
+func TestVSA_Upgrade_NoLostUpdates(t *testing.T) {
+	if New(0).Upgrade(0) {
+		t.Fatalf("Upgrade must refuse a multi-stripe VSA")
+	}
+	v := NewWithOptions(1_000_000, Options{Stripes: 1, FastPathGuard: 10})
+	const workers, perWorker = 8, 5000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if i%2 == 0 {
+					v.Update(1)
+				} else if !v.TryConsume(1) {
+					t.Errorf("TryConsume denied far from the limit")
+					return
+				}
+			}
+		}()
+	}
+	if !v.Upgrade(16) {
+		t.Fatalf("first Upgrade should succeed")
+	}
+	if v.Upgrade(16) {
+		t.Fatalf("second Upgrade should be a no-op")
+	}
+	wg.Wait()
+	if got := v.StripeCount(); got != 16 {
+		t.Fatalf("StripeCount()=%d want 16", got)
+	}
+	if _, vec := v.State(); vec != workers*perWorker {
+		t.Fatalf("vector=%d want %d (updates lost across upgrade)", vec, workers*perWorker)
+	}
+	if !v.TryRefund(10) {
+		t.Fatalf("TryRefund after upgrade should apply")
+	}
+	_, vec := v.State()
+	v.Commit(vec)
+	if s, vec := v.State(); vec != 0 || s != 1_000_000-workers*perWorker+10 {
+		t.Fatalf("after commit State()=(%d,%d)", s, vec)
+	}
+}
+
+// TrySetVector reconciles the net up and down, and refuses targets beyond the scalar.
+func TestVSA_TrySetVector_Reconcile(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"default":      {},
+		"single":       {Stripes: 1},
+		"hierarchical": {HierarchicalGroups: 4},
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := NewWithOptions(100, opts)
+			defer v.Close()
+			v.Update(10)
+			if !v.TrySetVector(40) {
+				t.Fatalf("TrySetVector(40) up should apply")
+			}
+			if s, vec := v.State(); s != 100 || vec != 40 {
+				t.Fatalf("after up State()=(%d,%d) want (100,40)", s, vec)
+			}
+			if !v.TrySetVector(-15) {
+				t.Fatalf("TrySetVector(-15) down should apply")
+			}
+			if _, vec := v.State(); vec != -15 || v.Available() != 85 {
+				t.Fatalf("after down vector=%d available=%d want -15/85", vec, v.Available())
+			}
+			if v.TrySetVector(101) || v.TrySetVector(-101) {
+				t.Fatalf("targets beyond the scalar must be refused")
+			}
+			if _, vec := v.State(); vec != -15 {
+				t.Fatalf("refused TrySetVector changed vector to %d", vec)
+			}
+			// After a commit the target is still relative to the new committed state.
+			v.Commit(-15)
+			if !v.TrySetVector(5) {
+				t.Fatalf("TrySetVector(5) after commit should apply")
+			}
+			if s, vec := v.State(); s != 85 || vec != 5 {
+				t.Fatalf("after commit State()=(%d,%d) want (85,5)", s, vec)
+			}
+		})
+	}
+}
+
+// TryConsumeAll is all-or-nothing across VSAs and sums duplicate entries.
+func TestTryConsumeAll(t *testing.T) {
+	a, b := New(5), NewWithOptions(3, Options{Stripes: 1})
+	if !TryConsumeAll([]*VSA{a, b}, []int64{2, 3}) {
+		t.Fatalf("TryConsumeAll within budget should succeed")
+	}
+	if a.Available() != 3 || b.Available() != 0 {
+		t.Fatalf("available a=%d b=%d want 3,0", a.Available(), b.Available())
+	}
+	// b is exhausted: a must not be charged either.
+	if TryConsumeAll([]*VSA{a, b}, []int64{1, 1}) {
+		t.Fatalf("TryConsumeAll must fail when any VSA lacks budget")
+	}
+	if a.Available() != 3 {
+		t.Fatalf("failed TryConsumeAll charged a: available=%d", a.Available())
+	}
+	// Duplicates are summed: 2+2 > 3 fails, 2+1 fits.
+	if TryConsumeAll([]*VSA{a, a}, []int64{2, 2}) {
+		t.Fatalf("duplicate entries must be checked against their total")
+	}
+	if !TryConsumeAll([]*VSA{a, a}, []int64{2, 1}) || a.Available() != 0 {
+		t.Fatalf("duplicate entries within budget should succeed, available=%d", a.Available())
+	}
+	for _, bad := range []struct {
+		vs []*VSA
+		n  []int64
+	}{{nil, nil}, {[]*VSA{a}, []int64{1, 2}}, {[]*VSA{a}, []int64{0}}} {
+		if TryConsumeAll(bad.vs, bad.n) {
+			t.Fatalf("TryConsumeAll(%v) must be rejected", bad.n)
+		}
+	}
+
+	// Concurrent overlapping sets never oversubscribe and never deadlock.
+	x, y := New(100), New(100)
+	var wg sync.WaitGroup
+	var ok atomic.Int64
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			set := []*VSA{x, y}
+			if w%2 == 1 {
+				set = []*VSA{y, x}
+			}
+			for i := 0; i < 100; i++ {
+				if TryConsumeAll(set, []int64{1, 1}) {
+					ok.Add(1)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if ok.Load() != 100 || x.Available() != 0 || y.Available() != 0 {
+		t.Fatalf("admitted=%d x=%d y=%d want 100,0,0", ok.Load(), x.Available(), y.Available())
+	}
+}
+
+func TestVSA_TryConsumeReport(t *testing.T) {
+	const limit = 200
+	v := NewWithOptions(limit, Options{Stripes: 8, FastPathGuard: 50})
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		seen   = make(map[int64]bool)
+		denied []int64
+	)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				ok, rem := v.TryConsumeReport(1)
+				mu.Lock()
+				if ok {
+					if seen[rem] {
+						t.Errorf("remaining %d reported twice", rem)
+					}
+					seen[rem] = true
+				} else {
+					denied = append(denied, rem)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// Every success observed a distinct post-consume availability, so the reports are
+	// exactly limit-1 … 0: no concurrent reader could have seen a fresher value.
+	if len(seen) != limit {
+		t.Fatalf("successes=%d want %d", len(seen), limit)
+	}
+	for r := int64(0); r < limit; r++ {
+		if !seen[r] {
+			t.Fatalf("remaining %d never reported", r)
+		}
+	}
+	for _, r := range denied {
+		if r != 0 {
+			t.Fatalf("denial reported remaining=%d want 0", r)
+		}
+	}
+	if ok, rem := v.TryConsumeReport(0); ok || rem != 0 {
+		t.Fatalf("TryConsumeReport(0) = %v,%d want false,0", ok, rem)
+	}
+}
+
+// PathStats splits TryConsume calls between the lock-free path (far from the limit)
+// and the serialized gate (within FastPathGuard of it).
+func TestVSA_PathStats(t *testing.T) {
+	v := NewWithOptions(200, Options{Stripes: 8, FastPathGuard: 50})
+	// Far from the limit: every consume leaves more than the guard available.
+	for i := 0; i < 100; i++ {
+		v.TryConsume(1)
+	}
+	if fast, locked := v.PathStats(); fast != 100 || locked != 0 {
+		t.Fatalf("far from limit: fast=%d locked=%d want 100,0", fast, locked)
+	}
+	// Near the limit: the guard sends consumes through the gate, denied ones included.
+	for i := 0; i < 150; i++ {
+		v.TryConsume(1)
+	}
+	fast, locked := v.PathStats()
+	if fast+locked != 250 || fast < 140 || fast > 150 || locked < 100 {
+		t.Fatalf("near limit: fast=%d locked=%d want ~150 fast, ~100 locked", fast, locked)
+	}
+	if v.Available() != 0 {
+		t.Fatalf("available=%d want 0", v.Available())
+	}
+	v.TryConsume(0)
+	if f, l := v.PathStats(); f != fast || l != locked {
+		t.Fatalf("n <= 0 must not be counted")
+	}
+
+	plain := New(10)
+	plain.TryConsume(1)
+	if fast, locked := plain.PathStats(); fast != 0 || locked != 1 {
+		t.Fatalf("without guard: fast=%d locked=%d want 0,1", fast, locked)
+	}
+}
+
+// TryRefundReport clamps to the net vector and reports the amount actually refunded.
+func TestVSA_TryRefundReport(t *testing.T) {
+	v := New(10)
+	for i := 0; i < 3; i++ {
+		if !v.TryConsume(1) {
+			t.Fatalf("consume %d denied", i)
+		}
+	}
+	if ok, refunded, rem := v.TryRefundReport(1); !ok || refunded != 1 || rem != 8 {
+		t.Fatalf("TryRefundReport(1) = %v,%d,%d want true,1,8", ok, refunded, rem)
+	}
+	// Only 2 units are outstanding: the refund of 5 is clamped to 2.
+	if ok, refunded, rem := v.TryRefundReport(5); !ok || refunded != 2 || rem != 10 {
+		t.Fatalf("TryRefundReport(5) = %v,%d,%d want true,2,10", ok, refunded, rem)
+	}
+	if ok, refunded, rem := v.TryRefundReport(1); ok || refunded != 0 || rem != 10 {
+		t.Fatalf("TryRefundReport on zero net = %v,%d,%d want false,0,10", ok, refunded, rem)
+	}
+	if ok, refunded, rem := v.TryRefundReport(0); ok || refunded != 0 || rem != 10 {
+		t.Fatalf("TryRefundReport(0) = %v,%d,%d want false,0,10", ok, refunded, rem)
+	}
+}
+
+func TestVSA_Clone(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"default": {},
+		"grouped": {Stripes: 16, GroupCount: 4, HierarchicalGroups: 4},
+		"cached":  {UseCachedGate: true, CacheInterval: time.Millisecond},
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := NewWithOptions(100, opts)
+			defer v.Close()
+			for i := 0; i < 30; i++ {
+				v.Update(1)
+			}
+			v.Commit(10)
+
+			c := v.Clone()
+			defer c.Close()
+			if cs, cv := c.State(); cs != 90 || cv != 20 {
+				t.Fatalf("clone state=(%d,%d) want (90,20)", cs, cv)
+			}
+			if c.StripeCount() != v.StripeCount() {
+				t.Fatalf("clone stripes=%d want %d", c.StripeCount(), v.StripeCount())
+			}
+			if c.Available() != 70 {
+				t.Fatalf("clone avail=%d want 70", c.Available())
+			}
+			c.Update(50)
+			c.Commit(c.Available())
+			if s, vec := v.State(); s != 90 || vec != 20 || v.Available() != 70 {
+				t.Fatalf("original changed: state=(%d,%d) avail=%d", s, vec, v.Available())
+			}
+		})
+	}
+
+	// An upgraded single-stripe VSA clones into an upgraded copy.
+	v := NewWithOptions(10, Options{Stripes: 1})
+	v.Update(3)
+	v.Upgrade(8)
+	c := v.Clone()
+	if c.StripeCount() != 8 || c.Available() != 7 {
+		t.Fatalf("clone stripes=%d avail=%d want 8,7", c.StripeCount(), c.Available())
+	}
+}
+
+func TestVSA_ConsumeUpTo(t *testing.T) {
+	v := New(10)
+	if got := v.ConsumeUpTo(7); got != 7 {
+		t.Fatalf("ConsumeUpTo(7)=%d want 7", got)
+	}
+	if got := v.ConsumeUpTo(5); got != 3 {
+		t.Fatalf("ConsumeUpTo(5) near exhaustion=%d want the remaining 3", got)
+	}
+	if got := v.ConsumeUpTo(1); got != 0 || v.Available() != 0 {
+		t.Fatalf("ConsumeUpTo on an exhausted VSA=%d avail=%d want 0,0", got, v.Available())
+	}
+	if got := v.ConsumeUpTo(0); got != 0 {
+		t.Fatalf("ConsumeUpTo(0)=%d want 0", got)
+	}
+
+	// Concurrent partial grants add up to exactly the limit.
+	v = NewWithOptions(1000, Options{Stripes: 8})
+	var wg sync.WaitGroup
+	var granted atomic.Int64
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				granted.Add(v.ConsumeUpTo(3))
+			}
+		}()
+	}
+	wg.Wait()
+	if granted.Load() != 1000 || v.Available() != 0 {
+		t.Fatalf("granted=%d avail=%d want 1000,0", granted.Load(), v.Available())
+	}
+}
+
+func TestVSA_AvailabilityReporter(t *testing.T) {
+	reports := make(chan int64, 64)
+	var n atomic.Int64
+	v := NewWithOptions(10, Options{
+		ReportInterval: 2 * time.Millisecond,
+		AvailabilityReporter: func(avail int64) {
+			n.Add(1)
+			select {
+			case reports <- avail:
+			default:
+			}
+		},
+	})
+	v.Update(4)
+	deadline := time.After(2 * time.Second)
+	for got := int64(-1); got != 6; {
+		select {
+		case got = <-reports:
+		case <-deadline:
+			t.Fatalf("no report of the current availability (6), last=%d", got)
+		}
+	}
+
+	v.Close()
+	time.Sleep(10 * time.Millisecond) // let a report racing with Close finish
+	after := n.Load()
+	time.Sleep(20 * time.Millisecond)
+	if n.Load() != after {
+		t.Fatalf("reports continued after Close: %d -> %d", after, n.Load())
+	}
+}
+
+func TestVSA_CommitIntervalStats(t *testing.T) {
+	v := NewWithOptions(1000, Options{RecordCommitIntervals: true})
+	if _, _, _, n := v.CommitIntervalStats(); n != 0 {
+		t.Fatalf("n=%d before any commit", n)
+	}
+	gaps := []time.Duration{10 * time.Millisecond, 30 * time.Millisecond}
+	v.Update(3)
+	v.Commit(3)
+	for _, gap := range gaps {
+		time.Sleep(gap)
+		v.Commit(5) // no-op: nothing to commit, so not counted
+		v.Update(3)
+		v.Commit(3)
+	}
+	lo, avg, hi, n := v.CommitIntervalStats()
+	if n != 2 {
+		t.Fatalf("n=%d want 2", n)
+	}
+	if lo < gaps[0] || hi < gaps[1] || lo > hi || avg < lo || avg > hi {
+		t.Fatalf("min=%v avg=%v max=%v, want min>=%v max>=%v and min<=avg<=max", lo, avg, hi, gaps[0], gaps[1])
+	}
+
+	// Off by default.
+	w := New(10)
+	w.Update(1)
+	w.Commit(1)
+	w.Update(1)
+	w.Commit(1)
+	if _, _, _, n := w.CommitIntervalStats(); n != 0 {
+		t.Fatalf("stats recorded without RecordCommitIntervals: n=%d", n)
+	}
+}
+
+func TestVSA_CommitAll(t *testing.T) {
+	for _, net := range []int64{7, -4} {
+		v := NewWithOptions(100, Options{Stripes: 8})
+		for i := int64(0); i < abs(net); i++ {
+			if net > 0 {
+				v.Update(1)
+			} else {
+				v.Update(-1)
+			}
+		}
+		availBefore := v.Available()
+		if got := v.CommitAll(); got != net {
+			t.Fatalf("CommitAll()=%d want the prior net %d", got, net)
+		}
+		if s, vec := v.State(); vec != 0 || s != 100-abs(net) {
+			t.Fatalf("after CommitAll state=(%d,%d) want (%d,0)", s, vec, 100-abs(net))
+		}
+		if v.Available() != availBefore {
+			t.Fatalf("CommitAll changed availability: %d -> %d", availBefore, v.Available())
+		}
+		if got := v.CommitAll(); got != 0 {
+			t.Fatalf("second CommitAll()=%d want 0", got)
+		}
+	}
+}
+
+func TestVSA_MaxPendingVector(t *testing.T) {
+	for _, opts := range []Options{
+		{MaxPendingVector: 10},
+		{MaxPendingVector: 10, FastPathGuard: 2},
+		{MaxPendingVector: 10, UseCachedGate: true},
+	} {
+		v := NewWithOptions(1000, opts)
+		for i := 0; i < 10; i++ {
+			v.Update(1)
+		}
+		if v.TryUpdate(1) {
+			t.Fatalf("%+v: TryUpdate past the cap succeeded", opts)
+		}
+		v.Update(5) // dropped and counted
+		if v.TryConsume(1) {
+			t.Fatalf("%+v: TryConsume past the cap succeeded", opts)
+		}
+		if got := v.ConsumeUpTo(3); got != 0 {
+			t.Fatalf("%+v: ConsumeUpTo at the cap granted %d", opts, got)
+		}
+		if TryConsumeAll([]*VSA{v}, []int64{1}) {
+			t.Fatalf("%+v: TryConsumeAll past the cap succeeded", opts)
+		}
+		if _, vec := v.State(); vec != 10 {
+			t.Fatalf("%+v: vector %d, want it held at the cap of 10", opts, vec)
+		}
+		if got := v.CapRejections(); got != 5 {
+			t.Fatalf("%+v: CapRejections()=%d want 5", opts, got)
+		}
+
+		// Moving toward zero always passes, and a commit frees room again.
+		if !v.TryUpdate(-4) || v.ConsumeUpTo(10) != 4 {
+			t.Fatalf("%+v: expected the refund and a partial grant up to the cap", opts)
+		}
+		v.Commit(10)
+		if !v.TryConsume(5) {
+			t.Fatalf("%+v: TryConsume after commit should fit under the cap", opts)
+		}
+		v.Close()
+	}
+}
+
+// TestVSA_MaxPendingVector_Concurrent checks that concurrent TryUpdates cannot jointly
+// overshoot MaxPendingVector: exactly the cap is applied and every other change is
+// rejected and counted once.
+func TestVSA_MaxPendingVector_Concurrent(t *testing.T) {
+	const capN, workers, perWorker = 100, 8, 50
+	v := NewWithOptions(1000, Options{MaxPendingVector: capN})
+	defer v.Close()
+	var applied atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if v.TryUpdate(1) {
+					applied.Add(1)
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	wg.Wait()
+	if got := applied.Load(); got != capN {
+		t.Fatalf("applied %d updates, want exactly the cap %d", got, capN)
+	}
+	if _, vec := v.State(); vec != capN {
+		t.Fatalf("vector %d, want %d", vec, capN)
+	}
+	if got := v.CapRejections(); got != workers*perWorker-capN {
+		t.Fatalf("CapRejections()=%d want %d", got, workers*perWorker-capN)
+	}
+}
+
+// TestVSA_StrictGate checks that StrictGate overrides every gating approximation:
+// requests the exact availability covers are admitted despite cache slack, group slack
+// and a stale cache, and concurrent consumers admit exactly the scalar with no
+// oversubscription through the fast path.
+func TestVSA_StrictGate(t *testing.T) {
+	approx := Options{
+		UseCachedGate: true, CacheInterval: time.Hour, CacheSlack: 5,
+		GroupCount: 4, GroupSlack: 50,
+		FastPathGuard: 1,
+	}
+
+	loose := NewWithOptions(10, approx)
+	defer loose.Close()
+	loose.Update(3)
+	if loose.TryConsume(7) {
+		t.Fatalf("sanity: without StrictGate the cache slack should deny TryConsume(7)")
+	}
+
+	strictOpts := approx
+	strictOpts.StrictGate = true
+	v := NewWithOptions(10, strictOpts)
+	defer v.Close()
+	v.Update(3) // the cache (refreshed hourly) never sees this
+	if !v.TryConsume(7) {
+		t.Fatalf("StrictGate denied TryConsume(7) with exactly 7 available")
+	}
+	if v.TryConsume(1) {
+		t.Fatalf("StrictGate admitted TryConsume(1) with nothing available")
+	}
+
+	const budget = 5000
+	c := NewWithOptions(budget, strictOpts)
+	defer c.Close()
+	var admitted atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 2*runtime.GOMAXPROCS(0); g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.TryConsume(1) {
+				admitted.Add(1)
+			}
+			// A denial under StrictGate means the exact availability was exhausted.
+			if a := c.Available(); a != 0 {
+				t.Errorf("denied with Available()=%d", a)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := admitted.Load(); got != budget {
+		t.Fatalf("admitted %d units, want exactly %d", got, budget)
+	}
+}
+
+func TestVSA_NewWithContext_CancelStopsAggregator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var n atomic.Int64
+	v := NewWithContext(ctx, 10, Options{
+		UseCachedGate:        true,
+		CacheInterval:        50 * time.Microsecond,
+		ReportInterval:       time.Millisecond,
+		AvailabilityReporter: func(int64) { n.Add(1) },
+	})
+	deadline := time.Now().Add(2 * time.Second)
+	for n.Load() == 0 || v.cachedAt.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("aggregator did not start: reports=%d cachedAt=%d", n.Load(), v.cachedAt.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	time.Sleep(10 * time.Millisecond) // let a tick racing with cancel finish
+	reports, refreshed := n.Load(), v.cachedAt.Load()
+	time.Sleep(20 * time.Millisecond)
+	if n.Load() != reports || v.cachedAt.Load() != refreshed {
+		t.Fatalf("aggregator still running after cancel: reports %d -> %d, cachedAt %d -> %d",
+			reports, n.Load(), refreshed, v.cachedAt.Load())
+	}
+	v.Close() // still safe after the context stopped the aggregator
+	v.Close()
+}
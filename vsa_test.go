@@ -175,6 +175,147 @@ func TestVSA_Concurrent(t *testing.T) {
 	}
 }
 
+// TestVSA_ApproxVector checks that the scan-free ApproxVector matches the exact vector
+// once concurrent updates, consumes, refunds and commits have quiesced, including
+// after an in-place stripe upgrade.
+func TestVSA_ApproxVector(t *testing.T) {
+	t.Parallel()
+
+	v := NewWithOptions(1_000_000, Options{FastPathGuard: 100})
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				switch j % 4 {
+				case 0:
+					v.Update(2)
+				case 1:
+					v.TryConsume(3)
+				case 2:
+					v.TryRefund(1)
+				default:
+					if i == 0 && j%100 == 3 {
+						if _, vec := v.State(); vec > 0 {
+							v.Commit(vec / 2)
+						}
+					}
+				}
+				_ = v.ApproxVector() // concurrent reads must be safe
+			}
+		}(i)
+		if i == 8 {
+			v.Upgrade(16)
+		}
+	}
+	wg.Wait()
+
+	_, exact := v.State()
+	if got := v.ApproxVector(); got != exact {
+		t.Fatalf("ApproxVector() = %d after quiescence, want exact vector %d", got, exact)
+	}
+	v.CommitAll()
+	if got := v.ApproxVector(); got != 0 {
+		t.Fatalf("ApproxVector() = %d after CommitAll, want 0", got)
+	}
+}
+
+// TestVSA_NewFromState checks that a VSA seeded with a net vector reports it at once,
+// with availability scalar - |vector| and no committed offset, for any stripe layout.
+func TestVSA_NewFromState(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		scalar, vector int64
+		opts           Options
+	}{
+		{"positive", 100, 30, Options{}},
+		{"negative", 100, -40, Options{}},
+		{"zero", 100, 0, Options{}},
+		{"single_stripe", 50, 20, Options{Stripes: 1}},
+		{"hierarchical", 100, 25, Options{Stripes: 8, HierarchicalGroups: 4}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewFromState(tc.scalar, tc.vector, tc.opts)
+			defer v.Close()
+			if s, vec := v.State(); s != tc.scalar || vec != tc.vector {
+				t.Fatalf("State() = (%d, %d), want (%d, %d)", s, vec, tc.scalar, tc.vector)
+			}
+			if got, want := v.Available(), tc.scalar-abs(tc.vector); got != want {
+				t.Fatalf("Available() = %d, want scalar-|vector| = %d", got, want)
+			}
+			if off := v.committedOffset.Load(); off != 0 {
+				t.Fatalf("committedOffset = %d, want 0", off)
+			}
+			if got := v.ApproxVector(); got != tc.vector {
+				t.Fatalf("ApproxVector() = %d, want %d", got, tc.vector)
+			}
+		})
+	}
+}
+
+// TestVSA_Healthy forces the scalar negative by committing ungated updates beyond the
+// budget twice, and checks that Healthy flags it while Available stays at zero and
+// consumes are denied.
+func TestVSA_Healthy(t *testing.T) {
+	v := New(10)
+	if !v.Healthy() {
+		t.Fatalf("fresh VSA reported unhealthy")
+	}
+	for i := 0; i < 2; i++ {
+		v.Update(15)
+		v.Commit(15)
+	}
+	if s, _ := v.State(); s != -20 {
+		t.Fatalf("scalar = %d, want -20 after over-committing", s)
+	}
+	if v.Healthy() {
+		t.Fatalf("Healthy() = true with a negative scalar")
+	}
+	if got := v.Available(); got != 0 {
+		t.Fatalf("Available() = %d, want clamped to 0", got)
+	}
+	if ok, remaining := v.TryConsumeReport(1); ok || remaining != 0 {
+		t.Fatalf("TryConsumeReport(1) = (%v, %d), want (false, 0)", ok, remaining)
+	}
+}
+
+// TestVSA_DebugStripes checks that the per-stripe dump accounts for the whole vector:
+// its sum minus the committed offset equals State's vector, before and after a commit
+// and an in-place upgrade.
+func TestVSA_DebugStripes(t *testing.T) {
+	v := NewWithOptions(1000, Options{Stripes: 1})
+	check := func(stage string, wantLen int) {
+		t.Helper()
+		dump := v.DebugStripes()
+		if len(dump) != wantLen {
+			t.Fatalf("%s: len(DebugStripes()) = %d, want %d", stage, len(dump), wantLen)
+		}
+		var sum int64
+		for _, s := range dump {
+			sum += s
+		}
+		if _, vec := v.State(); sum-v.committedOffset.Load() != vec {
+			t.Fatalf("%s: sum(stripes)-committedOffset = %d, want vector %d", stage, sum-v.committedOffset.Load(), vec)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		v.Update(3)
+	}
+	check("single stripe", 1)
+	v.Commit(20)
+	check("after commit", 1)
+	v.Upgrade(8)
+	for i := 0; i < 16; i++ {
+		v.Update(1)
+	}
+	check("upgraded", 9)
+	if dump := v.DebugStripes(); dump[0] != 30 {
+		t.Fatalf("base stripe = %d, want 30 (committed amounts are not swept)", dump[0])
+	}
+}
+
 // TestVSA_TryRefund_Scenarios exercises end-to-end consume (TryConsume) and undo/refund (TryRefund)
 // flows at the data-structure level. It verifies that:
 //   - NoPendingRefundFails: When there is nothing to refund (net vector <= 0), TryRefund returns false and state remains unchanged.
@@ -359,7 +500,7 @@ func quickConfig() *quick.Config {
 
 // TestVSA_Property_Interleavings exercises randomized single-threaded interleavings of
 // Update, TryConsume, TryRefund, and Commit. It checks core invariants after each step:
-//   - Availability formula: Available == S - |V|
+//   - Availability formula: Available == max(S - |V|, 0)
 //   - Commit invariance when committing the current effective vector
 //   - Consume reduces Available by n when it succeeds and never when it fails
 func TestVSA_Property_Interleavings(t *testing.T) {
@@ -416,9 +557,9 @@ func TestVSA_Property_Interleavings(t *testing.T) {
 					}
 				}
 			}
-			// Generic invariant: Available == S - |V|
+			// Generic invariant: Available == max(S - |V|, 0)
 			S, V, A := get()
-			if A != S-int64Abs(V) {
+			if A != nonNegative(S-int64Abs(V)) {
 				// include some context from the step
 				t.Logf("availability formula failed at step %d: S=%d V=%d A=%d", i, S, V, A)
 				return false
@@ -584,3 +725,62 @@ func TestVSA_Close_NoAggregator(t *testing.T) {
 		t.Fatalf("state changed after Close() with no aggregator: before=(%d,%d) after=(%d,%d)", s0, vec0, s1, vec1)
 	}
 }
+
+// LowerScalar reduces the scalar by at most the step, never below the floor, never raises
+// it, and never below |net| so availability cannot go negative.
+func TestVSA_LowerScalar(t *testing.T) {
+	v := New(100)
+	if got := v.LowerScalar(30, 50); got != 70 {
+		t.Fatalf("LowerScalar(30,50)=%d want 70", got)
+	}
+	if got := v.LowerScalar(30, 50); got != 50 {
+		t.Fatalf("LowerScalar clamps to floor: got %d want 50", got)
+	}
+	if got := v.LowerScalar(10, 80); got != 50 {
+		t.Fatalf("LowerScalar must never raise the scalar: got %d want 50", got)
+	}
+	if got := v.LowerScalar(0, 0); got != 50 {
+		t.Fatalf("LowerScalar(0,…) must be a no-op: got %d", got)
+	}
+
+	// With 40 units admitted, the scalar cannot drop below 40.
+	for i := 0; i < 40; i++ {
+		v.TryConsume(1)
+	}
+	if got := v.LowerScalar(30, 0); got != 40 {
+		t.Fatalf("LowerScalar must keep scalar >= |net|: got %d want 40", got)
+	}
+	if got := v.Available(); got != 0 {
+		t.Fatalf("Available()=%d want 0", got)
+	}
+	v.TryRefund(15)
+	if got := v.LowerScalar(30, 0); got != 25 {
+		t.Fatalf("after refund LowerScalar=%d want 25", got)
+	}
+}
+
+// RaiseScalar replenishes up to maxAvailable, counting admitted units, and never lowers.
+func TestVSA_RaiseScalar(t *testing.T) {
+	v := New(10)
+	for i := 0; i < 10; i++ {
+		v.TryConsume(1)
+	}
+	if got := v.RaiseScalar(4, 10); got != 14 {
+		t.Fatalf("RaiseScalar(4,10)=%d want 14", got)
+	}
+	if got := v.Available(); got != 4 {
+		t.Fatalf("Available()=%d want 4", got)
+	}
+	if got := v.RaiseScalar(100, 10); got != 20 {
+		t.Fatalf("RaiseScalar must cap availability at maxAvailable: scalar=%d want 20", got)
+	}
+	if got := v.RaiseScalar(5, 3); got != 20 {
+		t.Fatalf("RaiseScalar must never lower the scalar: got %d want 20", got)
+	}
+	// Committing the admitted units leaves availability (and the cap) unchanged.
+	_, vec := v.State()
+	v.Commit(vec)
+	if s, vec := v.State(); s != 10 || vec != 0 || v.Available() != 10 {
+		t.Fatalf("after commit State()=(%d,%d) Available()=%d", s, vec, v.Available())
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsa
+
+import "sync"
+
+// Dims constrains the vector type of a VSAN to a fixed-size array of 1 to 8
+// dimensions, e.g. [3]int64 for (requests, bytes, connections).
+type Dims interface {
+	~[1]int64 | ~[2]int64 | ~[3]int64 | ~[4]int64 | ~[5]int64 | ~[6]int64 | ~[7]int64 | ~[8]int64
+}
+
+// VSAN is a Vector-Scalar Accumulator over a fixed D-dimensional vector, for composite
+// limits that track several correlated dimensions per key (requests, bytes,
+// connections, ...). Each dimension is a striped VSA, so Update stays lock-free; the
+// gate (TryConsume) admits only when every dimension has budget and applies all
+// dimensions together, so no dimension is ever consumed for a rejected request.
+type VSAN[V Dims] struct {
+	dims []*VSA
+	// mu serializes TryConsume and Commit so the all-dimensions check and the
+	// subsequent per-dimension updates are observed as one step.
+	mu sync.Mutex
+}
+
+// NewVSAN creates a VSAN with one initial scalar per dimension.
+func NewVSAN[V Dims](scalars V) *VSAN[V] {
+	v := &VSAN[V]{dims: make([]*VSA, len(scalars))}
+	for i := range v.dims {
+		v.dims[i] = New(scalars[i])
+	}
+	return v
+}
+
+// Update applies a change to every dimension of the volatile vector.
+func (v *VSAN[V]) Update(delta V) {
+	for i, d := range v.dims {
+		if delta[i] != 0 {
+			d.Update(delta[i])
+		}
+	}
+}
+
+// Available returns the per-dimension available budget: S[i] - |A_net[i]|.
+func (v *VSAN[V]) Available() V {
+	var out V
+	for i, d := range v.dims {
+		out[i] = d.Available()
+	}
+	return out
+}
+
+// State returns the per-dimension scalars and effective vectors.
+func (v *VSAN[V]) State() (scalars, vector V) {
+	for i, d := range v.dims {
+		scalars[i], vector[i] = d.State()
+	}
+	return scalars, vector
+}
+
+// TryConsume atomically checks that every dimension has at least n[i] units available
+// and, if so, consumes them all. Components must be non-negative and at least one
+// positive; a zero component is not checked (the request does not use that
+// dimension).
+func (v *VSAN[V]) TryConsume(n V) bool {
+	used := false
+	for i := range v.dims {
+		if n[i] < 0 {
+			return false
+		}
+		used = used || n[i] > 0
+	}
+	if !used {
+		return false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i, d := range v.dims {
+		if n[i] > 0 && d.Available() < n[i] {
+			return false
+		}
+	}
+	for i, d := range v.dims {
+		if n[i] > 0 {
+			d.Update(n[i])
+		}
+	}
+	return true
+}
+
+// CheckCommit reports whether any dimension's |vector| has reached threshold, and
+// returns the full vector so all dimensions can be persisted in one write.
+func (v *VSAN[V]) CheckCommit(threshold int64) (bool, V) {
+	_, vec := v.State()
+	for i := range v.dims {
+		if abs(vec[i]) >= threshold {
+			return true, vec
+		}
+	}
+	return false, vec
+}
+
+// Commit applies a persisted vector to every dimension, with the same per-dimension
+// semantics as VSA.Commit (S[i] -= |committed[i]|, vector reduced accordingly).
+func (v *VSAN[V]) Commit(committed V) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i, d := range v.dims {
+		d.Commit(committed[i])
+	}
+}
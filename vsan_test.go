@@ -0,0 +1,94 @@
+// Copyright 2025 Esteban Alvarez. All Rights Reserved.
+//
+// Created: October 2025
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsa
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Admit until any dimension is exhausted; a rejected request consumes nothing.
+func TestVSAN_AdmitsUntilAnyDimensionExhausted(t *testing.T) {
+	// (requests, bytes, connections)
+	v := NewVSAN([3]int64{10, 1000, 3})
+	req := [3]int64{1, 300, 1}
+	for i := 0; i < 3; i++ {
+		if !v.TryConsume(req) {
+			t.Fatalf("TryConsume #%d denied with budget left: available=%v", i+1, v.Available())
+		}
+	}
+	if got, want := v.Available(), [3]int64{7, 100, 0}; got != want {
+		t.Fatalf("Available()=%v want %v", got, want)
+	}
+	// Bytes and connections are both exhausted for req; nothing may be consumed.
+	if v.TryConsume(req) {
+		t.Fatalf("TryConsume must be denied once a dimension is exhausted")
+	}
+	if got, want := v.Available(), [3]int64{7, 100, 0}; got != want {
+		t.Fatalf("denied TryConsume changed Available(): %v want %v", got, want)
+	}
+	// A request that does not use the exhausted dimension is still admitted.
+	if !v.TryConsume([3]int64{1, 100, 0}) {
+		t.Fatalf("TryConsume without connections should be admitted")
+	}
+	for _, bad := range [][3]int64{{0, 0, 0}, {1, -1, 0}} {
+		if v.TryConsume(bad) {
+			t.Fatalf("TryConsume(%v) must be rejected", bad)
+		}
+	}
+
+	// Releasing a connection re-opens that dimension; commits keep Available unchanged.
+	v.Update([3]int64{0, 0, -1})
+	before := v.Available()
+	ok, vec := v.CheckCommit(4)
+	if !ok || vec != [3]int64{4, 1000, 2} {
+		t.Fatalf("CheckCommit(4)=(%v,%v) want (true,[4 1000 2])", ok, vec)
+	}
+	v.Commit(vec)
+	if after := v.Available(); after != before {
+		t.Fatalf("commit changed Available(): before=%v after=%v", before, after)
+	}
+	if s, vec := v.State(); s != [3]int64{6, 0, 1} || vec != [3]int64{} {
+		t.Fatalf("State()=(%v,%v) want ([6 0 1],[0 0 0])", s, vec)
+	}
+}
+
+// Concurrent consumers never oversubscribe the scarcest dimension.
+func TestVSAN_ConcurrentNoOversubscription(t *testing.T) {
+	v := NewVSAN([2]int64{1000, 50})
+	var admitted atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if v.TryConsume([2]int64{1, 1}) {
+					admitted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := admitted.Load(); got != 50 {
+		t.Fatalf("admitted=%d want 50", got)
+	}
+	if got, want := v.Available(), [2]int64{950, 0}; got != want {
+		t.Fatalf("Available()=%v want %v", got, want)
+	}
+}